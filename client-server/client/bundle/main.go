@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+// this client has no cached schema, so instead of fetching /get-schema/ and then
+// /get-data/ it gets both at once from /get-bundle/ (or, with -framed, from
+// /get-framed/, which also detects a response cut short)
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the (v2) server")
+	framed := flag.Bool("framed", false, "use /get-framed/ instead of /get-bundle/")
+	flag.Parse()
+
+	fetch := schemerclient.FetchBundle
+	if *framed {
+		fetch = schemerclient.FetchFramed
+	}
+
+	var dest schemas.V2Reading
+	if _, err := fetch(context.Background(), *baseURL, &dest); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("sequence: %d\n", dest.Sequence)
+	fmt.Printf("header: %q\n", dest.Header)
+	fmt.Printf("readings: %v\n", dest.FilteredReadings)
+}
@@ -0,0 +1,92 @@
+// this client keeps the server's schema in a file between runs
+// (schemerclient.WithSchemaFile), for clients that restart often: the first run
+// fetches the schema and saves it, every later run loads it from disk and goes
+// straight to /get-data/. If the server has been upgraded since, the data stops
+// decoding with the saved schema; the client then fetches the new one, saves
+// that, and decodes again. -refresh checks with the server up front instead.
+//
+//	go run ./client-server/client/cached                 # fetches and saves schema.bin
+//	go run ./client-server/client/cached                 # no /get-schema/ request
+//	go run ./client-server/client/cached -refresh        # asks the server anyway
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/signing"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	schemaFile := flag.String("schema-file", "schema.bin", "file the schema is kept in between runs")
+	refresh := flag.Bool("refresh", false, "fetch the schema even if the file has one, and save it if it changed")
+	polls := flag.Int("polls", 1, "number of times to fetch data")
+	interval := flag.Duration("interval", time.Second, "time to wait between polls")
+	insecure := flag.Bool("insecure", false, "accept any TLS certificate, e.g. a server's self-signed one (unsafe)")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	opts := []schemerclient.Option{
+		schemerclient.WithSchemaFile(*schemaFile),
+		schemerclient.WithRetries(3, 250*time.Millisecond),
+	}
+	if key := signing.KeyFromEnv(); key != nil {
+		opts = append(opts, schemerclient.WithSigningKey(key))
+	}
+	if *insecure {
+		log.Println("WARNING: -insecure is set, TLS certificates are NOT verified; only use this against a local demo server")
+		opts = append(opts, schemerclient.WithInsecureSkipVerify())
+	}
+
+	start := time.Now()
+	client, err := schemerclient.New(*baseURL, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if schemaRequests, _ := client.Requests(); schemaRequests == 0 {
+		log.Printf("schema %.12s loaded from %s in %v", client.SchemaHash(), *schemaFile, time.Since(start))
+	} else {
+		log.Printf("schema %.12s fetched and saved to %s in %v", client.SchemaHash(), *schemaFile, time.Since(start))
+	}
+
+	if *refresh {
+		before := client.SchemaHash()
+		if err := client.RefreshSchema(ctx); err != nil {
+			log.Fatal(err)
+		}
+		if h := client.SchemaHash(); h != before {
+			log.Printf("the saved schema was stale, now using %.12s", h)
+		}
+	}
+
+	var dest schemas.V2Reading
+	for i := 0; i < *polls; i++ {
+		if i > 0 {
+			time.Sleep(*interval)
+		}
+
+		before := client.SchemaHash()
+		schemerclient.ResetForReuse(&dest)
+		if err := client.Fetch(ctx, &dest); err != nil {
+			log.Fatal(err)
+		}
+		// Fetch refetches (and saves) the schema if the data doesn't decode with it
+		if h := client.SchemaHash(); h != before {
+			log.Printf("the data didn't decode with schema %.12s, refetched %.12s and saved it", before, h)
+		}
+
+		fmt.Printf("sequence: %d\n", dest.Sequence)
+		fmt.Printf("header: %q\n", dest.Header)
+		fmt.Printf("readings: %v\n", dest.FilteredReadings)
+	}
+
+	schemaRequests, dataRequests := client.Requests()
+	log.Printf("made %d requests: %d for the schema, %d for data", schemaRequests+dataRequests, schemaRequests, dataRequests)
+}
@@ -0,0 +1,243 @@
+// csvsink archives a server's readings to CSV files, for spreadsheets and
+// anything else that can't read schemer's binary format. Every sample becomes a
+// row per index of its readings:
+//
+//	timestamp,sequence,index,raw,filtered
+//	2021-06-29T20:26:40.000Z,7,0,20.25,10.125
+//	2021-06-29T20:26:40.000Z,7,1,-3.5,3.3125
+//
+// It polls /get-data/ (against the v1, v2 or v3 server), or with -stream follows
+// the websocket server's /ws; either way it keeps going, retrying, while the
+// server is down. The files rotate every UTC day and at -max-size, and are
+// synced to disk every -sync, so a crash loses at most that much. A sample
+// that was already written (the same sample polled twice, or the last one in the
+// files from before a restart of csvsink) is skipped.
+//
+//	go run ./client-server/client/csvsink -url http://localhost:8080 -dir archive
+//	go run ./client-server/client/csvsink -url http://localhost:8080 -stream
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/heartbeat"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+
+	// for a websocket server that doesn't announce a heartbeat interval
+	readTimeout = 10 * time.Second
+)
+
+// poller fetches samples from a server, connecting on the first fetch
+type poller struct {
+	baseURL string
+	client  *schemerclient.Client
+}
+
+// fetch returns the server's current sample. Fetch fetches the schema again if
+// the data doesn't decode with the one it has, which is what a server that came
+// back upgraded needs.
+func (p *poller) fetch(ctx context.Context) (*schemas.V2Reading, error) {
+	if p.client == nil {
+		client, err := schemerclient.New(p.baseURL, schemerclient.WithRetries(1, 250*time.Millisecond))
+		if err != nil {
+			return nil, err
+		}
+		p.client = client
+	}
+	var sample schemas.V2Reading
+	if err := p.client.Fetch(ctx, &sample); err != nil {
+		return nil, err
+	}
+	return &sample, nil
+}
+
+// poll sends the server's current sample to samples every interval, until ctx is
+// done
+func poll(ctx context.Context, baseURL string, interval time.Duration, samples chan<- *schemas.V2Reading) {
+	p := &poller{baseURL: baseURL}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if sample, err := p.fetch(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("%v (retrying)", err)
+		} else {
+			select {
+			case samples <- sample:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// session reads one connection to the websocket server at wsURL: the schema,
+// then a sample per frame, sent to samples, until the connection fails or ctx is
+// done
+func session(ctx context.Context, wsURL string, samples chan<- *schemas.V2Reading) error {
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// stop reading as soon as ctx is done, rather than at the next frame
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-sessionDone:
+		}
+	}()
+
+	timeout := readTimeout
+	if interval, ok := heartbeat.ParseInterval(resp.Header.Get(heartbeat.Header)); ok {
+		timeout = heartbeat.Timeout(interval)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	msgType, binarySchema, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if msgType != websocket.BinaryMessage {
+		return errors.New("expected the first frame to be a binary schema")
+	}
+	writerSchema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		return fmt.Errorf("cannot decode schema: %w", err)
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if msgType == websocket.TextMessage && string(data) == heartbeat.Message {
+			continue
+		}
+		var sample schemas.V2Reading
+		if err := writerSchema.Decode(bytes.NewReader(data), &sample); err != nil {
+			return fmt.Errorf("cannot decode data: %w", err)
+		}
+		select {
+		case samples <- &sample:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// follow runs sessions with the websocket server at wsURL, reconnecting with
+// exponential backoff, until ctx is done
+func follow(ctx context.Context, wsURL string, samples chan<- *schemas.V2Reading) {
+	backoff := initialBackoff
+	for {
+		start := time.Now()
+		err := session(ctx, wsURL, samples)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > maxBackoff {
+			// it was up for a while, so start over from the shortest wait
+			backoff = initialBackoff
+		}
+		log.Printf("disconnected: %v (reconnecting in %v)", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// archive writes every sample from samples to s, and syncs it every syncEvery,
+// until ctx is done
+func archive(ctx context.Context, s *sink, samples <-chan *schemas.V2Reading, syncEvery time.Duration) error {
+	ticker := time.NewTicker(syncEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sample := <-samples:
+			if _, err := s.Write(sample); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := s.Sync(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	stream := flag.Bool("stream", false, "follow the websocket server's /ws instead of polling")
+	interval := flag.Duration("interval", time.Second, "time to wait between polls")
+	dir := flag.String("dir", ".", "directory to write the CSV files to")
+	prefix := flag.String("prefix", "readings", "start of the CSV file names, which go on with the day and a part number")
+	maxSize := flag.Int64("max-size", 64<<20, "start a new file once the current one has this many bytes (0 = only every day)")
+	syncEvery := flag.Duration("sync", 5*time.Second, "sync the file to disk this often")
+	flag.Parse()
+
+	if *interval <= 0 || *syncEvery <= 0 {
+		log.Fatal("-interval and -sync must be positive")
+	}
+
+	s, err := newSink(*dir, *prefix, *maxSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	url := strings.TrimSuffix(*baseURL, "/")
+	samples := make(chan *schemas.V2Reading)
+	if *stream {
+		go follow(ctx, "ws"+strings.TrimPrefix(url, "http")+"/ws", samples)
+	} else {
+		go poll(ctx, url, *interval, samples)
+	}
+
+	err = archive(ctx, s, samples, *syncEvery)
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	fmt.Println("summary:", s.summary())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
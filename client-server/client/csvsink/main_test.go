@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/gorilla/websocket"
+)
+
+// start is when the first synthetic tick was generated
+var start = time.Date(2021, 6, 29, 22, 0, 0, 0, time.UTC)
+
+// tick returns the sample of synthetic tick seq, a second after the one before:
+// three raw readings and two filtered ones, none of them exact in binary
+func tick(seq uint64) *schemas.V2Reading {
+	f := float64(seq)
+	return &schemas.V2Reading{
+		Header:            "tick " + strconv.FormatUint(seq, 10),
+		RawReadings:       []float64{f + 0.1, -f / 3, 1e-7 * f},
+		FilteredReadings:  []float64{f + 0.2, f / 7},
+		Sequence:          seq,
+		GeneratedAtUnixMs: start.Add(time.Duration(seq)*time.Second).UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// archived returns what samples should read back from the files as: everything
+// but the Header
+func archived(samples ...*schemas.V2Reading) []schemas.V2Reading {
+	var want []schemas.V2Reading
+	for _, s := range samples {
+		a := *s
+		a.Header = ""
+		want = append(want, a)
+	}
+	return want
+}
+
+// readArchive reads every file in dir, in order, and puts the samples back
+// together from their rows
+func readArchive(dir string) ([]schemas.V2Reading, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	var samples []schemas.V2Reading
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		records, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(records) == 0 || !reflect.DeepEqual(records[0], header) {
+			return nil, fmt.Errorf("%s doesn't start with the header row", file)
+		}
+		for _, record := range records[1:] {
+			if err := addRow(&samples, record); err != nil {
+				return nil, fmt.Errorf("%s: row %q: %w", file, record, err)
+			}
+		}
+	}
+	return samples, nil
+}
+
+// addRow adds record to the last of samples, or starts a new one
+func addRow(samples *[]schemas.V2Reading, record []string) error {
+	ts, err := time.Parse(timeLayout, record[0])
+	if err != nil {
+		return err
+	}
+	sequence, err := strconv.ParseUint(record[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	index, err := strconv.Atoi(record[2])
+	if err != nil {
+		return err
+	}
+
+	if index == 0 {
+		*samples = append(*samples, schemas.V2Reading{Sequence: sequence, GeneratedAtUnixMs: ts.UnixNano() / int64(time.Millisecond)})
+	}
+	if len(*samples) == 0 {
+		return fmt.Errorf("index %d with no row 0 before it", index)
+	}
+	s := &(*samples)[len(*samples)-1]
+	if s.Sequence != sequence || s.GeneratedAtUnixMs != ts.UnixNano()/int64(time.Millisecond) {
+		return fmt.Errorf("not the sample of the rows before it")
+	}
+	if n := len(s.RawReadings); index != 0 && index != n && index != len(s.FilteredReadings) {
+		return fmt.Errorf("index %d out of order", index)
+	}
+
+	for _, c := range []struct {
+		cell     string
+		readings *[]float64
+	}{{record[3], &s.RawReadings}, {record[4], &s.FilteredReadings}} {
+		if c.cell == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(c.cell, 64)
+		if err != nil {
+			return err
+		}
+		*c.readings = append(*c.readings, v)
+	}
+	return nil
+}
+
+// expectArchive checks that dir holds the samples in want, in order
+func expectArchive(t *testing.T, dir string, want []schemas.V2Reading) {
+	t.Helper()
+	got, err := readArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("read back\n  %+v\nwant\n  %+v", got, want)
+	}
+}
+
+// pollTwice fetches twice from p, as overlapping polls would, and writes both
+// samples to s
+func pollTwice(t *testing.T, p *poller, s *sink) {
+	t.Helper()
+	for i := 0; i < 2; i++ {
+		sample, err := p.fetch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Write(sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestPoll checks every tick is written once, and reads back
+func TestPoll(t *testing.T) {
+	dir := t.TempDir()
+	u := testserver.New(t, tick(1))
+	s, err := newSink(dir, "readings", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &poller{baseURL: u.URL}
+	var sent []*schemas.V2Reading
+	for seq := uint64(1); seq <= 4; seq++ {
+		u.Set(t, tick(seq))
+		pollTwice(t, p, s)
+		sent = append(sent, tick(seq))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s.written != 4 || s.skipped != 4 {
+		t.Fatalf("%s, want 4 written and 4 skipped", s.summary())
+	}
+	expectArchive(t, dir, archived(sent...))
+}
+
+// TestPollV1 polls the v1 server, which sends no sequence numbers
+func TestPollV1(t *testing.T) {
+	dir := t.TempDir()
+	u := testserver.New(t, &schemas.V1Reading{})
+	s, err := newSink(dir, "readings", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return start }
+
+	p := &poller{baseURL: u.URL}
+	for _, readings := range [][]float32{{20.5, 21.25}, {20.5, 21.25}, {19.875}} {
+		u.Set(t, &schemas.V1Reading{Readings: readings})
+		pollTwice(t, p, s)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ms := start.UnixNano() / int64(time.Millisecond)
+	expectArchive(t, dir, []schemas.V2Reading{
+		{FilteredReadings: []float64{20.5, 21.25}, GeneratedAtUnixMs: ms},
+		{FilteredReadings: []float64{19.875}, GeneratedAtUnixMs: ms},
+	})
+}
+
+// TestStream checks every frame is written once, and reads back
+func TestStream(t *testing.T) {
+	dir := t.TempDir()
+
+	// the server sends every tick twice, as a server that resent its last frame
+	// to a reconnecting client might, and hangs up
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		writerSchema := schemas.V2WriterSchema()
+		conn.WriteMessage(websocket.BinaryMessage, writerSchema.MarshalSchemer())
+		for seq := uint64(1); seq <= 3; seq++ {
+			var frame bytes.Buffer
+			if err := writerSchema.Encode(&frame, tick(seq)); err != nil {
+				return
+			}
+			conn.WriteMessage(websocket.BinaryMessage, frame.Bytes())
+			conn.WriteMessage(websocket.BinaryMessage, frame.Bytes())
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "done"))
+	}))
+	defer server.Close()
+
+	samples := make(chan *schemas.V2Reading, 10)
+	if err := session(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), samples); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("the session ended with %v, not the server hanging up", err)
+	}
+	close(samples)
+
+	s, err := newSink(dir, "readings", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for sample := range samples {
+		if _, err := s.Write(sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s.written != 3 || s.skipped != 3 {
+		t.Fatalf("%s, want 3 written and 3 skipped", s.summary())
+	}
+	expectArchive(t, dir, archived(tick(1), tick(2), tick(3)))
+}
+
+// writeAll writes samples to a new sink in dir, and closes it
+func writeAll(t *testing.T, dir string, maxSize int64, samples ...*schemas.V2Reading) *sink {
+	t.Helper()
+	s, err := newSink(dir, "readings", maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sample := range samples {
+		if _, err := s.Write(sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestReopen checks a restarted sink appends, and skips what it wrote
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	writeAll(t, dir, 0, tick(1), tick(2))
+	// the new sink polls the last sample the old one wrote before the new one
+	s := writeAll(t, dir, 0, tick(2), tick(3))
+	if s.written != 1 || s.skipped != 1 {
+		t.Fatalf("%s, want 1 written and 1 skipped", s.summary())
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.csv")); len(files) != 1 {
+		t.Fatalf("files %q, want the one appended to", files)
+	}
+	// a second header row in the file would fail to read back
+	expectArchive(t, dir, archived(tick(1), tick(2), tick(3)))
+}
+
+// TestTorn checks a crash mid-row makes the next sink start a new file
+func TestTorn(t *testing.T) {
+	dir := t.TempDir()
+	s := writeAll(t, dir, 0, tick(1))
+	// the rows of tick 2, cut off by a crash before they were all written
+	path := s.path(start.Format(dayLayout), 1)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString("2021-06-29T22:00:02.000Z,2,0,2.1,2.2\n2021-06-29T22:00:02.000Z,2,1,-0.66")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tick 2 is written again, in full, in a new file
+	if s = writeAll(t, dir, 0, tick(2), tick(3)); s.written != 2 {
+		t.Fatalf("%s, want 2 written", s.summary())
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	expectArchive(t, dir, archived(tick(2), tick(3)))
+}
+
+func TestDailyRotation(t *testing.T) {
+	dir := t.TempDir()
+	// ticks 7199 to 7202 straddle midnight, two hours after start
+	var samples []*schemas.V2Reading
+	for seq := uint64(7199); seq <= 7202; seq++ {
+		samples = append(samples, tick(seq))
+	}
+	writeAll(t, dir, 0, samples...)
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"readings-2021-06-29-001.csv", "readings-2021-06-30-001.csv"}
+	var got []string
+	for _, f := range files {
+		got = append(got, filepath.Base(f))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("files %q, want %q", got, want)
+	}
+	expectArchive(t, dir, archived(samples...))
+}
+
+func TestSizeRotation(t *testing.T) {
+	dir := t.TempDir()
+	// a tick's rows take about 150 bytes, so every file gets two ticks
+	const maxSize = 200
+	var samples []*schemas.V2Reading
+	for seq := uint64(1); seq <= 7; seq++ {
+		samples = append(samples, tick(seq))
+	}
+	writeAll(t, dir, maxSize, samples...)
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 3 {
+		t.Fatalf("%d files, want the ticks split over several", len(files))
+	}
+	for _, f := range files[:len(files)-1] {
+		info, err := os.Stat(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() < maxSize {
+			t.Errorf("%s was rotated at %d bytes, under the limit", f, info.Size())
+		}
+	}
+	expectArchive(t, dir, archived(samples...))
+}
+
+// TestSync checks the file is synced periodically, and only with rows to sync
+func TestSync(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSink(dir, "readings", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(); err != nil || s.syncs != 0 {
+		t.Fatalf("synced %d times before anything was written (%v)", s.syncs, err)
+	}
+	s.Write(tick(1))
+	s.Sync()
+	s.Sync()
+	if s.syncs != 1 {
+		t.Fatalf("synced %d times after one write, want once", s.syncs)
+	}
+
+	// archive syncs on its own while samples keep coming
+	ctx, cancel := context.WithCancel(context.Background())
+	samples := make(chan *schemas.V2Reading)
+	done := make(chan error, 1)
+	go func() { done <- archive(ctx, s, samples, 10*time.Millisecond) }()
+	for seq := uint64(2); seq <= 6; seq++ {
+		samples <- tick(seq)
+		time.Sleep(25 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s.syncs < 3 {
+		t.Errorf("synced %d times over 5 ticks, 2.5 sync intervals apart", s.syncs)
+	}
+	if s.dirty {
+		t.Error("rows left unsynced after the last interval")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectArchive(t, dir, archived(tick(1), tick(2), tick(3), tick(4), tick(5), tick(6)))
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// header is the first row of every file the sink creates
+var header = []string{"timestamp", "sequence", "index", "raw", "filtered"}
+
+// timeLayout is how the timestamp column is written, always in UTC
+const timeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// dayLayout names the day in file names, and decides when the sink rotates
+const dayLayout = "2006-01-02"
+
+// sizeWriter counts the bytes written through it
+type sizeWriter struct {
+	w    io.Writer
+	size int64
+}
+
+func (sw *sizeWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	sw.size += int64(n)
+	return n, err
+}
+
+// sink appends samples to CSV files in dir, a row per index of the samples'
+// readings. Files are named prefix-DAY-NNN.csv: a new one is started on the
+// first sample of every UTC day, and whenever the current one has reached
+// maxSize bytes (a sample's rows always go in the same file, so files go a little
+// over it). Every file starts with a header row.
+//
+// A sample with the sequence number of the previous one is a duplicate, and
+// skipped. A sample without one (from the v1 server) is a duplicate if its
+// readings are the same as the previous sample's.
+//
+// Rows are handed to the operating system as every sample is written, but only
+// Sync makes sure they are on disk.
+type sink struct {
+	dir, prefix string
+	maxSize     int64 // 0 rotates daily only
+
+	// now stamps samples that don't say when they were generated
+	now func() time.Time
+
+	f     *os.File
+	out   *sizeWriter
+	w     *csv.Writer
+	day   string // of the open file
+	part  int    // of the open file, from 1
+	dirty bool   // rows written since the last Sync
+
+	last *schemas.V2Reading // the last sample written, nil before the first
+
+	// what the sink has done, for the summary and the checks
+	written, rows, skipped, syncs int
+}
+
+func newSink(dir, prefix string, maxSize int64) (*sink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &sink{dir: dir, prefix: prefix, maxSize: maxSize, now: time.Now}, nil
+}
+
+// path returns the name of file part of day
+func (s *sink) path(day string, part int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s-%s-%03d.csv", s.prefix, day, part))
+}
+
+// isDuplicate reports whether sample is the one written last
+func (s *sink) isDuplicate(sample *schemas.V2Reading) bool {
+	if s.last == nil {
+		return false
+	}
+	if sample.Sequence != 0 || s.last.Sequence != 0 {
+		// a sequence that went backwards is a restarted server, not a duplicate
+		return sample.Sequence == s.last.Sequence
+	}
+	return reflect.DeepEqual(sample.FilteredReadings, s.last.FilteredReadings) &&
+		reflect.DeepEqual(sample.RawReadings, s.last.RawReadings)
+}
+
+// Write appends sample's rows, unless it is a duplicate, and reports whether it
+// did
+func (s *sink) Write(sample *schemas.V2Reading) (bool, error) {
+	ts := s.now()
+	if sample.GeneratedAtUnixMs != 0 {
+		ts = time.Unix(0, sample.GeneratedAtUnixMs*int64(time.Millisecond))
+	}
+	ts = ts.UTC()
+	// before the first sample, this reads the last one written before
+	if err := s.rotate(ts.Format(dayLayout)); err != nil {
+		return false, err
+	}
+	if s.isDuplicate(sample) {
+		s.skipped++
+		return false, nil
+	}
+
+	n := len(sample.RawReadings)
+	if len(sample.FilteredReadings) > n {
+		n = len(sample.FilteredReadings)
+	}
+	timestamp := ts.Format(timeLayout)
+	sequence := strconv.FormatUint(sample.Sequence, 10)
+	for i := 0; i < n; i++ {
+		record := []string{timestamp, sequence, strconv.Itoa(i), cell(sample.RawReadings, i), cell(sample.FilteredReadings, i)}
+		if err := s.w.Write(record); err != nil {
+			return false, err
+		}
+	}
+	s.w.Flush()
+	if err := s.w.Error(); err != nil {
+		return false, err
+	}
+
+	s.last = sample
+	s.written++
+	s.rows += n
+	s.dirty = s.dirty || n > 0
+	return true, nil
+}
+
+// cell formats readings[i], or returns an empty cell past the end of readings.
+// Floats use the shortest representation that reads back as the same value.
+func cell(readings []float64, i int) string {
+	if i >= len(readings) {
+		return ""
+	}
+	return strconv.FormatFloat(readings[i], 'g', -1, 64)
+}
+
+// rotate makes sure the open file is one for day with room left in it
+func (s *sink) rotate(day string) error {
+	if s.f != nil && s.day == day && (s.maxSize <= 0 || s.out.size < s.maxSize) {
+		return nil
+	}
+	part := 1
+	if s.f != nil && s.day == day {
+		part = s.part + 1
+	}
+	if err := s.Close(); err != nil {
+		return err
+	}
+	return s.open(day, part)
+}
+
+// open opens the last file of day, starting from part, to append to it, or
+// creates the one after it if it is full or was cut off mid-row by a crash (which
+// is left as it is). A file the sink creates gets the header row. When the sink
+// has written nothing yet, the last sample in the last file counts as the
+// previous one, so a restarted sink doesn't write the same sample again.
+func (s *sink) open(day string, part int) error {
+	for {
+		if _, err := os.Stat(s.path(day, part+1)); err != nil {
+			break
+		}
+		part++
+	}
+	path := s.path(day, part)
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if s.last == nil {
+		if s.last, err = lastSample(data); err != nil {
+			return fmt.Errorf("cannot read %s: %w", path, err)
+		}
+	}
+	torn := len(data) > 0 && data[len(data)-1] != '\n'
+	if torn || s.maxSize > 0 && int64(len(data)) >= s.maxSize {
+		part++
+		path = s.path(day, part)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.day, s.part = f, day, part
+	s.out = &sizeWriter{w: f, size: info.Size()}
+	s.w = csv.NewWriter(s.out)
+
+	if info.Size() == 0 {
+		s.w.Write(header)
+		s.w.Flush()
+		s.dirty = true
+		return s.w.Error()
+	}
+	return nil
+}
+
+// lastSample returns the last sample in data, the contents of a file the sink
+// wrote, with nothing but its sequence number. If a crash cut the file off
+// mid-row, the sample of the last whole row may be missing rows too, so it
+// doesn't count either: it is written again if it comes again. It returns nil if
+// there are no rows, or the last one has no sequence number.
+func lastSample(data []byte) (*schemas.V2Reading, error) {
+	torn := len(data) > 0 && data[len(data)-1] != '\n'
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil || len(records) < 2 {
+		return nil, err
+	}
+	rows := records[1:]
+	if torn {
+		cut := rows[len(rows)-1][1]
+		for len(rows) > 0 && rows[len(rows)-1][1] == cut {
+			rows = rows[:len(rows)-1]
+		}
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	sequence, err := strconv.ParseUint(rows[len(rows)-1][1], 10, 64)
+	if err != nil || sequence == 0 {
+		return nil, err
+	}
+	return &schemas.V2Reading{Sequence: sequence}, nil
+}
+
+// Sync flushes the rows written since the last Sync to disk
+func (s *sink) Sync() error {
+	if s.f == nil || !s.dirty {
+		return nil
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	s.syncs++
+	return nil
+}
+
+// Close syncs and closes the open file, if there is one. Writing again opens it
+// again.
+func (s *sink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f, s.out, s.w = nil, nil, nil
+	return err
+}
+
+// summary describes what the sink has done
+func (s *sink) summary() string {
+	return fmt.Sprintf("%d samples written (%d rows), %d duplicates skipped, %d syncs", s.written, s.rows, s.skipped, s.syncs)
+}
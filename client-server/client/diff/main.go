@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+// diffReadings describes how the readings called name changed from prev to cur:
+// how many of the ones both have changed value, and how many were added or
+// dropped at the end
+func diffReadings(name string, prev, cur []float64) []string {
+	var changes []string
+	if len(prev) != len(cur) {
+		changes = append(changes, fmt.Sprintf("%s count changed %d→%d", name, len(prev), len(cur)))
+	}
+
+	common := len(prev)
+	if len(cur) < common {
+		common = len(cur)
+	}
+	changed := 0
+	for i := 0; i < common; i++ {
+		if prev[i] != cur[i] {
+			changed++
+		}
+	}
+	if changed > 0 {
+		changes = append(changes, fmt.Sprintf("%d of the first %d %s changed", changed, common, name))
+	}
+
+	switch {
+	case len(cur) > len(prev):
+		changes = append(changes, fmt.Sprintf("%d new %s: %v", len(cur)-len(prev), name, cur[len(prev):]))
+	case len(cur) < len(prev):
+		changes = append(changes, fmt.Sprintf("%d %s dropped", len(prev)-len(cur), name))
+	}
+	return changes
+}
+
+// diff describes everything that changed from prev to cur
+func diff(prev, cur *schemas.V2Reading) []string {
+	var changes []string
+	switch {
+	case cur.Sequence == prev.Sequence+1:
+	case cur.Sequence > prev.Sequence:
+		changes = append(changes, fmt.Sprintf("missed %d samples", cur.Sequence-prev.Sequence-1))
+	case cur.Sequence < prev.Sequence:
+		changes = append(changes, "sequence went backwards; was the server restarted?")
+	}
+	if cur.Header != prev.Header {
+		changes = append(changes, fmt.Sprintf("Header changed from %q to %q", prev.Header, cur.Header))
+	}
+	changes = append(changes, diffReadings("readings", prev.FilteredReadings, cur.FilteredReadings)...)
+	changes = append(changes, diffReadings("raw readings", prev.RawReadings, cur.RawReadings)...)
+	return changes
+}
+
+// this client polls the server like the v2 client, but only prints what changed
+// since the previous poll, which makes an evolving server easy to watch
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	polls := flag.Int("polls", 0, "number of times to fetch data (0 = until interrupted)")
+	interval := flag.Duration("interval", time.Second, "time to wait between polls")
+	flag.Parse()
+
+	ctx := context.Background()
+	client, err := schemerclient.New(*baseURL, schemerclient.WithRetries(3, 250*time.Millisecond))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// nil until the first poll, which has nothing to diff against
+	var prev *schemas.V2Reading
+
+	for i := 0; *polls == 0 || i < *polls; i++ {
+		if i > 0 {
+			time.Sleep(*interval)
+		}
+
+		cur := &schemas.V2Reading{}
+		if prev == nil {
+			err = client.Fetch(ctx, cur)
+		} else {
+			// a bodyless 304 when nothing changed
+			_, err = client.FetchSince(ctx, prev.Sequence, cur)
+		}
+		if errors.Is(err, schemerclient.ErrNotModified) {
+			fmt.Printf("sequence %d: no change\n", prev.Sequence)
+			continue
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if prev == nil {
+			fmt.Printf("sequence %d: Header %q; %d readings: %v\n", cur.Sequence, cur.Header, len(cur.FilteredReadings), cur.FilteredReadings)
+			prev = cur
+			continue
+		}
+
+		changes := diff(prev, cur)
+		if len(changes) == 0 {
+			changes = []string{"no change"}
+		}
+		fmt.Printf("sequence %d: %s\n", cur.Sequence, strings.Join(changes, "; "))
+		prev = cur
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+// this client is meant for a fleet where not every server speaks schemer's binary
+// format yet. It tries the binary schema and data first, and if either step fails
+// it asks the same endpoints for JSON instead (the v2 server answers with JSON when
+// sent Accept: application/json). It logs which path worked, so operators can see
+// how the fleet is mixed.
+
+// fetchBinary is the normal path: binary schema, binary data
+func fetchBinary(ctx context.Context, baseURL string, dest *schemas.V2Reading) error {
+	client, err := schemerclient.New(baseURL)
+	if err != nil {
+		return err
+	}
+	return client.Fetch(ctx, dest)
+}
+
+// getJSON fetches path from the server, asking for JSON
+func getJSON(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		return nil, fmt.Errorf("GET %s: wanted JSON, got %q", url, ct)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// fetchJSON is the fallback path: JSON schema, JSON data. The schema isn't needed
+// to decode JSON, but parsing it checks the server is one we know how to talk to.
+func fetchJSON(ctx context.Context, baseURL string, dest *schemas.V2Reading) error {
+	jsonSchema, err := getJSON(ctx, baseURL+schemerclient.SchemaPath)
+	if err != nil {
+		return err
+	}
+	if _, err := schemer.DecodeSchemaJSON(jsonSchema); err != nil {
+		return fmt.Errorf("cannot decode JSON schema: %w", err)
+	}
+
+	data, err := getJSON(ctx, baseURL+schemerclient.DataPath)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("cannot decode JSON data: %w", err)
+	}
+	return nil
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	timeout := flag.Duration("timeout", 10*time.Second, "time allowed for each path")
+	flag.Parse()
+
+	url := strings.TrimSuffix(*baseURL, "/")
+	var dest schemas.V2Reading
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	err := fetchBinary(ctx, url, &dest)
+	cancel()
+
+	if err == nil {
+		log.Printf("%s: binary path succeeded", url)
+	} else {
+		log.Printf("%s: binary path failed (%v), falling back to JSON", url, err)
+
+		dest = schemas.V2Reading{}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		if err := fetchJSON(ctx, url, &dest); err != nil {
+			log.Fatalf("%s: JSON path failed too: %v", url, err)
+		}
+		log.Printf("%s: JSON path succeeded", url)
+	}
+
+	fmt.Printf("header: %q\n", dest.Header)
+	fmt.Printf("readings: %v\n", dest.FilteredReadings)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// this client never asks the data server for its schema. Every payload carries
+// the fingerprint of the schema it was encoded with, and the client looks up the
+// fingerprints it hasn't seen yet in the schema registry. Run server v2 with
+// REGISTRY_URL pointing at the registry so it registers its schema there.
+
+// fetch gets one payload and the fingerprint of its schema
+func fetch(ctx context.Context, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/get-data/", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+	fingerprint := resp.Header.Get(registry.FingerprintHeader)
+	if fingerprint == "" {
+		return nil, "", fmt.Errorf("the server didn't say which schema its data uses (no %s header)", registry.FingerprintHeader)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, fingerprint, err
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the data server")
+	registryURL := flag.String("registry", os.Getenv(registry.RegistryEnv), "base URL of the schema registry (default $"+registry.RegistryEnv+")")
+	polls := flag.Int("polls", 1, "number of times to fetch data")
+	interval := flag.Duration("interval", time.Second, "time to wait between polls")
+	flag.Parse()
+
+	if *registryURL == "" {
+		log.Fatal("no registry: pass -registry or set " + registry.RegistryEnv)
+	}
+
+	ctx := context.Background()
+	url := strings.TrimSuffix(*baseURL, "/")
+	resolver := registry.NewResolver(*registryURL)
+
+	for i := 0; i < *polls; i++ {
+		if i > 0 {
+			time.Sleep(*interval)
+		}
+
+		data, fingerprint, err := fetch(ctx, url)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// only the first payload with a given fingerprint costs a trip to the registry
+		schema, err := resolver.Resolve(ctx, fingerprint)
+		if err != nil {
+			log.Fatal("cannot resolve schema: " + err.Error())
+		}
+
+		var reading schemas.V2Reading
+		if err := schema.Decode(bytes.NewReader(data), &reading); err != nil {
+			log.Fatal("cannot decode data: " + err.Error())
+		}
+		fmt.Printf("schema %.12s: sequence %d, readings %v\n", fingerprint, reading.Sequence, reading.FilteredReadings)
+	}
+	log.Printf("%d polls, %d schema fetches from the registry", *polls, resolver.Fetches())
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/heartbeat"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+	"github.com/gorilla/websocket"
+)
+
+// this client follows the websocket server (client-server/server/ws) and
+// survives it going away: it reconnects with capped exponential backoff plus
+// jitter, parses the schema again only if its fingerprint changed, and asks
+// /get-history/ for whatever was broadcast while it was gone, so it sees every
+// sequence number exactly once and in order. The samples it couldn't get back
+// (it was away longer than the server's history reaches) are reported as gaps.
+
+const (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+
+	// for a server that doesn't announce a heartbeat interval
+	readTimeout = 10 * time.Second
+
+	// the longest /get-history/ frame accepted
+	maxFrameSize = 1 << 20
+)
+
+// gap is a run of sequence numbers that were never received
+type gap struct {
+	from, to uint64
+}
+
+func (g gap) String() string {
+	if g.from == g.to {
+		return strconv.FormatUint(g.from, 10)
+	}
+	return fmt.Sprintf("%d-%d", g.from, g.to)
+}
+
+// follower keeps a stream going across reconnects. Only its run goroutine
+// touches it.
+type follower struct {
+	wsURL      string
+	historyURL string
+	backoff    func(attempt int) time.Duration
+	deliver    func(schemas.V2Reading) // gets every sample, in order
+
+	schema      schemer.Schema
+	fingerprint string
+	last        uint64 // sequence of the last sample delivered
+	gaps        []gap
+	resets      int // times the server's sequence went backwards
+}
+
+// newFollower follows the websocket server at baseURL (http:// or https://)
+func newFollower(baseURL string, deliver func(schemas.V2Reading)) *follower {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &follower{
+		wsURL:      "ws" + strings.TrimPrefix(baseURL, "http") + "/ws",
+		historyURL: baseURL + "/get-history/",
+		backoff:    jitteredBackoff(initialBackoff, maxBackoff),
+		deliver:    deliver,
+	}
+}
+
+// jitteredBackoff doubles the wait after every failed attempt up to max, and
+// waits a random time between half of that and all of it, so clients dropped by
+// the same restart don't all come back at the same moment
+func jitteredBackoff(initial, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := initial
+		for i := 0; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+}
+
+// run connects, reads until the connection fails, and reconnects, until ctx is
+// done
+func (f *follower) run(ctx context.Context) {
+	attempt := 0
+	for ctx.Err() == nil {
+		err := f.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errConnect) {
+			attempt++
+		} else {
+			// it was up, so start over from the shortest wait
+			attempt = 0
+		}
+		wait := f.backoff(attempt)
+		log.Printf("disconnected: %v (reconnecting in %v)", err, wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+}
+
+var errConnect = errors.New("cannot connect")
+
+// session is one connection: the schema, then whatever was missed, then live
+// frames until the connection fails
+func (f *follower) session(ctx context.Context) error {
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, f.wsURL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errConnect, err)
+	}
+	defer conn.Close()
+
+	// stop reading as soon as ctx is done, rather than at the next frame
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-sessionDone:
+		}
+	}()
+
+	timeout := readTimeout
+	if interval, ok := heartbeat.ParseInterval(resp.Header.Get(heartbeat.Header)); ok {
+		timeout = heartbeat.Timeout(interval)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	msgType, binarySchema, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if msgType != websocket.BinaryMessage {
+		return errors.New("expected the first frame to be a binary schema")
+	}
+	if err := f.useSchema(binarySchema); err != nil {
+		return err
+	}
+
+	// frames broadcast from now on queue up on the connection while the history
+	// is fetched; the ones it also holds are skipped as duplicates
+	if err := f.catchUp(ctx); err != nil {
+		return fmt.Errorf("cannot catch up: %w", err)
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if msgType == websocket.TextMessage && string(data) == heartbeat.Message {
+			continue
+		}
+		if err := f.decode(data); err != nil {
+			return err
+		}
+	}
+}
+
+// useSchema parses binarySchema, unless it is the one already in use
+func (f *follower) useSchema(binarySchema []byte) error {
+	fingerprint := registry.Fingerprint(binarySchema)
+	if fingerprint == f.fingerprint {
+		return nil
+	}
+	schema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		return fmt.Errorf("cannot decode schema: %w", err)
+	}
+	if f.fingerprint != "" {
+		log.Printf("the server's schema changed from %.12s to %.12s", f.fingerprint, fingerprint)
+	}
+	f.schema, f.fingerprint = schema, fingerprint
+	return nil
+}
+
+// catchUp fetches and delivers everything broadcast after the last sample
+// delivered
+func (f *follower) catchUp(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.historyURL+"?since="+strconv.FormatUint(f.last, 10), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("GET %s: %s", f.historyURL, resp.Status)
+	}
+	if fp := resp.Header.Get(registry.FingerprintHeader); fp != f.fingerprint {
+		return fmt.Errorf("the history was encoded with schema %.12s, the stream with %.12s", fp, f.fingerprint)
+	}
+
+	// a server that restarted without its history counts from 1 again
+	if latest, err := strconv.ParseUint(resp.Header.Get("X-Sequence"), 10, 64); err == nil && latest < f.last {
+		log.Printf("the server's sequence went back from %d to %d: it lost its history, starting over", f.last, latest)
+		f.resets++
+		f.last = 0
+	}
+
+	for {
+		payload, err := frame.ReadFrame(resp.Body, maxFrameSize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := f.decode(payload); err != nil {
+			return err
+		}
+	}
+}
+
+// decode decodes one payload and delivers it, unless it was delivered already.
+// A sample that isn't the one after the last leaves a gap.
+func (f *follower) decode(payload []byte) error {
+	var reading schemas.V2Reading
+	if err := f.schema.Decode(bytes.NewReader(payload), &reading); err != nil {
+		return fmt.Errorf("cannot decode data: %w", err)
+	}
+	if reading.Sequence <= f.last {
+		return nil
+	}
+	if f.last != 0 && reading.Sequence > f.last+1 {
+		g := gap{f.last + 1, reading.Sequence - 1}
+		log.Printf("missed %s: the server no longer has them", g)
+		f.gaps = append(f.gaps, g)
+	}
+	f.last = reading.Sequence
+	f.deliver(reading)
+	return nil
+}
+
+// summary describes what could not be recovered
+func (f *follower) summary() string {
+	if len(f.gaps) == 0 && f.resets == 0 {
+		return fmt.Sprintf("no gaps up to sequence %d", f.last)
+	}
+	var missed uint64
+	var runs []string
+	for _, g := range f.gaps {
+		missed += g.to - g.from + 1
+		runs = append(runs, g.String())
+	}
+	return fmt.Sprintf("%d samples missed (%s), %d sequence resets", missed, strings.Join(runs, ", "), f.resets)
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the websocket server")
+	flag.Parse()
+
+	rand.Seed(time.Now().UnixNano())
+
+	f := newFollower(*baseURL, func(r schemas.V2Reading) {
+		fmt.Printf("%d %q %v\n", r.Sequence, r.Header, r.FilteredReadings)
+	})
+
+	// run until interrupted, then say what couldn't be recovered
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	f.run(ctx)
+	fmt.Println("summary:", f.summary())
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// how often restartServer broadcasts, and how long it stays down
+	broadcastInterval = 20 * time.Millisecond
+	downtime          = 150 * time.Millisecond
+)
+
+// restartServer is a small copy of the websocket server whose data source outlives
+// its listener: stop and start model a restart that keeps the history, so the
+// sequence carries on where it was.
+type restartServer struct {
+	binarySchema []byte
+	fingerprint  string
+
+	mu          sync.Mutex
+	history     [][]byte // the payload of sequence i is history[i-1]
+	clients     map[chan []byte]bool
+	conns       map[*websocket.Conn]bool
+	connections int // upgrades served, over all restarts
+	srv         *http.Server
+}
+
+func newRestartServer() *restartServer {
+	binarySchema := schemas.V2WriterSchema().MarshalSchemer()
+	return &restartServer{
+		binarySchema: binarySchema,
+		fingerprint:  registry.Fingerprint(binarySchema),
+		clients:      map[chan []byte]bool{},
+		conns:        map[*websocket.Conn]bool{},
+	}
+}
+
+// broadcast encodes and sends a reading every broadcastInterval until stop is closed
+func (s *restartServer) broadcast(stop <-chan struct{}) error {
+	writerSchema := schemas.V2WriterSchema()
+	ticker := time.NewTicker(broadcastInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		reading := schemas.V2Reading{Header: "test", Sequence: uint64(len(s.history) + 1)}
+		var encodedData bytes.Buffer
+		if err := writerSchema.Encode(&encodedData, &reading); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.history = append(s.history, encodedData.Bytes())
+		for ch := range s.clients {
+			select {
+			case ch <- encodedData.Bytes():
+			default:
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// latest is the sequence of the last reading broadcast
+func (s *restartServer) latest() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return uint64(len(s.history))
+}
+
+func (s *restartServer) wsHandler(w http.ResponseWriter, req *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, req, http.Header{registry.FingerprintHeader: {s.fingerprint}})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// registered before the schema goes out, so the client can't miss anything
+	// between the history and the live frames
+	ch := make(chan []byte, 100)
+	s.mu.Lock()
+	s.clients[ch] = true
+	s.conns[conn] = true
+	s.connections++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, ch)
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, s.binarySchema); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case payload := <-ch:
+			if err := conn.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *restartServer) historyHandler(w http.ResponseWriter, req *http.Request) {
+	since, err := strconv.ParseUint(req.URL.Query().Get("since"), 10, 64)
+	if err != nil {
+		http.Error(w, "since must be a sequence number", http.StatusBadRequest)
+		return
+	}
+
+	var body bytes.Buffer
+	s.mu.Lock()
+	for i := since; i < uint64(len(s.history)); i++ {
+		frame.WriteFrame(&body, s.history[i])
+	}
+	latest := len(s.history)
+	s.mu.Unlock()
+
+	w.Header().Set(registry.FingerprintHeader, s.fingerprint)
+	w.Header().Set("X-Sequence", strconv.Itoa(latest))
+	w.Write(body.Bytes())
+}
+
+// start listens on addr ("127.0.0.1:0" picks a port) and returns the address
+func (s *restartServer) start(addr string) (string, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.wsHandler)
+	mux.HandleFunc("/get-history/", s.historyHandler)
+
+	srv := &http.Server{Handler: mux}
+	s.mu.Lock()
+	s.srv = srv
+	s.mu.Unlock()
+	go srv.Serve(l)
+	return l.Addr().String(), nil
+}
+
+// stop closes the listener and drops every client. Close doesn't know about
+// upgraded connections, so they are closed here.
+func (s *restartServer) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.srv.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// TestRestarts follows a server through two restarts, and checks every sample
+// it broadcast was delivered once, in order
+func TestRestarts(t *testing.T) {
+	s := newRestartServer()
+	addr, err := s.start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.stop()
+
+	stopBroadcast := make(chan struct{})
+	broadcastErr := make(chan error, 1)
+	go func() { broadcastErr <- s.broadcast(stopBroadcast) }()
+
+	// deliver runs on the follower's goroutine, the test reads from this one
+	var mu sync.Mutex
+	var received []uint64
+	f := newFollower("http://"+addr, func(r schemas.V2Reading) {
+		mu.Lock()
+		received = append(received, r.Sequence)
+		mu.Unlock()
+	})
+	f.backoff = jitteredBackoff(10*time.Millisecond, 100*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		f.run(ctx)
+	}()
+
+	for i := 0; i < 2; i++ {
+		time.Sleep(10 * broadcastInterval)
+		s.stop()
+		time.Sleep(downtime)
+		if _, err := s.start(addr); err != nil {
+			t.Fatalf("cannot restart on %s: %v", addr, err)
+		}
+	}
+	time.Sleep(10 * broadcastInterval)
+	close(stopBroadcast)
+	if err := <-broadcastErr; err != nil {
+		t.Fatal(err)
+	}
+
+	latest := s.latest()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		var last uint64
+		if n > 0 {
+			last = received[n-1]
+		}
+		mu.Unlock()
+		if last >= latest {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the client got up to %d of %d", n, latest)
+		}
+		time.Sleep(broadcastInterval)
+	}
+	cancel()
+	<-stopped
+
+	s.mu.Lock()
+	connections := s.connections
+	s.mu.Unlock()
+	if connections < 3 {
+		t.Errorf("the client connected %d times over two restarts", connections)
+	}
+	for i, seq := range received {
+		if seq != uint64(i+1) {
+			t.Fatalf("received[%d] is sequence %d: %v", i, seq, received)
+		}
+	}
+	if uint64(len(received)) != latest {
+		t.Errorf("received %d samples, %d were broadcast", len(received), latest)
+	}
+	if len(f.gaps) != 0 || f.resets != 0 {
+		t.Errorf("expected no gaps or resets, the summary says %s", f.summary())
+	}
+}
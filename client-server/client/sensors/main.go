@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+// this client knows nothing about the sensors in advance. It reads the index,
+// fetches the schema of every sensor, and decodes each sensor's data into a value
+// of the Go type schemer derives from that schema.
+
+type indexEntry struct {
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+func get(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// readSensor fetches the schema and data of one sensor and returns the decoded
+// value
+func readSensor(baseURL string, e indexEntry) (interface{}, error) {
+	binarySchema, err := get(baseURL + "/sensors/" + e.Name + "/schema")
+	if err != nil {
+		return nil, err
+	}
+	if fingerprint := registry.Fingerprint(binarySchema); fingerprint != e.Fingerprint {
+		return nil, fmt.Errorf("schema fingerprint %.12s doesn't match the index (%.12s)", fingerprint, e.Fingerprint)
+	}
+
+	schema, err := schemerclient.DecodeSchema(binarySchema)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode schema: %w", err)
+	}
+
+	data, err := get(baseURL + "/sensors/" + e.Name + "/data")
+	if err != nil {
+		return nil, err
+	}
+	return decodeGeneric(schema, data)
+}
+
+// decodeGeneric decodes data into a new value of the type schemer derives from
+// schema, for when there's no Go struct for it
+func decodeGeneric(schema schemer.Schema, data []byte) (interface{}, error) {
+	t := schema.GoType()
+	if t == nil {
+		return nil, fmt.Errorf("schema has no Go type to decode into")
+	}
+	dest := reflect.New(t)
+	if err := schema.Decode(bytes.NewReader(data), dest.Interface()); err != nil {
+		return nil, fmt.Errorf("cannot decode data: %w", err)
+	}
+	return dest.Elem().Interface(), nil
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the sensor server")
+	flag.Parse()
+	url := strings.TrimSuffix(*baseURL, "/")
+
+	indexJSON, err := get(url + "/sensors")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var index []indexEntry
+	if err := json.Unmarshal(indexJSON, &index); err != nil {
+		log.Fatal("cannot parse the sensor index: " + err.Error())
+	}
+
+	failed := false
+	for _, e := range index {
+		v, err := readSensor(url, e)
+		if err != nil {
+			log.Printf("%s: %v", e.Name, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s (schema %.12s): %+v\n", e.Name, e.Fingerprint, v)
+	}
+	if failed {
+		log.Fatal("could not read every sensor")
+	}
+}
@@ -0,0 +1,253 @@
+// spark charts a server's readings live in the terminal, as Unicode bars: every
+// new sample's readings are added on the right, the oldest scroll off the left,
+// and the bars are scaled to the smallest and largest readings seen so far. The
+// sample's Header is the title. Press r to switch between the filtered and raw
+// readings, and q (or Ctrl-C) to quit.
+//
+//	go run ./client-server/client/spark -url http://localhost:8080
+//
+// It polls with schemerclient, so it rides out a server restart during a demo:
+// while the server is down the chart stays up with the error under it, a new
+// schema is picked up when the server comes back with one, and a sequence
+// number that starts over counts as new data. Against the v1 server, which only
+// has (filtered) readings, the raw chart stays empty.
+//
+// The keys are read a press at a time by putting the terminal in cbreak mode
+// with stty; where that doesn't work, type the key and press Enter.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/spark"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+const (
+	// clears the terminal and moves the cursor to the top left
+	clearScreen = "\x1b[H\x1b[2J"
+	// hides the cursor while the chart is up, and shows it again
+	hideCursor = "\x1b[?25l"
+	showCursor = "\x1b[?25h"
+)
+
+// series is the most recent readings of one kind, and the range of all of them
+// seen so far
+type series struct {
+	name   string
+	values []float64
+	seen   spark.Range
+}
+
+// add appends values, dropping the oldest ones beyond width
+func (s *series) add(values []float64, width int) {
+	s.values = append(s.values, values...)
+	if len(s.values) > width {
+		s.values = append([]float64(nil), s.values[len(s.values)-width:]...)
+	}
+	s.seen.Add(values...)
+}
+
+// chart is what is on the screen
+type chart struct {
+	width, height int
+
+	filtered, raw series
+	showRaw       bool
+
+	header string
+	last   *schemas.V2Reading // the previous sample, nil before the first
+	status string             // the last poll's error, or what the chart is waiting for
+}
+
+func newChart(width, height int) *chart {
+	return &chart{
+		width:    width,
+		height:   height,
+		filtered: series{name: "filtered readings"},
+		raw:      series{name: "raw readings"},
+		status:   "waiting for the first sample",
+	}
+}
+
+// isNew reports whether sample is one the chart hasn't had. Samples are told
+// apart by their sequence number; the v1 server's have none, and change only when
+// their readings do.
+func (c *chart) isNew(sample *schemas.V2Reading) bool {
+	if c.last == nil {
+		return true
+	}
+	if sample.Sequence != 0 || c.last.Sequence != 0 {
+		// a sequence that went backwards is a restarted server
+		return sample.Sequence != c.last.Sequence
+	}
+	return !reflect.DeepEqual(sample.FilteredReadings, c.last.FilteredReadings) ||
+		!reflect.DeepEqual(sample.RawReadings, c.last.RawReadings)
+}
+
+// update adds sample to the chart, unless it has it already
+func (c *chart) update(sample *schemas.V2Reading) {
+	c.status = ""
+	if !c.isNew(sample) {
+		return
+	}
+	c.header = sample.Header
+	c.filtered.add(sample.FilteredReadings, c.width)
+	c.raw.add(sample.RawReadings, c.width)
+	c.last = sample
+}
+
+// draw returns the screen: the title, the chart with the range it is scaled to
+// alongside, and a line of help or the last error
+func (c *chart) draw() string {
+	s := &c.filtered
+	if c.showRaw {
+		s = &c.raw
+	}
+
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	title := c.header
+	if title == "" {
+		title = "(no header)"
+	}
+	fmt.Fprintf(&b, "%s\n%s", title, s.name)
+	if c.last != nil && c.last.Sequence != 0 {
+		fmt.Fprintf(&b, ", up to sample %d", c.last.Sequence)
+	}
+	b.WriteString("\n\n")
+
+	rows := spark.Rows(s.values, s.seen, c.height)
+	for i, row := range rows {
+		label := ""
+		switch {
+		case s.seen.Empty():
+		case i == 0:
+			label = fmt.Sprintf("%.2f", s.seen.Max)
+		case i == len(rows)-1:
+			label = fmt.Sprintf("%.2f", s.seen.Min)
+		}
+		fmt.Fprintf(&b, "%8s │%s\n", label, string(row))
+	}
+	fmt.Fprintf(&b, "%8s └%s\n\n", "", strings.Repeat("─", c.width))
+
+	if c.status != "" {
+		b.WriteString(c.status + "\n")
+	}
+	b.WriteString("r: raw/filtered   q: quit\n")
+	return b.String()
+}
+
+// cbreak makes the terminal hand over key presses one at a time, without echoing
+// them, and returns a function that puts it back the way it was
+func cbreak() (restore func(), err error) {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("cbreak", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(saved) }, nil
+}
+
+// readKeys sends every byte typed on stdin to keys
+func readKeys(keys chan<- byte) {
+	r := bufio.NewReader(os.Stdin)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		keys <- b
+	}
+}
+
+func run(ctx context.Context, baseURL string, interval time.Duration, c *chart) error {
+	if restore, err := cbreak(); err == nil {
+		defer restore()
+	}
+	fmt.Print(hideCursor)
+	defer fmt.Print(showCursor)
+
+	keys := make(chan byte)
+	go readKeys(keys)
+
+	var client *schemerclient.Client
+	poll := func() {
+		var err error
+		if client == nil {
+			// the server may not be up yet
+			if client, err = schemerclient.New(baseURL, schemerclient.WithRetries(1, 250*time.Millisecond)); err != nil {
+				client = nil
+				c.status = fmt.Sprintf("cannot reach %s: %v (retrying)", baseURL, err)
+				return
+			}
+		}
+		// Fetch fetches the schema again if the data doesn't decode with the one it
+		// has, which is what a server that came back upgraded needs
+		var sample schemas.V2Reading
+		if err := client.Fetch(ctx, &sample); err != nil {
+			c.status = fmt.Sprintf("%v (retrying)", err)
+			return
+		}
+		c.update(&sample)
+	}
+
+	poll()
+	fmt.Print(c.draw())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			poll()
+		case key := <-keys:
+			switch key {
+			case 'r', 'R':
+				c.showRaw = !c.showRaw
+			case 'q', 'Q':
+				return nil
+			default:
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		fmt.Print(c.draw())
+	}
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	interval := flag.Duration("interval", time.Second, "time to wait between polls")
+	width := flag.Int("width", 60, "number of readings on the chart")
+	height := flag.Int("height", 8, "height of the chart, in rows")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, strings.TrimSuffix(*baseURL, "/"), *interval, newChart(*width, *height)); err != nil {
+		log.Fatal(err)
+	}
+}
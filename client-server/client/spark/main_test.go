@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/spark"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// TestWaiting checks the chart before any sample has arrived
+func TestWaiting(t *testing.T) {
+	screen := newChart(10, 4).draw()
+	if !strings.Contains(screen, "waiting for the first sample") || strings.ContainsAny(screen, string(spark.Blocks)) {
+		t.Fatalf("the empty chart:\n%s", screen)
+	}
+}
+
+// TestSamples checks the chart keeps the newest readings, skips duplicates and
+// takes in a restarted server
+func TestSamples(t *testing.T) {
+	c := newChart(4, 2)
+	c.update(&schemas.V2Reading{Header: "first", FilteredReadings: []float64{1, 2, 3}, RawReadings: []float64{10, 20, 30}, Sequence: 1})
+	// the same sample polled again
+	c.update(&schemas.V2Reading{Header: "first", FilteredReadings: []float64{1, 2, 3}, RawReadings: []float64{10, 20, 30}, Sequence: 1})
+	c.update(&schemas.V2Reading{Header: "second", FilteredReadings: []float64{4, 5}, RawReadings: []float64{40, 50}, Sequence: 2})
+
+	// only the newest width readings are kept, but the range has them all
+	if want := []float64{2, 3, 4, 5}; !reflect.DeepEqual(c.filtered.values, want) {
+		t.Fatalf("filtered readings %v, expected %v", c.filtered.values, want)
+	}
+	if want := []float64{20, 30, 40, 50}; !reflect.DeepEqual(c.raw.values, want) {
+		t.Fatalf("raw readings %v, expected %v", c.raw.values, want)
+	}
+	if c.filtered.seen.Min != 1 || c.filtered.seen.Max != 5 {
+		t.Fatalf("filtered range [%g, %g], expected [1, 5]", c.filtered.seen.Min, c.filtered.seen.Max)
+	}
+
+	// a restarted server starts its sequence over
+	c.update(&schemas.V2Reading{Header: "after the restart", FilteredReadings: []float64{6}, Sequence: 1})
+	if c.header != "after the restart" || c.filtered.values[len(c.filtered.values)-1] != 6 {
+		t.Fatalf("the sample after a restart wasn't added: %q %v", c.header, c.filtered.values)
+	}
+
+	// the v1 server numbers nothing: a sample is new when its readings change
+	v1 := newChart(10, 2)
+	for _, readings := range [][]float64{{1, 2}, {1, 2}, {3}} {
+		v1.update(&schemas.V2Reading{FilteredReadings: readings})
+	}
+	if want := []float64{1, 2, 3}; !reflect.DeepEqual(v1.filtered.values, want) {
+		t.Fatalf("v1 readings %v, expected %v", v1.filtered.values, want)
+	}
+
+	screen := c.draw()
+	if !strings.Contains(screen, "after the restart\nfiltered readings, up to sample 1") {
+		t.Fatalf("no title:\n%s", screen)
+	}
+	c.showRaw = true
+	if screen := c.draw(); !strings.Contains(screen, "raw readings") {
+		t.Fatalf("r doesn't switch to the raw readings:\n%s", screen)
+	}
+}
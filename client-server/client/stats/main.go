@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/signing"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+// this client is an analytics consumer: rather than printing every sample, it
+// polls the v2 server for a window of polls, collects the FilteredReadings of
+// every new sample, and at the end of the window prints their min, max, mean,
+// standard deviation and a histogram before starting the next window. A sample
+// that hasn't changed since the previous poll is only counted once.
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	windowSize := flag.Int("window", 60, "number of polls per window")
+	windows := flag.Int("windows", 0, "number of windows to run (0 = until interrupted)")
+	interval := flag.Duration("interval", time.Second, "time to wait between polls")
+	buckets := flag.Int("buckets", 10, "number of histogram buckets")
+	insecure := flag.Bool("insecure", false, "accept any TLS certificate, e.g. a server's self-signed one (unsafe)")
+	flag.Parse()
+
+	if *windowSize < 1 {
+		log.Fatal("-window must be at least 1")
+	}
+	if *buckets < 1 {
+		log.Fatal("-buckets must be at least 1")
+	}
+
+	ctx := context.Background()
+
+	opts := []schemerclient.Option{schemerclient.WithRetries(3, 250*time.Millisecond)}
+	if key := signing.KeyFromEnv(); key != nil {
+		opts = append(opts, schemerclient.WithSigningKey(key))
+	}
+	if *insecure {
+		log.Println("WARNING: -insecure is set, TLS certificates are NOT verified; only use this against a local demo server")
+		opts = append(opts, schemerclient.WithInsecureSkipVerify())
+	}
+
+	// the schema is fetched once; Fetch refreshes it by itself if the server's
+	// changes under us
+	client, err := schemerclient.New(*baseURL, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		w            window
+		dest         schemas.V2Reading
+		lastSequence uint64
+		haveSample   bool
+	)
+
+	for n := 1; *windows == 0 || n <= *windows; n++ {
+		for i := 0; i < *windowSize; i++ {
+			if n > 1 || i > 0 {
+				time.Sleep(*interval)
+			}
+
+			schemerclient.ResetForReuse(&dest)
+			if !haveSample {
+				err = client.Fetch(ctx, &dest)
+			} else {
+				_, err = client.FetchSince(ctx, lastSequence, &dest)
+			}
+			if errors.Is(err, schemerclient.ErrNotModified) {
+				// the same sample as last time; counting it again would skew the stats
+				continue
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			haveSample = true
+			lastSequence = dest.Sequence
+			w.add(dest.FilteredReadings)
+		}
+
+		printWindow(os.Stdout, n, &w, *buckets)
+		w.reset()
+	}
+
+	schemaRequests, dataRequests := client.Requests()
+	log.Printf("made %d requests: %d for the schema, %d for data", schemaRequests+dataRequests, schemaRequests, dataRequests)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// widest histogram bar, in characters
+const barWidth = 40
+
+// window accumulates the readings of every sample decoded during one window
+type window struct {
+	samples  int
+	readings []float64
+}
+
+func (w *window) add(readings []float64) {
+	w.samples++
+	w.readings = append(w.readings, readings...)
+}
+
+// reset empties the window for the next one, keeping its capacity
+func (w *window) reset() {
+	w.samples = 0
+	w.readings = w.readings[:0]
+}
+
+// summary is what gets printed at the end of a window
+type summary struct {
+	count          int
+	min, max, mean float64
+	stddev         float64 // population standard deviation
+}
+
+func summarize(readings []float64) summary {
+	s := summary{count: len(readings)}
+	if s.count == 0 {
+		return s
+	}
+
+	s.min, s.max = readings[0], readings[0]
+	var sum float64
+	for _, r := range readings {
+		s.min = math.Min(s.min, r)
+		s.max = math.Max(s.max, r)
+		sum += r
+	}
+	s.mean = sum / float64(s.count)
+
+	// a second pass, rather than a running sum of squares, so the deviations
+	// don't get lost in the rounding of large sums
+	var squares float64
+	for _, r := range readings {
+		d := r - s.mean
+		squares += d * d
+	}
+	s.stddev = math.Sqrt(squares / float64(s.count))
+	return s
+}
+
+// histogram counts readings into buckets equal-width buckets between min and max
+func histogram(readings []float64, min, max float64, buckets int) []int {
+	counts := make([]int, buckets)
+	width := (max - min) / float64(buckets)
+	for _, r := range readings {
+		i := 0
+		if width > 0 {
+			i = int((r - min) / width)
+		}
+		// max itself lands just past the last bucket
+		if i >= buckets {
+			i = buckets - 1
+		}
+		counts[i]++
+	}
+	return counts
+}
+
+// printWindow writes the statistics and histogram of one window to out
+func printWindow(out io.Writer, n int, w *window, buckets int) {
+	fmt.Fprintf(out, "window %d: %d samples, %d readings\n", n, w.samples, len(w.readings))
+
+	s := summarize(w.readings)
+	if s.count == 0 {
+		fmt.Fprintln(out, "  no readings")
+		return
+	}
+	fmt.Fprintf(out, "  min %.4f  max %.4f  mean %.4f  stddev %.4f\n", s.min, s.max, s.mean, s.stddev)
+
+	// every reading the same: one bucket says all there is to say
+	if s.min == s.max {
+		buckets = 1
+	}
+	counts := histogram(w.readings, s.min, s.max, buckets)
+	most := 0
+	for _, c := range counts {
+		if c > most {
+			most = c
+		}
+	}
+	width := (s.max - s.min) / float64(buckets)
+	for i, c := range counts {
+		lo := s.min + float64(i)*width
+		closing := ")"
+		if i == buckets-1 {
+			closing = "]"
+		}
+		bar := strings.Repeat("#", (c*barWidth+most-1)/most)
+		fmt.Fprintf(out, "  [%9.4f, %9.4f%s %5d %s\n", lo, lo+width, closing, c, bar)
+	}
+}
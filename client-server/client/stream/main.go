@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+// StreamPath is where the v2 server streams its samples
+const StreamPath = "/stream-data/"
+
+// the longest sample the client accepts. The v2 server's samples are a few
+// hundred bytes; this leaves room for big ones posted to /admin/update.
+const maxSampleSize = 16 << 20
+
+// how long to wait before reconnecting after a stream fails (one that just ends
+// is reconnected right away)
+const reconnectDelay = time.Second
+
+// errEnough stops a stream once -count samples have been decoded
+var errEnough = errors.New("got enough samples")
+
+// sequenceTracker skips samples already seen and reports missed ones, across
+// reconnects
+type sequenceTracker struct {
+	last uint64
+}
+
+// see records sequence, and reports whether it is a sample we haven't had yet.
+// Every stream starts with the server's current sample, which after a reconnect
+// is often the last one the previous stream sent.
+func (t *sequenceTracker) see(sequence uint64) bool {
+	switch {
+	case t.last == 0:
+		// nothing to compare against yet
+	case sequence == t.last:
+		return false
+	case sequence > t.last+1:
+		log.Printf("missed %d samples (sequence %d -> %d)", sequence-t.last-1, t.last, sequence)
+	case sequence < t.last:
+		log.Printf("sequence went backwards (%d -> %d); was the server restarted?", t.last, sequence)
+	}
+	t.last = sequence
+	return true
+}
+
+// streamOnce reads one /stream-data/ response: the schema frame, then a frame per
+// sample, each decoded and passed to handle as soon as it arrives. It returns nil
+// when the server ends the stream, or the error handle returns.
+func streamOnce(ctx context.Context, baseURL string, handle func(*schemas.V2Reading) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+StreamPath, nil)
+	if err != nil {
+		return err
+	}
+	// no timeout on the client: the response is meant to stay open
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", StreamPath, resp.Status)
+	}
+
+	binarySchema, err := frame.ReadFrame(resp.Body, schemerclient.MaxSchemaSize)
+	if err != nil {
+		return fmt.Errorf("cannot read the schema: %w", err)
+	}
+	schema, err := schemerclient.DecodeSchema(binarySchema)
+	if err != nil {
+		return err
+	}
+
+	var dest schemas.V2Reading
+	for {
+		payload, err := frame.ReadFrame(resp.Body, maxSampleSize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read a sample: %w", err)
+		}
+
+		schemerclient.ResetForReuse(&dest)
+		if err := schema.Decode(bytes.NewReader(payload), &dest); err != nil {
+			return fmt.Errorf("decode error: %w", err)
+		}
+		if err := handle(&dest); err != nil {
+			return err
+		}
+	}
+}
+
+// this client makes one request and gets every new sample pushed to it over the
+// same response, instead of polling /get-data/. The server ends each stream after
+// its REQUEST_TIMEOUT; with -reconnect (the default) the client opens the next one
+// and carries on, reporting any samples it missed in between.
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the (v2) server")
+	count := flag.Int("count", 0, "stop after this many samples (0 = run until interrupted)")
+	reconnect := flag.Bool("reconnect", true, "open a new stream when one ends")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var tracker sequenceTracker
+	received := 0
+	handle := func(dest *schemas.V2Reading) error {
+		if !tracker.see(dest.Sequence) {
+			return nil
+		}
+		fmt.Printf("sequence: %d (generated %s)\n", dest.Sequence, time.Unix(0, dest.GeneratedAtUnixMs*int64(time.Millisecond)).Format(time.RFC3339Nano))
+		fmt.Printf("header: %q\n", dest.Header)
+		fmt.Printf("readings: %v\n", dest.FilteredReadings)
+		received++
+		if *count > 0 && received >= *count {
+			return errEnough
+		}
+		return nil
+	}
+
+	for streams := 1; ; streams++ {
+		err := streamOnce(ctx, *baseURL, handle)
+		switch {
+		case errors.Is(err, errEnough):
+			log.Printf("received %d samples over %d streams", received, streams)
+			return
+		case ctx.Err() != nil:
+			log.Printf("interrupted after %d samples over %d streams", received, streams)
+			return
+		case !*reconnect:
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("the server ended the stream after %d samples", received)
+			return
+		case err != nil:
+			log.Printf("stream failed (%v), reconnecting in %s", err, reconnectDelay)
+			select {
+			case <-time.After(reconnectDelay):
+			case <-ctx.Done():
+			}
+		default:
+			log.Println("the server ended the stream, reconnecting")
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	polls := flag.Int("polls", 1, "number of times to fetch data")
+	interval := flag.Duration("interval", time.Second, "time to wait between polls")
+	schemaCache := flag.Bool("schema-cache", false, "fetch the schema once and reuse it for every poll")
+	schemaRefresh := flag.Int("schema-refresh", 0, "with -schema-cache, refetch the schema every N polls to notice server upgrades (0 = never)")
+	insecure := flag.Bool("insecure", false, "accept any TLS certificate, e.g. a server's self-signed one (unsafe)")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	opts := []schemerclient.Option{schemerclient.WithRetries(3, 250*time.Millisecond)}
+	if *insecure {
+		log.Println("WARNING: -insecure is set, TLS certificates are NOT verified; only use this against a local demo server")
+		opts = append(opts, schemerclient.WithInsecureSkipVerify())
+	}
+
+	// New fetches the schema for us
+	client, err := schemerclient.New(*baseURL, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// before anything is decoded, check what decoding the server's data into our
+	// struct will quietly do (fields skipped or left at zero, numbers narrowed),
+	// and give up now if it can't be done at all, rather than on the first payload
+	checkCompatible := func() {
+		report, ok := schemerclient.CheckCompatible(&schemas.V1Reading{}, client.Schema()).(*schemerclient.CompatibilityReport)
+		if !ok {
+			log.Print("schema check: the server's schema matches ours field for field")
+			return
+		}
+		for _, line := range report.Lines() {
+			log.Printf("schema check: %s", line)
+		}
+		if !report.Decodable() {
+			log.Fatal(report)
+		}
+	}
+	checkCompatible()
+
+	// the server's schema can change under us, e.g. during a rolling upgrade;
+	// checkSchema makes that visible
+	schemaHash := client.SchemaHash()
+	checkSchema := func() {
+		if h := client.SchemaHash(); h != schemaHash {
+			log.Printf("*** server schema changed (%.12s -> %.12s), now using the new one ***", schemaHash, h)
+			schemaHash = h
+			checkCompatible()
+		}
+	}
+
+	for i := 0; i < *polls; i++ {
+		if i > 0 {
+			time.Sleep(*interval)
+
+			// without the cache the schema is fetched again before every data request,
+			// which is wasteful since it almost never changes
+			refresh := *schemaRefresh > 0 && i%*schemaRefresh == 0
+			if !*schemaCache || refresh {
+				if err := client.RefreshSchema(ctx); err != nil {
+					log.Fatal(err)
+				}
+			}
+			checkSchema()
+		}
+
+		// v1 of the client only knows about a slice of readings. It keeps working when
+		// pointed at the v2 server, because v2 sends its filtered readings under the
+		// "readings" name and schemer decodes them into our float32s.
+		var dest schemas.V1Reading
+		if err := client.Fetch(ctx, &dest); err != nil {
+			log.Fatal(err)
+		}
+		// Fetch refreshes the schema by itself if the data doesn't decode with it
+		checkSchema()
+
+		fmt.Printf("readings: %v\n", dest.Readings)
+	}
+
+	schemaRequests, dataRequests := client.Requests()
+	log.Printf("made %d requests: %d for the schema, %d for data", schemaRequests+dataRequests, schemaRequests, dataRequests)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/signing"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	polls := flag.Int("polls", 1, "number of times to fetch data")
+	interval := flag.Duration("interval", time.Second, "time to wait between polls")
+	schemaCache := flag.Bool("schema-cache", false, "fetch the schema once and reuse it for every poll")
+	schemaRefresh := flag.Int("schema-refresh", 0, "with -schema-cache, refetch the schema every N polls to notice server upgrades (0 = never)")
+	insecure := flag.Bool("insecure", false, "accept any TLS certificate, e.g. a server's self-signed one (unsafe)")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	opts := []schemerclient.Option{schemerclient.WithRetries(3, 250*time.Millisecond)}
+	// with $SIGNING_KEY set (on both sides), data that isn't signed with it is rejected
+	if key := signing.KeyFromEnv(); key != nil {
+		opts = append(opts, schemerclient.WithSigningKey(key))
+	}
+	if *insecure {
+		log.Println("WARNING: -insecure is set, TLS certificates are NOT verified; only use this against a local demo server")
+		opts = append(opts, schemerclient.WithInsecureSkipVerify())
+	}
+
+	// New fetches the schema for us
+	client, err := schemerclient.New(*baseURL, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the sequence number of the previous sample, to report duplicates and gaps
+	var lastSequence uint64
+	var dest schemas.V2Reading
+
+	// before anything is decoded, check what decoding the server's data into our
+	// struct will quietly do (fields skipped or left at zero, numbers narrowed),
+	// and give up now if it can't be done at all, rather than on the first payload
+	checkCompatible := func() {
+		report, ok := schemerclient.CheckCompatible(&dest, client.Schema()).(*schemerclient.CompatibilityReport)
+		if !ok {
+			log.Print("schema check: the server's schema matches ours field for field")
+			return
+		}
+		for _, line := range report.Lines() {
+			log.Printf("schema check: %s", line)
+		}
+		if !report.Decodable() {
+			log.Fatal(report)
+		}
+	}
+	checkCompatible()
+
+	// the server's schema can change under us, e.g. during a rolling upgrade;
+	// checkSchema makes that visible
+	schemaHash := client.SchemaHash()
+	checkSchema := func() {
+		if h := client.SchemaHash(); h != schemaHash {
+			log.Printf("*** server schema changed (%.12s -> %.12s), now using the new one ***", schemaHash, h)
+			schemaHash = h
+			checkCompatible()
+		}
+	}
+
+	for i := 0; i < *polls; i++ {
+		if i > 0 {
+			time.Sleep(*interval)
+
+			// without the cache the schema is fetched again before every data request,
+			// which is wasteful since it almost never changes
+			refresh := *schemaRefresh > 0 && i%*schemaRefresh == 0
+			if !*schemaCache || refresh {
+				if err := client.RefreshSchema(ctx); err != nil {
+					log.Fatal(err)
+				}
+			}
+			checkSchema()
+		}
+
+		// v2 of the client knows about everything the v2 server sends. Pointed at the v1
+		// server it still works: the missing Header and RawReadings are left empty, and
+		// the float32 readings are widened into FilteredReadings.
+		// dest is reused for every poll; resetting it keeps the slices' capacity for
+		// the next decode (see examples/reusedest) without letting a field the
+		// server didn't send this time keep its previous value.
+		schemerclient.ResetForReuse(&dest)
+		if i == 0 {
+			if err := client.Fetch(ctx, &dest); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			// only ask for data newer than what we have; an unchanged sample comes
+			// back as a bodyless 304 and doesn't need decoding at all
+			_, err := client.FetchSince(ctx, lastSequence, &dest)
+			if errors.Is(err, schemerclient.ErrNotModified) {
+				log.Printf("no new sample since sequence %d", lastSequence)
+				continue
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		// Fetch refreshes the schema by itself if the data doesn't decode with it
+		checkSchema()
+
+		switch {
+		case i == 0 || dest.Sequence == 0:
+			// nothing to compare against yet, or a server that doesn't send sequences
+		case dest.Sequence == lastSequence:
+			log.Printf("duplicate sample: sequence %d was already seen", dest.Sequence)
+		case dest.Sequence > lastSequence+1:
+			log.Printf("skipped %d samples (sequence %d -> %d)", dest.Sequence-lastSequence-1, lastSequence, dest.Sequence)
+		case dest.Sequence < lastSequence:
+			log.Printf("sequence went backwards (%d -> %d); was the server restarted?", lastSequence, dest.Sequence)
+		}
+		lastSequence = dest.Sequence
+
+		fmt.Printf("sequence: %d (generated %s)\n", dest.Sequence, time.Unix(0, dest.GeneratedAtUnixMs*int64(time.Millisecond)).Format(time.RFC3339Nano))
+		fmt.Printf("header: %q\n", dest.Header)
+		fmt.Printf("raw readings: %v\n", dest.RawReadings)
+		fmt.Printf("readings: %v\n", dest.FilteredReadings)
+	}
+
+	schemaRequests, dataRequests := client.Requests()
+	log.Printf("made %d requests: %d for the schema, %d for data", schemaRequests+dataRequests, schemaRequests, dataRequests)
+}
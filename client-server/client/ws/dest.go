@@ -0,0 +1,10 @@
+package main
+
+// destStruct deliberately does NOT use schemas.V2Reading: this client only cares
+// about the header and the (filtered) readings, and declares just those. schemer
+// matches fields by name, so RawReadings is skipped and the "readings" field lands
+// in Readings.
+type destStruct struct {
+	Header   string
+	Readings []float64
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/heartbeat"
+	"github.com/bminer/schemer"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+
+	// for a server that doesn't announce a heartbeat interval: it sends a frame
+	// every second, so this much silence means the connection is dead even if
+	// nobody told us
+	readTimeout = 10 * time.Second
+)
+
+// readTimeoutFor returns how long to wait for a message on a connection whose
+// upgrade response was resp: three heartbeat intervals if the server announced
+// one, since even with no data it sends something that often
+func readTimeoutFor(resp *http.Response) time.Duration {
+	if resp != nil {
+		if interval, ok := heartbeat.ParseInterval(resp.Header.Get(heartbeat.Header)); ok {
+			return heartbeat.Timeout(interval)
+		}
+	}
+	return readTimeout
+}
+
+// readFrames reads the schema from the first frame on conn, then decodes and
+// prints every frame after it. Every message, heartbeats included, restarts the
+// timeout; it only returns once the connection fails or nothing arrived within
+// timeout.
+func readFrames(conn *websocket.Conn, timeout time.Duration) error {
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	msgType, binarySchema, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if msgType != websocket.BinaryMessage {
+		return errors.New("expected the first frame to be a binary schema")
+	}
+
+	// the server might have been upgraded since the last time we connected, so
+	// the schema is read fresh on every connection
+	writerSchema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		return fmt.Errorf("cannot decode schema: %w", err)
+	}
+	log.Printf("received %d byte schema", len(binarySchema))
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if msgType == websocket.TextMessage && string(data) == heartbeat.Message {
+			// no data, but the connection is alive
+			continue
+		}
+
+		var dest destStruct
+		if err := writerSchema.Decode(bytes.NewReader(data), &dest); err != nil {
+			return fmt.Errorf("cannot decode data: %w", err)
+		}
+		fmt.Printf("%q %v\n", dest.Header, dest.Readings)
+	}
+}
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws", "websocket endpoint of the server")
+	flag.Parse()
+
+	backoff := initialBackoff
+	for {
+		conn, resp, err := websocket.DefaultDialer.Dial(*url, nil)
+		if err != nil {
+			log.Printf("cannot connect: %v (retrying in %v)", err, backoff)
+			time.Sleep(backoff)
+
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+
+		timeout := readTimeoutFor(resp)
+		log.Printf("connected to %s (reconnecting after %v without a message)", *url, timeout)
+		backoff = initialBackoff
+
+		err = readFrames(conn, timeout)
+		conn.Close()
+		log.Printf("disconnected: %v", err)
+	}
+}
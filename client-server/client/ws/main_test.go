@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/heartbeat"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/gorilla/websocket"
+)
+
+// interval is the heartbeat interval stalledServer announces
+const interval = 50 * time.Millisecond
+
+// stalledServer announces interval, sends the schema and one frame, and then
+// stalls for 20 intervals, sending a heartbeat every interval if heartbeats is
+// set and nothing at all otherwise. Then it hangs up. It returns the URL to
+// dial, and is closed when the test ends.
+func stalledServer(t *testing.T, heartbeats bool) string {
+	upgrader := websocket.Upgrader{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header := http.Header{heartbeat.Header: {heartbeat.FormatInterval(interval)}}
+		conn, err := upgrader.Upgrade(w, req, header)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		writerSchema := schemas.V2WriterSchema()
+		var frame bytes.Buffer
+		if err := writerSchema.Encode(&frame, schemas.V2Reading{Header: "before the stall", Sequence: 1}); err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.BinaryMessage, writerSchema.MarshalSchemer())
+		conn.WriteMessage(websocket.BinaryMessage, frame.Bytes())
+
+		for i := 0; i < 20; i++ {
+			time.Sleep(interval)
+			if heartbeats {
+				conn.WriteMessage(websocket.TextMessage, []byte(heartbeat.Message))
+			}
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "done"))
+	}))
+	t.Cleanup(ts.Close)
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+// connect connects to url the way main does, and returns how long readFrames
+// took to give up on the connection, and why
+func connect(t *testing.T, url string) (time.Duration, error) {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	timeout := readTimeoutFor(resp)
+	if timeout != heartbeat.Timeout(interval) {
+		t.Fatalf("the server announced %v, but the client waits %v", interval, timeout)
+	}
+	start := time.Now()
+	readErr := readFrames(conn, timeout)
+	return time.Since(start), readErr
+}
+
+func TestHeartbeatsKeepAlive(t *testing.T) {
+	took, readErr := connect(t, stalledServer(t, true))
+	// the only way out is the server hanging up at the end of the stall
+	if !websocket.IsCloseError(readErr, websocket.CloseNormalClosure) {
+		t.Fatalf("gave up on the connection after %v: %v", took, readErr)
+	}
+	if took < 20*interval {
+		t.Fatalf("gave up after %v, before the stall was over", took)
+	}
+}
+
+func TestSilenceTimesOut(t *testing.T) {
+	took, readErr := connect(t, stalledServer(t, false))
+	var netErr net.Error
+	if !errors.As(readErr, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout, got %v", readErr)
+	}
+	timeout := heartbeat.Timeout(interval)
+	if took < timeout || took > timeout+5*interval {
+		t.Fatalf("gave up after %v, expected about %v", took, timeout)
+	}
+}
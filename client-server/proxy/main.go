@@ -0,0 +1,211 @@
+// proxy is a migration bridge: it sits between v1 clients and a server of a later
+// version, and serves what the v1 server would. Every /get-data/ request is
+// fetched from the upstream server and decoded with the upstream's schema into a
+// schemas.V1Reading, which re-encodes it with the v1 schema; /get-schema/ serves
+// the v1 schema, as JSON, the way the v1 server does. A genuine, unmodified v1
+// client can't tell it isn't talking to a v1 server.
+//
+// The decode does the conversion: the filtered readings, which v2 sends under
+// the "readings" name, land in the v1 Readings (narrowed from float64 to
+// float32), and every field v1 has no place for (Header, RawReadings, Sequence
+// and so on, and whatever later versions add) is dropped. The proxy logs a note
+// about each of those, once for every upstream schema it sees, and answers 502
+// if the upstream sends something that doesn't decode into a V1Reading at all.
+//
+//	UPSTREAM_URL   the server to fetch from (default http://localhost:8080)
+//	PORT           the port to listen on (default 8081)
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/etag"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/serve"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+const DefaultPort = "8081"
+
+const DefaultUpstream = "http://localhost:8080"
+
+// what the proxy sends, the way the v1 server sends it
+var writerSchema = schemas.V1WriterSchema()
+var jsonWriterSchema []byte
+var schemaFingerprint string // registry.Fingerprint of jsonWriterSchema
+
+// proxy transcodes what upstream sends into what the v1 server sends
+type proxy struct {
+	upstream *schemerclient.Client
+	logger   *log.Logger
+
+	mu         sync.Mutex
+	schemaHash string // of the upstream schema the notes were last logged for
+}
+
+// checkUpstream logs what transcoding from the upstream's current schema drops
+// or changes, if it hasn't already for that schema. It returns the report as the
+// error if the upstream's data doesn't decode into a V1Reading at all.
+func (p *proxy) checkUpstream() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hash := p.upstream.SchemaHash()
+	if hash == p.schemaHash {
+		return nil
+	}
+	report := schemerclient.Compatibility(&schemas.V1Reading{}, p.upstream.Schema())
+	if !report.Decodable() {
+		for _, m := range report.Unconvertible {
+			p.logger.Printf("upstream schema %.12s: can't transcode %s", hash, m)
+		}
+		return report
+	}
+	p.schemaHash = hash
+
+	for _, f := range report.Ignored {
+		p.logger.Printf("upstream schema %.12s: dropping %s, which v1 can't represent", hash, f)
+	}
+	for _, m := range report.Mapped {
+		if m.Note != "" {
+			p.logger.Printf("upstream schema %.12s: coercing %s", hash, m)
+		}
+	}
+	for _, f := range report.Unset {
+		p.logger.Printf("upstream schema %.12s: the upstream doesn't send %s, v1 clients get it empty", hash, f)
+	}
+	return nil
+}
+
+// transcode fetches the upstream's current data and returns it encoded the way
+// the v1 server would encode it
+func (p *proxy) transcode(ctx context.Context) ([]byte, error) {
+	var reading schemas.V1Reading
+	if err := p.upstream.Fetch(ctx, &reading); err != nil {
+		return nil, err
+	}
+	// Fetch fetches the schema again by itself if the upstream was upgraded
+	if err := p.checkUpstream(); err != nil {
+		return nil, err
+	}
+
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, &reading); err != nil {
+		return nil, err
+	}
+	return encodedData.Bytes(), nil
+}
+
+func getSchemaHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if _, err := etag.Serve(w, req, jsonWriterSchema); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+func (p *proxy) getDataHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		data, err := p.transcode(req.Context())
+		if err != nil {
+			middleware.Error(w, "upstream: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set(registry.FingerprintHeader, schemaFingerprint)
+		if _, err := w.Write(data); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+// newMux returns the v1 server's two endpoints. Each answers only its own path,
+// and only GET; every error has a JSON body.
+func newMux(p *proxy) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", middleware.NotFound())
+	middleware.Handle(mux, "/get-schema/", getSchemaHandler(), http.MethodGet)
+	middleware.Handle(mux, "/get-data/", p.getDataHandler(), http.MethodGet)
+	return mux
+}
+
+// newProxy connects to the upstream server at url, and checks its data can be
+// transcoded
+func newProxy(url string, logger *log.Logger) (*proxy, error) {
+	upstream, err := schemerclient.New(url, schemerclient.WithRetries(3, 250*time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	p := &proxy{upstream: upstream, logger: logger}
+	if err := p.checkUpstream(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func run() error {
+	jsonSchema, err := writerSchema.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	jsonWriterSchema = jsonSchema
+	schemaFingerprint = registry.Fingerprint(jsonWriterSchema)
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = DefaultPort
+	}
+	upstreamURL := os.Getenv("UPSTREAM_URL")
+	if upstreamURL == "" {
+		upstreamURL = DefaultUpstream
+	}
+
+	requestTimeout, err := middleware.TimeoutFromEnv()
+	if err != nil {
+		return err
+	}
+
+	logLevel, err := middleware.LogLevelFromEnv()
+	if err != nil {
+		return err
+	}
+
+	p, err := newProxy(upstreamURL, log.Default())
+	if err != nil {
+		return fmt.Errorf("cannot transcode from %s: %w", upstreamURL, err)
+	}
+
+	log.Println("v1 proxy listening on port:", port)
+	log.Println("upstream (UPSTREAM_URL):", upstreamURL)
+	log.Println("endpoint 1: /get-schema/")
+	log.Println("endpoint 2: /get-data/")
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           middleware.Logging(log.Default(), logLevel, middleware.Recover(middleware.Timeout(requestTimeout, newMux(p)))),
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      requestTimeout + 5*time.Second,
+	}
+
+	return serve.ListenAndServe(server)
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/etag"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+var (
+	v2Sample = &schemas.V2Reading{Header: "boiler room", RawReadings: []float64{20.5, 21.3}, FilteredReadings: []float64{20.5, 21.25}, Sequence: 7, GeneratedAtUnixMs: 1700000000000}
+	v3Sample = &schemas.V3Reading{Header: "boiler room", RawReadings: []float64{68.9}, FilteredReadings: []float64{68.9}, Sequence: 8, Unit: "F"}
+)
+
+// what the v1 server would send for v2Sample
+var v1Expected = schemas.V1Reading{Readings: []float32{20.5, 21.25}}
+
+// stringReadings is an upstream whose readings v1 can't decode
+type stringReadings struct {
+	Readings []string
+}
+
+// harness is an upstream standing in for a later server, and a proxy in front
+// of it whose notes go to notes
+type harness struct {
+	upstream *testserver.Upstream
+	proxyURL string
+	notes    bytes.Buffer
+}
+
+// start starts an upstream sending first, and a proxy in front of it, both
+// closed when the test ends
+func start(t *testing.T, first interface{}) *harness {
+	t.Helper()
+	jsonSchema, err := writerSchema.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonWriterSchema = jsonSchema
+
+	h := &harness{upstream: testserver.New(t, first)}
+	p, err := newProxy(h.upstream.URL, log.New(&h.notes, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(newMux(p))
+	t.Cleanup(ts.Close)
+	h.proxyURL = ts.URL
+	return h
+}
+
+// hasNotes checks the proxy logged each of want
+func (h *harness) hasNotes(t *testing.T, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(h.notes.String(), w) {
+			t.Errorf("the proxy didn't log %q; it logged:\n%s", w, h.notes.String())
+		}
+	}
+}
+
+// fetchV1 fetches from the proxy the way the v1 client does
+func fetchV1(t *testing.T, url string) schemas.V1Reading {
+	t.Helper()
+	client, err := schemerclient.New(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dest schemas.V1Reading
+	if err := client.Fetch(context.Background(), &dest); err != nil {
+		t.Fatal(err)
+	}
+	return dest
+}
+
+func TestSchema(t *testing.T) {
+	h := start(t, v2Sample)
+	status, _, body := testserver.Get(t, h.proxyURL+"/get-schema/", nil)
+	if status != http.StatusOK || !bytes.Equal(body, jsonWriterSchema) {
+		t.Fatalf("got %d %s, want the v1 JSON schema %s", status, body, jsonWriterSchema)
+	}
+	// a v1 client with -schema-cache asks with the ETag it has
+	status, _, _ = testserver.Get(t, h.proxyURL+"/get-schema/", http.Header{"If-None-Match": {etag.Of(jsonWriterSchema)}})
+	if status != http.StatusNotModified {
+		t.Fatalf("the schema's own ETag got %d, want 304", status)
+	}
+}
+
+// TestV2 checks the readings are coerced, and the rest dropped and logged
+func TestV2(t *testing.T) {
+	h := start(t, v2Sample)
+	if got := fetchV1(t, h.proxyURL); !reflect.DeepEqual(got, v1Expected) {
+		t.Fatalf("the v1 client got %+v, want %+v", got, v1Expected)
+	}
+	h.hasNotes(t, "dropping Header", "dropping RawReadings", "dropping Sequence", "dropping GeneratedAtUnixMs", "coercing Readings")
+}
+
+// TestPayload checks the proxy sends the very bytes the v1 server would
+func TestPayload(t *testing.T) {
+	h := start(t, v2Sample)
+	var want bytes.Buffer
+	if err := schemas.V1WriterSchema().Encode(&want, &v1Expected); err != nil {
+		t.Fatal(err)
+	}
+	status, _, body := testserver.Get(t, h.proxyURL+"/get-data/", nil)
+	if status != http.StatusOK || !bytes.Equal(body, want.Bytes()) {
+		t.Fatalf("got %d % x, want % x", status, body, want.Bytes())
+	}
+}
+
+// TestUntranscodable switches the upstream to readings v1 can't decode, which
+// the proxy has to answer with a 502, and back
+func TestUntranscodable(t *testing.T) {
+	h := start(t, v2Sample)
+	h.upstream.Set(t, &stringReadings{[]string{"warm"}})
+	if status, _, body := testserver.Get(t, h.proxyURL+"/get-data/", nil); status != http.StatusBadGateway {
+		t.Fatalf("got %d %s, want 502", status, body)
+	}
+
+	h.upstream.Set(t, v2Sample)
+	if got := fetchV1(t, h.proxyURL); !reflect.DeepEqual(got, v1Expected) {
+		t.Fatalf("after the upstream went back to v2, the v1 client got %+v", got)
+	}
+}
+
+// TestV3 checks Unit is dropped too
+func TestV3(t *testing.T) {
+	h := start(t, v3Sample)
+	if got, want := fetchV1(t, h.proxyURL).Readings, []float32{68.9}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("the v1 client got %v, want %v", got, want)
+	}
+	h.hasNotes(t, "dropping Unit")
+}
+
+// TestRefused checks the proxy won't start in front of an upstream v1 can't
+// decode
+func TestRefused(t *testing.T) {
+	u := testserver.New(t, &stringReadings{[]string{"warm"}})
+	if _, err := newProxy(u.URL, log.New(&bytes.Buffer{}, "", 0)); err == nil {
+		t.Fatal("the proxy started in front of an upstream whose readings are strings")
+	}
+}
+
+func TestUpstreamDown(t *testing.T) {
+	h := start(t, v2Sample)
+	h.upstream.Close()
+	if status, _, body := testserver.Get(t, h.proxyURL+"/get-data/", nil); status != http.StatusBadGateway {
+		t.Fatalf("got %d %s, want 502", status, body)
+	}
+}
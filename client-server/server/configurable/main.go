@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/dryrun"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/serve"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+const DefaultPort = "8080"
+
+// where the schema is read from unless SCHEMA_FILE says otherwise
+const DefaultSchemaFile = "schema.json"
+
+// the most elements a generated slice or map gets
+const maxElements = 5
+
+// published is one version of the schema, as loaded from the schema file
+type published struct {
+	schema       schemer.Schema
+	goType       reflect.Type // what schema decodes into; the data is generated as one of these
+	binarySchema []byte
+	fingerprint  string // registry.Fingerprint of binarySchema
+}
+
+// server serves random data conforming to whatever schema the schema file held
+// when it was last loaded
+type server struct {
+	path string
+
+	mu      sync.Mutex
+	current *published
+	rnd     *rand.Rand
+}
+
+// load reads the schema file and checks that data can be generated and encoded
+// for it
+func load(path string) (*published, error) {
+	jsonSchema, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := schemer.DecodeSchemaJSON(jsonSchema)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode schema: %w", err)
+	}
+	t := schema.GoType()
+	if t == nil {
+		return nil, errors.New("schema has no Go type to generate data for")
+	}
+	sample := randomValue(rand.New(rand.NewSource(1)), t)
+	if err := dryrun.Encode(schema, sample.Addr().Interface()); err != nil {
+		return nil, fmt.Errorf("data generated for the schema doesn't encode: %w", err)
+	}
+
+	p := &published{schema: schema, goType: t, binarySchema: schema.MarshalSchemer()}
+	p.fingerprint = registry.Fingerprint(p.binarySchema)
+	return p, nil
+}
+
+func newServer(path string, seed int64) (*server, error) {
+	p, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &server{path: path, current: p, rnd: rand.New(rand.NewSource(seed))}, nil
+}
+
+// reload loads the schema file again. If it can't be loaded, the server keeps
+// publishing the schema it had.
+func (s *server) reload() error {
+	p, err := load(s.path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.current = p
+	s.mu.Unlock()
+	return nil
+}
+
+// reloadOn reloads the schema file whenever a signal arrives on signals, until
+// the channel is closed
+func (s *server) reloadOn(signals <-chan os.Signal) {
+	for range signals {
+		if err := s.reload(); err != nil {
+			log.Printf("cannot reload %s, keeping schema %.12s: %v", s.path, s.fingerprint(), err)
+			continue
+		}
+		log.Printf("reloaded %s: now publishing schema %.12s", s.path, s.fingerprint())
+	}
+}
+
+func (s *server) fingerprint() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current.fingerprint
+}
+
+// randomValue returns an addressable value of type t with random contents
+func randomValue(rnd *rand.Rand, t reflect.Type) reflect.Value {
+	v := reflect.New(t).Elem()
+	fill(rnd, v)
+	return v
+}
+
+// fill sets v, which must be settable, to random contents of its type
+func fill(rnd *rand.Rand, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(rnd.Intn(2) == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(rnd.Int63n(100))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(uint64(rnd.Int63n(100)))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(rnd.Intn(4000)) / 100)
+	case reflect.Complex64, reflect.Complex128:
+		v.SetComplex(complex(float64(rnd.Intn(100)), float64(rnd.Intn(100))))
+	case reflect.String:
+		v.SetString(fmt.Sprintf("value %d", rnd.Intn(1000)))
+	case reflect.Slice:
+		n := rnd.Intn(maxElements + 1)
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		for i := 0; i < n; i++ {
+			fill(rnd, v.Index(i))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fill(rnd, v.Index(i))
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		for i := rnd.Intn(maxElements + 1); i > 0; i-- {
+			key := randomValue(rnd, v.Type().Key())
+			v.SetMapIndex(key, randomValue(rnd, v.Type().Elem()))
+		}
+	case reflect.Ptr:
+		// a nullable field: leave it nil now and then
+		if rnd.Intn(4) > 0 {
+			v.Set(reflect.New(v.Type().Elem()))
+			fill(rnd, v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fill(rnd, v.Field(i))
+			}
+		}
+	}
+}
+
+func (s *server) getSchemaHandler(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	p := s.current
+	s.mu.Unlock()
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set(registry.FingerprintHeader, p.fingerprint)
+	w.Write(p.binarySchema)
+}
+
+// getDataHandler generates a new value for every request, with the schema
+// current when the request came in
+func (s *server) getDataHandler(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	p := s.current
+	sample := randomValue(s.rnd, p.goType)
+	s.mu.Unlock()
+
+	var encodedData bytes.Buffer
+	if err := p.schema.Encode(&encodedData, sample.Addr().Interface()); err != nil {
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set(registry.FingerprintHeader, p.fingerprint)
+	w.Write(encodedData.Bytes())
+}
+
+func (s *server) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/get-schema/", s.getSchemaHandler)
+	mux.HandleFunc("/get-data/", s.getDataHandler)
+	return mux
+}
+
+// writeStarterSchema writes the JSON schema of schemas.V2Reading to path, as
+// something to edit
+func writeStarterSchema(path string) error {
+	jsonSchema, err := schemas.V2WriterSchema().MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	return ioutil.WriteFile(path, jsonSchema, 0o644)
+}
+
+func printIntro() {
+
+	s := `
+This is an example of a server whose struct isn't compiled in: it reads a JSON schema from the file
+SCHEMA_FILE (schema.json by default) at startup, publishes it at /get-schema/, and answers every
+/get-data/ with random data that conforms to it. Edit the file and send the server SIGHUP to publish
+the new schema without a rebuild or a restart; if the file doesn't load, the server logs why and keeps
+the schema it had. Run it with -init to write a starting schema (that of schemas.V2Reading). It listens
+on port 8080, or the port in the environment variable PORT.
+	`
+	fmt.Println(s)
+
+}
+
+func run(path string) error {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = DefaultPort
+	}
+
+	requestTimeout, err := middleware.TimeoutFromEnv()
+	if err != nil {
+		return err
+	}
+
+	logLevel, err := middleware.LogLevelFromEnv()
+	if err != nil {
+		return err
+	}
+
+	s, err := newServer(path, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("cannot load %s (run with -init to write one): %w", path, err)
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go s.reloadOn(hangups)
+
+	printIntro()
+
+	log.Println("configurable server listening on port:", port)
+	log.Printf("publishing schema %.12s from %s; send SIGHUP (kill -HUP %d) to reload it", s.fingerprint(), path, os.Getpid())
+	log.Println("endpoint 1: /get-schema/")
+	log.Println("endpoint 2: /get-data/")
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           middleware.Logging(log.Default(), logLevel, middleware.Recover(middleware.Timeout(requestTimeout, s.mux()))),
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      requestTimeout + 5*time.Second,
+	}
+
+	return serve.ListenAndServe(server)
+}
+
+func main() {
+	initSchema := flag.Bool("init", false, "write a starting schema to SCHEMA_FILE, then exit")
+	flag.Parse()
+
+	path := os.Getenv("SCHEMA_FILE")
+	if path == "" {
+		path = DefaultSchemaFile
+	}
+
+	switch {
+	case *initSchema:
+		if err := writeStarterSchema(path); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("wrote", path)
+	default:
+		if err := run(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+// writeSchemaOf writes the JSON schema of v to path
+func writeSchemaOf(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	jsonSchema, err := schemer.SchemaOf(v).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, jsonSchema, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, url string) ([]byte, string) {
+	t.Helper()
+	status, header, body := testserver.Get(t, url, nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", url, status, bytes.TrimSpace(body))
+	}
+	return body, header.Get(registry.FingerprintHeader)
+}
+
+// fetch gets the schema and a sample from the server at url, and returns the
+// schema's fingerprint and the decoded sample
+func fetch(t *testing.T, url string) (string, reflect.Value) {
+	t.Helper()
+	binarySchema, fingerprint := get(t, url+schemerclient.SchemaPath)
+	schema, err := schemerclient.DecodeSchema(binarySchema)
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+
+	data, dataFingerprint := get(t, url+schemerclient.DataPath)
+	if dataFingerprint != fingerprint {
+		t.Fatalf("data sent with schema %.12s, want %.12s", dataFingerprint, fingerprint)
+	}
+	dest := reflect.New(schema.GoType())
+	if err := schema.Decode(bytes.NewReader(data), dest.Interface()); err != nil {
+		t.Fatalf("cannot decode data: %v", err)
+	}
+	return fingerprint, dest.Elem()
+}
+
+// serves checks that a few samples decode, and have the field named field
+func serves(t *testing.T, url, field string) {
+	t.Helper()
+	for i := 0; i < 20; i++ {
+		_, v := fetch(t, url)
+		if v.Kind() != reflect.Struct || !v.FieldByName(field).IsValid() {
+			t.Fatalf("decoded %#v, which has no field %s", v.Interface(), field)
+		}
+	}
+}
+
+// TestReload starts the server on a schema file in a temporary directory, then
+// replaces the file and sends SIGHUP, then spoils it in several ways. The
+// subtests run in order, each starting from where the last left off.
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	writeSchemaOf(t, path, &schemas.V1Reading{})
+	s, err := newServer(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.mux())
+	defer ts.Close()
+
+	hangups := make(chan os.Signal)
+	defer close(hangups)
+	go s.reloadOn(hangups)
+
+	t.Run("initial schema", func(t *testing.T) {
+		serves(t, ts.URL, "Readings")
+	})
+
+	t.Run("reload on SIGHUP", func(t *testing.T) {
+		before, _ := fetch(t, ts.URL)
+		writeSchemaOf(t, path, &schemas.V2Reading{})
+		hangups <- syscall.SIGHUP
+
+		deadline := time.Now().Add(2 * time.Second)
+		for s.fingerprint() == before {
+			if time.Now().After(deadline) {
+				t.Fatalf("still publishing schema %.12s after SIGHUP", before)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		serves(t, ts.URL, "Sequence")
+	})
+
+	t.Run("bad reload keeps the schema", func(t *testing.T) {
+		before, _ := fetch(t, ts.URL)
+		for _, c := range []struct {
+			name  string
+			spoil func() error
+		}{
+			{"not JSON", func() error { return ioutil.WriteFile(path, []byte("{not json"), 0o644) }},
+			{"empty", func() error { return ioutil.WriteFile(path, nil, 0o644) }},
+			{"removed", func() error { return os.Remove(path) }},
+		} {
+			if err := c.spoil(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.reload(); err == nil {
+				t.Fatalf("%s: reload succeeded", c.name)
+			}
+			if after, _ := fetch(t, ts.URL); after != before {
+				t.Fatalf("%s: publishing schema %.12s, want the previous %.12s", c.name, after, before)
+			}
+		}
+		serves(t, ts.URL, "Sequence")
+	})
+}
+
+func TestMissingSchema(t *testing.T) {
+	if _, err := newServer(filepath.Join(t.TempDir(), "missing.json"), 1); err == nil {
+		t.Fatal("started without a schema file")
+	}
+}
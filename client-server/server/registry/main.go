@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/serve"
+)
+
+// the registry listens next to the example servers rather than on their port
+const DefaultPort = "8090"
+
+// where the schemas are kept unless REGISTRY_DIR says otherwise
+const DefaultDir = "schema-registry"
+
+func printIntro() {
+
+	s := `
+This is a minimal schema registry. Producers POST their binary schema to /schemas once at startup and
+stamp every payload with its fingerprint (the SHA-256 of the schema, in the X-Schema-Fingerprint header);
+consumers that see a fingerprint they don't know GET /schemas/{fingerprint} from here instead of asking
+the producer. The schemas are kept in the directory REGISTRY_DIR, so they survive restarts. It listens
+on port 8090, or the port in the environment variable PORT. Start server v2 with REGISTRY_URL set to
+this registry's address to try it.
+	`
+	fmt.Println(s)
+
+}
+
+func run() error {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = DefaultPort
+	}
+
+	dir := os.Getenv("REGISTRY_DIR")
+	if dir == "" {
+		dir = DefaultDir
+	}
+
+	requestTimeout, err := middleware.TimeoutFromEnv()
+	if err != nil {
+		return err
+	}
+
+	logLevel, err := middleware.LogLevelFromEnv()
+	if err != nil {
+		return err
+	}
+
+	store, err := registry.Open(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/schemas", registry.Handler(store))
+	mux.HandleFunc("/schemas/", registry.Handler(store))
+
+	printIntro()
+
+	log.Println("schema registry listening on port:", port)
+	log.Printf("keeping schemas in %s (REGISTRY_DIR), %d registered so far", dir, len(entries))
+	log.Println("endpoint 1: POST /schemas")
+	log.Println("endpoint 2: GET /schemas")
+	log.Println("endpoint 3: GET /schemas/{fingerprint}")
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           middleware.Logging(log.Default(), logLevel, middleware.Recover(middleware.Timeout(requestTimeout, mux))),
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      requestTimeout + 5*time.Second,
+	}
+
+	return serve.ListenAndServe(server)
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/selftest"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/serve"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+const DefaultPort = "8080"
+
+// sensor is one simulated sensor, with its own struct, schema and update loop
+type sensor struct {
+	name         string
+	interval     time.Duration
+	binarySchema []byte
+	fingerprint  string // registry.Fingerprint of binarySchema
+
+	mu     sync.Mutex
+	value  interface{} // pointer to the sensor's struct
+	schema schemer.Schema
+	update func() // refreshes value; called with mu held
+}
+
+func newSensor(name string, interval time.Duration, value interface{}, update func()) *sensor {
+	s := &sensor{name: name, interval: interval, value: value, update: update}
+	s.schema = schemer.SchemaOf(value)
+	s.binarySchema = s.schema.MarshalSchemer()
+	s.fingerprint = registry.Fingerprint(s.binarySchema)
+	return s
+}
+
+// run updates the sensor every interval, forever
+func (s *sensor) run() {
+	for {
+		s.mu.Lock()
+		s.update()
+		s.mu.Unlock()
+		time.Sleep(s.interval)
+	}
+}
+
+// sensors returns the simulated sensors. Each gets its own generator from the
+// shared simulator, tuned to look like that kind of sensor, and seeded from seed.
+func sensors(seed int64) []*sensor {
+
+	temperature := &schemas.TemperatureReading{}
+	tempGen := sim.New(sim.DefaultConfig, seed)
+
+	humidity := &schemas.HumidityReading{}
+	humidityGen := sim.New(sim.Config{Baseline: 45, Amplitude: 10, Period: 300, Noise: 1}, seed+1)
+
+	door := &schemas.DoorEvents{}
+	// the door counts as open whenever the trace spikes
+	doorGen := sim.New(sim.Config{Baseline: 0, Period: 1, Noise: 0.1, SpikeProbability: 0.05, SpikeSize: 1}, seed+2)
+
+	return []*sensor{
+		newSensor("temperature", time.Second, temperature, func() {
+			temperature.Readings = tempGen.Next(tempGen.Intn(10))
+		}),
+		newSensor("humidity", 2*time.Second, humidity, func() {
+			raw := humidityGen.Next(humidityGen.Intn(10))
+			humidity.Readings = make([]float32, len(raw))
+			for i, v := range raw {
+				humidity.Readings[i] = float32(v)
+			}
+		}),
+		newSensor("door", 500*time.Millisecond, door, func() {
+			raw := doorGen.Next(doorGen.Intn(10))
+			door.Events = make([]bool, len(raw))
+			for i, v := range raw {
+				door.Events[i] = v > 0.5 || v < -0.5
+			}
+		}),
+	}
+}
+
+// indexEntry describes one sensor in the /sensors index
+type indexEntry struct {
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+func getIndexHandler(byName map[string]*sensor) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		var index []indexEntry
+		for _, s := range byName {
+			index = append(index, indexEntry{Name: s.name, Fingerprint: s.fingerprint})
+		}
+		sort.Slice(index, func(i, j int) bool { return index[i].Name < index[j].Name })
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(index); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+func getSchemaHandler(s *sensor) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Write(s.binarySchema)
+	}
+}
+
+func getDataHandler(s *sensor) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		s.mu.Lock()
+		var encodedData bytes.Buffer
+		err := s.schema.Encode(&encodedData, s.value)
+		s.mu.Unlock()
+
+		if err != nil {
+			middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set(registry.FingerprintHeader, s.fingerprint)
+		w.Write(encodedData.Bytes())
+	}
+}
+
+// newMux sets up /sensors, and /sensors/{name}/schema and /sensors/{name}/data
+// for every sensor in byName. Each answers only its own path, and only GET (see
+// middleware.Endpoint); any other path, an unknown sensor's included, gets a
+// 404, and every error has a JSON body.
+func newMux(byName map[string]*sensor) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", middleware.NotFound())
+	middleware.Handle(mux, "/sensors", getIndexHandler(byName), http.MethodGet)
+	for name, s := range byName {
+		middleware.Handle(mux, "/sensors/"+name+"/schema", getSchemaHandler(s), http.MethodGet)
+		middleware.Handle(mux, "/sensors/"+name+"/data", getDataHandler(s), http.MethodGet)
+	}
+	return mux
+}
+
+func printIntro() {
+
+	s := `
+This is an example of one server sending data from several kinds of sensor, each with a struct and a schema
+of its own. It listens either on port 8080 (the default), or some other port specified in the environment
+called PORT. /sensors lists the sensors and the fingerprints of their schemas; a client that doesn't know
+a fingerprint yet fetches /sensors/{name}/schema before decoding /sensors/{name}/data.
+	`
+	fmt.Println(s)
+
+}
+
+func run() error {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = DefaultPort
+	}
+
+	requestTimeout, err := middleware.TimeoutFromEnv()
+	if err != nil {
+		return err
+	}
+
+	logLevel, err := middleware.LogLevelFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// RANDOM_SEED makes the samples the same every run
+	seed, err := sim.SeedFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// every sensor's struct has to round-trip before any of them is served
+	all := sensors(seed)
+	var values []interface{}
+	for _, s := range all {
+		values = append(values, s.value)
+	}
+	if err := selftest.Run(values...); err != nil {
+		return fmt.Errorf("startup self-test failed: %w", err)
+	}
+
+	// one update loop per sensor
+	byName := map[string]*sensor{}
+	for _, s := range all {
+		byName[s.name] = s
+		go s.run()
+	}
+
+	mux := newMux(byName)
+
+	printIntro()
+
+	log.Println("sensor server listening on port:", port)
+	log.Println("endpoint 1: /sensors")
+	log.Println("endpoint 2: /sensors/{name}/schema")
+	log.Println("endpoint 3: /sensors/{name}/data")
+	log.Println("random seed (RANDOM_SEED):", seed)
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           middleware.Logging(log.Default(), logLevel, middleware.Recover(middleware.Timeout(requestTimeout, mux))),
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      requestTimeout + 5*time.Second,
+	}
+
+	return serve.ListenAndServe(server)
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
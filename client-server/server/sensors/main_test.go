@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/routecheck"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+	"github.com/bminer/schemer"
+)
+
+// start serves newMux for the sensors, each updated until it has at least one
+// reading, until the end of the test. It returns the server's URL and the
+// sensors by name. The update loops aren't started, so the values stay put.
+func start(t *testing.T) (string, map[string]*sensor) {
+	t.Helper()
+	byName := map[string]*sensor{}
+	for _, s := range sensors(1) {
+		for reflect.ValueOf(s.value).Elem().Field(0).Len() == 0 {
+			s.update()
+		}
+		byName[s.name] = s
+	}
+
+	ts := httptest.NewServer(newMux(byName))
+	t.Cleanup(ts.Close)
+	return ts.URL, byName
+}
+
+func TestRoutes(t *testing.T) {
+	url, _ := start(t)
+	get := []string{http.MethodGet}
+	routes := []routecheck.Route{
+		{Path: "/sensors", Allowed: get, Status: http.StatusOK},
+		{Path: "/"},
+		{Path: "/sensors/"},
+		{Path: "/sensors/temperature"},
+	}
+	for _, name := range []string{"temperature", "humidity", "door"} {
+		routes = append(routes,
+			routecheck.Route{Path: "/sensors/" + name + "/schema", Allowed: get, Status: http.StatusOK},
+			routecheck.Route{Path: "/sensors/" + name + "/data", Allowed: get, Status: http.StatusOK},
+		)
+	}
+	if err := routecheck.Check(url, routes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnknownSensor(t *testing.T) {
+	url, _ := start(t)
+	for _, path := range []string{"/sensors/thermostat/schema", "/sensors/thermostat/data"} {
+		status, _, body := testserver.Get(t, url+path, nil)
+		var e middleware.ErrorBody
+		if status != http.StatusNotFound || json.Unmarshal(body, &e) != nil || e.Code != http.StatusNotFound {
+			t.Errorf("GET %s: %d %s, want a 404 with an error body", path, status, bytes.TrimSpace(body))
+		}
+	}
+}
+
+// TestRoundTrip decodes every sensor listed in the index with the schema it
+// serves, and checks it gets the sensor's current value, and the fingerprint the
+// index lists
+func TestRoundTrip(t *testing.T) {
+	url, byName := start(t)
+
+	status, _, indexJSON := testserver.Get(t, url+"/sensors", nil)
+	var index []indexEntry
+	if status != http.StatusOK || json.Unmarshal(indexJSON, &index) != nil {
+		t.Fatalf("GET /sensors: %d %s", status, bytes.TrimSpace(indexJSON))
+	}
+	if len(index) != len(byName) {
+		t.Fatalf("the index lists %d sensors, want %d", len(index), len(byName))
+	}
+
+	for _, e := range index {
+		t.Run(e.Name, func(t *testing.T) {
+			s, ok := byName[e.Name]
+			if !ok {
+				t.Fatalf("the index lists a sensor %q that doesn't exist", e.Name)
+			}
+
+			status, _, binarySchema := testserver.Get(t, url+"/sensors/"+e.Name+"/schema", nil)
+			if status != http.StatusOK {
+				t.Fatalf("GET schema: %d %s", status, bytes.TrimSpace(binarySchema))
+			}
+			if fp := registry.Fingerprint(binarySchema); fp != e.Fingerprint {
+				t.Errorf("the schema's fingerprint is %.12s, the index lists %.12s", fp, e.Fingerprint)
+			}
+			schema, err := schemer.DecodeSchema(binarySchema)
+			if err != nil {
+				t.Fatalf("cannot decode schema: %v", err)
+			}
+
+			status, header, data := testserver.Get(t, url+"/sensors/"+e.Name+"/data", nil)
+			if status != http.StatusOK {
+				t.Fatalf("GET data: %d %s", status, bytes.TrimSpace(data))
+			}
+			if fp := header.Get(registry.FingerprintHeader); fp != e.Fingerprint {
+				t.Errorf("data sent with schema %.12s, want %.12s", fp, e.Fingerprint)
+			}
+
+			dest := reflect.New(reflect.TypeOf(s.value).Elem())
+			if err := schema.Decode(bytes.NewReader(data), dest.Interface()); err != nil {
+				t.Fatalf("cannot decode data: %v", err)
+			}
+			if !reflect.DeepEqual(dest.Interface(), s.value) {
+				t.Errorf("decoded %+v, want %+v", dest.Elem(), reflect.ValueOf(s.value).Elem())
+			}
+		})
+	}
+}
@@ -1,5 +0,0 @@
-module github.com/bminer/server
-
-go 1.16
-
-require github.com/bminer/schemer v0.0.0-20210611192654-982f4821acdc
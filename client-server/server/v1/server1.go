@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"expvar"
 	"fmt"
 	"log"
 	"math/rand"
@@ -10,63 +12,66 @@ import (
 	"sync"
 	"time"
 
-	"github.com/bminer/schemer"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/etag"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/selftest"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/serve"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
 )
 
 const DefaultPort = "8080"
 
-// v1 of this server only sends out a slice of readings
-type sourceStruct struct {
-	Readings []float32 // temp sensor readings
-}
+// how often asyncUpdate produces a new sample
+const updateInterval = time.Second
 
+// v1 of this server only sends out a slice of readings (see schemas.V1Reading)
 var mu sync.Mutex
-var structToEncode = sourceStruct{}
-var writerSchema = schemer.SchemaOf(&structToEncode)
+var structToEncode = schemas.V1Reading{}
+var writerSchema = schemas.V1WriterSchema()
 var binaryWriterSchema []byte
+var schemaFingerprint string // registry.Fingerprint of binaryWriterSchema
+var generator *sim.Generator
+
+// opened by the first sample; /get-data/ answers 503 until then
+var warm middleware.Gate
 
 func asyncUpdate() {
 
 	mu.Lock()
 	defer mu.Unlock()
 
-	numFloats := rand.Intn(10)
+	numFloats := generator.Intn(10)
 	structToEncode.Readings = make([]float32, numFloats)
 
-	for i := 0; i < numFloats; i++ {
-		structToEncode.Readings[i] = float32(rand.Intn(10000000))
+	for i, reading := range generator.Next(numFloats) {
+		structToEncode.Readings[i] = float32(reading)
 	}
 
+	warm.Open()
 }
 
 func getSchemaHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 
-		if req.Method != http.MethodGet {
-			http.Error(w, "Invalid Invocation", http.StatusNotFound)
-			return
-		}
-
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 
-		buf := bytes.NewBuffer(binaryWriterSchema)
-		_, err := w.Write(buf.Bytes())
-
-		if err != nil {
-			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		// the schema hardly ever changes, so a client that already has it (and sends
+		// its ETag in If-None-Match) gets a 304 instead of the same bytes again
+		if _, err := etag.Serve(w, req, binaryWriterSchema); err != nil {
 			log.Println("i/o error: " + err.Error())
-			return
 		}
-
-		log.Printf("successfully returned binary schema")
 	}
 }
 
 func getDataHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 
-		if req.Method != http.MethodGet {
-			http.Error(w, "Invalid Invocation", http.StatusNotFound)
+		// don't bother encoding for a client that has already gone away
+		ctx := req.Context()
+		if ctx.Err() != nil {
+			log.Println("request abandoned before encoding: " + ctx.Err().Error())
 			return
 		}
 
@@ -75,26 +80,78 @@ func getDataHandler() http.HandlerFunc {
 		var encodedData bytes.Buffer
 		err := writerSchema.Encode(&encodedData, structToEncode)
 		if err != nil {
-			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+			middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
 			defer mu.Unlock()
 			return
 		}
 
 		mu.Unlock()
 
-		n, err := w.Write(encodedData.Bytes())
-		log.Printf("%d bytes written ", n)
+		// the encode may have taken long enough for the client to leave or for the
+		// request to time out; either way nobody wants the payload anymore
+		if ctx.Err() != nil {
+			middleware.Error(w, "request timed out", http.StatusServiceUnavailable)
+			log.Println("request abandoned after encoding: " + ctx.Err().Error())
+			return
+		}
 
-		if err != nil {
-			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		// which schema decodes this payload, for the request log and for
+		// consumers that look schemas up in a registry
+		w.Header().Set(registry.FingerprintHeader, schemaFingerprint)
+
+		if _, err := w.Write(encodedData.Bytes()); err != nil {
 			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+// getDataJSONHandler shows what /get-data/ is carrying right now as indented
+// JSON, for comparing against the binary payload while debugging. It is only
+// registered with DEBUG_ENDPOINTS=1.
+func getDataJSONHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		mu.Lock()
+		b, err := json.MarshalIndent(structToEncode, "", "  ")
+		mu.Unlock()
+
+		if err != nil {
+			middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		log.Printf("successfully returned binary data")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
 	}
 }
 
+// routes says which of the optional endpoints newMux registers, and how it
+// wraps /get-data/
+type routes struct {
+	limiter      *middleware.RateLimiter // RATE_LIMIT; nil for none
+	slow, jitter time.Duration           // SLOW_MS and SLOW_JITTER
+	debug        bool                    // DEBUG_ENDPOINTS=1
+}
+
+// newMux sets up our endpoints. Each answers only its own path, and only GET
+// (see middleware.Endpoint); any other path gets a 404, and every error has a
+// JSON body.
+func newMux(r routes) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", middleware.NotFound())
+	middleware.Handle(mux, "/get-schema/", getSchemaHandler(), http.MethodGet)
+	middleware.Handle(mux, "/get-data/", middleware.WarmUp(&warm, middleware.RateLimit(r.limiter, middleware.Latency(r.slow, r.jitter, getDataHandler()))), http.MethodGet)
+
+	if r.debug {
+		middleware.Handle(mux, "/get-data-json/", middleware.WarmUp(&warm, getDataJSONHandler()), http.MethodGet)
+		middleware.Handle(mux, "/debug/vars", expvar.Handler(), http.MethodGet)
+	}
+	return mux
+}
+
 func printIntro() {
 
 	s := `
@@ -110,29 +167,122 @@ expects the original data.)
 
 }
 
-func main() {
+func run() error {
+	// a struct that doesn't round-trip fails here, rather than in the first client
+	if err := selftest.Run(&schemas.V1Reading{}); err != nil {
+		return fmt.Errorf("startup self-test failed: %w", err)
+	}
+
 	binaryWriterSchema, _ = writerSchema.MarshalJSON()
+	schemaFingerprint = registry.Fingerprint(binaryWriterSchema)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = DefaultPort
 	}
 
-	rand.Seed(time.Now().UnixNano())
+	requestTimeout, err := middleware.TimeoutFromEnv()
+	if err != nil {
+		return err
+	}
+
+	logLevel, err := middleware.LogLevelFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// SLOW_MS (and SLOW_JITTER) make /get-data/ answer slowly, for testing clients
+	slow, jitter, err := middleware.LatencyFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// RATE_LIMIT (and RATE_BURST, TRUST_PROXY) cap how often one IP can make us
+	// encode a sample; every data endpoint draws on the same per-IP budget
+	limiter, err := middleware.RateLimiterFromEnv()
+	if err != nil {
+		return err
+	}
+
+	warmUp, err := middleware.WarmUpFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// RANDOM_SEED makes the samples the same every run
+	seed, err := sim.SeedFromEnv()
+	if err != nil {
+		return err
+	}
+	// the generator draws everything in a sample; the global source is left to
+	// SLOW_JITTER
+	rand.Seed(seed)
+	generator = sim.New(sim.DefaultConfig, seed)
 
 	// constantly write out new data
-	go asyncUpdate()
+	// WARMUP=sync makes the first sample before we start listening; with the
+	// default WARMUP=gate, /get-data/ gets a 503 until the first sample is there
+	firstUpdate := time.Duration(0)
+	if warmUp == middleware.WarmUpSync {
+		asyncUpdate()
+		firstUpdate = updateInterval
+	}
+	go func() {
+		time.Sleep(firstUpdate)
+		for {
+			asyncUpdate()
+			time.Sleep(updateInterval)
+		}
+	}()
+
+	// off by default: DEBUG_ENDPOINTS=1 hands out the data without schemer, as
+	// plain JSON
+	debugEndpoints := os.Getenv("DEBUG_ENDPOINTS") == "1"
+	if debugEndpoints {
+		// request counts and timings per endpoint (from middleware.Timing), and how
+		// many readings the current sample holds
+		expvar.Publish("readings", expvar.Func(func() interface{} {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(structToEncode.Readings)
+		}))
+	}
 
-	// setup our endpoints
-	mux := http.NewServeMux()
-	mux.HandleFunc("/get-schema/", getSchemaHandler())
-	mux.HandleFunc("/get-data/", getDataHandler())
+	mux := newMux(routes{limiter: limiter, slow: slow, jitter: jitter, debug: debugEndpoints})
 
 	printIntro()
 
-	log.Println("example server listing on port:", port)
-	log.Println("endpont 1: /get-schema/")
-	log.Println("endpont 2: /get-data/")
+	log.Println("example server listening on port:", port)
+	log.Println("endpoint 1: /get-schema/")
+	log.Println("endpoint 2: /get-data/")
+	if debugEndpoints {
+		log.Println("endpoint 3: /get-data-json/ (DEBUG_ENDPOINTS=1)")
+		log.Println("endpoint 4: /debug/vars (DEBUG_ENDPOINTS=1)")
+	}
+	log.Println("request timeout (REQUEST_TIMEOUT):", requestTimeout)
+	log.Println("warm-up (WARMUP):", warmUp)
+	log.Println("random seed (RANDOM_SEED):", seed)
+	if slow > 0 || jitter > 0 {
+		log.Printf("slowing down /get-data/ by %s plus up to %s (SLOW_MS, SLOW_JITTER)", slow, jitter)
+	}
+	if limiter != nil {
+		log.Printf("rate limiting /get-data/ per client IP to %s (RATE_LIMIT, RATE_BURST, TRUST_PROXY)", limiter)
+	}
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           middleware.Logging(log.Default(), logLevel, middleware.Recover(middleware.Timeout(requestTimeout, middleware.Timing(mux)))),
+		ReadHeaderTimeout: 5 * time.Second,
+		// leave the handler time to notice its own timeout and answer
+		WriteTimeout: requestTimeout + 5*time.Second,
+	}
 
-	log.Fatal(http.ListenAndServe(":"+port, mux))
+	// HTTPS if TLS_CERT/TLS_KEY or TLS_SELF_SIGNED say so
+	return serve.ListenAndServe(server)
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/routecheck"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// start sets the server up the way run does, with no sample yet, and serves
+// newMux(r) until the end of the test. It returns the server's URL.
+func start(t *testing.T, r routes) string {
+	t.Helper()
+	binaryWriterSchema, _ = writerSchema.MarshalJSON()
+	schemaFingerprint = registry.Fingerprint(binaryWriterSchema)
+	generator = sim.New(sim.DefaultConfig, 1)
+
+	mu.Lock()
+	structToEncode = schemas.V1Reading{}
+	mu.Unlock()
+	warm = middleware.Gate{}
+
+	ts := httptest.NewServer(newMux(r))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// TestRoutes requests every endpoint, with the debug endpoints registered, and a
+// few paths that aren't endpoints with every method. The data endpoints answer
+// 503 until the first sample, and 200 from then on.
+func TestRoutes(t *testing.T) {
+	url := start(t, routes{debug: true})
+	get := []string{http.MethodGet}
+	check := func(t *testing.T, dataStatus int) {
+		err := routecheck.Check(url, []routecheck.Route{
+			{Path: "/get-schema/", Allowed: get, Status: http.StatusOK},
+			{Path: "/get-data/", Allowed: get, Status: dataStatus},
+			{Path: "/get-data-json/", Allowed: get, Status: dataStatus},
+			{Path: "/debug/vars", Allowed: get, Status: http.StatusOK},
+
+			{Path: "/"},
+			{Path: "/no-such-endpoint"},
+			{Path: "/get-data/garbage"},
+			{Path: "/get-schema/v1"},
+			{Path: "/get-bundle/"}, // only the v2 server has it
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("warming up", func(t *testing.T) { check(t, http.StatusServiceUnavailable) })
+	asyncUpdate()
+	t.Run("warm", func(t *testing.T) { check(t, http.StatusOK) })
+}
+
+// TestData decodes /get-data/ and checks it is the current sample, with the
+// schema's fingerprint in the response
+func TestData(t *testing.T) {
+	url := start(t, routes{})
+	for i := 0; i < 3; i++ {
+		asyncUpdate()
+		mu.Lock()
+		want := structToEncode
+		mu.Unlock()
+
+		status, header, data := testserver.Get(t, url+"/get-data/", nil)
+		if status != http.StatusOK {
+			t.Fatalf("status %d %s", status, data)
+		}
+		if fp := header.Get(registry.FingerprintHeader); fp != schemaFingerprint {
+			t.Errorf("fingerprint %q, want %q", fp, schemaFingerprint)
+		}
+		var got schemas.V1Reading
+		if err := writerSchema.Decode(bytes.NewReader(data), &got); err != nil {
+			t.Fatal(err)
+		}
+		// an empty sample decodes with an empty slice rather than nil
+		if len(got.Readings) != len(want.Readings) || (len(want.Readings) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Fatalf("decoded %+v, the sample is %+v", got, want)
+		}
+	}
+}
@@ -2,19 +2,48 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/bminer/schemer"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/broker"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/bufpool"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/etag"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/export"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/profiling"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/selftest"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/serve"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/signing"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
 )
 
 const DefaultPort = "8080"
 
+// how often asyncUpdate produces a new sample
+const updateInterval = time.Second
+
+// how many of the most recent samples are kept for /export/?limit=
+const historySize = 100
+
+// how many samples a /stream-data/ client may fall behind by before the oldest
+// of them are dropped
+const streamBufferSize = 16
+
 /*
 // v1 of this server only sends out a slice of readings
 type sourceStruct struct {
@@ -29,21 +58,52 @@ type sourceStruct struct {
 // Additionally, imagine that in newer version of the front end, we wanted to display higher-resolution (more precise)
 // versions of our readings. Therefore, we decided to send the values out as float64's. This hypothetical scenario
 // let's us illustrate here how the Schemer library itself will allow decoding of float64's into float32's
-type sourceStruct struct {
-	Header string // example of this is new string-based value that was added in version 2 of this system
-	// in newer version of the front end, we might now want to include both the raw readings and the filtered version
-	RawReadings []float64
-	// however, for backwards compatibility...
-	// notice the struct tag here: we want the old front end to just
-	// see these new filtered values as its "readings" w/o even knowing
-	// that anything changed!
-	FilteredReadings []float64 `schemer:"readings"`
-}
-
+// (the struct itself is schemas.V2Reading, shared with the clients)
 var mu sync.Mutex
-var structToEncode = sourceStruct{}
-var writerSchema = schemer.SchemaOf(&structToEncode)
+var structToEncode = schemas.V2Reading{}
+var writerSchema = schemas.V2WriterSchema()
 var binaryWriterSchema []byte
+var schemaFingerprint string // registry.Fingerprint of binaryWriterSchema
+var generator *sim.Generator
+
+// the last historySize samples, oldest first. asyncUpdate makes new slices for
+// every sample, so copies of structToEncode can be kept (or encoded after mu is
+// released) without copying them.
+var history []schemas.V2Reading
+
+// key used to sign every data payload, from $SIGNING_KEY; nil means no signing
+var signingKey []byte
+
+// serverCounters counts what the server does, for /debug/stats on the
+// DEBUG_ADDR listener. It satisfies profiling.Stats without the handlers
+// having to know about that package.
+type serverCounters struct {
+	encodes    int64 // samples encoded, for /get-data/, /get-bundle/, /get-framed/ and /stream-data/
+	encodeTime int64 // time spent encoding them, in nanoseconds
+	cacheHits  int64 // 304s, for clients that already had the schema or the sample
+}
+
+func (c *serverCounters) Stats() map[string]int64 {
+	return map[string]int64{
+		"encodes":      atomic.LoadInt64(&c.encodes),
+		"encodeTimeNs": atomic.LoadInt64(&c.encodeTime),
+		"cacheHits":    atomic.LoadInt64(&c.cacheHits),
+	}
+}
+
+// countEncode records one encode that started at start
+func (c *serverCounters) countEncode(start time.Time) {
+	atomic.AddInt64(&c.encodes, 1)
+	atomic.AddInt64(&c.encodeTime, int64(time.Since(start)))
+}
+
+var counters serverCounters
+
+// every new sample, encoded, for the /stream-data/ clients subscribed to it
+var stream = broker.New(streamBufferSize)
+
+// opened by the first sample; the data endpoints answer 503 until then
+var warm middleware.Gate
 
 // this is original version
 /*
@@ -90,88 +150,567 @@ func asyncUpdate() {
 		"proper that we should do this.",
 	}
 
-	randomIndex := rand.Intn(len(randomStrings))
-	structToEncode.Header = randomStrings[randomIndex]
+	randomIndex := generator.Intn(len(randomStrings))
+	header := randomStrings[randomIndex]
 
 	// now in version 2.0 of this server, imagine we want to send over
 	// both the raw readings and the filtered readings
 
-	numFloats := rand.Intn(10)
-	structToEncode.RawReadings = make([]float64, numFloats)
+	numFloats := generator.Intn(10)
+	raw := generator.Next(numFloats)
 
-	for i := 0; i < numFloats; i++ {
-		structToEncode.RawReadings[i] = float64(rand.Intn(10000000))
-	}
+	storeSample(header, raw, filter(raw))
+}
 
-	// put a simple filter on the values
-	structToEncode.FilteredReadings = make([]float64, numFloats)
+// filter puts a simple filter on the raw readings
+func filter(raw []float64) []float64 {
+	filtered := make([]float64, len(raw))
 	smoothingFactor := 0.5
 
 	var workingAverage float64 = 0.0
-	for i := 0; i < numFloats; i++ {
-		newValue := structToEncode.RawReadings[i]
+	for i, newValue := range raw {
 		workingAverage = (newValue * smoothingFactor) + (workingAverage * (1.0 - smoothingFactor))
-		structToEncode.FilteredReadings[i] = workingAverage
+		filtered[i] = workingAverage
+	}
+	return filtered
+}
+
+// storeSample makes the given header and readings the current sample, and
+// returns its sequence number. mu must be held.
+func storeSample(header string, raw, filtered []float64) uint64 {
+	structToEncode.Header = header
+	structToEncode.RawReadings = raw
+	structToEncode.FilteredReadings = filtered
+
+	// every update gets the next sequence number, so clients can spot samples they
+	// have already seen or ones they missed
+	structToEncode.Sequence++
+	structToEncode.GeneratedAtUnixMs = time.Now().UnixNano() / int64(time.Millisecond)
+
+	history = append(history, structToEncode)
+	if len(history) > historySize {
+		history = history[len(history)-historySize:]
+	}
+
+	publishSample()
+
+	warm.Open()
+	return structToEncode.Sequence
+}
+
+// publishSample hands the current sample to the /stream-data/ clients. It runs
+// under mu, so that a client subscribing (also under mu) gets every sample after
+// the one it was sent first, and no sample twice. Nothing is encoded while nobody
+// is streaming.
+func publishSample() {
+	if stream.Subscribers() == 0 {
+		return
+	}
+	var encodedData bytes.Buffer
+	encodeStart := time.Now()
+	if err := writerSchema.Encode(&encodedData, structToEncode); err != nil {
+		log.Println("cannot encode a sample for /stream-data/: " + err.Error())
+		return
 	}
+	counters.countEncode(encodeStart)
+	stream.Publish(encodedData.Bytes())
+}
 
+// wantsJSON reports whether the client asked for JSON instead of schemer's binary
+// format. Clients that don't send an Accept header (like v1 of the client) keep
+// getting binary. This only looks for application/json and ignores q-values.
+func wantsJSON(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "application/json")
 }
 
-func getSchemaHanlder() http.HandlerFunc {
+// dataFormat reports whether /get-data/ should send JSON instead of schemer's
+// binary format. ?format=json or ?format=binary decides, whatever the Accept
+// header says, so either can be picked from a browser's address bar, which
+// always sends its own Accept; without the parameter, Accept decides (see
+// wantsJSON). Any other format is an error.
+func dataFormat(req *http.Request) (bool, error) {
+	switch format := req.URL.Query().Get("format"); format {
+	case "":
+		return wantsJSON(req), nil
+	case "json":
+		return true, nil
+	case "binary":
+		return false, nil
+	default:
+		return false, fmt.Errorf("format must be binary or json, not %q", format)
+	}
+}
+
+func getSchemaHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 
-		if req.Method != http.MethodGet {
-			http.Error(w, "Invalid Invocation", http.StatusNotFound)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Vary", "Accept")
+
+		if wantsJSON(req) {
+			jsonSchema, err := writerSchema.MarshalJSON()
+			if err != nil {
+				middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if sent, err := etag.Serve(w, req, jsonSchema); err != nil {
+				log.Println("i/o error: " + err.Error())
+			} else if !sent {
+				atomic.AddInt64(&counters.cacheHits, 1)
+			}
 			return
 		}
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/octet-stream")
 
-		buf := bytes.NewBuffer(binaryWriterSchema)
-		_, err := w.Write(buf.Bytes())
+		// the schema hardly ever changes, so a client that already has it (and sends
+		// its ETag in If-None-Match) gets a 304 instead of the same bytes again. The
+		// JSON and binary schemas have different ETags.
+		sent, err := etag.Serve(w, req, binaryWriterSchema)
 
 		if err != nil {
-			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
 			log.Println("i/o error: " + err.Error())
 			return
 		}
 
-		log.Printf("successfully returned binary schema")
+		if !sent {
+			atomic.AddInt64(&counters.cacheHits, 1)
+		}
 	}
 }
 
-func getDataHanlder() http.HandlerFunc {
+// parseLastSequence reads the optional X-Last-Sequence request header
+func parseLastSequence(req *http.Request) (uint64, bool, error) {
+	s := req.Header.Get("X-Last-Sequence")
+	if s == "" {
+		return 0, false, nil
+	}
+	sequence, err := strconv.ParseUint(s, 10, 64)
+	return sequence, err == nil, err
+}
+
+// afterSequenceCheck, if set, is called by /get-data/ once it has checked
+// X-Last-Sequence and released mu, before it encodes. The tests use it to land
+// an update exactly there.
+var afterSequenceCheck func()
+
+func getDataHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 
-		if req.Method != http.MethodGet {
-			http.Error(w, "Invalid Invocation", http.StatusNotFound)
+		// don't bother encoding for a client that has already gone away
+		ctx := req.Context()
+		if ctx.Err() != nil {
+			log.Println("request abandoned before encoding: " + ctx.Err().Error())
+			return
+		}
+
+		// a client that sends the sequence of the last sample it saw gets a 304
+		// instead of the same payload again
+		lastSequence, hasLastSequence, err := parseLastSequence(req)
+		if err != nil {
+			middleware.Error(w, "invalid X-Last-Sequence header", http.StatusBadRequest)
+			return
+		}
+
+		// clients that can't use schemer (or fell back from it) can ask for the same
+		// data as JSON
+		asJSON, err := dataFormat(req)
+		if err != nil {
+			middleware.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+
+		// the check and the copy happen under one lock, so an update landing in
+		// between can't make the returned sequence disagree with the payload
+		if hasLastSequence && lastSequence == structToEncode.Sequence {
+			mu.Unlock()
+			atomic.AddInt64(&counters.cacheHits, 1)
+			w.Header().Set("X-Sequence", strconv.FormatUint(lastSequence, 10))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		// the encode works on a copy, so updates don't wait for it (see
+		// examples/saferead)
+		sample := structToEncode
+		mu.Unlock()
+		sequence := sample.Sequence
+
+		if afterSequenceCheck != nil {
+			afterSequenceCheck()
+		}
+
+		// a buffer from the pool, not a new one per request (see the benchmarks
+		// in internal/bufpool); it goes back once the payload has been written
+		encodedData := bufpool.Get()
+		defer bufpool.Put(encodedData)
+		encodeStart := time.Now()
+		if asJSON {
+			err = json.NewEncoder(encodedData).Encode(sample)
+		} else {
+			err = writerSchema.Encode(encodedData, sample)
+		}
+		if err != nil {
+			middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		counters.countEncode(encodeStart)
+
+		// the encode may have taken long enough for the client to leave or for the
+		// request to time out; either way nobody wants the payload anymore
+		if ctx.Err() != nil {
+			middleware.Error(w, "request timed out", http.StatusServiceUnavailable)
+			log.Println("request abandoned after encoding: " + ctx.Err().Error())
 			return
 		}
 
+		// the sequence in the header always matches the payload, since both come
+		// from the same copy
+		w.Header().Set("X-Sequence", strconv.FormatUint(sequence, 10))
+		w.Header().Set("Vary", "Accept")
+		if asJSON {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		if signingKey != nil {
+			w.Header().Set(signing.Header, signing.SignHex(signingKey, encodedData.Bytes()))
+		}
+		if !asJSON {
+			// which schema decodes this payload; consumers can look it up in the
+			// schema registry instead of asking us
+			w.Header().Set(registry.FingerprintHeader, schemaFingerprint)
+		}
+
+		if _, err := w.Write(encodedData.Bytes()); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+// getBundleHandler returns the schema and the data in one response, so a client
+// without a cached schema needs a single round trip, and can't be caught out by
+// the server being upgraded between fetching the schema and fetching the data.
+// The body is the binary schema as a frame (see package frame), and then the
+// encoded data.
+func getBundleHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		var bundle bytes.Buffer
+		frame.WriteFrame(&bundle, binaryWriterSchema)
+
 		mu.Lock()
+		sample := structToEncode
+		mu.Unlock()
+
+		encodeStart := time.Now()
+		err := writerSchema.Encode(&bundle, sample)
+		sequence := sample.Sequence
+
+		if err != nil {
+			middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		counters.countEncode(encodeStart)
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("X-Sequence", strconv.FormatUint(sequence, 10))
+
+		if _, err := w.Write(bundle.Bytes()); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+// getFramedHandler is like getBundleHandler, but the body starts with
+// frame.FramedMagic, and the encoded data is a frame too. Knowing the lengths of
+// both parts up front, a client can tell a truncated response from a complete
+// one.
+func getFramedHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
 
 		var encodedData bytes.Buffer
-		err := writerSchema.Encode(&encodedData, structToEncode)
+		mu.Lock()
+		sample := structToEncode
+		mu.Unlock()
+
+		encodeStart := time.Now()
+		err := writerSchema.Encode(&encodedData, sample)
+		sequence := sample.Sequence
+
 		if err != nil {
-			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
-			defer mu.Unlock()
+			middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		counters.countEncode(encodeStart)
+
+		var framed bytes.Buffer
+		framed.WriteString(frame.FramedMagic)
+		frame.WriteFrame(&framed, binaryWriterSchema)
+		frame.WriteFrame(&framed, encodedData.Bytes())
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(framed.Len()))
+		w.Header().Set("X-Sequence", strconv.FormatUint(sequence, 10))
+
+		if _, err := w.Write(framed.Bytes()); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+// getStreamHandler keeps the response open and sends every new sample as it is
+// made, instead of a client polling /get-data/ for it. The body is a series of
+// frames (see package frame): the binary schema, then the current sample (if
+// there is one yet), then each sample asyncUpdate (or /admin/update) makes from
+// then on, encoded with the schema. With no Content-Length, the response goes out
+// with chunked transfer encoding, and every frame is flushed as it is written.
+//
+// A client that falls more than streamBufferSize samples behind loses the oldest
+// of them; the sequence numbers show where. Like any other request, a stream ends
+// after REQUEST_TIMEOUT (the server's WriteTimeout would cut it off soon after),
+// so a client that wants to keep streaming reconnects.
+func getStreamHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			middleware.Error(w, "streaming is not supported", http.StatusInternalServerError)
 			return
 		}
 
+		// subscribing and taking the current sample under mu means the first sample
+		// published to us is the one after it
+		mu.Lock()
+		samples, cancel := stream.Subscribe()
+		current := structToEncode
 		mu.Unlock()
+		defer cancel()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set(registry.FingerprintHeader, schemaFingerprint)
+
+		if err := frame.WriteFrame(w, binaryWriterSchema); err != nil {
+			log.Println("i/o error: " + err.Error())
+			return
+		}
+		if current.Sequence > 0 {
+			var encodedData bytes.Buffer
+			encodeStart := time.Now()
+			if err := writerSchema.Encode(&encodedData, current); err != nil {
+				log.Println("encode error: " + err.Error())
+				return
+			}
+			counters.countEncode(encodeStart)
+			if err := frame.WriteFrame(w, encodedData.Bytes()); err != nil {
+				log.Println("i/o error: " + err.Error())
+				return
+			}
+		}
+		flusher.Flush()
+
+		sent := 0
+		for {
+			select {
+			case <-req.Context().Done():
+				// the client went away, or REQUEST_TIMEOUT is up
+				log.Printf("streamed %d samples (%d dropped)", sent, stream.Dropped(samples))
+				return
+			case payload := <-samples:
+				if err := frame.WriteFrame(w, payload); err != nil {
+					log.Println("i/o error: " + err.Error())
+					return
+				}
+				flusher.Flush()
+				sent++
+			}
+		}
+	}
+}
+
+// getExportHandler renders readings for tools that can't decode schemer, as CSV
+// (the default) or JSON, with one row per reading:
+//
+//	/export/?format=csv|json   the current sample
+//	/export/?limit=N           the last N samples (up to historySize), oldest first
+func getExportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		format := req.URL.Query().Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		if format != "csv" && format != "json" {
+			middleware.Error(w, "format must be csv or json", http.StatusBadRequest)
+			return
+		}
+
+		limit := 0
+		if s := req.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				middleware.Error(w, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		mu.Lock()
+		var samples []interface{}
+		if limit == 0 {
+			samples = append(samples, structToEncode)
+		} else {
+			start := len(history) - limit
+			if start < 0 {
+				start = 0
+			}
+			for _, sample := range history[start:] {
+				samples = append(samples, sample)
+			}
+		}
+		mu.Unlock()
+
+		table, err := export.Flatten(samples...)
+		if err != nil {
+			middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Disposition", `attachment; filename="readings.`+format+`"`)
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			err = export.WriteJSON(w, table)
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			err = export.WriteCSV(w, table)
+		}
+		if err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
 
-		n, err := w.Write(encodedData.Bytes())
-		log.Printf("%d bytes written ", n)
+// getDataJSONHandler shows what /get-data/ is carrying right now as indented
+// JSON, for comparing against the binary payload while debugging. It is only
+// registered with DEBUG_ENDPOINTS=1.
+func getDataJSONHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		mu.Lock()
+		b, err := json.MarshalIndent(structToEncode, "", "  ")
+		mu.Unlock()
 
 		if err != nil {
-			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+			middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+// adminUpdate is the optional body of POST /admin/update. Without
+// FilteredReadings the filter is run on RawReadings, as for a random update.
+type adminUpdate struct {
+	Header           string
+	RawReadings      []float64
+	FilteredReadings []float64
+}
+
+// getAdminUpdateHandler makes a new sample right away instead of waiting for the
+// next tick, and answers with its sequence number as {"Sequence": N}. Without a
+// body the sample is random, like every other; with an adminUpdate body it holds
+// exactly the given values, so a test can check that a client decodes them. It is
+// only registered with ADMIN_TOKEN set, behind middleware.AdminAuth.
+func getAdminUpdateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		var update adminUpdate
+		dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<20))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&update)
+		explicit := err == nil
+		if err != nil && err != io.EOF {
+			middleware.Error(w, "invalid update: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var sequence uint64
+		if explicit {
+			if update.FilteredReadings == nil {
+				update.FilteredReadings = filter(update.RawReadings)
+			}
+			mu.Lock()
+			sequence = storeSample(update.Header, update.RawReadings, update.FilteredReadings)
+			mu.Unlock()
+		} else {
+			asyncUpdate()
+			mu.Lock()
+			sequence = structToEncode.Sequence
+			mu.Unlock()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct{ Sequence uint64 }{sequence}); err != nil {
 			log.Println("i/o error: " + err.Error())
 			return
 		}
 
-		log.Printf("successfully returned binary data")
+		if explicit {
+			log.Printf("admin set sample %d", sequence)
+		} else {
+			log.Printf("admin triggered sample %d", sequence)
+		}
 	}
 }
 
+// routes says which of the optional endpoints newMux registers, and how it
+// wraps the data endpoints
+type routes struct {
+	limiter      *middleware.RateLimiter // RATE_LIMIT; nil for none
+	slow, jitter time.Duration           // SLOW_MS and SLOW_JITTER, for /get-data/
+	debug        bool                    // DEBUG_ENDPOINTS=1
+	adminToken   string                  // ADMIN_TOKEN; "" for no /admin/update
+}
+
+// newMux sets up our endpoints. Each answers only its own path, and only the
+// methods it is registered for (see middleware.Endpoint); any other path gets
+// a 404, and every error has a JSON body.
+func newMux(r routes) *http.ServeMux {
+	// every endpoint that sends data waits for the first sample, and is rate limited
+	data := func(h http.Handler) http.Handler {
+		return middleware.WarmUp(&warm, middleware.RateLimit(r.limiter, h))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", middleware.NotFound())
+	middleware.Handle(mux, "/get-schema/", getSchemaHandler(), http.MethodGet)
+	middleware.Handle(mux, "/get-data/", data(middleware.Latency(r.slow, r.jitter, getDataHandler())), http.MethodGet)
+	middleware.Handle(mux, "/get-bundle/", data(getBundleHandler()), http.MethodGet)
+	middleware.Handle(mux, "/export/", data(getExportHandler()), http.MethodGet)
+	middleware.Handle(mux, "/get-framed/", data(getFramedHandler()), http.MethodGet)
+	middleware.Handle(mux, "/stream-data/", data(getStreamHandler()), http.MethodGet)
+
+	if r.debug {
+		middleware.Handle(mux, "/get-data-json/", middleware.WarmUp(&warm, getDataJSONHandler()), http.MethodGet)
+		middleware.Handle(mux, "/debug/vars", expvar.Handler(), http.MethodGet)
+	}
+	if r.adminToken != "" {
+		middleware.Handle(mux, "/admin/update", middleware.AdminAuth(r.adminToken, getAdminUpdateHandler()), http.MethodPost)
+	}
+	return mux
+}
+
 func printIntro() {
 
 	s := `
@@ -187,29 +726,171 @@ expects the original data.)
 
 }
 
-func main() {
+func run() error {
+	// a struct that doesn't round-trip fails here, rather than in the first client
+	if err := selftest.Run(&schemas.V2Reading{}); err != nil {
+		return fmt.Errorf("startup self-test failed: %w", err)
+	}
+
 	binaryWriterSchema = writerSchema.MarshalSchemer()
+	schemaFingerprint = registry.Fingerprint(binaryWriterSchema)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = DefaultPort
 	}
 
-	rand.Seed(time.Now().UnixNano())
+	requestTimeout, err := middleware.TimeoutFromEnv()
+	if err != nil {
+		return err
+	}
+
+	logLevel, err := middleware.LogLevelFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// SLOW_MS (and SLOW_JITTER) make /get-data/ answer slowly, for testing clients
+	slow, jitter, err := middleware.LatencyFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// RATE_LIMIT (and RATE_BURST, TRUST_PROXY) cap how often one IP can make us
+	// encode a sample; every data endpoint draws on the same per-IP budget
+	limiter, err := middleware.RateLimiterFromEnv()
+	if err != nil {
+		return err
+	}
+
+	warmUp, err := middleware.WarmUpFromEnv()
+	if err != nil {
+		return err
+	}
+
+	signingKey = signing.KeyFromEnv()
+
+	// with REGISTRY_URL set, the schema is registered before serving any data
+	// stamped with its fingerprint
+	registryURL := os.Getenv(registry.RegistryEnv)
+	if registryURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		_, err := registry.Register(ctx, registryURL, binaryWriterSchema)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("cannot register the schema with %s: %w", registryURL, err)
+		}
+	}
+
+	// RANDOM_SEED makes the samples the same every run
+	seed, err := sim.SeedFromEnv()
+	if err != nil {
+		return err
+	}
+	// the generator draws everything in a sample; the global source is left to
+	// SLOW_JITTER
+	rand.Seed(seed)
+	generator = sim.New(sim.DefaultConfig, seed)
 
 	// constantly write out new data
-	go asyncUpdate()
+	// WARMUP=sync makes the first sample before we start listening; with the
+	// default WARMUP=gate, data requests get a 503 until the first sample is there
+	firstUpdate := time.Duration(0)
+	if warmUp == middleware.WarmUpSync {
+		asyncUpdate()
+		firstUpdate = updateInterval
+	}
+	go func() {
+		time.Sleep(firstUpdate)
+		for {
+			asyncUpdate()
+			time.Sleep(updateInterval)
+		}
+	}()
+
+	// off by default: DEBUG_ENDPOINTS=1 hands out the data without schemer, as
+	// plain JSON, and publishes the counters
+	debugEndpoints := os.Getenv("DEBUG_ENDPOINTS") == "1"
+	if debugEndpoints {
+		// request counts and timings per endpoint (from middleware.Timing), the
+		// counters, and how many readings the current sample holds
+		expvar.Publish("counters", expvar.Func(func() interface{} { return counters.Stats() }))
+		expvar.Publish("readings", expvar.Func(func() interface{} {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(structToEncode.FilteredReadings)
+		}))
+	}
 
-	// setup our endpoints
-	mux := http.NewServeMux()
-	mux.HandleFunc("/get-schema/", getSchemaHanlder())
-	mux.HandleFunc("/get-data/", getDataHanlder())
+	// also off by default: with ADMIN_TOKEN set, POST /admin/update makes a new
+	// sample on demand, for demos and tests
+	adminToken := middleware.AdminTokenFromEnv()
+
+	mux := newMux(routes{
+		limiter:    limiter,
+		slow:       slow,
+		jitter:     jitter,
+		debug:      debugEndpoints,
+		adminToken: adminToken,
+	})
+
+	// pprof and /debug/stats on a listener of their own, only with DEBUG_ADDR set
+	debugAddr, err := profiling.StartFromEnv(&counters)
+	if err != nil {
+		return fmt.Errorf("cannot start the debug listener (%s): %w", profiling.AddrEnv, err)
+	}
 
 	printIntro()
 
-	log.Println("example server listing on port:", port)
-	log.Println("endpont 1: /get-schema/")
-	log.Println("endpont 2: /get-data/")
+	log.Println("example server listening on port:", port)
+	log.Println("endpoint 1: /get-schema/")
+	log.Println("endpoint 2: /get-data/?format=binary|json")
+	log.Println("endpoint 3: /get-bundle/")
+	log.Println("endpoint 4: /export/?format=csv|json&limit=N")
+	log.Println("endpoint 5: /get-framed/")
+	log.Println("endpoint 6: /stream-data/")
+	if debugEndpoints {
+		log.Println("endpoint 7: /get-data-json/ (DEBUG_ENDPOINTS=1)")
+	}
+	if adminToken != "" {
+		log.Println("endpoint 8: POST /admin/update (ADMIN_TOKEN)")
+	}
+	if debugEndpoints {
+		log.Println("endpoint 9: /debug/vars (DEBUG_ENDPOINTS=1)")
+	}
+	log.Println("request timeout (REQUEST_TIMEOUT):", requestTimeout)
+	log.Println("warm-up (WARMUP):", warmUp)
+	log.Println("random seed (RANDOM_SEED):", seed)
+	if slow > 0 || jitter > 0 {
+		log.Printf("slowing down /get-data/ by %s plus up to %s (SLOW_MS, SLOW_JITTER)", slow, jitter)
+	}
+	if limiter != nil {
+		log.Printf("rate limiting /get-data/, /get-bundle/, /get-framed/, /stream-data/ and /export/ per client IP to %s (RATE_LIMIT, RATE_BURST, TRUST_PROXY)", limiter)
+	}
+	if signingKey != nil {
+		log.Println("signing data with the key in " + signing.KeyEnv)
+	}
+	if debugAddr != nil {
+		log.Printf("pprof and /debug/stats on %s (%s)", debugAddr, profiling.AddrEnv)
+	}
+	if registryURL != "" {
+		log.Printf("schema %.12s registered with %s (%s)", schemaFingerprint, registryURL, registry.RegistryEnv)
+	}
 
-	log.Fatal(http.ListenAndServe(":"+port, mux))
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           middleware.Logging(log.Default(), logLevel, middleware.Recover(middleware.Timeout(requestTimeout, middleware.Timing(mux)))),
+		ReadHeaderTimeout: 5 * time.Second,
+		// leave the handler time to notice its own timeout and answer
+		WriteTimeout: requestTimeout + 5*time.Second,
+	}
+
+	// HTTPS if TLS_CERT/TLS_KEY or TLS_SELF_SIGNED say so
+	return serve.ListenAndServe(server)
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
 }
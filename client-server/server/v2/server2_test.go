@@ -0,0 +1,753 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/routecheck"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/serve"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+const testToken = "test-admin-token"
+
+// start sets the server up the way run does, with no sample yet, and serves
+// newMux(r) until the end of the test. It returns the server's URL.
+func start(t *testing.T, r routes) string {
+	t.Helper()
+	binaryWriterSchema = writerSchema.MarshalSchemer()
+	schemaFingerprint = registry.Fingerprint(binaryWriterSchema)
+	generator = sim.New(sim.DefaultConfig, 1)
+
+	mu.Lock()
+	structToEncode = schemas.V2Reading{}
+	history = nil
+	mu.Unlock()
+	warm = middleware.Gate{}
+
+	ts := httptest.NewServer(newMux(r))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// startWarm is start, with a first sample made
+func startWarm(t *testing.T, r routes) string {
+	url := start(t, r)
+	asyncUpdate()
+	return url
+}
+
+// postUpdate posts body (if any) to /admin/update with token (if any), and
+// returns the status and the sequence number in the response
+func postUpdate(t *testing.T, url, token string, body interface{}) (int, uint64) {
+	t.Helper()
+	var b bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, url+"/admin/update", &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, 0
+	}
+	var result struct{ Sequence uint64 }
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, result.Sequence
+}
+
+// decode decodes a /get-data/ payload the way a client would
+func decode(t *testing.T, data []byte) schemas.V2Reading {
+	t.Helper()
+	var reading schemas.V2Reading
+	schema, err := schemerclient.DecodeSchema(binaryWriterSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Decode(bytes.NewReader(data), &reading); err != nil {
+		t.Fatal(err)
+	}
+	return reading
+}
+
+// fetch decodes the current sample from /get-data/, and checks X-Sequence
+// matches it
+func fetch(t *testing.T, url string) schemas.V2Reading {
+	t.Helper()
+	status, header, data := testserver.Get(t, url+"/get-data/", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /get-data/: %d %s", status, data)
+	}
+	reading := decode(t, data)
+	if s := header.Get("X-Sequence"); s != strconv.FormatUint(reading.Sequence, 10) {
+		t.Fatalf("X-Sequence is %q, the payload has %d", s, reading.Sequence)
+	}
+	return reading
+}
+
+func TestWarmUp(t *testing.T) {
+	url := start(t, routes{})
+
+	status, header, _ := testserver.Get(t, url+"/get-data/", nil)
+	if status != http.StatusServiceUnavailable || header.Get("Retry-After") != "1" {
+		t.Fatalf("before the first sample: status %d with Retry-After %q, want 503 with 1", status, header.Get("Retry-After"))
+	}
+
+	// the schema doesn't wait for data
+	if status, _, _ := testserver.Get(t, url+"/get-schema/", nil); status != http.StatusOK {
+		t.Fatalf("/get-schema/ before the first sample: status %d", status)
+	}
+
+	asyncUpdate()
+	if reading := fetch(t, url); reading.Sequence != 1 || reading.Header == "" {
+		t.Fatalf("after the first sample got %+v", reading)
+	}
+}
+
+func TestAdminUpdate(t *testing.T) {
+	url := startWarm(t, routes{adminToken: testToken})
+
+	t.Run("without credentials", func(t *testing.T) {
+		before := fetch(t, url)
+		for _, token := range []string{"", "wrong-token"} {
+			if status, _ := postUpdate(t, url, token, nil); status != http.StatusUnauthorized {
+				t.Fatalf("token %q: status %d, want %d", token, status, http.StatusUnauthorized)
+			}
+		}
+		if after := fetch(t, url); after.Sequence != before.Sequence {
+			t.Fatalf("a rejected update still made sample %d", after.Sequence)
+		}
+	})
+
+	t.Run("random", func(t *testing.T) {
+		before := fetch(t, url)
+		status, sequence := postUpdate(t, url, testToken, nil)
+		if status != http.StatusOK {
+			t.Fatalf("status %d", status)
+		}
+		if sequence != before.Sequence+1 {
+			t.Fatalf("returned sequence %d, want %d", sequence, before.Sequence+1)
+		}
+		if after := fetch(t, url); after.Sequence != sequence {
+			t.Fatalf("/get-data/ has sample %d, the update returned %d", after.Sequence, sequence)
+		}
+	})
+
+	t.Run("explicit values", func(t *testing.T) {
+		for _, update := range []adminUpdate{
+			{Header: "known values", RawReadings: []float64{21.5, -3.25, 0.125}, FilteredReadings: []float64{1, 2, 3}},
+			// without FilteredReadings, the server's filter is run on RawReadings
+			{Header: "filtered by the server", RawReadings: []float64{20, 22}},
+		} {
+			status, sequence := postUpdate(t, url, testToken, update)
+			if status != http.StatusOK {
+				t.Fatalf("status %d", status)
+			}
+
+			got := fetch(t, url)
+			want := update.FilteredReadings
+			if want == nil {
+				want = []float64{10, 16}
+			}
+			if got.Sequence != sequence || got.Header != update.Header ||
+				!reflect.DeepEqual(got.RawReadings, update.RawReadings) || !reflect.DeepEqual(got.FilteredReadings, want) {
+				t.Fatalf("decoded %+v, want sequence %d with %+v and filtered readings %v", got, sequence, update, want)
+			}
+		}
+	})
+}
+
+// TestSequenceUnderLoad has several goroutines making samples while several
+// others read /get-data/. Each reader has to see sequences that never go back,
+// with X-Sequence matching the payload, and each sequence has to stand for one
+// sample only: two readers given the same sequence got the same sample.
+func TestSequenceUnderLoad(t *testing.T) {
+	url := startWarm(t, routes{})
+	const updaters, updates, readers, reads = 4, 50, 8, 50
+
+	var wg sync.WaitGroup
+	for i := 0; i < updaters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				asyncUpdate()
+			}
+		}()
+	}
+
+	var seenMu sync.Mutex
+	seen := map[uint64]int64{} // sequence -> GeneratedAtUnixMs
+	errs := make(chan error, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last uint64
+			for j := 0; j < reads; j++ {
+				resp, err := http.Get(url + "/get-data/")
+				if err != nil {
+					errs <- err
+					return
+				}
+				data, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					errs <- err
+					return
+				}
+				var reading schemas.V2Reading
+				if err := writerSchema.Decode(bytes.NewReader(data), &reading); err != nil {
+					errs <- err
+					return
+				}
+				if s := resp.Header.Get("X-Sequence"); s != strconv.FormatUint(reading.Sequence, 10) {
+					errs <- fmt.Errorf("X-Sequence is %q, the payload has %d", s, reading.Sequence)
+					return
+				}
+				if reading.Sequence < last {
+					errs <- fmt.Errorf("got sequence %d after %d", reading.Sequence, last)
+					return
+				}
+				last = reading.Sequence
+
+				seenMu.Lock()
+				at, ok := seen[reading.Sequence]
+				seen[reading.Sequence] = reading.GeneratedAtUnixMs
+				seenMu.Unlock()
+				if ok && at != reading.GeneratedAtUnixMs {
+					errs <- fmt.Errorf("sequence %d was given to two samples", reading.Sequence)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// no update got lost or numbered twice
+	if got, want := fetch(t, url).Sequence, uint64(1+updaters*updates); got != want {
+		t.Errorf("after %d updates the sequence is %d, want %d", want, got, want)
+	}
+}
+
+// TestUpdateBeforeEncode lands an update after /get-data/ has checked
+// X-Last-Sequence but before it encodes: the response has to be the sample that
+// passed the check, with its own sequence in X-Sequence, not the new one
+func TestUpdateBeforeEncode(t *testing.T) {
+	url := startWarm(t, routes{})
+	asyncUpdate()
+	before := fetch(t, url)
+
+	reached, proceed := make(chan struct{}), make(chan struct{})
+	afterSequenceCheck = func() {
+		reached <- struct{}{}
+		<-proceed
+	}
+	defer func() { afterSequenceCheck = nil }()
+
+	type response struct {
+		status int
+		header http.Header
+		data   []byte
+	}
+	done := make(chan response, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, url+"/get-data/", nil)
+		req.Header.Set("X-Last-Sequence", strconv.FormatUint(before.Sequence-1, 10))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			done <- response{}
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		done <- response{resp.StatusCode, resp.Header, data}
+	}()
+
+	select {
+	case <-reached:
+	case r := <-done:
+		t.Fatalf("the request ended without reaching the encode: %d %s", r.status, r.data)
+	}
+	// mu is free again, so this doesn't wait for the handler
+	asyncUpdate()
+	close(proceed)
+	resp := <-done
+
+	if resp.status != http.StatusOK {
+		t.Fatalf("status %d %s", resp.status, resp.data)
+	}
+	got := decode(t, resp.data)
+	if got.Sequence != before.Sequence || got.GeneratedAtUnixMs != before.GeneratedAtUnixMs {
+		t.Errorf("got sample %d, want the one that passed the check, %d", got.Sequence, before.Sequence)
+	}
+	if s := resp.header.Get("X-Sequence"); s != strconv.FormatUint(got.Sequence, 10) {
+		t.Errorf("X-Sequence is %q, the payload has %d", s, got.Sequence)
+	}
+	afterSequenceCheck = nil
+	if after := fetch(t, url); after.Sequence != before.Sequence+1 {
+		t.Errorf("the update made sample %d, want %d", after.Sequence, before.Sequence+1)
+	}
+}
+
+// TestFramed decodes a /get-framed/ response with schemerclient, the way the
+// bundle client does, and checks one cut short by a byte is caught
+func TestFramed(t *testing.T) {
+	url := startWarm(t, routes{})
+	want := fetch(t, url)
+
+	status, header, body := testserver.Get(t, url+"/get-framed/", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status %d %s", status, body)
+	}
+	if n, _ := strconv.Atoi(header.Get("Content-Length")); n != len(body) {
+		t.Errorf("Content-Length %q for a %d byte body", header.Get("Content-Length"), len(body))
+	}
+	var got schemas.V2Reading
+	if _, err := schemerclient.ParseFramed(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %+v, /get-data/ has %+v", got, want)
+	}
+	if _, err := schemerclient.ParseFramed(body[:len(body)-1], &got); !errors.Is(err, schemerclient.ErrTruncated) {
+		t.Errorf("a response a byte short: got %v, want schemerclient.ErrTruncated", err)
+	}
+}
+
+// TestStream opens /stream-data/, makes samples with /admin/update, and checks
+// that each arrives on the stream, in order, as soon as it is made
+func TestStream(t *testing.T) {
+	url := startWarm(t, routes{adminToken: testToken})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/stream-data/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /stream-data/: %s", resp.Status)
+	}
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("transfer encoding %v, want chunked", resp.TransferEncoding)
+	}
+
+	binarySchema, err := frame.ReadFrame(resp.Body, schemerclient.MaxSchemaSize)
+	if err != nil {
+		t.Fatalf("schema frame: %v", err)
+	}
+	if !bytes.Equal(binarySchema, binaryWriterSchema) {
+		t.Fatalf("the stream started with schema % x, want % x", binarySchema, binaryWriterSchema)
+	}
+	next := func() schemas.V2Reading {
+		t.Helper()
+		payload, err := frame.ReadFrame(resp.Body, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decode(t, payload)
+	}
+
+	// the stream starts with the current sample
+	current := fetch(t, url)
+	if first := next(); first.Sequence != current.Sequence {
+		t.Fatalf("the stream started with sample %d, /get-data/ has %d", first.Sequence, current.Sequence)
+	}
+
+	// each update has to arrive before the next is made, so a stream that buffered
+	// its frames instead of flushing them would time out here
+	for i, header := range []string{"streamed first", "streamed second", "streamed third"} {
+		update := adminUpdate{Header: header, RawReadings: []float64{float64(i), 0.5}}
+		status, sequence := postUpdate(t, url, testToken, update)
+		if status != http.StatusOK {
+			t.Fatalf("status %d", status)
+		}
+		got := next()
+		if got.Sequence != sequence || got.Header != header || !reflect.DeepEqual(got.RawReadings, update.RawReadings) {
+			t.Fatalf("streamed %+v, want sequence %d with %+v", got, sequence, update)
+		}
+	}
+}
+
+// TestRoutes requests every endpoint, a few paths that aren't endpoints, and
+// some bad query parameters with every method. POST /admin/update is sent
+// without credentials, so it gets a 401 and makes no sample.
+func TestRoutes(t *testing.T) {
+	url := startWarm(t, routes{adminToken: testToken})
+
+	get := []string{http.MethodGet}
+	if err := routecheck.Check(url, []routecheck.Route{
+		{Path: "/get-schema/", Allowed: get, Status: http.StatusOK},
+		{Path: "/get-data/", Allowed: get, Status: http.StatusOK},
+		{Path: "/get-bundle/", Allowed: get, Status: http.StatusOK},
+		{Path: "/export/", Allowed: get, Status: http.StatusOK},
+		{Path: "/get-framed/", Allowed: get, Status: http.StatusOK},
+		{Path: "/stream-data/", Allowed: get, Status: http.StatusOK},
+		{Path: "/admin/update", Allowed: []string{http.MethodPost}, Status: http.StatusUnauthorized},
+
+		{Path: "/get-data/?format=json", Allowed: get, Status: http.StatusOK},
+		{Path: "/get-data/?format=xml", Allowed: get, Status: http.StatusBadRequest},
+		{Path: "/export/?format=xml", Allowed: get, Status: http.StatusBadRequest},
+		{Path: "/export/?limit=0", Allowed: get, Status: http.StatusBadRequest},
+
+		{Path: "/"},
+		{Path: "/no-such-endpoint"},
+		{Path: "/get-data/garbage"},
+		{Path: "/get-schema/v2"},
+		{Path: "/admin/update/now"},
+		{Path: "/get-data-json/"}, // only with DEBUG_ENDPOINTS=1
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFormat checks that ?format= picks the format of /get-data/ when it is
+// there, whatever Accept says, and Accept does when it isn't
+func TestFormat(t *testing.T) {
+	url := startWarm(t, routes{})
+
+	for _, c := range []struct {
+		query, accept string
+		json          bool
+	}{
+		{"", "", false},
+		{"", "application/json", true},
+		{"?format=binary", "", false},
+		{"?format=json", "", true},
+		{"?format=binary", "application/json", false},
+		{"?format=json", "application/octet-stream", true},
+	} {
+		var header http.Header
+		if c.accept != "" {
+			header = http.Header{"Accept": {c.accept}}
+		}
+		status, respHeader, body := testserver.Get(t, url+"/get-data/"+c.query, header)
+
+		what := strconv.Quote(c.query) + " with Accept " + strconv.Quote(c.accept)
+		contentType := respHeader.Get("Content-Type")
+		var reading schemas.V2Reading
+		switch {
+		case status != http.StatusOK:
+			t.Fatalf("%s: %d %s", what, status, body)
+		case c.json && contentType != "application/json":
+			t.Fatalf("%s: Content-Type %q, want JSON", what, contentType)
+		case !c.json && contentType != "application/octet-stream":
+			t.Fatalf("%s: Content-Type %q, want binary", what, contentType)
+		case c.json:
+			if err := json.Unmarshal(body, &reading); err != nil {
+				t.Fatalf("%s: %v", what, err)
+			}
+		default:
+			reading = decode(t, body)
+		}
+		if reading.Sequence == 0 {
+			t.Fatalf("%s: decoded an empty sample", what)
+		}
+	}
+}
+
+// seededSamples makes n samples the way the server does with RANDOM_SEED set to
+// seed, and returns them without the parts that come from the clock
+func seededSamples(seed int64, n int) []schemas.V2Reading {
+	generator = sim.New(sim.DefaultConfig, seed)
+	var samples []schemas.V2Reading
+	for i := 0; i < n; i++ {
+		asyncUpdate()
+		mu.Lock()
+		samples = append(samples, schemas.V2Reading{
+			Header:           structToEncode.Header,
+			RawReadings:      structToEncode.RawReadings,
+			FilteredReadings: structToEncode.FilteredReadings,
+		})
+		mu.Unlock()
+	}
+	return samples
+}
+
+func TestSeed(t *testing.T) {
+	defer os.Unsetenv(sim.SeedEnv)
+	os.Setenv(sim.SeedEnv, "42")
+	if seed, err := sim.SeedFromEnv(); err != nil || seed != 42 {
+		t.Fatalf("%s=42 gave seed %d (%v)", sim.SeedEnv, seed, err)
+	}
+	os.Setenv(sim.SeedEnv, "forty-two")
+	if _, err := sim.SeedFromEnv(); err == nil {
+		t.Fatalf("%s=forty-two was accepted", sim.SeedEnv)
+	}
+
+	first, second := seededSamples(42, 20), seededSamples(42, 20)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("seed 42 made\n  %v\nthe first time, and\n  %v\nthe second", first, second)
+	}
+	if other := seededSamples(43, 20); reflect.DeepEqual(first, other) {
+		t.Fatal("seeds 42 and 43 made the same samples")
+	}
+}
+
+// getSchemaWith fetches /get-schema/ from url with client
+func getSchemaWith(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url + "/get-schema/")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// TestListeners serves the endpoints on TCP and on a Unix socket at once, as
+// LISTEN="tcp:...,unix:..." does, and checks both serve the same schema bytes.
+// The socket path starts out with a stale socket on it, which has to be
+// replaced; while the server runs, a second one can't take the path over; and
+// once it has shut down, the socket is gone.
+func TestListeners(t *testing.T) {
+	start(t, routes{})
+
+	dir, err := ioutil.TempDir("", "schemer-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "schemer.sock")
+
+	// what a server that was killed leaves behind
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listens, err := serve.ParseListen("tcp:127.0.0.1:0,unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listeners []net.Listener
+	for _, l := range listens {
+		listener, err := l.Listen()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			t.Fatalf("listen on %s: %v", l, err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- serve.Serve(ctx, &http.Server{Handler: newMux(routes{})}, listeners...)
+	}()
+
+	overTCP, err := getSchemaWith(http.DefaultClient, "http://"+listeners[0].Addr().String())
+	if err != nil {
+		t.Fatalf("over TCP: %v", err)
+	}
+	// the host in the URL is only for the Host header: every connection goes to
+	// the socket
+	unixTransport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}
+	defer unixTransport.CloseIdleConnections()
+	overUnix, err := getSchemaWith(&http.Client{Transport: unixTransport}, "http://schemer")
+	if err != nil {
+		t.Fatalf("over the Unix socket: %v", err)
+	}
+	if !bytes.Equal(overTCP, overUnix) || !bytes.Equal(overTCP, binaryWriterSchema) {
+		t.Fatalf("the schemas differ:\n  TCP:  % x\n  Unix: % x", overTCP, overUnix)
+	}
+
+	if l, err := (serve.Listen{Network: "unix", Address: sock}).Listen(); err == nil {
+		l.Close()
+		t.Fatal("a second server took over the socket while the first was serving on it")
+	}
+
+	unixTransport.CloseIdleConnections()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("shutting down: %v", err)
+	}
+	if _, err := os.Lstat(sock); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("%s is still there after shutting down", sock)
+	}
+}
+
+// settle waits up to a few seconds for the number of goroutines to come back
+// down to at most want, and returns how many there are
+func settle(want int) int {
+	n := runtime.NumGoroutine()
+	for deadline := time.Now().Add(5 * time.Second); n > want && time.Now().Before(deadline); n = runtime.NumGoroutine() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return n
+}
+
+// TestCancelStream opens several streams, has samples written to them, and
+// cancels them while the handlers are in the middle of streaming. Every handler
+// has to notice and return, unsubscribing from the broker, and leave no
+// goroutine behind.
+func TestCancelStream(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		timeout time.Duration // middleware.Timeout's; 0 for the client to cancel
+	}{
+		{"client cancels", 0},
+		{"REQUEST_TIMEOUT", 200 * time.Millisecond},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			startWarm(t, routes{})
+			var handler http.Handler = newMux(routes{})
+			if c.timeout > 0 {
+				handler = middleware.Timeout(c.timeout, handler)
+			}
+			ts := httptest.NewServer(handler)
+			defer ts.Close()
+			transport := &http.Transport{}
+			defer transport.CloseIdleConnections()
+			client := &http.Client{Transport: transport}
+
+			baseline := runtime.NumGoroutine()
+
+			const streams = 5
+			var cancels []context.CancelFunc
+			var bodies []io.ReadCloser
+			for i := 0; i < streams; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream-data/", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+				// the schema and the current sample: the handler is in its loop now
+				for f := 0; f < 2; f++ {
+					if _, err := frame.ReadFrame(resp.Body, 1<<20); err != nil {
+						t.Fatalf("stream %d: %v", i, err)
+					}
+				}
+				cancels = append(cancels, cancel)
+				bodies = append(bodies, resp.Body)
+			}
+			if n := stream.Subscribers(); n != streams {
+				t.Fatalf("%d subscribers, want %d", n, streams)
+			}
+
+			// samples keep coming while the streams are cut off
+			stop := make(chan struct{})
+			updates := make(chan struct{})
+			go func() {
+				defer close(updates)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						asyncUpdate()
+						time.Sleep(time.Millisecond)
+					}
+				}
+			}()
+			time.Sleep(20 * time.Millisecond)
+			if c.timeout == 0 {
+				for _, cancel := range cancels {
+					cancel()
+				}
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for stream.Subscribers() > 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			close(stop)
+			<-updates
+			if n := stream.Subscribers(); n != 0 {
+				t.Fatalf("%d stream handlers still running", n)
+			}
+
+			for _, body := range bodies {
+				body.Close()
+			}
+			transport.CloseIdleConnections()
+			if n := settle(baseline); n > baseline {
+				t.Errorf("%d goroutines after the streams ended, %d before they started", n, baseline)
+			}
+		})
+	}
+}
+
+// TestCanceledBeforeEncode hands /get-data/ a request whose client is already
+// gone: the handler has to give up without encoding or writing anything
+func TestCanceledBeforeEncode(t *testing.T) {
+	startWarm(t, routes{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/get-data/", nil).WithContext(ctx)
+
+	encodes := counters.Stats()["encodes"]
+	rec := httptest.NewRecorder()
+	getDataHandler().ServeHTTP(rec, req)
+	if rec.Body.Len() != 0 {
+		t.Errorf("wrote %d bytes for a client that had gone", rec.Body.Len())
+	}
+	if n := counters.Stats()["encodes"]; n != encodes {
+		t.Errorf("encoded %d samples for a client that had gone", n-encodes)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/etag"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/selftest"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/serve"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+const DefaultPort = "8080"
+
+// how often asyncUpdate produces a new sample
+const updateInterval = time.Second
+
+// in version 3, imagine front ends in different regions want their readings in
+// different units. The server keeps measuring in Celsius, converts the readings
+// to the unit each client asks for, and says which unit it sent in the new Unit
+// field (see schemas.V3Reading). v1 and v2 clients still decode everything they
+// know about and ignore Unit.
+var mu sync.Mutex
+var current = schemas.V3Reading{Unit: "C"} // always in Celsius
+var writerSchema = schemas.V3WriterSchema()
+var binaryWriterSchema []byte
+var schemaFingerprint string // registry.Fingerprint of binaryWriterSchema
+var generator *sim.Generator
+
+// payloads caches the encoded current sample per unit, so clients asking for the
+// same unit share one encode. asyncUpdate empties it.
+var payloads = map[string][]byte{}
+
+// opened by the first sample; /get-data/ answers 503 until then
+var warm middleware.Gate
+
+// unit is one of the units /get-data/?unit= accepts
+type unit struct {
+	name        string // what goes in V3Reading.Unit
+	fromCelsius func(c float64) float64
+}
+
+var units = map[string]unit{
+	"c": {"C", func(c float64) float64 { return c }},
+	"f": {"F", func(c float64) float64 { return c*9/5 + 32 }},
+	"k": {"K", func(c float64) float64 { return c + 273.15 }},
+}
+
+// parseUnit reads ?unit=c|f|k (in either case), defaulting to Celsius
+func parseUnit(req *http.Request) (unit, error) {
+	s := req.URL.Query().Get("unit")
+	if s == "" {
+		return units["c"], nil
+	}
+	u, ok := units[strings.ToLower(s)]
+	if !ok {
+		return unit{}, fmt.Errorf("invalid unit %q: use c, f or k", s)
+	}
+	return u, nil
+}
+
+// convert returns a copy of sample with every reading converted from Celsius to u.
+// The slices are new, so the current sample is never touched.
+func convert(sample schemas.V3Reading, u unit) schemas.V3Reading {
+	convertAll := func(celsius []float64) []float64 {
+		converted := make([]float64, len(celsius))
+		for i, c := range celsius {
+			converted[i] = u.fromCelsius(c)
+		}
+		return converted
+	}
+	sample.RawReadings = convertAll(sample.RawReadings)
+	sample.FilteredReadings = convertAll(sample.FilteredReadings)
+	sample.Unit = u.name
+	return sample
+}
+
+func asyncUpdate() {
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	numFloats := generator.Intn(10)
+	raw := generator.Next(numFloats)
+
+	// put a simple filter on the values
+	filtered := make([]float64, numFloats)
+	smoothingFactor := 0.5
+	var workingAverage float64 = 0.0
+	for i, newValue := range raw {
+		workingAverage = (newValue * smoothingFactor) + (workingAverage * (1.0 - smoothingFactor))
+		filtered[i] = workingAverage
+	}
+
+	setSample(fmt.Sprintf("update at %s", time.Now().Format(time.RFC3339)), raw, filtered)
+}
+
+// setSample makes the given Celsius readings the current sample. mu must be held.
+func setSample(header string, raw, filtered []float64) {
+	current.Header = header
+	current.RawReadings = raw
+	current.FilteredReadings = filtered
+	current.Sequence++
+	current.GeneratedAtUnixMs = time.Now().UnixNano() / int64(time.Millisecond)
+
+	// every cached payload holds the previous sample
+	payloads = map[string][]byte{}
+
+	warm.Open()
+}
+
+func getSchemaHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/octet-stream")
+
+		// the schema doesn't depend on the unit, so every client shares one ETag
+		if _, err := etag.Serve(w, req, binaryWriterSchema); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+// getDataHandler sends the current sample in the unit asked for with
+// ?unit=c|f|k (Celsius if there is none). The conversion happens on a copy,
+// just before encoding.
+func getDataHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		u, err := parseUnit(req)
+		if err != nil {
+			middleware.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+
+		// the cache is keyed by unit: a payload encoded for one unit must never go
+		// out to a client that asked for another
+		payload, cached := payloads[u.name]
+		if !cached {
+			var encodedData bytes.Buffer
+			if err := writerSchema.Encode(&encodedData, convert(current, u)); err != nil {
+				mu.Unlock()
+				middleware.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			payload = encodedData.Bytes()
+			payloads[u.name] = payload
+		}
+		sequence := current.Sequence
+
+		mu.Unlock()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Sequence", strconv.FormatUint(sequence, 10))
+		w.Header().Set(registry.FingerprintHeader, schemaFingerprint)
+
+		if _, err := w.Write(payload); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+func printIntro() {
+
+	s := `
+This is version 3 of the example server. It listens either on port 8080 (the default), or some other port
+specified in the environment called PORT.
+It sends the same data as version 2, plus the unit the readings are in: /get-data/?unit=c|f|k converts
+the readings (kept in Celsius) to Celsius, Fahrenheit or Kelvin before encoding them. Clients written
+for versions 1 and 2 keep working; they just don't know about the unit.
+	`
+	fmt.Println(s)
+
+}
+
+// newMux returns the server's routes. Each endpoint answers only its own path,
+// and only GET; every error has a JSON body.
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", middleware.NotFound())
+	middleware.Handle(mux, "/get-schema/", getSchemaHandler(), http.MethodGet)
+	middleware.Handle(mux, "/get-data/", middleware.WarmUp(&warm, getDataHandler()), http.MethodGet)
+	return mux
+}
+
+func run() error {
+	// a struct that doesn't round-trip fails here, rather than in the first client
+	if err := selftest.Run(&schemas.V3Reading{}); err != nil {
+		return fmt.Errorf("startup self-test failed: %w", err)
+	}
+
+	binaryWriterSchema = writerSchema.MarshalSchemer()
+	schemaFingerprint = registry.Fingerprint(binaryWriterSchema)
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = DefaultPort
+	}
+
+	requestTimeout, err := middleware.TimeoutFromEnv()
+	if err != nil {
+		return err
+	}
+
+	logLevel, err := middleware.LogLevelFromEnv()
+	if err != nil {
+		return err
+	}
+
+	warmUp, err := middleware.WarmUpFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// RANDOM_SEED makes the samples the same every run
+	seed, err := sim.SeedFromEnv()
+	if err != nil {
+		return err
+	}
+	generator = sim.New(sim.DefaultConfig, seed)
+
+	// WARMUP=sync makes the first sample before we start listening; with the
+	// default WARMUP=gate, /get-data/ gets a 503 until the first sample is there
+	firstUpdate := time.Duration(0)
+	if warmUp == middleware.WarmUpSync {
+		asyncUpdate()
+		firstUpdate = updateInterval
+	}
+
+	// constantly write out new data
+	go func() {
+		time.Sleep(firstUpdate)
+		for {
+			asyncUpdate()
+			time.Sleep(updateInterval)
+		}
+	}()
+
+	mux := newMux()
+
+	printIntro()
+
+	log.Println("example server (v3) listening on port:", port)
+	log.Println("endpoint 1: /get-schema/")
+	log.Println("endpoint 2: /get-data/?unit=c|f|k")
+	log.Println("request timeout (REQUEST_TIMEOUT):", requestTimeout)
+	log.Println("warm-up (WARMUP):", warmUp)
+	log.Println("random seed (RANDOM_SEED):", seed)
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           middleware.Logging(log.Default(), logLevel, middleware.Recover(middleware.Timeout(requestTimeout, mux))),
+		ReadHeaderTimeout: 5 * time.Second,
+		// leave the handler time to notice its own timeout and answer
+		WriteTimeout: requestTimeout + 5*time.Second,
+	}
+
+	// HTTPS if TLS_CERT/TLS_KEY or TLS_SELF_SIGNED say so
+	return serve.ListenAndServe(server)
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/routecheck"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+// start sets the server up the way run does, with no sample yet, and serves
+// newMux until the end of the test. It returns the server's URL.
+func start(t *testing.T) string {
+	t.Helper()
+	binaryWriterSchema = writerSchema.MarshalSchemer()
+	schemaFingerprint = registry.Fingerprint(binaryWriterSchema)
+
+	mu.Lock()
+	current = schemas.V3Reading{Unit: "C"}
+	payloads = map[string][]byte{}
+	mu.Unlock()
+	warm = middleware.Gate{}
+
+	ts := httptest.NewServer(newMux())
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// set makes the given Celsius readings the current sample
+func set(header string, celsius []float64) {
+	mu.Lock()
+	defer mu.Unlock()
+	setSample(header, celsius, append([]float64(nil), celsius...))
+}
+
+// close enough, given that 273.15 and 9/5 aren't exact in binary
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestConversions(t *testing.T) {
+	for _, c := range []struct {
+		celsius, fahrenheit, kelvin float64
+	}{
+		{-273.15, -459.67, 0}, // absolute zero
+		{-40, -40, 233.15},    // where Celsius and Fahrenheit meet
+		{0, 32, 273.15},       // water freezes
+		{37, 98.6, 310.15},
+		{100, 212, 373.15}, // water boils
+	} {
+		if got := units["c"].fromCelsius(c.celsius); got != c.celsius {
+			t.Errorf("%g C is %g C", c.celsius, got)
+		}
+		if got := units["f"].fromCelsius(c.celsius); !near(got, c.fahrenheit) {
+			t.Errorf("%g C is %g F, want %g", c.celsius, got, c.fahrenheit)
+		}
+		if got := units["k"].fromCelsius(c.celsius); !near(got, c.kelvin) {
+			t.Errorf("%g C is %g K, want %g", c.celsius, got, c.kelvin)
+		}
+	}
+}
+
+// get decodes /get-data/ with the given query, the way a client would, and
+// checks it was sent with the schema's fingerprint
+func get(t *testing.T, url, query string) schemas.V3Reading {
+	t.Helper()
+	status, header, data := testserver.Get(t, url+"/get-data/"+query, nil)
+	if status != http.StatusOK {
+		t.Fatalf("%q: status %d %s", query, status, data)
+	}
+	if fp := header.Get(registry.FingerprintHeader); fp != schemaFingerprint {
+		t.Errorf("%q: fingerprint %q, want %q", query, fp, schemaFingerprint)
+	}
+	schema, err := schemerclient.DecodeSchema(binaryWriterSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reading schemas.V3Reading
+	if err := schema.Decode(bytes.NewReader(data), &reading); err != nil {
+		t.Fatalf("%q: %v", query, err)
+	}
+	return reading
+}
+
+// expect checks that got is the Celsius readings in the given unit
+func expect(t *testing.T, got schemas.V3Reading, celsius []float64, u unit) {
+	t.Helper()
+	if got.Unit != u.name {
+		t.Fatalf("asked for %s, got Unit %q", u.name, got.Unit)
+	}
+	if len(got.RawReadings) != len(celsius) || len(got.FilteredReadings) != len(celsius) {
+		t.Fatalf("asked for %s, got %d raw and %d filtered readings, want %d", u.name, len(got.RawReadings), len(got.FilteredReadings), len(celsius))
+	}
+	for i, c := range celsius {
+		if !near(got.RawReadings[i], u.fromCelsius(c)) || !near(got.FilteredReadings[i], u.fromCelsius(c)) {
+			t.Fatalf("asked for %s, got readings %v", u.name, got.RawReadings)
+		}
+	}
+}
+
+func TestInvalidUnit(t *testing.T) {
+	url := start(t)
+	set("known values", []float64{20})
+	for _, c := range []struct {
+		query  string
+		status int
+	}{
+		{"?unit=x", http.StatusBadRequest},
+		{"?unit=celsius", http.StatusBadRequest},
+		{"?unit=R", http.StatusBadRequest},
+		// an empty unit is the same as none
+		{"?unit=", http.StatusOK},
+	} {
+		if status, _, body := testserver.Get(t, url+"/get-data/"+c.query, nil); status != c.status {
+			t.Errorf("%s: status %d %s, want %d", c.query, status, body, c.status)
+		}
+	}
+}
+
+func TestUnitPerRequest(t *testing.T) {
+	url := start(t)
+	celsius := []float64{-40, 0, 100}
+	set("known values", celsius)
+
+	// the same unit twice, so the second of each comes out of the cache, and
+	// every unit in between
+	for _, c := range []struct {
+		query string
+		unit  unit
+	}{
+		{"", units["c"]}, {"?unit=f", units["f"]}, {"?unit=c", units["c"]}, {"?unit=F", units["f"]},
+		{"?unit=k", units["k"]}, {"?unit=c", units["c"]}, {"?unit=K", units["k"]}, {"?unit=f", units["f"]},
+	} {
+		expect(t, get(t, url, c.query), celsius, c.unit)
+	}
+
+	// the conversions worked on copies: the sample itself is still in Celsius
+	mu.Lock()
+	defer mu.Unlock()
+	if current.Unit != "C" || !reflect.DeepEqual(current.RawReadings, celsius) {
+		t.Fatalf("the current sample was changed to %s %v", current.Unit, current.RawReadings)
+	}
+}
+
+func TestCacheUpdates(t *testing.T) {
+	url := start(t)
+	set("first", []float64{20})
+	get(t, url, "?unit=f")
+
+	second := []float64{30}
+	set("second", second)
+	got := get(t, url, "?unit=f")
+	if got.Header != "second" {
+		t.Fatalf("got sample %q after the update, want \"second\"", got.Header)
+	}
+	expect(t, got, second, units["f"])
+}
+
+// TestRoutes requests every endpoint, and a few paths that aren't endpoints,
+// with every method
+func TestRoutes(t *testing.T) {
+	url := start(t)
+	set("known values", []float64{20})
+
+	get := []string{http.MethodGet}
+	err := routecheck.Check(url, []routecheck.Route{
+		{Path: "/get-schema/", Allowed: get, Status: http.StatusOK},
+		{Path: "/get-data/", Allowed: get, Status: http.StatusOK},
+		{Path: "/get-data/?unit=f", Allowed: get, Status: http.StatusOK},
+		{Path: "/get-data/?unit=x", Allowed: get, Status: http.StatusBadRequest},
+
+		{Path: "/"},
+		{Path: "/no-such-endpoint"},
+		{Path: "/get-data/garbage"},
+		{Path: "/get-schema/v3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/heartbeat"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// time allowed to write one frame; a client that can't keep up is evicted
+	writeWait = 10 * time.Second
+
+	// a client has to answer a ping within pongWait
+	pongWait = 60 * time.Second
+
+	// pings go out a bit more often than pongWait, so a healthy client always
+	// answers in time
+	pingPeriod = pongWait * 9 / 10
+
+	// frames queued for one client; a client that falls this far behind is evicted
+	// rather than allowed to hold up the others
+	sendBuffer = 16
+)
+
+// hubClient is one connected browser (or other client)
+type hubClient struct {
+	hub  *hub
+	conn *websocket.Conn
+	addr string
+	send chan []byte // frames waiting to be written by writePump
+}
+
+// hub keeps track of every connected client and broadcasts each new frame to all
+// of them. Only the run goroutine touches the clients map; everything else talks
+// to it over channels.
+type hub struct {
+	register   chan *hubClient
+	unregister chan *hubClient
+	broadcast  chan []byte
+
+	clients   map[*hubClient]bool
+	connected int64 // number of clients, readable from any goroutine
+
+	// a client that hasn't been sent a frame for this long gets a heartbeat;
+	// 0 means never
+	heartbeat  time.Duration
+	heartbeats int64 // sent so far, to all clients
+}
+
+func newHub(heartbeatInterval time.Duration) *hub {
+	return &hub{
+		register:   make(chan *hubClient),
+		unregister: make(chan *hubClient),
+		broadcast:  make(chan []byte),
+		clients:    make(map[*hubClient]bool),
+		heartbeat:  heartbeatInterval,
+	}
+}
+
+// Connected returns the number of connected clients
+func (h *hub) Connected() int {
+	return int(atomic.LoadInt64(&h.connected))
+}
+
+// Heartbeats returns the number of heartbeats sent so far
+func (h *hub) Heartbeats() int64 {
+	return atomic.LoadInt64(&h.heartbeats)
+}
+
+// remove drops c from the hub; closing c.send tells its writePump to hang up
+func (h *hub) remove(c *hubClient) {
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+		atomic.StoreInt64(&h.connected, int64(len(h.clients)))
+	}
+}
+
+func (h *hub) run() {
+	for {
+		select {
+		case c := <-h.register:
+			h.clients[c] = true
+			atomic.StoreInt64(&h.connected, int64(len(h.clients)))
+			log.Printf("client connected from %s (%d connected)", c.addr, len(h.clients))
+
+		case c := <-h.unregister:
+			if h.clients[c] {
+				h.remove(c)
+				log.Printf("client %s disconnected (%d connected)", c.addr, len(h.clients))
+			}
+
+		case frame := <-h.broadcast:
+			for c := range h.clients {
+				select {
+				case c.send <- frame:
+				default:
+					h.remove(c)
+					log.Printf("client %s fell %d frames behind, evicted", c.addr, sendBuffer)
+				}
+			}
+		}
+	}
+}
+
+// readPump reads (and throws away) whatever the client sends, so that pongs, close
+// frames and dropped connections are noticed
+func (c *hubClient) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		if _, _, err := c.conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// writePump is the only goroutine writing to the connection. It sends the frames
+// queued by the hub, a heartbeat whenever there has been no frame for the hub's
+// heartbeat interval, and a ping every pingPeriod, and gives up on the client as
+// soon as a write takes longer than writeWait.
+//
+// Pings only tell the server that the client is still there: the browser answers
+// them without the page ever seeing them. Heartbeats are for the client, which
+// can't tell a stalled generator from a dead connection otherwise.
+func (c *hubClient) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	// the timer is restarted by every frame, so heartbeats only go out while
+	// there is nothing else to send; with no interval it is never started
+	var heartbeats <-chan time.Time
+	var heartbeatTimer *time.Timer
+	if c.hub.heartbeat > 0 {
+		heartbeatTimer = time.NewTimer(c.hub.heartbeat)
+		defer heartbeatTimer.Stop()
+		heartbeats = heartbeatTimer.C
+	}
+	restartHeartbeat := func() {
+		if heartbeatTimer == nil {
+			return
+		}
+		if !heartbeatTimer.Stop() {
+			select {
+			case <-heartbeatTimer.C:
+			default:
+			}
+		}
+		heartbeatTimer.Reset(c.hub.heartbeat)
+	}
+
+	for {
+		select {
+		case frame, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// evicted or gone
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+				log.Printf("client %s: %v", c.addr, err)
+				return
+			}
+			restartHeartbeat()
+
+		case <-heartbeats:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, []byte(heartbeat.Message)); err != nil {
+				log.Printf("client %s: %v", c.addr, err)
+				return
+			}
+			atomic.AddInt64(&c.hub.heartbeats, 1)
+			restartHeartbeat()
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/heartbeat"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+	"github.com/gorilla/websocket"
+)
+
+// wsURL is the /ws endpoint of the server start serves at url
+func wsURL(url string) string {
+	return "ws" + strings.TrimPrefix(url, "http") + "/ws"
+}
+
+// TestHub connects several clients to a hub, broadcasts some frames, and checks
+// that every client received the schema and could decode every frame, in order.
+// Frames are broadcast only once every client is connected, and fit in
+// sendBuffer, so no client may be evicted.
+func TestHub(t *testing.T) {
+	const numClients, numFrames = 50, 10
+	if numFrames > sendBuffer {
+		t.Fatalf("%d frames could get a slow client evicted; the limit is %d", numFrames, sendBuffer)
+	}
+
+	h := newHub(0)
+	go h.run()
+	url := wsURL(start(t, h, nil))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numClients)
+
+	for i := 0; i < numClients; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		wg.Add(1)
+		go func(i int, conn *websocket.Conn) {
+			defer wg.Done()
+			if err := receive(conn, numFrames); err != nil {
+				errs <- fmt.Errorf("client %d: %w", i, err)
+			}
+		}(i, conn)
+	}
+
+	// wait for the hub to have registered everybody
+	deadline := time.Now().Add(5 * time.Second)
+	for h.Connected() < numClients {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of %d clients connected", h.Connected(), numClients)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for seq := 1; seq <= numFrames; seq++ {
+		var frame bytes.Buffer
+		if err := writerSchema.Encode(&frame, schemas.V2Reading{Sequence: uint64(seq)}); err != nil {
+			t.Fatal(err)
+		}
+		h.broadcast <- frame.Bytes()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// receive reads the schema frame and then numFrames data frames from conn
+func receive(conn *websocket.Conn, numFrames int) error {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	_, binarySchema, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	schema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		return fmt.Errorf("cannot decode schema: %w", err)
+	}
+
+	for seq := 1; seq <= numFrames; seq++ {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", seq, err)
+		}
+		var dest schemas.V2Reading
+		if err := schema.Decode(bytes.NewReader(frame), &dest); err != nil {
+			return fmt.Errorf("frame %d: %w", seq, err)
+		}
+		if dest.Sequence != uint64(seq) {
+			return fmt.Errorf("got sequence %d, want %d", dest.Sequence, seq)
+		}
+	}
+	return nil
+}
+
+// TestHeartbeats stalls the generator with a client connected, and checks that
+// heartbeats keep the client's liveness timer from running out (Timeout(interval)
+// without a message is when it would reconnect), that data still gets through on
+// the same connection afterwards, and that no heartbeats are sent while data is
+// flowing.
+func TestHeartbeats(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	h := newHub(interval)
+	go h.run()
+	url := wsURL(start(t, h, nil))
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	announced, ok := heartbeat.ParseInterval(resp.Header.Get(heartbeat.Header))
+	if !ok || announced != interval {
+		t.Fatalf("the upgrade response announced %q, expected %v", resp.Header.Get(heartbeat.Header), interval)
+	}
+	timeout := heartbeat.Timeout(announced)
+
+	// next reads the next message the way the client does: any message at all
+	// resets the liveness timer
+	next := func() (int, []byte, error) {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		return conn.ReadMessage()
+	}
+
+	_, binarySchema, err := next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+
+	// data every interval/5: the heartbeat timer never gets to fire
+	seq := uint64(0)
+	send := func() error {
+		seq++
+		var frame bytes.Buffer
+		if err := writerSchema.Encode(&frame, schemas.V2Reading{Sequence: seq}); err != nil {
+			return err
+		}
+		h.broadcast <- frame.Bytes()
+		return nil
+	}
+	expectData := func() error {
+		msgType, frame, err := next()
+		if err != nil {
+			return fmt.Errorf("waiting for frame %d: %w", seq, err)
+		}
+		if msgType != websocket.BinaryMessage {
+			return fmt.Errorf("waiting for frame %d: got a %q text message", seq, frame)
+		}
+		var dest schemas.V2Reading
+		if err := schema.Decode(bytes.NewReader(frame), &dest); err != nil {
+			return err
+		}
+		if dest.Sequence != seq {
+			return fmt.Errorf("got sequence %d, expected %d", dest.Sequence, seq)
+		}
+		return nil
+	}
+	for i := 0; i < 25; i++ {
+		if err := send(); err != nil {
+			t.Fatal(err)
+		}
+		if err := expectData(); err != nil {
+			t.Fatalf("while data is flowing: %v", err)
+		}
+		time.Sleep(interval / 5)
+	}
+	if n := h.Heartbeats(); n != 0 {
+		t.Fatalf("%d heartbeats were sent while data was flowing", n)
+	}
+
+	// the generator stalls for 20 intervals: only heartbeats arrive, and each one
+	// comes before the liveness timer runs out
+	stallEnd := time.Now().Add(20 * interval)
+	received := 0
+	for time.Now().Before(stallEnd) {
+		msgType, msg, err := next()
+		if err != nil {
+			t.Fatalf("after %d heartbeats the client would have reconnected: %v", received, err)
+		}
+		if msgType != websocket.TextMessage || string(msg) != heartbeat.Message {
+			t.Fatalf("got %d byte message of type %d during the stall, expected a heartbeat", len(msg), msgType)
+		}
+		received++
+	}
+	if received < 15 {
+		t.Fatalf("only %d heartbeats in 20 intervals", received)
+	}
+
+	// and once the generator is back, so is the data, on the same connection
+	if err := send(); err != nil {
+		t.Fatal(err)
+	}
+	if err := expectData(); err != nil {
+		t.Fatalf("after the stall: %v", err)
+	}
+}
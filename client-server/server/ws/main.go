@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/heartbeat"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/profiling"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/selftest"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/serve"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/gorilla/websocket"
+)
+
+const DefaultPort = "8080"
+
+// how often a new set of readings is pushed to every connected client
+const updateInterval = time.Second
+
+// same data as v2 of the HTTP server
+var mu sync.Mutex
+var structToEncode = schemas.V2Reading{}
+var writerSchema = schemas.V2WriterSchema()
+var binaryWriterSchema []byte
+var generator *sim.Generator
+
+// frames encoded by publish, for /debug/stats on the DEBUG_ADDR listener
+var encodes int64
+
+// how many of the latest frames /get-history/ can send again
+const historySize = 300
+
+// a frame as it was broadcast, kept for /get-history/
+type sentFrame struct {
+	sequence uint64
+	payload  []byte
+}
+
+// the last historySize frames, oldest first; guarded by mu
+var history []sentFrame
+
+var schemaFingerprint string
+
+var upgrader = websocket.Upgrader{
+	// this is an example, so let any page connect
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func asyncUpdate() {
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	structToEncode.Header = fmt.Sprintf("update at %s", time.Now().Format(time.RFC3339))
+
+	numFloats := generator.Intn(10)
+	structToEncode.RawReadings = generator.Next(numFloats)
+	structToEncode.FilteredReadings = make([]float64, numFloats)
+
+	smoothingFactor := 0.5
+	var workingAverage float64 = 0.0
+	for i := 0; i < numFloats; i++ {
+		workingAverage = (structToEncode.RawReadings[i] * smoothingFactor) + (workingAverage * (1.0 - smoothingFactor))
+		structToEncode.FilteredReadings[i] = workingAverage
+	}
+
+	structToEncode.Sequence++
+	structToEncode.GeneratedAtUnixMs = time.Now().UnixNano() / int64(time.Millisecond)
+
+}
+
+// publish encodes the current data once and hands the frame to the hub, which
+// sends it to every connected client
+func publish(h *hub) {
+	mu.Lock()
+	var encodedData bytes.Buffer
+	err := writerSchema.Encode(&encodedData, structToEncode)
+	if err == nil {
+		history = append(history, sentFrame{structToEncode.Sequence, encodedData.Bytes()})
+		if len(history) > historySize {
+			history = history[len(history)-historySize:]
+		}
+	}
+	mu.Unlock()
+
+	if err != nil {
+		log.Println("encode error: " + err.Error())
+		return
+	}
+	atomic.AddInt64(&encodes, 1)
+	h.broadcast <- encodedData.Bytes()
+}
+
+// getHistoryHandler sends the frames broadcast after ?since=N, oldest first, so a
+// client that reconnects can fill in what it missed. The body is one frame (see
+// package frame) per payload, encoded with the schema whose fingerprint is in
+// X-Schema-Fingerprint; X-Sequence is the latest sequence broadcast. A client
+// that has been away longer than the history reaches back will find the first
+// frame isn't the one right after its last.
+func getHistoryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		since, err := strconv.ParseUint(req.URL.Query().Get("since"), 10, 64)
+		if err != nil {
+			middleware.Error(w, "since must be a sequence number", http.StatusBadRequest)
+			return
+		}
+
+		var body bytes.Buffer
+		mu.Lock()
+		for _, f := range history {
+			if f.sequence > since {
+				frame.WriteFrame(&body, f.payload)
+			}
+		}
+		latest := structToEncode.Sequence
+		mu.Unlock()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set(registry.FingerprintHeader, schemaFingerprint)
+		w.Header().Set("X-Sequence", strconv.FormatUint(latest, 10))
+		if _, err := w.Write(body.Bytes()); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+// wsHandler registers every new connection with the hub. The binary schema is
+// queued as the first frame, so it always arrives before any data. The upgrade
+// response carries the schema's fingerprint, so a reconnecting client can tell
+// whether it changed, and announces the heartbeat interval, so the client knows
+// how long a silence means the connection is dead.
+func wsHandler(h *hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		header := http.Header{registry.FingerprintHeader: {schemaFingerprint}}
+		if h.heartbeat > 0 {
+			header.Set(heartbeat.Header, heartbeat.FormatInterval(h.heartbeat))
+		}
+		conn, err := upgrader.Upgrade(w, req, header)
+		if err != nil {
+			log.Println("upgrade error: " + err.Error())
+			return
+		}
+
+		c := &hubClient{hub: h, conn: conn, addr: req.RemoteAddr, send: make(chan []byte, sendBuffer)}
+		c.send <- binaryWriterSchema
+		h.register <- c
+
+		go c.writePump()
+		go c.readPump()
+	}
+}
+
+// metricsHandler reports the number of connected clients, in the Prometheus text
+// format
+func metricsHandler(h *hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP ws_connected_clients Number of connected WebSocket clients.")
+		fmt.Fprintln(w, "# TYPE ws_connected_clients gauge")
+		fmt.Fprintf(w, "ws_connected_clients %d\n", h.Connected())
+	}
+}
+
+// newMux sets up our endpoints. /get-history/ answers only GET (see
+// middleware.Endpoint), with JSON errors, and draws on limiter's per-IP budget.
+func newMux(h *hub, limiter *middleware.RateLimiter) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", wsHandler(h))
+	mux.HandleFunc("/metrics", metricsHandler(h))
+	middleware.Handle(mux, "/get-history/", middleware.RateLimit(limiter, getHistoryHandler()), http.MethodGet)
+	return mux
+}
+
+func printIntro() {
+
+	s := `
+This is an example of a server that pushes schemer-encoded data over a WebSocket. It listens either on
+port 8080 (the default), or some other port specified in the environment called PORT.
+The first binary frame sent on every connection is the schema; every frame after that is encoded data.
+Try killing and restarting this server while the client in client-server/client/ws is running: the
+client reconnects on its own and re-reads the schema.
+Every client gets the same frames, broadcast by one hub; a client that falls more than 16 frames behind,
+or takes longer than 10 seconds to accept a frame, is disconnected. /metrics shows how many are connected.
+A client that hasn't been sent anything for HEARTBEAT_INTERVAL (5s by default) gets a heartbeat text
+message, so its connection doesn't look dead to it, or to a NAT in between, while there is no data.
+/get-history/?since=N sends the last few hundred frames after sequence N again, for a client that
+reconnects (see client-server/client/resume).
+	`
+	fmt.Println(s)
+
+}
+
+func run() error {
+	// a struct that doesn't round-trip fails here, rather than in the first client
+	if err := selftest.Run(&schemas.V2Reading{}); err != nil {
+		return fmt.Errorf("startup self-test failed: %w", err)
+	}
+
+	binaryWriterSchema = writerSchema.MarshalSchemer()
+	schemaFingerprint = registry.Fingerprint(binaryWriterSchema)
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = DefaultPort
+	}
+
+	logLevel, err := middleware.LogLevelFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// RATE_LIMIT (and RATE_BURST, TRUST_PROXY) cap how often one IP can ask for
+	// the history, which copies up to historySize frames per request
+	limiter, err := middleware.RateLimiterFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// sent to a client whenever it hasn't had a frame for this long
+	heartbeatInterval, err := heartbeat.IntervalFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// RANDOM_SEED makes the samples the same every run
+	seed, err := sim.SeedFromEnv()
+	if err != nil {
+		return err
+	}
+	generator = sim.New(sim.DefaultConfig, seed)
+
+	h := newHub(heartbeatInterval)
+	go h.run()
+
+	// constantly write out new data, and push it to every client
+	asyncUpdate()
+	go func() {
+		for range time.Tick(updateInterval) {
+			asyncUpdate()
+			publish(h)
+		}
+	}()
+
+	mux := newMux(h, limiter)
+
+	// pprof and /debug/stats on a listener of their own, only with DEBUG_ADDR set
+	debugAddr, err := profiling.StartFromEnv(profiling.StatsFunc(func() map[string]int64 {
+		return map[string]int64{
+			"encodes":     atomic.LoadInt64(&encodes),
+			"subscribers": int64(h.Connected()),
+			"heartbeats":  h.Heartbeats(),
+		}
+	}))
+	if err != nil {
+		return fmt.Errorf("cannot start the debug listener (%s): %w", profiling.AddrEnv, err)
+	}
+
+	printIntro()
+
+	log.Println("example websocket server listening on port:", port)
+	log.Println("endpoint 1: /ws")
+	log.Println("endpoint 2: /metrics")
+	log.Println("endpoint 3: /get-history/?since=N")
+	log.Printf("heartbeat (%s): %v", heartbeat.IntervalEnv, heartbeatInterval)
+	log.Printf("random seed (%s): %d", sim.SeedEnv, seed)
+	if limiter != nil {
+		log.Printf("rate limiting /get-history/ per client IP to %s (RATE_LIMIT, RATE_BURST, TRUST_PROXY)", limiter)
+	}
+	if debugAddr != nil {
+		log.Printf("pprof and /debug/stats on %s (%s)", debugAddr, profiling.AddrEnv)
+	}
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           middleware.Logging(log.Default(), logLevel, middleware.Recover(mux)),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	// HTTPS (and wss://) if TLS_CERT/TLS_KEY or TLS_SELF_SIGNED say so, and every
+	// address in LISTEN. On SIGINT or SIGTERM the listeners stop taking new
+	// connections and requests; WebSocket connections, which net/http no longer
+	// tracks once upgraded, end when the process exits.
+	return serve.ListenAndServe(server)
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
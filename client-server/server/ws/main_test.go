@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// start sets the server up the way main does, with an empty history, and serves
+// newMux(h, limiter) until the end of the test. It returns the server's URL.
+func start(t *testing.T, h *hub, limiter *middleware.RateLimiter) string {
+	t.Helper()
+	binaryWriterSchema = writerSchema.MarshalSchemer()
+	schemaFingerprint = registry.Fingerprint(binaryWriterSchema)
+	generator = sim.New(sim.DefaultConfig, 1)
+
+	mu.Lock()
+	structToEncode = schemas.V2Reading{}
+	history = nil
+	mu.Unlock()
+
+	ts := httptest.NewServer(newMux(h, limiter))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// errorBody checks body is a middleware.ErrorBody for code
+func errorBody(t *testing.T, body []byte, code int) {
+	t.Helper()
+	var e middleware.ErrorBody
+	if err := json.Unmarshal(body, &e); err != nil || e.Code != code {
+		t.Errorf("error body %q, want a JSON %d", body, code)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := newHub(0)
+	go h.run()
+	url := start(t, h, nil)
+
+	// publish hands each frame to the hub; nobody is connected, so it drops them
+	for i := 0; i < 5; i++ {
+		asyncUpdate()
+		publish(h)
+	}
+
+	status, header, body := testserver.Get(t, url+"/get-history/?since=2", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status %d %s", status, body)
+	}
+	if header.Get("X-Sequence") != "5" || header.Get(registry.FingerprintHeader) != schemaFingerprint {
+		t.Errorf("X-Sequence %q and fingerprint %q, want 5 and %q",
+			header.Get("X-Sequence"), header.Get(registry.FingerprintHeader), schemaFingerprint)
+	}
+	r := bytes.NewReader(body)
+	for want := uint64(3); want <= 5; want++ {
+		payload, err := frame.ReadFrame(r, 1<<20)
+		if err != nil {
+			t.Fatalf("frame for sequence %d: %v", want, err)
+		}
+		var reading schemas.V2Reading
+		if err := writerSchema.Decode(bytes.NewReader(payload), &reading); err != nil {
+			t.Fatal(err)
+		}
+		if reading.Sequence != want {
+			t.Fatalf("got sequence %d, want %d", reading.Sequence, want)
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes after the last frame", r.Len())
+	}
+
+	status, _, body = testserver.Get(t, url+"/get-history/?since=latest", nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("a since that isn't a number: status %d, want 400", status)
+	}
+	errorBody(t, body, http.StatusBadRequest)
+
+	resp, err := http.Post(url+"/get-history/?since=0", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e middleware.ErrorBody
+	json.NewDecoder(resp.Body).Decode(&e)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, HEAD" || e.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, Allow %q, body %+v; want a 405 allowing GET, HEAD", resp.StatusCode, resp.Header.Get("Allow"), e)
+	}
+}
+
+func TestHistoryRateLimit(t *testing.T) {
+	h := newHub(0)
+	go h.run()
+	url := start(t, h, middleware.NewRateLimiter(1, 2, false))
+
+	for i := 0; i < 2; i++ {
+		if status, _, body := testserver.Get(t, url+"/get-history/?since=0", nil); status != http.StatusOK {
+			t.Fatalf("request %d of a burst of 2: status %d %s", i, status, body)
+		}
+	}
+	status, header, body := testserver.Get(t, url+"/get-history/?since=0", nil)
+	if status != http.StatusTooManyRequests || header.Get("Retry-After") == "" {
+		t.Fatalf("past the burst: status %d with Retry-After %q, want 429 with one", status, header.Get("Retry-After"))
+	}
+	errorBody(t, body, http.StatusTooManyRequests)
+	if _, err := strconv.Atoi(header.Get("Retry-After")); err != nil {
+		t.Errorf("Retry-After %q isn't a number of seconds", header.Get("Retry-After"))
+	}
+}
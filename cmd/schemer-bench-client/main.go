@@ -0,0 +1,217 @@
+// schemer-bench-client measures a server end to end: it fires /get-data/
+// requests from a number of concurrent workers for a while, decodes every
+// response the way a real client would, and prints requests/sec, the latency
+// percentiles and the errors. Every request to the v2 server encodes the current
+// sample under the server's mutex, so this is the number to watch when that
+// mutex or the Encode behind it changes.
+//
+//	PORT=8080 go run ./client-server/server/v2 &
+//	cd cmd/schemer-bench-client
+//	go run . -c 32 -duration 10s -warmup 2s
+//
+// Requests started during -warmup are made, decoded and thrown away, so
+// connection setup and a cold server don't skew the numbers. The v2 server's
+// rate limiter is off unless RATE_LIMIT is set; with it on, expect 429s.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+// results is what one worker saw while measuring
+type results struct {
+	latencies    []time.Duration // of every request that decoded
+	decodeErrors int
+	statusErrors map[int]int // non-200 responses, by status
+	netErrors    int
+}
+
+func (r *results) merge(o *results) {
+	r.latencies = append(r.latencies, o.latencies...)
+	r.decodeErrors += o.decodeErrors
+	r.netErrors += o.netErrors
+	for status, n := range o.statusErrors {
+		r.statusErrors[status] += n
+	}
+}
+
+func newResults() *results {
+	return &results{statusErrors: map[int]int{}}
+}
+
+// worker requests and decodes /get-data/ until ctx is done, recording what
+// happened to every request started at or after measureFrom
+func worker(ctx context.Context, hc *http.Client, url string, schema schemer.Schema, measureFrom time.Time) *results {
+	r := newResults()
+	var dest schemas.V2Reading
+	for ctx.Err() == nil {
+		start := time.Now()
+		measured := !start.Before(measureFrom)
+
+		status, data, err := get(ctx, hc, url)
+		if ctx.Err() != nil {
+			// cut short by the end of the run, not the server's fault
+			break
+		}
+		if !measured {
+			continue
+		}
+		switch {
+		case err != nil:
+			r.netErrors++
+		case status != http.StatusOK:
+			r.statusErrors[status]++
+		default:
+			schemerclient.ResetForReuse(&dest)
+			if err := schema.Decode(bytes.NewReader(data), &dest); err != nil {
+				r.decodeErrors++
+				continue
+			}
+			r.latencies = append(r.latencies, time.Since(start))
+		}
+	}
+	return r
+}
+
+func get(ctx context.Context, hc *http.Client, url string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	// read the body even for an error, so the connection can be reused
+	data, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// percentile returns the p-th percentile of sorted, by nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func printSummary(r *results, concurrency int, duration time.Duration) {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	ok := len(r.latencies)
+
+	var statuses []string
+	statusTotal := 0
+	for status, n := range r.statusErrors {
+		statuses = append(statuses, fmt.Sprintf("%d: %d", status, n))
+		statusTotal += n
+	}
+	sort.Strings(statuses)
+
+	fmt.Println()
+	fmt.Printf("%-16s %d\n", "concurrency", concurrency)
+	fmt.Printf("%-16s %s\n", "duration", duration)
+	fmt.Printf("%-16s %d\n", "requests", ok+r.decodeErrors+statusTotal+r.netErrors)
+	fmt.Printf("%-16s %.1f\n", "requests/sec", float64(ok)/duration.Seconds())
+	fmt.Printf("%-16s %s\n", "latency p50", percentile(r.latencies, 50))
+	fmt.Printf("%-16s %s\n", "latency p95", percentile(r.latencies, 95))
+	fmt.Printf("%-16s %s\n", "latency p99", percentile(r.latencies, 99))
+	if ok > 0 {
+		fmt.Printf("%-16s %s\n", "latency max", r.latencies[ok-1])
+	}
+	fmt.Printf("%-16s %d\n", "decode errors", r.decodeErrors)
+	if statusTotal > 0 {
+		fmt.Printf("%-16s %d (%s)\n", "http errors", statusTotal, strings.Join(statuses, ", "))
+	} else {
+		fmt.Printf("%-16s 0\n", "http errors")
+	}
+	fmt.Printf("%-16s %d\n", "network errors", r.netErrors)
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	concurrency := flag.Int("c", 8, "number of concurrent workers")
+	duration := flag.Duration("duration", 10*time.Second, "how long to measure for")
+	warmup := flag.Duration("warmup", 2*time.Second, "how long to run before measuring")
+	insecure := flag.Bool("insecure", false, "accept any TLS certificate, e.g. a server's self-signed one (unsafe)")
+	flag.Parse()
+
+	if *concurrency < 1 {
+		log.Fatal("-c must be at least 1")
+	}
+	if *duration <= 0 || *warmup < 0 {
+		log.Fatal("-duration must be positive and -warmup not negative")
+	}
+
+	// one connection per worker, kept open between requests: the default of 2
+	// idle connections per host would have the other workers dialing all the time
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = *concurrency
+	if *insecure {
+		log.Println("WARNING: -insecure is set, TLS certificates are NOT verified; only use this against a local demo server")
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	hc := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	// the schema is fetched once, like any client would; it isn't part of the
+	// measurement
+	client, err := schemerclient.New(*baseURL, schemerclient.WithHTTPClient(hc))
+	if err != nil {
+		log.Fatal(err)
+	}
+	schema := client.Schema()
+	url := strings.TrimSuffix(*baseURL, "/") + schemerclient.DataPath
+
+	fmt.Printf("%d workers against %s: %s warm-up, then %s measured\n", *concurrency, url, *warmup, *duration)
+
+	start := time.Now()
+	measureFrom := start.Add(*warmup)
+	ctx, cancel := context.WithDeadline(context.Background(), measureFrom.Add(*duration))
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total = newResults()
+	)
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := worker(ctx, hc, url, schema, measureFrom)
+			mu.Lock()
+			total.merge(r)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	printSummary(total, *concurrency, *duration)
+	if len(total.latencies) == 0 {
+		fmt.Fprintln(os.Stderr, "no request succeeded")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/signing"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+// the structs a payload can be decoded into, by -type
+var types = map[string]func() interface{}{
+	"v1":          func() interface{} { return &schemas.V1Reading{} },
+	"v2":          func() interface{} { return &schemas.V2Reading{} },
+	"v3":          func() interface{} { return &schemas.V3Reading{} },
+	"temperature": func() interface{} { return &schemas.TemperatureReading{} },
+	"humidity":    func() interface{} { return &schemas.HumidityReading{} },
+	"door":        func() interface{} { return &schemas.DoorEvents{} },
+}
+
+func typeNames() []string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decode runs the decode command
+func decode(args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	baseURL := fs.String("url", "", "base URL of a running server to fetch the schema and data from")
+	schemaFile := fs.String("schema", "", "file holding the writer schema, binary or JSON (instead of -url)")
+	dataFile := fs.String("data", "", "file holding the encoded payload, - for stdin (instead of -url)")
+	typeName := fs.String("type", "v2", "struct to decode into: "+strings.Join(typeNames(), ", "))
+	formatName := fs.String("format", "json", "output format: "+strings.Join(formatNames(), ", "))
+	insecure := fs.Bool("insecure", false, "accept any TLS certificate, e.g. a server's self-signed one (unsafe)")
+	fs.Parse(args)
+
+	newDest, ok := types[*typeName]
+	if !ok {
+		return fmt.Errorf("invalid -type %q: use one of %s", *typeName, strings.Join(typeNames(), ", "))
+	}
+	write, ok := formats[*formatName]
+	if !ok {
+		return fmt.Errorf("invalid -format %q: use one of %s", *formatName, strings.Join(formatNames(), ", "))
+	}
+	dest := newDest()
+
+	switch {
+	case *baseURL != "" && (*schemaFile != "" || *dataFile != ""):
+		return errors.New("use either -url or -schema and -data, not both")
+	case *baseURL != "":
+		if err := fetch(*baseURL, *insecure, dest); err != nil {
+			return err
+		}
+	case *schemaFile != "" && *dataFile != "":
+		if err := decodeFiles(*schemaFile, *dataFile, dest); err != nil {
+			return err
+		}
+	default:
+		return errors.New("decode needs -url, or both -schema and -data")
+	}
+
+	return write(os.Stdout, dest)
+}
+
+// fetch decodes the current sample of the server at baseURL into dest
+func fetch(baseURL string, insecure bool, dest interface{}) error {
+	opts := []schemerclient.Option{schemerclient.WithRetries(3, 250*time.Millisecond)}
+	if key := signing.KeyFromEnv(); key != nil {
+		opts = append(opts, schemerclient.WithSigningKey(key))
+	}
+	if insecure {
+		fmt.Fprintln(os.Stderr, "WARNING: -insecure is set, TLS certificates are NOT verified")
+		opts = append(opts, schemerclient.WithInsecureSkipVerify())
+	}
+	client, err := schemerclient.New(baseURL, opts...)
+	if err != nil {
+		return err
+	}
+	return client.Fetch(context.Background(), dest)
+}
+
+// decodeFiles decodes the payload in dataFile with the schema in schemaFile
+func decodeFiles(schemaFile, dataFile string, dest interface{}) error {
+	schemaBytes, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		return err
+	}
+	schema, err := schemerclient.DecodeSchema(schemaBytes)
+	if err != nil {
+		return fmt.Errorf("cannot decode schema: %w", err)
+	}
+
+	var data []byte
+	if dataFile == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(dataFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	r := bytes.NewReader(data)
+	if err := schema.Decode(r, dest); err != nil {
+		return fmt.Errorf("cannot decode data: %w", err)
+	}
+	// the right schema uses up the whole payload
+	if r.Len() != 0 {
+		fmt.Fprintf(os.Stderr, "warning: %d of %d bytes left over; was the data encoded with this schema?\n", r.Len(), len(data))
+	}
+	return nil
+}
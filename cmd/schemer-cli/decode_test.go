@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+func TestDecodeFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	schema := schemas.V2WriterSchema()
+	var data bytes.Buffer
+	if err := schema.Encode(&data, &sample); err != nil {
+		t.Fatal(err)
+	}
+	schemaFile, dataFile := filepath.Join(dir, "v2.schema"), filepath.Join(dir, "v2.bin")
+	if err := ioutil.WriteFile(schemaFile, schema.MarshalSchemer(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dataFile, data.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got schemas.V2Reading
+	if err := decodeFiles(schemaFile, dataFile, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sample) {
+		t.Fatalf("decoded %+v, encoded %+v", got, sample)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// a format writes a decoded value to w
+type format func(w io.Writer, v interface{}) error
+
+var formats = map[string]format{
+	"json": writeJSON,
+	"yaml": writeYAML,
+	"go":   writeGo,
+}
+
+// formatNames lists the formats for usage and error messages
+func formatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeJSON writes v as indented JSON. encoding/json writes a []byte as a base64
+// string, so a binary blob can't break the output or the jq on the other end of
+// a pipe.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeYAML writes v as YAML. It goes through JSON rather than marshalling v
+// directly, so the field names are the Go ones (yaml.v3 would lower-case them),
+// a []byte is the same base64 string as in the JSON output, and the fields stay
+// in struct order.
+func writeYAML(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	// parsed from JSON, every node is in flow style and every string quoted;
+	// clearing the styles gets us plain block YAML
+	blockStyle(&doc)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// writeGo writes v in Go syntax, ready to paste into a test
+func writeGo(w io.Writer, v interface{}) error {
+	_, err := fmt.Fprintf(w, "%#v\n", reflect.Indirect(reflect.ValueOf(v)).Interface())
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"gopkg.in/yaml.v3"
+)
+
+// none of the example structs has a []byte field, so the tests make one up
+type blobReading struct {
+	Header string
+	Blob   []byte
+}
+
+// bytes that would break the output if they were written as they are
+var blob = []byte{0x00, 0xff, '\n', '"', '\\', 0x1b, 0x7f, 0xfe}
+
+var sample = schemas.V2Reading{
+	Header:            "Four score and seven years ago",
+	RawReadings:       []float64{20.25, -3.5},
+	FilteredReadings:  []float64{10.125, 3.3125},
+	Sequence:          7,
+	GeneratedAtUnixMs: 1625000000000,
+}
+
+func TestJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeJSON(&b, &sample); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "\n  \"Header\": ") {
+		t.Fatalf("not indented:\n%s", b.String())
+	}
+	var got schemas.V2Reading
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sample) {
+		t.Fatalf("read back %+v, wrote %+v", got, sample)
+	}
+}
+
+func TestJSONBlob(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeJSON(&b, &blobReading{"binary", blob}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"Blob": "`+base64.StdEncoding.EncodeToString(blob)+`"`) {
+		t.Fatalf("the blob isn't a base64 string:\n%s", b.String())
+	}
+	var got blobReading
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Blob, blob) {
+		t.Fatalf("read back blob % x, wrote % x", got.Blob, blob)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeYAML(&b, &sample); err != nil {
+		t.Fatal(err)
+	}
+	// the Go field names, in struct order, in block style
+	want := "Header: Four score and seven years ago\nRawReadings:\n  - 20.25\n  - -3.5\n"
+	if !strings.HasPrefix(b.String(), want) {
+		t.Fatalf("expected it to start with\n%s\ngot\n%s", want, b.String())
+	}
+	var got map[string]interface{}
+	if err := yaml.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["Sequence"] != 7 || got["GeneratedAtUnixMs"] != 1625000000000 {
+		t.Fatalf("read back %v", got)
+	}
+}
+
+func TestYAMLBlob(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeYAML(&b, &blobReading{"binary", blob}); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := yaml.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["Blob"] != base64.StdEncoding.EncodeToString(blob) {
+		t.Fatalf("the blob isn't a base64 string:\n%s", b.String())
+	}
+}
+
+func TestGo(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeGo(&b, &sample); err != nil {
+		t.Fatal(err)
+	}
+	want := `schemas.V2Reading{Header:"Four score and seven years ago", RawReadings:[]float64{20.25, -3.5}, `
+	if !strings.HasPrefix(b.String(), want) {
+		t.Fatalf("expected it to start with\n%s\ngot\n%s", want, b.String())
+	}
+}
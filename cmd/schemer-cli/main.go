@@ -0,0 +1,50 @@
+// schemer-cli is a command line tool for poking at schemer payloads. Its decode
+// command decodes a payload, either fetched from a running server or read from
+// files, into one of the structs in the schemas package and prints it:
+//
+//	cd cmd/schemer-cli
+//	go run . decode -url http://localhost:8080                   # the v2 server's current sample, as JSON
+//	go run . decode -url http://localhost:8080 -format yaml      # the same, as YAML
+//	go run . decode -schema v1.schema -data v1.bin -type v1 -format go
+//
+// -format json (the default) is indented JSON to pipe into jq, yaml is easier to
+// read by eye, and go prints a Go literal to paste into a test. Either way a
+// []byte field comes out as a base64 string in JSON and YAML, so binary data
+// can't mangle the output.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: schemer-cli <command> [flags]\n\ncommands:\n")
+	fmt.Fprintf(os.Stderr, "  decode   decode a payload from a server or from files and print it\n")
+	fmt.Fprintf(os.Stderr, "\nrun schemer-cli <command> -h for the command's flags\n")
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "decode":
+		err = decode(args)
+	default:
+		fmt.Fprintf(os.Stderr, "schemer-cli: unknown command %q\n\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,142 @@
+// schemer-client polls one of the example servers and prints what it sends. It
+// fetches the writer schema once, then decodes every payload into a value of the
+// type schemer derives from that schema, so it works against the v1, v2 and v3
+// servers (or anything else with /get-schema/ and /get-data/) without a struct
+// compiled in:
+//
+//	cd cmd/schemer-client
+//	go run . -url http://localhost:8080                 # the current sample, as JSON
+//	go run . -url http://localhost:8080 -output table   # single values, then the readings in columns
+//	go run . -url http://localhost:8080 -output raw     # the payload in hex
+//	go run . -watch 2s -output table                    # poll every 2s
+//
+// In watch mode the screen is cleared and redrawn after every poll, and the
+// values (with -output raw, the bytes) that changed since the previous poll are
+// shown in reverse video. A poll that fails shows its error instead, and polling
+// goes on.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+const (
+	// clears the terminal and moves the cursor to the top left
+	clearScreen = "\x1b[H\x1b[2J"
+	// reverse video on, and back off
+	highlightOn  = "\x1b[7m"
+	highlightOff = "\x1b[0m"
+)
+
+func highlight(s string) string { return highlightOn + s + highlightOff }
+
+// poll fetches the server's current payload and decodes it with schema
+func poll(ctx context.Context, hc *http.Client, baseURL string, schema schemer.Schema) (*sample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+schemerclient.DataPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	payload, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s: %s", req.URL, resp.Status, bytes.TrimSpace(payload))
+	}
+	return decodeSample(schema, payload)
+}
+
+// decodeSample decodes payload into a new value of schema's Go type
+func decodeSample(schema schemer.Schema, payload []byte) (*sample, error) {
+	t := schema.GoType()
+	if t == nil {
+		return nil, errors.New("schema has no Go type to decode into")
+	}
+	dest := reflect.New(t)
+	if err := schema.Decode(bytes.NewReader(payload), dest.Interface()); err != nil {
+		return nil, fmt.Errorf("cannot decode data: %w", err)
+	}
+	return &sample{payload: payload, value: dest.Elem()}, nil
+}
+
+func run(ctx context.Context, baseURL string, watch time.Duration, render renderer) error {
+	client, err := schemerclient.New(baseURL, schemerclient.WithRetries(3, 250*time.Millisecond))
+	if err != nil {
+		return err
+	}
+	schema := client.Schema()
+	hc := &http.Client{Timeout: 10 * time.Second}
+
+	if watch <= 0 {
+		cur, err := poll(ctx, hc, baseURL, schema)
+		if err != nil {
+			return err
+		}
+		return render(os.Stdout, cur, nil, highlight)
+	}
+
+	var prev *sample
+	for {
+		// the whole screen goes out in one write, so it doesn't flicker
+		var screen bytes.Buffer
+		screen.WriteString(clearScreen)
+		fmt.Fprintf(&screen, "%s every %s (schema %.12s), at %s\n\n", baseURL+schemerclient.DataPath, watch, client.SchemaHash(), time.Now().Format("15:04:05"))
+
+		cur, err := poll(ctx, hc, baseURL, schema)
+		if err == nil {
+			err = render(&screen, cur, prev, highlight)
+			prev = cur
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(&screen, "error: %v\n", err)
+		}
+		os.Stdout.Write(screen.Bytes())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watch):
+		}
+	}
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the server")
+	watch := flag.Duration("watch", 0, "poll this often, redrawing the screen, until interrupted (0 = print once)")
+	output := flag.String("output", "json", "output format: "+strings.Join(rendererNames(), ", "))
+	flag.Parse()
+
+	render, ok := renderers[*output]
+	if !ok {
+		log.Fatalf("invalid -output %q: use one of %s", *output, strings.Join(rendererNames(), ", "))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, strings.TrimSuffix(*baseURL, "/"), *watch, render); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+// a struct with a nested one, which the table flattens
+type calibration struct {
+	Offset float64
+	Scale  float64
+}
+
+type calibratedReading struct {
+	Header   string
+	Cal      calibration
+	Readings []float64
+}
+
+var v2Sample = schemas.V2Reading{
+	Header:            "Four score and seven years ago",
+	RawReadings:       []float64{20.25, -3.5, 18},
+	FilteredReadings:  []float64{10.125, 3.3125, 10.65625},
+	Sequence:          7,
+	GeneratedAtUnixMs: 1625000000000,
+}
+
+// the payloads the renderers are checked against, one per kind of server
+var fixtures = []struct {
+	name  string
+	value interface{}
+}{
+	{"v1", &schemas.V1Reading{Readings: []float32{20.5, 21.25, 19.875}}},
+	{"v2", &v2Sample},
+	{"v3", &schemas.V3Reading{Header: "in F", RawReadings: []float64{68.9}, FilteredReadings: []float64{68.9}, Sequence: 3, GeneratedAtUnixMs: 1625000000000, Unit: "F"}},
+	{"nested struct", &calibratedReading{Header: "calibrated", Cal: calibration{-0.75, 1.02}, Readings: []float64{1, 2}}},
+	{"bare slice", &[]float64{1.5, 2.5}},
+}
+
+// fixture encodes v with its own schema, and decodes it the way the client does:
+// with the schema as the server sends it, into its Go type
+func fixture(v interface{}) (*sample, error) {
+	writerSchema := schemer.SchemaOf(v)
+	var payload bytes.Buffer
+	if err := writerSchema.Encode(&payload, v); err != nil {
+		return nil, err
+	}
+	schema, err := schemerclient.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		return nil, err
+	}
+	return decodeSample(schema, payload.Bytes())
+}
+
+// the v2 fixture and the one a poll later, with four changes: Header, Sequence,
+// the second filtered reading, and a new raw reading
+func v2Pair() (prev, cur *sample, err error) {
+	next := v2Sample
+	next.Header = "Four score and eight years ago"
+	next.Sequence++
+	next.FilteredReadings = []float64{10.125, 21.5, 10.65625}
+	next.RawReadings = append(append([]float64(nil), v2Sample.RawReadings...), -1)
+
+	if prev, err = fixture(&v2Sample); err != nil {
+		return nil, nil, err
+	}
+	cur, err = fixture(&next)
+	return prev, cur, err
+}
+
+func bracket(s string) string { return "<<" + s + ">>" }
+
+var bracketed = regexp.MustCompile(`<<(.*?)>>`)
+
+// marked returns the bracketed parts of s, sorted
+func marked(s string) []string {
+	var texts []string
+	for _, m := range bracketed.FindAllStringSubmatch(s, -1) {
+		texts = append(texts, m[1])
+	}
+	sort.Strings(texts)
+	return texts
+}
+
+// eachFixture renders every fixture with render, nothing marked, and calls check
+// with the output, in a subtest per fixture
+func eachFixture(t *testing.T, render renderer, check func(s *sample, out string) error) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			s, err := fixture(f.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := render(&out, s, nil, bracket); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(out.String(), "<<") {
+				t.Fatalf("marked changes on the first poll:\n%s", out.String())
+			}
+			if err := check(s, out.String()); err != nil {
+				t.Fatalf("%v\n%s", err, out.String())
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	eachFixture(t, renderJSON, func(s *sample, out string) error {
+		// encoding/json reads it back into the same type
+		got := reflect.New(s.value.Type())
+		if err := json.Unmarshal([]byte(out), got.Interface()); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got.Elem().Interface(), s.value.Interface()) {
+			return fmt.Errorf("read back %+v, rendered %+v", got.Elem(), s.value)
+		}
+		// and it is indented like encoding/json's
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, []byte(out), "", "  "); err != nil {
+			return err
+		}
+		if indented.String() != out {
+			return fmt.Errorf("indented differently from json.Indent:\n%s", indented.String())
+		}
+		return nil
+	})
+}
+
+func TestJSONChanges(t *testing.T) {
+	prev, cur, err := v2Pair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := renderJSON(&out, cur, prev, bracket); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`"Four score and eight years ago"`, "-1", "21.5", "8"}
+	if got := marked(out.String()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("marked %q, expected %q:\n%s", got, want, out.String())
+	}
+}
+
+// starts returns the positions in line where a column starts: after two or more
+// spaces, or at the beginning
+func starts(line string) []int {
+	var positions []int
+	for i := range line {
+		if line[i] != ' ' && (i == 0 || i >= 2 && line[i-2:i] == "  ") {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+func TestTable(t *testing.T) {
+	eachFixture(t, renderTable, func(s *sample, out string) error {
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+
+		// the single values, each in its own row, with the values lined up
+		valueColumn := -1
+		for len(lines) > 0 && lines[0] != "" && !strings.HasPrefix(lines[0], "#") {
+			p := starts(lines[0])
+			if len(p) != 2 || valueColumn >= 0 && p[1] != valueColumn {
+				return fmt.Errorf("row %q isn't aligned with the others", lines[0])
+			}
+			valueColumn = p[1]
+			lines = lines[1:]
+		}
+		if len(lines) > 0 && lines[0] == "" {
+			lines = lines[1:]
+		}
+
+		// the lists, a column each
+		var columns []namedValue
+		for _, f := range topLevel(s.value) {
+			if v := reflect.Indirect(f.value); v.Kind() == reflect.Slice {
+				columns = append(columns, namedValue{f.name, f.path, v})
+			}
+		}
+		if len(lines) == 0 {
+			return fmt.Errorf("no table of readings")
+		}
+		header := lines[0]
+		positions := starts(header)
+		if len(positions) != len(columns)+1 {
+			return fmt.Errorf("header %q, expected # and %d columns", header, len(columns))
+		}
+		for i, c := range columns {
+			if !strings.HasPrefix(header[positions[i+1]:], c.name) {
+				return fmt.Errorf("header %q: column %d isn't %s", header, i+1, c.name)
+			}
+			for r := 0; r < c.value.Len(); r++ {
+				if r+1 >= len(lines) {
+					return fmt.Errorf("%s[%d] is missing", c.name, r)
+				}
+				row := lines[r+1]
+				want := fmt.Sprint(c.value.Index(r).Interface())
+				if len(row) < positions[i+1] || !strings.HasPrefix(row[positions[i+1]:], want) {
+					return fmt.Errorf("row %q doesn't have %s[%d] = %s under its header", row, c.name, r, want)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func TestTableChanges(t *testing.T) {
+	prev, cur, err := v2Pair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := renderTable(&out, cur, prev, bracket); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-1", "21.5", "8", "Four score and eight years ago"}
+	if got := marked(out.String()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("marked %q, expected %q:\n%s", got, want, out.String())
+	}
+}
+
+// hexBytes reads the payload back out of raw's output
+func hexBytes(out string) ([]byte, error) {
+	var payload []byte
+	for _, line := range strings.Split(out, "\n")[1:] {
+		if line == "" {
+			continue
+		}
+		end := strings.Index(line, "|")
+		if end < 0 {
+			return nil, fmt.Errorf("line %q has no text column", line)
+		}
+		b, err := hex.DecodeString(strings.Join(strings.Fields(line[9:end]), ""))
+		if err != nil {
+			return nil, fmt.Errorf("line %q: %w", line, err)
+		}
+		payload = append(payload, b...)
+	}
+	return payload, nil
+}
+
+func TestRaw(t *testing.T) {
+	eachFixture(t, renderRaw, func(s *sample, out string) error {
+		if first := fmt.Sprintf("%d bytes\n", len(s.payload)); !strings.HasPrefix(out, first) {
+			return fmt.Errorf("doesn't start with %q", first)
+		}
+		got, err := hexBytes(out)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, s.payload) {
+			return fmt.Errorf("read back % x, the payload is % x", got, s.payload)
+		}
+		// the text column lines up on every line, the last one too
+		bar := -1
+		for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n")[1:] {
+			i := strings.Index(line, "|")
+			if bar >= 0 && i != bar {
+				return fmt.Errorf("line %q: the text column is at %d, not %d", line, i, bar)
+			}
+			bar = i
+		}
+		return nil
+	})
+}
+
+func TestRawChanges(t *testing.T) {
+	prev, cur, err := v2Pair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := renderRaw(&out, cur, prev, bracket); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for i, c := range cur.payload {
+		if i >= len(prev.payload) || prev.payload[i] != c {
+			want = append(want, fmt.Sprintf("%02x", c))
+		}
+	}
+	sort.Strings(want)
+	if got := marked(out.String()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("marked %q, expected the %d bytes that changed, %q", got, len(want), want)
+	}
+
+	// with the marks taken out, it's the new payload
+	got, err := hexBytes(bracketed.ReplaceAllString(out.String(), "$1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, cur.payload) {
+		t.Fatalf("read back % x, the payload is % x", got, cur.payload)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// a sample is one poll's payload, and what it decoded to
+type sample struct {
+	payload []byte
+	value   reflect.Value // a value of the type schemer derives from the schema
+}
+
+// a renderer writes cur to w, passing every value (or, for raw, every byte) that
+// differs from prev through mark. prev is nil on the first poll, when nothing is
+// marked.
+type renderer func(w io.Writer, cur, prev *sample, mark func(string) string) error
+
+var renderers = map[string]renderer{
+	"json":  renderJSON,
+	"table": renderTable,
+	"raw":   renderRaw,
+}
+
+// rendererNames lists the renderers for usage and error messages
+func rendererNames() []string {
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isLeaf reports whether v is printed as a single value: anything but structs,
+// collections and the pointers and interfaces around them. A []byte is a leaf,
+// written as base64 in JSON like encoding/json does.
+func isLeaf(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Ptr, reflect.Interface:
+		return false
+	case reflect.Slice, reflect.Array:
+		return v.Type().Elem().Kind() == reflect.Uint8
+	}
+	return true
+}
+
+// walk calls leaf for every leaf of v, with its path: "Cal.Scale" for a struct
+// field, "Readings[3]" for an element, `Tags["site"]` for a map value
+func walk(v reflect.Value, path string, leaf func(path string, v reflect.Value)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			leaf(path, v)
+			return
+		}
+		walk(v.Elem(), path, leaf)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.PkgPath == "" {
+				walk(v.Field(i), join(path, f.Name), leaf)
+			}
+		}
+	case reflect.Map:
+		for _, k := range sortedKeys(v) {
+			walk(v.MapIndex(k), fmt.Sprintf("%s[%q]", path, fmt.Sprint(k.Interface())), leaf)
+		}
+	default:
+		if isLeaf(v) {
+			leaf(path, v)
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i), leaf)
+		}
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// sortedKeys returns the keys of the map v, in the order of their printed form
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	return keys
+}
+
+func format(v reflect.Value) string {
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return "null"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// leaves maps the path of every leaf of s to its printed value, for telling what
+// changed. It is nil for a nil sample.
+type leaves map[string]string
+
+func leavesOf(s *sample) leaves {
+	if s == nil {
+		return nil
+	}
+	l := leaves{}
+	walk(s.value, "", func(path string, v reflect.Value) {
+		l[path] = format(v)
+	})
+	return l
+}
+
+// changed reports whether the leaf v at path differs from the one in l (a leaf
+// that is new is a change too)
+func (l leaves) changed(path string, v reflect.Value) bool {
+	if l == nil {
+		return false
+	}
+	old, ok := l[path]
+	return !ok || old != format(v)
+}
+
+// renderJSON writes the sample as indented JSON, with the field names of the
+// schema's Go type. It walks the value itself, rather than leaving it to
+// encoding/json, so it can mark the values that changed.
+func renderJSON(w io.Writer, cur, prev *sample, mark func(string) string) error {
+	var b bytes.Buffer
+	if err := writeJSON(&b, cur.value, "", "", leavesOf(prev), mark); err != nil {
+		return err
+	}
+	b.WriteByte('\n')
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func writeJSON(b *bytes.Buffer, v reflect.Value, path, indent string, prev leaves, mark func(string) string) error {
+	inner := indent + "  "
+	switch {
+	case (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil():
+		return writeJSON(b, v.Elem(), path, indent, prev, mark)
+
+	case v.Kind() == reflect.Struct:
+		b.WriteString("{")
+		first := true
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if !first {
+				b.WriteString(",")
+			}
+			first = false
+			name, _ := json.Marshal(f.Name)
+			fmt.Fprintf(b, "\n%s%s: ", inner, name)
+			if err := writeJSON(b, v.Field(i), join(path, f.Name), inner, prev, mark); err != nil {
+				return err
+			}
+		}
+		if !first {
+			b.WriteString("\n" + indent)
+		}
+		b.WriteString("}")
+		return nil
+
+	case v.Kind() == reflect.Map && !v.IsNil():
+		b.WriteString("{")
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			key := fmt.Sprint(k.Interface())
+			name, _ := json.Marshal(key)
+			fmt.Fprintf(b, "\n%s%s: ", inner, name)
+			if err := writeJSON(b, v.MapIndex(k), fmt.Sprintf("%s[%q]", path, key), inner, prev, mark); err != nil {
+				return err
+			}
+		}
+		if v.Len() > 0 {
+			b.WriteString("\n" + indent)
+		}
+		b.WriteString("}")
+		return nil
+
+	case (v.Kind() == reflect.Slice && !v.IsNil() || v.Kind() == reflect.Array) && !isLeaf(v):
+		b.WriteString("[")
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n" + inner)
+			if err := writeJSON(b, v.Index(i), fmt.Sprintf("%s[%d]", path, i), inner, prev, mark); err != nil {
+				return err
+			}
+		}
+		if v.Len() > 0 {
+			b.WriteString("\n" + indent)
+		}
+		b.WriteString("]")
+		return nil
+	}
+
+	// a leaf, or a nil pointer, map or slice, which is null
+	text, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if prev.changed(path, v) {
+		text = []byte(mark(string(text)))
+	}
+	b.Write(text)
+	return nil
+}
+
+// a cell of a table: its text, and whether it is to be marked
+type cell struct {
+	text    string
+	changed bool
+}
+
+// writeColumns writes rows with every column as wide as its widest cell. The
+// padding goes by the unmarked text, since tabwriter would count the marking
+// towards the width.
+func writeColumns(w io.Writer, rows [][]cell, mark func(string) string) error {
+	var widths []int
+	for _, row := range rows {
+		for i, c := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(c.text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	for _, row := range rows {
+		var line strings.Builder
+		for i, c := range row {
+			text := c.text
+			if c.changed {
+				text = mark(text)
+			}
+			line.WriteString(text)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c.text)+2))
+			}
+		}
+		b.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// renderTable writes the sample as two aligned tables: one row per single
+// value (with nested fields flattened, as in "Cal.Scale"), then the top-level
+// lists of single values, such as the readings, side by side in columns, with an
+// index on each row
+func renderTable(w io.Writer, cur, prev *sample, mark func(string) string) error {
+	prevLeaves := leavesOf(prev)
+
+	var scalars [][]cell
+	var columns []namedValue
+	for _, f := range topLevel(cur.value) {
+		v := reflect.Indirect(f.value)
+		if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && !isLeaf(v) && isLeaf(reflect.Zero(v.Type().Elem())) {
+			columns = append(columns, namedValue{f.name, f.path, v})
+			continue
+		}
+		walk(f.value, f.path, func(path string, v reflect.Value) {
+			name := path
+			if name == "" {
+				name = f.name
+			}
+			scalars = append(scalars, []cell{{text: name}, {format(v), prevLeaves.changed(path, v)}})
+		})
+	}
+
+	if len(scalars) > 0 {
+		if err := writeColumns(w, scalars, mark); err != nil {
+			return err
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	if len(scalars) > 0 {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+
+	header := []cell{{text: "#"}}
+	rowCount := 0
+	for _, c := range columns {
+		header = append(header, cell{text: c.name})
+		if n := c.value.Len(); n > rowCount {
+			rowCount = n
+		}
+	}
+	rows := [][]cell{header}
+	for r := 0; r < rowCount; r++ {
+		row := []cell{{text: fmt.Sprint(r)}}
+		for _, c := range columns {
+			if r >= c.value.Len() {
+				row = append(row, cell{})
+				continue
+			}
+			v := c.value.Index(r)
+			row = append(row, cell{format(v), prevLeaves.changed(fmt.Sprintf("%s[%d]", c.path, r), v)})
+		}
+		rows = append(rows, row)
+	}
+	return writeColumns(w, rows, mark)
+}
+
+// a top-level value: its name in a table, and its path for walk
+type namedValue struct {
+	name, path string
+	value      reflect.Value
+}
+
+// topLevel returns the fields of v if it is a struct, and v itself, named
+// "value", if it isn't (a server can send a bare slice)
+func topLevel(v reflect.Value) []namedValue {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return []namedValue{{"value", "", v}}
+	}
+	var fields []namedValue
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Type().Field(i); f.PkgPath == "" {
+			fields = append(fields, namedValue{f.Name, f.Name, v.Field(i)})
+		}
+	}
+	return fields
+}
+
+// renderRaw writes the payload in hex, 16 bytes to a line with their offset and
+// the printable ones as text, like hexdump -C. The bytes that differ from the
+// previous payload, or that it didn't have, are marked.
+func renderRaw(w io.Writer, cur, prev *sample, mark func(string) string) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d bytes\n", len(cur.payload))
+	for offset := 0; offset < len(cur.payload); offset += 16 {
+		line := cur.payload[offset:]
+		if len(line) > 16 {
+			line = line[:16]
+		}
+
+		fmt.Fprintf(&b, "%08x ", offset)
+		for i, c := range line {
+			if i == 8 {
+				b.WriteString(" ")
+			}
+			text := fmt.Sprintf("%02x", c)
+			if at := offset + i; prev != nil && (at >= len(prev.payload) || prev.payload[at] != c) {
+				text = mark(text)
+			}
+			b.WriteString(" " + text)
+		}
+		// pad a short last line so its text lines up
+		for i := len(line); i < 16; i++ {
+			if i == 8 {
+				b.WriteString(" ")
+			}
+			b.WriteString("   ")
+		}
+
+		b.WriteString("  |")
+		for _, c := range line {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			b.WriteByte(c)
+		}
+		b.WriteString("|\n")
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,181 @@
+package e2e
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pairing is a server and a client to run against it. Adding a new example is a
+// matter of adding an entry to pairings.
+type pairing struct {
+	server string   // server program dir, relative to the repo root
+	client string   // client program dir, relative to the repo root
+	env    []string // extra server environment, e.g. "TLS_SELF_SIGNED=1"
+	ready  string   // path that answers 200 once the server is up; default /get-schema/
+	args   []string // extra client arguments; -url is added automatically
+	expect []string // substrings that must appear in the client's output
+}
+
+var pairings = []pairing{
+	{
+		server: "client-server/server/v1",
+		client: "client-server/client/v1",
+		expect: []string{"readings: ["},
+	},
+	{
+		server: "client-server/server/v2",
+		client: "client-server/client/v2",
+		expect: []string{"header: ", "raw readings: [", "readings: ["},
+	},
+	{
+		// the old client must keep working against the new server
+		server: "client-server/server/v2",
+		client: "client-server/client/v1",
+		expect: []string{"readings: ["},
+	},
+	{
+		server: "client-server/server/v1",
+		client: "client-server/client/v2",
+		expect: []string{"readings: ["},
+	},
+	{
+		server: "client-server/server/v2",
+		client: "client-server/client/bundle",
+		expect: []string{"sequence: ", "readings: ["},
+	},
+	{
+		server: "client-server/server/v2",
+		client: "client-server/client/bundle",
+		args:   []string{"-framed"},
+		expect: []string{"sequence: ", "readings: ["},
+	},
+	{
+		server: "client-server/server/v2",
+		client: "client-server/client/fallback",
+		expect: []string{"header: ", "readings: ["},
+	},
+	{
+		// schema and data over https, with the certificate generated at startup
+		server: "client-server/server/v2",
+		client: "client-server/client/v2",
+		env:    []string{"TLS_SELF_SIGNED=1"},
+		args:   []string{"-insecure"},
+		expect: []string{"header: ", "readings: ["},
+	},
+	{
+		// v3 adds a Unit field that the older clients don't know about
+		server: "client-server/server/v3",
+		client: "client-server/client/v2",
+		expect: []string{"header: ", "raw readings: [", "readings: ["},
+	},
+	{
+		server: "client-server/server/v3",
+		client: "client-server/client/v1",
+		expect: []string{"readings: ["},
+	},
+	{
+		server: "client-server/server/v2",
+		client: "client-server/client/stats",
+		args:   []string{"-window", "3", "-windows", "1", "-interval", "500ms"},
+		expect: []string{"window 1: ", "stddev "},
+	},
+	{
+		server: "client-server/server/v2",
+		client: "cmd/schemer-bench-client",
+		env:    []string{"WARMUP=sync"},
+		args:   []string{"-c", "4", "-duration", "1s", "-warmup", "200ms"},
+		expect: []string{"requests/sec", "latency p99", "decode errors    0"},
+	},
+	{
+		// one generic client for every server version, with no struct compiled in
+		server: "client-server/server/v1",
+		client: "cmd/schemer-client",
+		env:    []string{"WARMUP=sync"},
+		expect: []string{`"Readings": [`},
+	},
+	{
+		server: "client-server/server/v2",
+		client: "cmd/schemer-client",
+		env:    []string{"WARMUP=sync"},
+		args:   []string{"-output", "table"},
+		expect: []string{"Header ", "Sequence ", "#  RawReadings "},
+	},
+	{
+		server: "client-server/server/v3",
+		client: "cmd/schemer-client",
+		env:    []string{"WARMUP=sync"},
+		args:   []string{"-output", "raw"},
+		expect: []string{" bytes\n00000000  "},
+	},
+	{
+		// every sensor type decoded without the client knowing any of them
+		server: "client-server/server/sensors",
+		client: "client-server/client/sensors",
+		ready:  "/sensors",
+		expect: []string{"door (schema ", "humidity (schema ", "temperature (schema "},
+	},
+}
+
+// run starts the server of p, runs its client and checks the result
+func run(h *Harness, p pairing) error {
+	ready := p.ready
+	if ready == "" {
+		ready = "/get-schema/"
+	}
+	server, err := h.StartServer(p.server, ready, p.env...)
+	if err != nil {
+		return err
+	}
+	defer server.Stop()
+
+	args := append([]string{"-url", server.URL}, p.args...)
+	out, code, err := h.RunClient(p.client, 30*time.Second, args...)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("client exited with status %d:\n%s", code, out)
+	}
+	for _, e := range p.expect {
+		if !strings.Contains(out, e) {
+			return fmt.Errorf("client output does not contain %q:\n%s", e, out)
+		}
+	}
+	return nil
+}
+
+// name says which client runs against which server, and how
+func (p pairing) name() string {
+	name := p.client
+	if len(p.args) > 0 {
+		name += " " + strings.Join(p.args, " ")
+	}
+	name += " -> " + p.server
+	if len(p.env) > 0 {
+		name += " " + strings.Join(p.env, " ")
+	}
+	return name
+}
+
+func TestPairings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and runs every example binary")
+	}
+
+	h, err := NewHarness("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	for _, p := range pairings {
+		p := p
+		t.Run(p.name(), func(t *testing.T) {
+			if err := run(h, p); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// arrays compares a fixed-size array field with a slice field holding the same
+// readings: what each looks like in the schema, how many bytes each encodes into,
+// and whether data written with one can be read with the other. That last part
+// matters when migrating a struct from [8]float64 to []float64 (or back) while
+// old writers or readers are still around.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/bminer/schemer"
+)
+
+type arrayStruct struct {
+	Readings [8]float64
+}
+
+type sliceStruct struct {
+	Readings []float64
+}
+
+// shortArrayStruct can't hold all 8 readings
+type shortArrayStruct struct {
+	Readings [4]float64
+}
+
+// encode returns the binary schema and the encoded data for v
+func encode(v interface{}) ([]byte, []byte) {
+	writerSchema := schemer.SchemaOf(v)
+
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, v); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+	return writerSchema.MarshalSchemer(), encodedData.Bytes()
+}
+
+// decode parses binarySchema and uses it to decode data into dest
+func decode(binarySchema, data []byte, dest interface{}) error {
+	writerSchema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		return err
+	}
+	return writerSchema.Decode(bytes.NewReader(data), dest)
+}
+
+func jsonSchema(v interface{}) string {
+	b, err := schemer.SchemaOf(v).MarshalJSON()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(b)
+}
+
+func main() {
+
+	readings := [8]float64{20.9, 21.0, 21.2, 21.1, 20.8, 21.3, 21.0, 20.9}
+	array := &arrayStruct{Readings: readings}
+	slice := &sliceStruct{Readings: readings[:]}
+
+	arraySchema, arrayData := encode(array)
+	sliceSchema, sliceData := encode(slice)
+
+	fmt.Println("array schema:", jsonSchema(array))
+	fmt.Println("slice schema:", jsonSchema(slice))
+	fmt.Printf("array encodes into %d bytes, slice into %d bytes\n", len(arrayData), len(sliceData))
+	fmt.Println()
+
+	// array writer, slice reader
+	var toSlice sliceStruct
+	if err := decode(arraySchema, arrayData, &toSlice); err != nil {
+		fmt.Println("array -> slice: error:", err)
+	} else {
+		fmt.Println("array -> slice:", toSlice.Readings)
+	}
+
+	// slice writer, array reader of the same length
+	var toArray arrayStruct
+	if err := decode(sliceSchema, sliceData, &toArray); err != nil {
+		fmt.Println("slice -> [8]array: error:", err)
+	} else {
+		fmt.Println("slice -> [8]array:", toArray.Readings)
+	}
+
+	// slice writer, array reader too short for the data
+	var toShort shortArrayStruct
+	if err := decode(sliceSchema, sliceData, &toShort); err != nil {
+		fmt.Println("slice -> [4]array: error:", err)
+	} else {
+		fmt.Println("slice -> [4]array:", toShort.Readings)
+	}
+
+	// array writer, array reader of a different length
+	toShort = shortArrayStruct{}
+	if err := decode(arraySchema, arrayData, &toShort); err != nil {
+		fmt.Println("[8]array -> [4]array: error:", err)
+	} else {
+		fmt.Println("[8]array -> [4]array:", toShort.Readings)
+	}
+}
@@ -0,0 +1,83 @@
+// bytefield shows schemer carrying an opaque binary blob (here a small PNG image)
+// in a []byte field next to ordinary structured fields. The blob comes back byte
+// for byte, embedded zero bytes included, and the example prints how much framing
+// schemer adds on top of the raw blob.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+
+	"github.com/bminer/schemer"
+)
+
+type sourceStruct struct {
+	Name string
+	Blob []byte // opaque binary data, e.g. a thumbnail from the sensor's camera
+}
+
+// thumbnail renders a tiny gradient image as a PNG. PNG files are full of zero
+// bytes, which makes them a good test for binary safety.
+func thumbnail() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		log.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func main() {
+
+	blob := thumbnail()
+	zeros := bytes.Count(blob, []byte{0})
+	fmt.Printf("blob is a %d byte PNG containing %d zero bytes\n", len(blob), zeros)
+
+	structToEncode := sourceStruct{Name: "camera-1", Blob: blob}
+	writerSchema := schemer.SchemaOf(&structToEncode)
+
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, structToEncode); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+
+	// how much does schemer add around the blob? Encode the blob on its own too, so
+	// the cost of the Name field doesn't muddy the numbers
+	var blobOnly bytes.Buffer
+	if err := schemer.SchemaOf(blob).Encode(&blobOnly, blob); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+
+	fmt.Printf("whole struct encoded into %d bytes\n", encodedData.Len())
+	fmt.Printf("blob alone encoded into %d bytes: %d bytes of framing on a %d byte blob\n",
+		blobOnly.Len(), blobOnly.Len()-len(blob), len(blob))
+
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		log.Fatal("cannot decode schema: " + err.Error())
+	}
+
+	var decoded sourceStruct
+	if err := readerSchema.Decode(&encodedData, &decoded); err != nil {
+		log.Fatal("decode error: " + err.Error())
+	}
+
+	if !bytes.Equal(decoded.Blob, blob) {
+		log.Fatalf("blob changed on the way through: got %d bytes, want %d", len(decoded.Blob), len(blob))
+	}
+	if _, err := png.Decode(bytes.NewReader(decoded.Blob)); err != nil {
+		log.Fatal("decoded blob is no longer a valid PNG: " + err.Error())
+	}
+
+	fmt.Printf("decoded %q with a %d byte blob that matches the original exactly\n", decoded.Name, len(decoded.Blob))
+}
@@ -0,0 +1,113 @@
+// concurrentdecode answers the question "can many goroutines share one parsed
+// schema for Decode?" by doing exactly that: it parses one schema, then 50
+// goroutines each decode their own payload with it at the same time and check
+// they got their own values back. Run it under the race detector:
+//
+//	go run -race ./examples/concurrentdecode
+//
+// A schema is only read while decoding, so sharing it is expected to be safe and
+// the race detector should stay quiet. If a schemer upgrade ever changes that,
+// the detector will point at it; -mode switches to the two patterns that are safe
+// regardless:
+//
+//	-mode=shared         one schema, used by every goroutine at once (default)
+//	-mode=per-goroutine  every goroutine parses its own copy of the schema
+//	-mode=mutex          one schema, but Decode calls are serialized with a mutex
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+const workers = 50
+
+func main() {
+	mode := flag.String("mode", "shared", "shared, per-goroutine or mutex")
+	rounds := flag.Int("rounds", 100, "number of decodes per goroutine")
+	flag.Parse()
+
+	binarySchema := schemas.V2WriterSchema().MarshalSchemer()
+	sharedSchema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		log.Fatal("cannot decode schema: " + err.Error())
+	}
+
+	// every goroutine gets a payload of its own, so a mix-up between goroutines
+	// shows up as a wrong value rather than going unnoticed
+	payloads := make([][]byte, workers)
+	for i := range payloads {
+		v := schemas.V2Reading{
+			Header:           fmt.Sprintf("worker %d", i),
+			RawReadings:      []float64{float64(i), float64(i) + 0.5},
+			FilteredReadings: []float64{float64(i)},
+			Sequence:         uint64(i),
+		}
+		var buf bytes.Buffer
+		if err := schemas.V2WriterSchema().Encode(&buf, &v); err != nil {
+			log.Fatal("encode error: " + err.Error())
+		}
+		payloads[i] = buf.Bytes()
+	}
+
+	var decodeMu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			schema := sharedSchema
+			if *mode == "per-goroutine" {
+				var err error
+				if schema, err = schemer.DecodeSchema(binarySchema); err != nil {
+					errs <- err
+					return
+				}
+			}
+
+			for r := 0; r < *rounds; r++ {
+				var dest schemas.V2Reading
+
+				if *mode == "mutex" {
+					decodeMu.Lock()
+				}
+				err := schema.Decode(bytes.NewReader(payloads[i]), &dest)
+				if *mode == "mutex" {
+					decodeMu.Unlock()
+				}
+
+				if err != nil {
+					errs <- fmt.Errorf("worker %d: %w", i, err)
+					return
+				}
+				if dest.Sequence != uint64(i) || dest.Header != fmt.Sprintf("worker %d", i) {
+					errs <- fmt.Errorf("worker %d decoded someone else's data: %+v", i, dest)
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	failed := false
+	for err := range errs {
+		log.Println(err)
+		failed = true
+	}
+	if failed {
+		log.Fatalf("concurrent decoding in %s mode went wrong", *mode)
+	}
+
+	fmt.Printf("%d goroutines x %d decodes in %s mode: every goroutine got its own data back\n", workers, *rounds, *mode)
+}
@@ -0,0 +1,238 @@
+// corruptschema checks what a client does with a binary schema whose field type
+// it doesn't recognise, as it might get from a corrupted response or from a
+// server running a newer schemer with a type this one doesn't have. The schema is
+// for
+//
+//	sourceStruct{Header string, Readings []float64, Flag bool}
+//
+// Rather than hard-code schemer's binary layout, the example finds the byte that
+// identifies Flag's type by building the same schema with Flag as another type
+// and diffing the two: the one byte that differs is it. It then tries all 256
+// values of that byte and sorts them into
+//
+//	parsed   a type code this schemer knows (printed as the JSON of the field
+//	         type it became); a payload for the original schema is then decoded
+//	         with it, and must fail or succeed without panicking
+//	error    DecodeSchema returned an error; the distinct messages are printed,
+//	         along with whether each names the code it didn't understand
+//	panic    DecodeSchema panicked
+//
+// The example exits non-zero if any value makes DecodeSchema (or the decode that
+// follows) panic, since that would take down a client, or if the original value
+// doesn't parse.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bminer/schemer"
+)
+
+type sourceStruct struct {
+	Header   string
+	Readings []float64
+	Flag     bool
+}
+
+// the same struct with Flag as something else, to find the byte that says what
+// type Flag is. The first that changes the schema by exactly one byte is used.
+var alternatives = []interface{}{
+	&struct {
+		Header   string
+		Readings []float64
+		Flag     string
+	}{},
+	&struct {
+		Header   string
+		Readings []float64
+		Flag     int64
+	}{},
+	&struct {
+		Header   string
+		Readings []float64
+		Flag     float64
+	}{},
+	&struct {
+		Header   string
+		Readings []float64
+		Flag     float32
+	}{},
+}
+
+// typeByte returns the offset of the byte giving Flag's type in binarySchema
+func typeByte(binarySchema []byte) (int, error) {
+	for _, alt := range alternatives {
+		other := schemer.SchemaOf(alt).MarshalSchemer()
+		if len(other) != len(binarySchema) {
+			continue
+		}
+		offset, diffs := -1, 0
+		for i := range other {
+			if other[i] != binarySchema[i] {
+				offset = i
+				diffs++
+			}
+		}
+		if diffs == 1 {
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("changing Flag's type never changes exactly one byte of the schema")
+}
+
+type outcome struct {
+	schema schemer.Schema
+	err    error
+	panic  interface{}
+}
+
+// parse calls schemer.DecodeSchema, catching a panic
+func parse(binarySchema []byte) (o outcome) {
+	defer func() {
+		o.panic = recover()
+	}()
+	o.schema, o.err = schemer.DecodeSchema(binarySchema)
+	return o
+}
+
+// decode decodes payload with schema, turning a panic into an error
+func decode(schema schemer.Schema, payload []byte) (panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked, err = true, fmt.Errorf("%v", r)
+		}
+	}()
+	var dest sourceStruct
+	return false, schema.Decode(bytes.NewReader(payload), &dest)
+}
+
+// numbers in an error message, so messages that differ only in the code they
+// name are counted together
+var numbers = regexp.MustCompile(`0x[0-9a-fA-F]+|[0-9]+`)
+
+// flagType returns the JSON of the type schema gives Flag
+func flagType(schema schemer.Schema) string {
+	b, err := schema.MarshalJSON()
+	if err != nil {
+		return "(no JSON: " + err.Error() + ")"
+	}
+	var parsed struct {
+		Fields []map[string]interface{} `json:"fields"`
+	}
+	if json.Unmarshal(b, &parsed) == nil {
+		for _, f := range parsed.Fields {
+			if f["name"] == "Flag" {
+				delete(f, "name")
+				b, _ = json.Marshal(f)
+				return string(b)
+			}
+		}
+	}
+	return string(b)
+}
+
+// namesCode reports whether msg mentions code in decimal or hex
+func namesCode(msg string, code byte) bool {
+	msg = strings.ToLower(msg)
+	for _, s := range []string{strconv.Itoa(int(code)), fmt.Sprintf("0x%02x", code), fmt.Sprintf("0x%x", code)} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	structToEncode := sourceStruct{Header: "a header", Readings: []float64{20.5, 21.25}, Flag: true}
+	writerSchema := schemer.SchemaOf(&structToEncode)
+	binarySchema := writerSchema.MarshalSchemer()
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, &structToEncode); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+
+	offset, err := typeByte(binarySchema)
+	if err != nil {
+		log.Fatal(err)
+	}
+	original := binarySchema[offset]
+	fmt.Printf("the %d byte schema gives Flag's type at offset %d: 0x%02x\n\n", len(binarySchema), offset, original)
+
+	parsed := 0
+	parsedCodes := map[string][]byte{} // what the field became -> codes that gave it
+	var parsedOrder []string
+	type errorGroup struct {
+		example string // the message for the first code
+		codes   []byte
+		naming  int // how many messages name their code
+	}
+	errorGroups := map[string]*errorGroup{}
+	var errorOrder []string
+	panics := 0
+	for code := 0; code < 256; code++ {
+		corrupt := append([]byte(nil), binarySchema...)
+		corrupt[offset] = byte(code)
+
+		o := parse(corrupt)
+		switch {
+		case o.panic != nil:
+			fmt.Printf("panic  0x%02x: %v\n", code, o.panic)
+			panics++
+		case o.err != nil:
+			msg := o.err.Error()
+			key := numbers.ReplaceAllString(msg, "N")
+			g, seen := errorGroups[key]
+			if !seen {
+				g = &errorGroup{example: msg}
+				errorGroups[key] = g
+				errorOrder = append(errorOrder, key)
+			}
+			g.codes = append(g.codes, byte(code))
+			if namesCode(msg, byte(code)) {
+				g.naming++
+			}
+		default:
+			panicked, err := decode(o.schema, encodedData.Bytes())
+			if panicked {
+				fmt.Printf("panic  0x%02x: decoding with the schema it parsed to: %v\n", code, err)
+				panics++
+				continue
+			}
+			result := "decodes the payload"
+			if err != nil {
+				result = "payload error: " + err.Error()
+			}
+			key := "Flag " + flagType(o.schema) + ", " + result
+			if _, seen := parsedCodes[key]; !seen {
+				parsedOrder = append(parsedOrder, key)
+			}
+			parsedCodes[key] = append(parsedCodes[key], byte(code))
+			parsed++
+		}
+	}
+
+	fmt.Printf("parsed: %d codes\n", parsed)
+	for _, key := range parsedOrder {
+		codes := parsedCodes[key]
+		fmt.Printf("  %3d codes, e.g. 0x%02x: %s\n", len(codes), codes[0], key)
+	}
+	fmt.Printf("\nerror: %d codes, %d distinct messages\n", 256-parsed-panics, len(errorOrder))
+	for _, key := range errorOrder {
+		g := errorGroups[key]
+		fmt.Printf("  %3d codes, %3d naming their code, e.g. 0x%02x: %s\n", len(g.codes), g.naming, g.codes[0], g.example)
+	}
+	fmt.Printf("\npanic: %d codes\n", panics)
+
+	if o := parse(binarySchema); o.err != nil || o.panic != nil {
+		log.Fatalf("the uncorrupted schema doesn't parse: %v %v", o.err, o.panic)
+	}
+	if panics > 0 {
+		log.Fatal("a corrupted type byte made schemer panic")
+	}
+}
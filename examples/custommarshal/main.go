@@ -0,0 +1,255 @@
+// custommarshal looks for a custom marshaling hook in schemer: a way for a field's
+// type to take over its own encoding and decoding, the way a type implementing
+// json.Marshaler does with encoding/json. Here the type is
+//
+//	type Celsius float64
+//
+// whose hook would round a temperature to a tenth of a degree and clamp it at
+// absolute zero. Celsius implements every interface such a hook could plausibly
+// be detected by: json.Marshaler and json.Unmarshaler, encoding.BinaryMarshaler
+// and encoding.BinaryUnmarshaler, encoding.TextMarshaler and
+// encoding.TextUnmarshaler. Each method counts its calls.
+//
+// What the checks below expect is that there is no such hook: that SchemaOf
+// goes by a field's kind, so a Celsius field is a float64 field to it, with the
+// same schema, the same bytes on the wire, and none of the methods called,
+// during Encode or during Decode, and the value goes across unrounded. That
+// expectation has only been checked against a local stand-in for schemer, not
+// against the release go.mod pins (v0.0.0-20210611192654-982f4821acdc), so
+// treat it as unverified until the example has been run against that release.
+// It is the example's output, not this comment, that settles it: if schemer
+// calls any of the methods, the example exits non-zero, and should be rewritten
+// to show the hook instead.
+//
+// If there is no hook, this is really a request for schemer: SchemaOf should
+// check a field's type for an interface of its own (say, a
+// MarshalSchemer/UnmarshalSchemer pair) the way encoding/json checks for
+// json.Marshaler, and let the type pick the schema it is written with. Until it
+// does, do the conversion at the boundary, as the last check below does: call
+// the rounding yourself before Encode and after Decode.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/bminer/schemer"
+)
+
+// Celsius is a temperature, which should be sent rounded to a tenth of a degree
+type Celsius float64
+
+// absoluteZero is the lowest temperature there is
+const absoluteZero Celsius = -273.15
+
+// Normalize rounds c to a tenth of a degree, and clamps it at absolute zero. It
+// is what the hooks would do.
+func (c Celsius) Normalize() Celsius {
+	if c < absoluteZero {
+		return absoluteZero
+	}
+	return Celsius(math.Round(float64(c)*10) / 10)
+}
+
+// hookCalls counts the calls to the methods below, by name
+var hookCalls = map[string]int{}
+
+func (c Celsius) MarshalJSON() ([]byte, error) {
+	hookCalls["MarshalJSON"]++
+	return json.Marshal(float64(c.Normalize()))
+}
+
+func (c *Celsius) UnmarshalJSON(b []byte) error {
+	hookCalls["UnmarshalJSON"]++
+	var f float64
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	*c = Celsius(f).Normalize()
+	return nil
+}
+
+func (c Celsius) MarshalText() ([]byte, error) {
+	hookCalls["MarshalText"]++
+	return []byte(strconv.FormatFloat(float64(c.Normalize()), 'f', 1, 64)), nil
+}
+
+func (c *Celsius) UnmarshalText(b []byte) error {
+	hookCalls["UnmarshalText"]++
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return err
+	}
+	*c = Celsius(f).Normalize()
+	return nil
+}
+
+func (c Celsius) MarshalBinary() ([]byte, error) {
+	hookCalls["MarshalBinary"]++
+	return c.MarshalText()
+}
+
+func (c *Celsius) UnmarshalBinary(b []byte) error {
+	hookCalls["UnmarshalBinary"]++
+	return c.UnmarshalText(b)
+}
+
+type celsiusReading struct {
+	Header string
+	Temp   Celsius
+}
+
+// the same struct, with a plain float64 where the Celsius was
+type plainReading struct {
+	Header string
+	Temp   float64
+}
+
+// sent is written in every check; rounded, its Temp would be 21.5
+var sent = celsiusReading{"boiler room", 21.456}
+
+// encode encodes v with its own schema
+func encode(v interface{}) (schemer.Schema, []byte, error) {
+	writerSchema := schemer.SchemaOf(v)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, v); err != nil {
+		return nil, nil, fmt.Errorf("encode error: %w", err)
+	}
+	return writerSchema, encodedData.Bytes(), nil
+}
+
+// decode decodes data into dest with writerSchema, starting from the binary
+// schema the way a client would
+func decode(writerSchema schemer.Schema, data []byte, dest interface{}) error {
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		return fmt.Errorf("cannot decode schema: %w", err)
+	}
+	if err := readerSchema.Decode(bytes.NewReader(data), dest); err != nil {
+		return fmt.Errorf("decode error: %w", err)
+	}
+	return nil
+}
+
+// noHooks returns an error naming the hooks that were called since the counts
+// were last reset, if any were
+func noHooks() error {
+	if len(hookCalls) > 0 {
+		return fmt.Errorf("schemer called %v: it has a hook after all, rewrite this example to show it", hookCalls)
+	}
+	return nil
+}
+
+func checkSchema() error {
+	celsiusSchema, err := schemer.SchemaOf(&celsiusReading{}).MarshalJSON()
+	if err != nil {
+		return err
+	}
+	plainSchema, err := schemer.SchemaOf(&plainReading{}).MarshalJSON()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  schema: %s\n", celsiusSchema)
+	if !bytes.Equal(celsiusSchema, plainSchema) {
+		return fmt.Errorf("the Celsius field's schema differs from a float64 one:\n  %s\n  %s", celsiusSchema, plainSchema)
+	}
+	return noHooks()
+}
+
+func checkEncode() error {
+	_, withCelsius, err := encode(&sent)
+	if err != nil {
+		return err
+	}
+	if err := noHooks(); err != nil {
+		return err
+	}
+	_, withFloat, err := encode(&plainReading{sent.Header, float64(sent.Temp)})
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(withCelsius, withFloat) {
+		return fmt.Errorf("the Celsius field encoded as % x, the float64 one as % x", withCelsius, withFloat)
+	}
+
+	// and the value on the wire is the unrounded one
+	writerSchema, data, err := encode(&sent)
+	if err != nil {
+		return err
+	}
+	var got plainReading
+	if err := decode(writerSchema, data, &got); err != nil {
+		return err
+	}
+	fmt.Printf("  sent %g, the wire has %g\n", sent.Temp, got.Temp)
+	if got.Temp != float64(sent.Temp) {
+		return fmt.Errorf("sent %g, decoded %g as a plain float64", sent.Temp, got.Temp)
+	}
+	return noHooks()
+}
+
+func checkDecode() error {
+	writerSchema, data, err := encode(&plainReading{sent.Header, float64(sent.Temp)})
+	if err != nil {
+		return err
+	}
+	var got celsiusReading
+	if err := decode(writerSchema, data, &got); err != nil {
+		return err
+	}
+	fmt.Printf("  the wire has %g, decoded %g\n", sent.Temp, got.Temp)
+	if got.Temp != sent.Temp {
+		return fmt.Errorf("decoded %g, expected %g as sent", got.Temp, sent.Temp)
+	}
+	return noHooks()
+}
+
+// checkBoundary does what the hook would have done, by hand: the value is
+// normalized before it is encoded, and again after it is decoded, since a
+// writer that doesn't bother can't be ruled out
+func checkBoundary() error {
+	out := sent
+	out.Temp = out.Temp.Normalize()
+	writerSchema, data, err := encode(&out)
+	if err != nil {
+		return err
+	}
+	var got celsiusReading
+	if err := decode(writerSchema, data, &got); err != nil {
+		return err
+	}
+	got.Temp = got.Temp.Normalize()
+
+	fmt.Printf("  sent %g, normalized to %g, decoded %g\n", sent.Temp, out.Temp, got.Temp)
+	if got.Temp != 21.5 {
+		return fmt.Errorf("decoded %g, expected 21.5", got.Temp)
+	}
+	if c := Celsius(-300).Normalize(); c != absoluteZero {
+		return fmt.Errorf("-300 normalized to %g, expected %g", c, absoluteZero)
+	}
+	return noHooks()
+}
+
+func main() {
+	for _, c := range []struct {
+		name  string
+		check func() error
+	}{
+		{"schema: a Celsius field is a float64 field", checkSchema},
+		{"Encode: no hook called, the value is sent unrounded", checkEncode},
+		{"Decode: no hook called, the value arrives unrounded", checkDecode},
+		{"workaround: normalize at the boundary", checkBoundary},
+	} {
+		hookCalls = map[string]int{}
+		if err := c.check(); err != nil {
+			log.Fatalf("%s: %v", c.name, err)
+		}
+		fmt.Println("ok  ", c.name)
+	}
+
+	fmt.Println("\nthe schemer this was built with called none of the hooks: it encoded the field by its kind, whatever methods its type has")
+}
@@ -0,0 +1,87 @@
+// delta shows how to avoid re-sending a large sensor array on every update,
+// using internal/delta. The server keeps a ring buffer of recent snapshots, and
+// /get-delta/?since=SEQ answers with just the readings that changed since SEQ.
+// If SEQ has already fallen out of the ring buffer, it answers 409 Conflict, and
+// the client has to start over from a full /get-snapshot/.
+//
+// The server and client run in the same program, and the client follows the
+// server one update at a time. Part way through, it falls far enough behind to
+// go through the 409 resync. internal/delta's tests check the state the client
+// rebuilds matches the server's.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http/httptest"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/delta"
+	"github.com/bminer/schemer"
+)
+
+const (
+	numReadings  = 1000 // size of the sensor array
+	historySize  = 16   // snapshots the server keeps for computing deltas
+	updates      = 60   // updates the client follows
+	fallBehindAt = 35   // update at which the client stops polling for a while
+)
+
+// encodedSize returns how many bytes v encodes into
+func encodedSize(v interface{}) int {
+	var buf bytes.Buffer
+	if err := schemer.SchemaOf(v).Encode(&buf, v); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+	return buf.Len()
+}
+
+func main() {
+	values := make([]float64, numReadings)
+	for i := range values {
+		values[i] = 21
+	}
+	history := delta.NewHistory(historySize, values)
+	ts := httptest.NewServer(history.Handler())
+	defer ts.Close()
+
+	// change a handful of readings, like a real array where most sensors hold
+	// steady between updates
+	rng := rand.New(rand.NewSource(1))
+	step := func() {
+		history.Update(func(values []float64) {
+			for n := 1 + rng.Intn(5); n > 0; n-- {
+				values[rng.Intn(len(values))] += rng.NormFloat64()
+			}
+		})
+	}
+
+	c, err := delta.Follow(ts.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fullBytes := 0 // what the same updates would have cost as full snapshots
+	for u := 1; u <= updates; u++ {
+		step()
+		if u == fallBehindAt {
+			// stop polling while the server moves on past its history
+			for i := 0; i < historySize; i++ {
+				step()
+			}
+		}
+
+		resyncs := c.Resyncs
+		if err := c.Update(); err != nil {
+			log.Fatal(err)
+		}
+		if c.Resyncs > resyncs {
+			fmt.Printf("  update %d: the server no longer had our sequence, resynced from a full snapshot\n", u)
+		}
+		state := c.State()
+		fullBytes += encodedSize(&state)
+	}
+
+	fmt.Printf("followed %d updates with %d resync(s): deltas cost %d bytes, full snapshots would have cost %d bytes\n",
+		updates, c.Resyncs, c.Bytes, fullBytes)
+}
@@ -0,0 +1,120 @@
+// dryrun shows package dryrun validating a value against a schema before
+// anything is written. The schema is for
+//
+//	sourceStruct{Header string, Readings []float64}
+//
+// and the values checked against it are one of that type, one whose Readings
+// are strings (a field type the schema doesn't expect), and one that isn't a
+// struct at all. Only the first may pass.
+//
+// It then serves the bad value over HTTP twice. Encoding straight into the
+// ResponseWriter can fail after it has written part of the payload (Header comes
+// before the bad field), and the first byte written commits a 200 status: the
+// client gets half a payload and nothing to tell it so. Checking with
+// dryrun.Encode first turns the same mistake into a 400 before a byte is written.
+//
+// The example exits non-zero if dryrun accepts a bad value or rejects the good
+// one, or if the checked handler doesn't answer 400.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/dryrun"
+	"github.com/bminer/schemer"
+)
+
+type sourceStruct struct {
+	Header   string
+	Readings []float64
+}
+
+// a struct that got Readings wrong
+type stringReadings struct {
+	Header   string
+	Readings []string
+}
+
+var writerSchema = schemer.SchemaOf(&sourceStruct{})
+
+// serve encodes v for every request, checking it with dryrun first if check is
+// set, and returns what a client gets back
+func serve(v interface{}, check bool) (int, []byte, error) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if check {
+			if err := dryrun.Encode(writerSchema, v); err != nil {
+				http.Error(w, "cannot encode: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := writerSchema.Encode(w, v); err != nil {
+			// too late: the status and part of the body are already out
+			log.Printf("encode error after the response started: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
+
+func main() {
+	bad := &stringReadings{Header: "a header that goes out before the error", Readings: []string{"20.5", "21.25"}}
+
+	fmt.Println("dryrun.Encode:")
+	for _, c := range []struct {
+		name  string
+		value interface{}
+		ok    bool
+	}{
+		{"sourceStruct", &sourceStruct{Header: "ok", Readings: []float64{20.5, 21.25}}, true},
+		{"Readings []string", bad, false},
+		{"not a struct", "20.5, 21.25", false},
+	} {
+		err := dryrun.Encode(writerSchema, c.value)
+		switch {
+		case err != nil && c.ok:
+			log.Fatalf("%s: rejected a value that matches the schema: %v", c.name, err)
+		case err == nil && !c.ok:
+			log.Fatalf("%s: accepted a value the schema doesn't describe", c.name)
+		case err != nil:
+			fmt.Printf("  %-18s rejected: %v\n", c.name, err)
+		default:
+			fmt.Printf("  %-18s ok\n", c.name)
+		}
+	}
+
+	fmt.Println("\nserving the Readings []string value:")
+	status, body, err := serve(bad, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("  encoded directly:   %d, %d bytes of body (% x...)\n", status, len(body), body[:min(len(body), 8)])
+
+	status, body, err = serve(bad, true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if status != http.StatusBadRequest {
+		log.Fatalf("checked with dryrun first: expected 400, got %d", status)
+	}
+	fmt.Printf("  checked first:      %d, %q\n", status, bytes.TrimSpace(body))
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
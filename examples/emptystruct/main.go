@@ -0,0 +1,196 @@
+// emptystruct checks that schemer copes with the degenerate cases: a struct with
+// no fields at all, and one whose fields are all at their zero values. They are
+// easy to dismiss, but they turn up: generated code has empty request and
+// response types, a union's variants often carry no payload (struct{} as the
+// "nothing" case), and a set is a map[string]struct{}. None of them should crash
+// the encoder, or the decoder on the other end.
+//
+// Each check encodes the value, decodes it again, starting from the binary schema
+// the way a client would, and prints the size of the encoding:
+//
+//	struct{}                 the schema and the encoding, and how small it is
+//	all zero                 a V2Reading with nothing set comes back as sent
+//	empty payload            struct{} as a field, between two fields that have data
+//	list and set             []struct{} and map[string]struct{}, where only the
+//	                         length and the keys go on the wire
+//	empty <-> non-empty      decoding a struct{} into a reading leaves the reading
+//	                         as it was, and decoding a reading into a struct{}
+//	                         skips all of it
+//
+// It exits non-zero if any of that doesn't hold.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+type empty struct{}
+
+// the smallest struct that has anything in it, to compare empty with
+type oneBool struct {
+	On bool
+}
+
+// a union's message, whose variant has no payload
+type message struct {
+	Kind    string
+	Payload empty
+	Seq     uint64
+}
+
+// emptySize is the length of the encoding of a struct{}, reported at the end
+var emptySize int
+
+// encode encodes v with its own schema
+func encode(v interface{}) (schemer.Schema, []byte, error) {
+	writerSchema := schemer.SchemaOf(v)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, v); err != nil {
+		return nil, nil, fmt.Errorf("encode error: %w", err)
+	}
+	return writerSchema, encodedData.Bytes(), nil
+}
+
+// decode decodes data into dest with writerSchema, starting from the binary
+// schema the way a client would
+func decode(writerSchema schemer.Schema, data []byte, dest interface{}) error {
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		return fmt.Errorf("cannot decode schema: %w", err)
+	}
+	r := bytes.NewReader(data)
+	if err := readerSchema.Decode(r, dest); err != nil {
+		return fmt.Errorf("decode error: %w", err)
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("decode left %d of %d bytes unread", r.Len(), len(data))
+	}
+	return nil
+}
+
+// roundTrip encodes sent, decodes it into got, and prints the size of the
+// encoding
+func roundTrip(sent, got interface{}) ([]byte, error) {
+	writerSchema, data, err := encode(sent)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("  %T: %d bytes: % x\n", sent, len(data), data)
+	return data, decode(writerSchema, data, got)
+}
+
+func checkEmpty() error {
+	schemaJSON, err := schemer.SchemaOf(&empty{}).MarshalJSON()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  schema: %s\n", schemaJSON)
+
+	var got empty
+	data, err := roundTrip(&empty{}, &got)
+	if err != nil {
+		return err
+	}
+	emptySize = len(data)
+	var one oneBool
+	oneData, err := roundTrip(&oneBool{}, &one)
+	if err != nil {
+		return err
+	}
+	// there is nothing to say about a struct{}, so it should take up less than
+	// the one bool does
+	if len(data) >= len(oneData) {
+		return fmt.Errorf("struct{} took %d bytes, as many as a struct with one bool (%d)", len(data), len(oneData))
+	}
+
+	// and a struct{} given as a value, not through a pointer
+	_, _, err = encode(empty{})
+	return err
+}
+
+func checkAllZero() error {
+	var got schemas.V2Reading
+	if _, err := roundTrip(&schemas.V2Reading{}, &got); err != nil {
+		return err
+	}
+	// a decoder may hand back an empty list for a nil one; both are no readings
+	if got.Header != "" || len(got.RawReadings) != 0 || len(got.FilteredReadings) != 0 || got.Sequence != 0 || got.GeneratedAtUnixMs != 0 {
+		return fmt.Errorf("decoded %+v, expected a zero reading", got)
+	}
+	return nil
+}
+
+func checkPayload() error {
+	sent := message{Kind: "heartbeat", Seq: 42}
+	var got message
+	if _, err := roundTrip(&sent, &got); err != nil {
+		return err
+	}
+	if got != sent {
+		return fmt.Errorf("decoded %+v, expected %+v", got, sent)
+	}
+	return nil
+}
+
+func checkListAndSet() error {
+	list := []empty{{}, {}, {}}
+	var gotList []empty
+	if _, err := roundTrip(&list, &gotList); err != nil {
+		return err
+	}
+	if len(gotList) != len(list) {
+		return fmt.Errorf("sent %d empty structs, decoded %d", len(list), len(gotList))
+	}
+
+	set := map[string]empty{"boiler room": {}, "attic": {}}
+	var gotSet map[string]empty
+	if _, err := roundTrip(&set, &gotSet); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(gotSet, set) {
+		return fmt.Errorf("sent %v, decoded %v", set, gotSet)
+	}
+	return nil
+}
+
+func checkEmptyNonEmpty() error {
+	reading := schemas.V2Reading{Header: "boiler room", FilteredReadings: []float64{20.5}, Sequence: 7}
+	got := reading
+	if _, err := roundTrip(&empty{}, &got); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(got, reading) {
+		return fmt.Errorf("decoding a struct{} changed the reading to %+v", got)
+	}
+
+	var skipped empty
+	_, err := roundTrip(&reading, &skipped)
+	return err
+}
+
+func main() {
+	for _, c := range []struct {
+		name  string
+		check func() error
+	}{
+		{"struct{}: encodes and decodes, smaller than one bool", checkEmpty},
+		{"all zero: a reading with nothing set", checkAllZero},
+		{"empty payload: a struct{} field between two others", checkPayload},
+		{"list and set: []struct{} and map[string]struct{}", checkListAndSet},
+		{"empty <-> non-empty: nothing set, nothing kept", checkEmptyNonEmpty},
+	} {
+		fmt.Println(c.name + ":")
+		if err := c.check(); err != nil {
+			log.Fatalf("%s: %v", c.name, err)
+		}
+		fmt.Println("ok  ", c.name)
+	}
+
+	fmt.Printf("\nschemer handles empty structs: a struct{} encodes to %d bytes\n", emptySize)
+}
@@ -0,0 +1,92 @@
+// fieldsizes shows where the bytes of a v2 payload go, field by field, using
+// package fieldsize. With a handful of readings the Header is a good part of the
+// payload; with a hundred, the two slices of readings are nearly all of it, and
+// dropping RawReadings (which v1 clients never look at) would halve it.
+//
+//	go run ./examples/fieldsizes
+//	go run ./examples/fieldsizes -readings 0,8,1000
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/fieldsize"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// sample builds a reading the way the v2 server does, from a fixed seed so the
+// output doesn't change from run to run
+func sample(readings int) *schemas.V2Reading {
+	v := schemas.V2Reading{
+		Header:            "update at 2021-06-12T00:33:09Z",
+		RawReadings:       sim.New(sim.DefaultConfig, 1).Next(readings),
+		FilteredReadings:  make([]float64, readings),
+		Sequence:          12345,
+		GeneratedAtUnixMs: 1623456789000,
+	}
+	var workingAverage float64
+	for i := range v.RawReadings {
+		workingAverage = (v.RawReadings[i] * 0.5) + (workingAverage * 0.5)
+		v.FilteredReadings[i] = workingAverage
+	}
+	return &v
+}
+
+// printSizes prints one row per field, in struct order
+func printSizes(v *schemas.V2Reading) error {
+	fields, total, err := fieldsize.Sizes(schemas.V2WriterSchema(), v)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d readings: %d bytes\n", len(v.RawReadings), total)
+	sum := 0
+	for _, f := range fields {
+		name := f.Name
+		if f.Tag != "" {
+			name += " (" + f.Tag + ")"
+		}
+		fmt.Printf("  %-28s %6d  %5.1f%%  %s\n", name, f.Bytes, percent(f.Bytes, total), bar(f.Bytes, total))
+		sum += f.Bytes
+	}
+	if sum != total {
+		fmt.Printf("  %-28s %6d  %5.1f%%\n", "(not in any field)", total-sum, percent(total-sum, total))
+	}
+	fmt.Println()
+	return nil
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// bar draws n as a share of total, 40 characters being all of it
+func bar(n, total int) string {
+	if total == 0 {
+		return ""
+	}
+	return strings.Repeat("#", 40*n/total)
+}
+
+func main() {
+	counts := flag.String("readings", "0,8,100", "comma-separated numbers of readings to break down")
+	flag.Parse()
+
+	for _, s := range strings.Split(*counts, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			log.Fatalf("invalid number of readings %q", s)
+		}
+		if err := printSizes(sample(n)); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// grouptree is the worked answer to "how do I send a tree?". A building's sensors
+// are grouped building → floor → room, and the natural Go type for that is
+// recursive:
+//
+//	type group struct {
+//		Name     string
+//		Readings []float64
+//		Children []group
+//	}
+//
+// examples/tree shows what schemer does with a recursive type like this one; a
+// schema that has to contain itself isn't something to build a protocol on either
+// way. So the tree goes over the wire flattened: a list of groups in pre-order,
+// each holding the index of its parent (-1 for the root) instead of its children.
+// A parent always comes before its children, so the reader can rebuild the tree in
+// one pass and reject any list that doesn't describe one. flatten and unflatten
+// below are the helpers; the flat list is an ordinary struct with a slice in it,
+// served and fetched like every other example:
+//
+//	go run ./examples/grouptree
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+// group is the tree as the application uses it
+type group struct {
+	Name     string
+	Readings []float64
+	Children []group
+}
+
+// flatGroup is a group on the wire: its Children are the flatGroups whose Parent
+// is its index
+type flatGroup struct {
+	Name     string
+	Readings []float64
+	Parent   int64 // index into flatTree.Groups, -1 for the root
+}
+
+// flatTree is what the server encodes
+type flatTree struct {
+	Groups []flatGroup
+}
+
+// flatten lists root and everything under it in pre-order
+func flatten(root group) flatTree {
+	var t flatTree
+	var walk func(g group, parent int64)
+	walk = func(g group, parent int64) {
+		index := int64(len(t.Groups))
+		t.Groups = append(t.Groups, flatGroup{Name: g.Name, Readings: g.Readings, Parent: parent})
+		for _, c := range g.Children {
+			walk(c, index)
+		}
+	}
+	walk(root, -1)
+	return t
+}
+
+// unflatten rebuilds the tree flatten listed. The first group must be the root,
+// and every other group's parent must come before it.
+func unflatten(t flatTree) (group, error) {
+	if len(t.Groups) == 0 {
+		return group{}, errors.New("no groups")
+	}
+	if t.Groups[0].Parent != -1 {
+		return group{}, fmt.Errorf("the first group has parent %d, expected the root (-1)", t.Groups[0].Parent)
+	}
+	children := make([][]int, len(t.Groups))
+	for i, g := range t.Groups[1:] {
+		i++
+		if g.Parent < 0 || g.Parent >= int64(i) {
+			return group{}, fmt.Errorf("group %d (%q) has parent %d, which doesn't come before it", i, g.Name, g.Parent)
+		}
+		children[g.Parent] = append(children[g.Parent], i)
+	}
+
+	var build func(i int) group
+	build = func(i int) group {
+		g := group{Name: t.Groups[i].Name, Readings: t.Groups[i].Readings}
+		for _, c := range children[i] {
+			g.Children = append(g.Children, build(c))
+		}
+		return g
+	}
+	return build(0), nil
+}
+
+// sameGroup compares two trees, treating nil and empty slices as the same
+func sameGroup(a, b group) bool {
+	if a.Name != b.Name || len(a.Readings) != len(b.Readings) || len(a.Children) != len(b.Children) {
+		return false
+	}
+	for i := range a.Readings {
+		if a.Readings[i] != b.Readings[i] {
+			return false
+		}
+	}
+	for i := range a.Children {
+		if !sameGroup(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// building is the tree the example serves
+func building() group {
+	room := func(name string, readings ...float64) group { return group{Name: name, Readings: readings} }
+	return group{
+		Name: "building",
+		Children: []group{
+			{Name: "floor 1", Children: []group{room("lobby", 20.5, 20.75), room("kitchen", 22.1)}},
+			{Name: "floor 2", Readings: []float64{19.8}, Children: []group{
+				room("office 201", 21.0, 21.25, 21.5),
+				room("office 202"),
+				{Name: "lab", Children: []group{room("cold room", 4.1, 4.0), room("bench", 21.9)}},
+			}},
+		},
+	}
+}
+
+func printGroup(g group, depth int) {
+	fmt.Printf("%s%s %v\n", strings.Repeat("  ", depth), g.Name, g.Readings)
+	for _, c := range g.Children {
+		printGroup(c, depth+1)
+	}
+}
+
+// serve serves t at /get-schema/ and /get-data/
+func serve(t flatTree) (*httptest.Server, error) {
+	writerSchema := schemer.SchemaOf(&t)
+	binarySchema := writerSchema.MarshalSchemer()
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, &t); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(schemerclient.SchemaPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(binarySchema)
+	})
+	mux.HandleFunc(schemerclient.DataPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(encodedData.Bytes())
+	})
+	return httptest.NewServer(mux), nil
+}
+
+// send serves root flattened, and returns the tree a client rebuilds from it
+func send(root group) (group, error) {
+	ts, err := serve(flatten(root))
+	if err != nil {
+		return group{}, err
+	}
+	defer ts.Close()
+
+	client, err := schemerclient.New(ts.URL)
+	if err != nil {
+		return group{}, err
+	}
+	var t flatTree
+	if err := client.Fetch(context.Background(), &t); err != nil {
+		return group{}, err
+	}
+	return unflatten(t)
+}
+
+func main() {
+	tree := building()
+	fmt.Println("on the wire:")
+	for i, g := range flatten(tree).Groups {
+		fmt.Printf("  %2d  parent %2d  %-10s %v\n", i, g.Parent, g.Name, g.Readings)
+	}
+
+	got, err := send(tree)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !sameGroup(got, tree) {
+		log.Fatal("the rebuilt tree differs from the one sent")
+	}
+	fmt.Println("\nrebuilt by the client:")
+	printGroup(got, 1)
+}
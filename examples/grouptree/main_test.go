@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// generate builds a tree depth levels deep in which every group has between 1 and
+// width children, stopping once it holds about maxGroups groups. Only the
+// groups at the bottom (the rooms) have readings.
+func generate(rnd *rand.Rand, depth, width, maxGroups int) group {
+	count := 1
+	var build func(name string, level int) group
+	build = func(name string, level int) group {
+		g := group{Name: name}
+		if level == depth {
+			g.Readings = make([]float64, rnd.Intn(4))
+			for i := range g.Readings {
+				g.Readings[i] = float64(rnd.Intn(4000)) / 100
+			}
+			return g
+		}
+		n := 1 + rnd.Intn(width)
+		for i := 0; i < n && count < maxGroups; i++ {
+			count++
+			g.Children = append(g.Children, build(fmt.Sprintf("%s.%d", name, i), level+1))
+		}
+		return g
+	}
+	return build("g", 1)
+}
+
+// treeDepth is how many levels g has
+func treeDepth(g group) int {
+	d := 0
+	for _, c := range g.Children {
+		if cd := treeDepth(c); cd > d {
+			d = cd
+		}
+	}
+	return d + 1
+}
+
+// TestRoundTrip sends trees up to 10 deep and 100 wide and checks the client
+// rebuilds each one
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for depth := 1; depth <= 10; depth++ {
+		for _, width := range []int{1, 2, 10, 100} {
+			tree := generate(rnd, depth, width, 5000)
+			got, err := send(tree)
+			if err != nil {
+				t.Fatalf("depth %d, width %d: %v", depth, width, err)
+			}
+			if !sameGroup(got, tree) {
+				t.Fatalf("depth %d, width %d: the rebuilt tree differs from the one sent", depth, width)
+			}
+		}
+	}
+
+	// the generated trees do reach depth 10, and a group can have 100 children
+	if d := treeDepth(generate(rand.New(rand.NewSource(1)), 10, 100, 5000)); d != 10 {
+		t.Errorf("the depth 10 tree is %d deep", d)
+	}
+	wide := group{Name: "wide"}
+	for i := 0; i < 100; i++ {
+		wide.Children = append(wide.Children, group{Name: fmt.Sprint(i), Readings: []float64{float64(i)}})
+	}
+	if got, err := send(wide); err != nil || !sameGroup(got, wide) {
+		t.Errorf("100 children: the rebuilt tree differs from the one sent (%v)", err)
+	}
+}
+
+// TestInvalid checks lists that don't describe a tree are rejected
+func TestInvalid(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		t    flatTree
+	}{
+		{"empty", flatTree{}},
+		{"no root", flatTree{Groups: []flatGroup{{Name: "a", Parent: 0}}}},
+		{"parent after child", flatTree{Groups: []flatGroup{{Parent: -1}, {Parent: 2}, {Parent: 0}}}},
+		{"second root", flatTree{Groups: []flatGroup{{Parent: -1}, {Parent: -1}}}},
+	} {
+		if _, err := unflatten(c.t); err == nil {
+			t.Errorf("%s: unflatten accepted a list that isn't a tree", c.name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// interfacefield tries schemer on struct fields typed interface{}. schemer is
+// schema-driven: the schema is built from the Go types, and an interface{} field
+// has no type until it holds a value. encoding/gob handles this by writing the
+// dynamic type's name into the stream (after gob.Register); schemer has nowhere
+// to put one, so code ported from gob needs to know what happens instead. The
+// example tries each side in turn and reports what schemer does:
+//
+//	writer    a field holding 20.5 in an interface{}: does SchemaOf build a
+//	          schema for it, and does it encode?
+//	changed   the same schema, encoding a value whose field now holds a string
+//	          (what gob would handle with a second registered type)
+//	reader    a concrete float64 on the writer, decoded into an interface{} field
+//
+// Each outcome is printed rather than asserted, since any of them may be an
+// error; a panic is caught and reported as one. Then it shows the alternative
+// that does work: a concrete struct with one field per kind of value and a Kind
+// saying which is set, the way the rest of this repo's schemas are written. The
+// example exits non-zero only if that alternative doesn't survive a round trip.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/bminer/schemer"
+)
+
+// what a struct ported from gob might look like
+type anyValue struct {
+	Name  string
+	Value interface{}
+}
+
+type floatValue struct {
+	Name  string
+	Value float64
+}
+
+// value is the concrete alternative: Kind says which of the other fields holds
+// the value, and the rest stay at their zero values
+type value struct {
+	Name    string
+	Kind    string // "number", "text" or "numbers"
+	Number  float64
+	Text    string
+	Numbers []float64
+}
+
+// try runs f, turning a panic into an error
+func try(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panicked: %v", r)
+		}
+	}()
+	return f()
+}
+
+// roundTrip encodes v with writerSchema and decodes it into dest with the schema
+// a client would have
+func roundTrip(writerSchema schemer.Schema, v, dest interface{}) error {
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, v); err != nil {
+		return fmt.Errorf("encode: %v", err)
+	}
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		return fmt.Errorf("decode schema: %v", err)
+	}
+	if err := readerSchema.Decode(&encodedData, dest); err != nil {
+		return fmt.Errorf("decode: %v", err)
+	}
+	return nil
+}
+
+func report(name string, err error, got interface{}) {
+	if err != nil {
+		fmt.Printf("%-8s error: %v\n", name, err)
+		return
+	}
+	fmt.Printf("%-8s ok: %+v (Value is a %T)\n", name, got, reflect.ValueOf(got).Elem().FieldByName("Value").Interface())
+}
+
+func main() {
+	fmt.Println("interface{} fields:")
+
+	// the writer's field is an interface{}
+	var writerSchema schemer.Schema
+	err := try(func() error {
+		writerSchema = schemer.SchemaOf(&anyValue{Value: 20.5})
+		return nil
+	})
+	if err != nil {
+		report("writer", fmt.Errorf("SchemaOf: %v", err), nil)
+	} else {
+		if jsonSchema, err := writerSchema.MarshalJSON(); err == nil {
+			fmt.Printf("%-8s schema: %s\n", "", jsonSchema)
+		}
+
+		var decoded anyValue
+		err := try(func() error { return roundTrip(writerSchema, &anyValue{Name: "temp", Value: 20.5}, &decoded) })
+		report("writer", err, &decoded)
+
+		decoded = anyValue{}
+		err = try(func() error { return roundTrip(writerSchema, &anyValue{Name: "unit", Value: "C"}, &decoded) })
+		report("changed", err, &decoded)
+	}
+
+	// only the reader's field is an interface{}
+	var decoded anyValue
+	err = try(func() error {
+		return roundTrip(schemer.SchemaOf(&floatValue{}), &floatValue{Name: "temp", Value: 20.5}, &decoded)
+	})
+	report("reader", err, &decoded)
+
+	fmt.Println("\na concrete field per kind instead:")
+	concreteSchema := schemer.SchemaOf(&value{})
+	for _, v := range []value{
+		{Name: "temp", Kind: "number", Number: 20.5},
+		{Name: "unit", Kind: "text", Text: "C"},
+		{Name: "history", Kind: "numbers", Numbers: []float64{20.5, 21.25}},
+	} {
+		var decoded value
+		if err := roundTrip(concreteSchema, &v, &decoded); err != nil {
+			log.Fatalf("%s: %v", v.Kind, err)
+		}
+		// an unset Numbers may come back empty rather than nil
+		if len(decoded.Numbers) == 0 && v.Numbers == nil {
+			decoded.Numbers = nil
+		}
+		if !reflect.DeepEqual(decoded, v) {
+			log.Fatalf("%s: sent %+v, got %+v", v.Kind, v, decoded)
+		}
+		fmt.Printf("%-8s ok: %+v\n", v.Kind, decoded)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// The Avro record equivalent to schemas.V2Reading. Avro has no unsigned
+// integers, so Sequence goes out as a long, which is the same bits for any
+// sequence below 2^63.
+//
+//	{"type": "record", "name": "V2Reading", "fields": [
+//	  {"name": "Header",            "type": "string"},
+//	  {"name": "RawReadings",       "type": {"type": "array", "items": "double"}},
+//	  {"name": "readings",          "type": {"type": "array", "items": "double"}},
+//	  {"name": "Sequence",          "type": "long"},
+//	  {"name": "GeneratedAtUnixMs", "type": "long"}
+//	]}
+//
+// Pulling in an Avro library for a single record isn't worth it, so it is
+// encoded by hand following the spec's binary encoding: fields back to back in
+// schema order, longs as zigzag varints, strings as a long length and the
+// bytes, doubles as 8 little-endian bytes, and an array as one block (its count,
+// then its items) followed by a zero count. Like schemer, Avro relies on the
+// reader having the writer's schema, and sends none of it with the data.
+
+var errAvroTruncated = errors.New("avro: truncated data")
+
+func appendLong(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(v<<1)^uint64(v>>63))
+	return append(b, buf[:n]...)
+}
+
+func appendDoubles(b []byte, values []float64) []byte {
+	if len(values) > 0 {
+		b = appendLong(b, int64(len(values)))
+		var buf [8]byte
+		for _, v := range values {
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+			b = append(b, buf[:]...)
+		}
+	}
+	return appendLong(b, 0)
+}
+
+// marshalAvro appends the Avro encoding of v to b
+func marshalAvro(b []byte, v *schemas.V2Reading) []byte {
+	b = appendLong(b, int64(len(v.Header)))
+	b = append(b, v.Header...)
+	b = appendDoubles(b, v.RawReadings)
+	b = appendDoubles(b, v.FilteredReadings)
+	b = appendLong(b, int64(v.Sequence))
+	return appendLong(b, v.GeneratedAtUnixMs)
+}
+
+// avroReader consumes an Avro encoding from the front of b
+type avroReader struct {
+	b []byte
+}
+
+func (r *avroReader) long() (int64, error) {
+	u, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, errAvroTruncated
+	}
+	r.b = r.b[n:]
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (r *avroReader) string() (string, error) {
+	n, err := r.long()
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || n > int64(len(r.b)) {
+		return "", errAvroTruncated
+	}
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s, nil
+}
+
+// doubles reads an array of doubles into dest, reusing its capacity
+func (r *avroReader) doubles(dest []float64) ([]float64, error) {
+	dest = dest[:0]
+	for {
+		count, err := r.long()
+		if err != nil {
+			return dest, err
+		}
+		if count == 0 {
+			return dest, nil
+		}
+		// a negative count is followed by the block's size in bytes
+		if count < 0 {
+			count = -count
+			if _, err := r.long(); err != nil {
+				return dest, err
+			}
+		}
+		if count > int64(len(r.b)/8) {
+			return dest, errAvroTruncated
+		}
+		for i := int64(0); i < count; i++ {
+			dest = append(dest, math.Float64frombits(binary.LittleEndian.Uint64(r.b)))
+			r.b = r.b[8:]
+		}
+	}
+}
+
+// unmarshalAvro decodes b into v
+func unmarshalAvro(b []byte, v *schemas.V2Reading) error {
+	r := avroReader{b}
+	var err error
+	if v.Header, err = r.string(); err != nil {
+		return err
+	}
+	if v.RawReadings, err = r.doubles(v.RawReadings); err != nil {
+		return err
+	}
+	if v.FilteredReadings, err = r.doubles(v.FilteredReadings); err != nil {
+		return err
+	}
+	sequence, err := r.long()
+	if err != nil {
+		return err
+	}
+	v.Sequence = uint64(sequence)
+	if v.GeneratedAtUnixMs, err = r.long(); err != nil {
+		return err
+	}
+	if len(r.b) != 0 {
+		return fmt.Errorf("avro: %d bytes left over", len(r.b))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// interop puts schemer next to two formats it is often weighed against, on the
+// v2 server's readings: MessagePack (github.com/vmihailenco/msgpack, which
+// schemer itself depends on) and Avro (a minimal encoder for this one record,
+// see avro.go). It prints the encoded size of each, for a range of reading
+// counts; the benchmarks time encoding and decoding a sample with each, and the
+// tests check all three round-trip the same values exactly, without which the
+// comparison would mean nothing.
+//
+// MessagePack is self-describing: every field name travels with every value,
+// so it needs no schema, and pays for that in size on small payloads (and a
+// type byte for every double on large ones). Avro and schemer both leave the
+// field names to a schema the reader already has. What sets schemer apart from
+// Avro is that its schema is built from the Go struct and sent by the server,
+// instead of being written and shared by hand.
+//
+//	go run ./examples/interop
+//	go test -bench . -benchmem ./examples/interop
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func sample(readings int) *schemas.V2Reading {
+	raw := sim.New(sim.DefaultConfig, 1).Next(readings)
+	return &schemas.V2Reading{
+		Header:            "interop",
+		RawReadings:       append([]float64(nil), raw...),
+		FilteredReadings:  append([]float64(nil), raw...),
+		Sequence:          12345,
+		GeneratedAtUnixMs: 1623456789000,
+	}
+}
+
+// a format encodes a sample and decodes it again. Both reuse what they are
+// given (the buffer, the destination), as a client decoding a stream would.
+type format struct {
+	name   string
+	encode func(buf *bytes.Buffer, v *schemas.V2Reading) error
+	decode func(b []byte, dest *schemas.V2Reading) error
+}
+
+func formats() []format {
+	writerSchema := schemas.V2WriterSchema()
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var avro []byte
+	return []format{
+		{"schemer",
+			func(buf *bytes.Buffer, v *schemas.V2Reading) error {
+				return writerSchema.Encode(buf, v)
+			},
+			func(b []byte, dest *schemas.V2Reading) error {
+				return readerSchema.Decode(bytes.NewReader(b), dest)
+			}},
+		{"msgpack",
+			func(buf *bytes.Buffer, v *schemas.V2Reading) error {
+				return msgpack.NewEncoder(buf).Encode(v)
+			},
+			func(b []byte, dest *schemas.V2Reading) error {
+				return msgpack.Unmarshal(b, dest)
+			}},
+		{"avro",
+			func(buf *bytes.Buffer, v *schemas.V2Reading) error {
+				avro = marshalAvro(avro[:0], v)
+				_, err := buf.Write(avro)
+				return err
+			},
+			func(b []byte, dest *schemas.V2Reading) error {
+				return unmarshalAvro(b, dest)
+			}},
+	}
+}
+
+func printSizes() {
+	fmt.Println("encoded size in bytes:")
+	fmt.Printf("  %8s", "readings")
+	for _, f := range formats() {
+		fmt.Printf(" %10s", f.name)
+	}
+	fmt.Println()
+
+	for _, n := range []int{0, 1, 10, 100, 1000} {
+		fmt.Printf("  %8d", n)
+		for _, f := range formats() {
+			var buf bytes.Buffer
+			if err := f.encode(&buf, sample(n)); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf(" %10d", buf.Len())
+		}
+		fmt.Println()
+	}
+	fmt.Printf("  schemer also sends its schema once: %d bytes\n", len(schemas.V2WriterSchema().MarshalSchemer()))
+}
+
+func main() {
+	printSizes()
+}
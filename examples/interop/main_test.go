@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// sameFloats compares bit for bit, so a format that rounds (or turns -0 into 0)
+// doesn't pass; nil and empty are the same
+func sameFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Float64bits(a[i]) != math.Float64bits(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func same(a, b *schemas.V2Reading) bool {
+	return a.Header == b.Header &&
+		sameFloats(a.RawReadings, b.RawReadings) &&
+		sameFloats(a.FilteredReadings, b.FilteredReadings) &&
+		a.Sequence == b.Sequence &&
+		a.GeneratedAtUnixMs == b.GeneratedAtUnixMs
+}
+
+// TestRoundTrips encodes and decodes samples of every size with every format,
+// including values at the edges of each field's range, and checks nothing
+// changed
+func TestRoundTrips(t *testing.T) {
+	edges := sample(3)
+	edges.Header = "ünïcødé, and a \x00 byte"
+	edges.RawReadings = []float64{math.Copysign(0, -1), math.SmallestNonzeroFloat64, math.MaxFloat64}
+	edges.FilteredReadings = []float64{math.Inf(1), math.Inf(-1), -1e-300}
+	edges.Sequence = math.MaxInt64
+	edges.GeneratedAtUnixMs = math.MinInt64
+
+	samples := []*schemas.V2Reading{edges, {}}
+	for _, n := range []int{0, 1, 10, 1000} {
+		samples = append(samples, sample(n))
+	}
+
+	for _, f := range formats() {
+		t.Run(f.name, func(t *testing.T) {
+			for _, v := range samples {
+				var buf bytes.Buffer
+				if err := f.encode(&buf, v); err != nil {
+					t.Fatalf("encoding %d readings: %v", len(v.RawReadings), err)
+				}
+				var decoded schemas.V2Reading
+				if err := f.decode(buf.Bytes(), &decoded); err != nil {
+					t.Fatalf("decoding %d readings: %v", len(v.RawReadings), err)
+				}
+				if !same(&decoded, v) {
+					t.Fatalf("sent %+v, got back %+v", v, decoded)
+				}
+			}
+		})
+	}
+}
+
+// benchReadings is the number of readings in the sample the benchmarks use
+const benchReadings = 100
+
+func BenchmarkEncode(b *testing.B) {
+	v := sample(benchReadings)
+	for _, f := range formats() {
+		b.Run(f.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var buf bytes.Buffer
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := f.encode(&buf, v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	v := sample(benchReadings)
+	for _, f := range formats() {
+		b.Run(f.name, func(b *testing.B) {
+			var buf bytes.Buffer
+			if err := f.encode(&buf, v); err != nil {
+				b.Fatal(err)
+			}
+			var dest schemas.V2Reading
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := f.decode(buf.Bytes(), &dest); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// mismatchedsources shows what happens when a client takes its schema from one
+// server and its data from another, as it can when a load balancer or a config
+// mistake sends /get-schema/ and /get-data/ to different versions of the server.
+// It decodes every combination of v1 and v2 schema and data into the v2 client's
+// struct:
+//
+//	v1 schema, v1 data   matched: decodes
+//	v2 schema, v2 data   matched: decodes
+//	v1 schema, v2 data   mismatched
+//	v2 schema, v1 data   mismatched
+//
+// A mismatch may fail with an error, or it may "work" and fill the struct with
+// garbage, which is the dangerous case. Either way two things give it away, and
+// the example prints both for every combination:
+//
+//   - the schema fingerprint: both servers stamp their data responses with the
+//     X-Schema-Fingerprint of the schema they encoded with, the SHA-256 of the
+//     schema exactly as /get-schema/ returns it. If it isn't the fingerprint of
+//     the schema the client holds, the two came from different servers.
+//   - unread bytes: decoding with the right schema uses up the whole payload.
+//     Bytes left over mean the schema described something else.
+//
+// The schemas and data are made locally, the way each server makes them, unless
+// -v1 and -v2 point at running servers:
+//
+//	PORT=8081 go run ./client-server/server/v1 &
+//	PORT=8082 go run ./client-server/server/v2 &
+//	go run ./examples/mismatchedsources -v1 http://localhost:8081 -v2 http://localhost:8082
+//
+// It exits non-zero if a matched combination doesn't decode, or a mismatched one
+// isn't given away by its fingerprint.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+)
+
+// source is what one server hands out
+type source struct {
+	name        string
+	schema      []byte // as /get-schema/ returns it
+	data        []byte // as /get-data/ returns it
+	fingerprint string // the X-Schema-Fingerprint /get-data/ sends with it
+}
+
+// localSources makes the schemas and data the way the servers do: v1 sends its
+// schema as JSON, v2 in binary
+func localSources() (source, source) {
+	v1Schema := schemas.V1WriterSchema()
+	v1JSON, err := v1Schema.MarshalJSON()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var v1Data bytes.Buffer
+	if err := v1Schema.Encode(&v1Data, &schemas.V1Reading{Readings: []float32{20.5, 21, 21.5}}); err != nil {
+		log.Fatal(err)
+	}
+
+	v2Schema := schemas.V2WriterSchema()
+	v2Binary := v2Schema.MarshalSchemer()
+	var v2Data bytes.Buffer
+	sample := schemas.V2Reading{
+		Header:           "Four score and seven years ago",
+		RawReadings:      []float64{20.25, 21.75},
+		FilteredReadings: []float64{10.125, 15.9375},
+		Sequence:         7,
+	}
+	if err := v2Schema.Encode(&v2Data, &sample); err != nil {
+		log.Fatal(err)
+	}
+
+	return source{"v1", v1JSON, v1Data.Bytes(), registry.Fingerprint(v1JSON)},
+		source{"v2", v2Binary, v2Data.Bytes(), registry.Fingerprint(v2Binary)}
+}
+
+func get(url string) ([]byte, http.Header, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	return b, resp.Header, err
+}
+
+// fetchSource gets the schema and data from a running server
+func fetchSource(name, baseURL string) (source, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	schema, _, err := get(baseURL + "/get-schema/")
+	if err != nil {
+		return source{}, err
+	}
+	data, header, err := get(baseURL + "/get-data/")
+	if err != nil {
+		return source{}, err
+	}
+	return source{name, schema, data, header.Get(registry.FingerprintHeader)}, nil
+}
+
+// try decodes dataSrc's payload with schemaSrc's schema and prints what
+// happened. It fails if a matched pair doesn't decode cleanly, or a mismatched
+// one gets past the fingerprint check.
+func try(schemaSrc, dataSrc source) error {
+	matched := schemaSrc.name == dataSrc.name
+	fmt.Printf("%s schema, %s data:\n", schemaSrc.name, dataSrc.name)
+
+	// the check a client can make before decoding anything
+	held := registry.Fingerprint(schemaSrc.schema)
+	switch {
+	case dataSrc.fingerprint == "":
+		fmt.Println("  fingerprint:  the data response didn't carry one")
+	case dataSrc.fingerprint == held:
+		fmt.Printf("  fingerprint:  %.12s, same as the schema's\n", held)
+	default:
+		fmt.Printf("  fingerprint:  data was encoded with %.12s, but the schema is %.12s: MISMATCH\n", dataSrc.fingerprint, held)
+	}
+	caught := dataSrc.fingerprint != "" && dataSrc.fingerprint != held
+
+	schema, err := schemerclient.DecodeSchema(schemaSrc.schema)
+	if err != nil {
+		return fmt.Errorf("cannot decode the %s schema: %w", schemaSrc.name, err)
+	}
+
+	var dest schemas.V2Reading
+	r := bytes.NewReader(dataSrc.data)
+	err = schema.Decode(r, &dest)
+	if err != nil {
+		fmt.Printf("  decode:       error: %v\n", err)
+	} else {
+		fmt.Printf("  decode:       no error; header %q, readings %v, raw readings %v\n", dest.Header, dest.FilteredReadings, dest.RawReadings)
+	}
+	fmt.Printf("  unread bytes: %d of %d\n", r.Len(), len(dataSrc.data))
+
+	switch {
+	case matched && (err != nil || r.Len() != 0):
+		return fmt.Errorf("%s schema and data should decode cleanly", schemaSrc.name)
+	case matched && caught:
+		return fmt.Errorf("%s data has a fingerprint that isn't its own schema's", schemaSrc.name)
+	case !matched && !caught && dataSrc.fingerprint != "":
+		return fmt.Errorf("%s schema and %s data got past the fingerprint check", schemaSrc.name, dataSrc.name)
+	}
+	if !matched && err == nil && r.Len() == 0 {
+		fmt.Println("  => no error and nothing left over: whatever the struct holds can't be trusted, and only the fingerprint says so")
+	}
+	return nil
+}
+
+func main() {
+	v1URL := flag.String("v1", "", "base URL of a running v1 server (default: make the v1 schema and data locally)")
+	v2URL := flag.String("v2", "", "base URL of a running v2 server (default: make the v2 schema and data locally)")
+	flag.Parse()
+
+	v1, v2 := localSources()
+	var err error
+	if *v1URL != "" {
+		if v1, err = fetchSource("v1", *v1URL); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *v2URL != "" {
+		if v2, err = fetchSource("v2", *v2URL); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, pair := range [][2]source{{v1, v1}, {v2, v2}, {v1, v2}, {v2, v1}} {
+		if err := try(pair[0], pair[1]); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println()
+	}
+	fmt.Println("check the fingerprint before decoding: a mismatch doesn't always fail, but it always shows there")
+}
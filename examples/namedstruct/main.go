@@ -0,0 +1,148 @@
+// namedstruct shows schemer with a struct that holds another named struct by
+// value: every reading carries the calibration of the sensor that took it, as a
+// field `Cal Calibration`. This is the usual way to compose structs in Go, and
+// schemer handles it by nesting an object schema inside the outer one (printed
+// below, next to the schema of the same struct embedded anonymously, for
+// comparison).
+//
+// It then evolves Calibration the way a real system would, by adding a field,
+// and checks both directions:
+//
+//	old writer -> new reader   the new field isn't sent, so it keeps whatever
+//	                           the reader put there before decoding
+//	new writer -> old reader   the new field is skipped, the rest of Cal and
+//	                           everything after it decode as before
+//
+// Only field names are matched, at every level: the Go name of the nested type
+// is not part of the schema, which is why the new version can be a different
+// type (calibrationV2) and still line up with the old one. The example exits
+// non-zero if any value doesn't come through.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/bminer/schemer"
+)
+
+// Calibration turns a sensor's raw value into degrees: raw*Scale + Offset
+type Calibration struct {
+	Offset float64
+	Scale  float64
+}
+
+type sourceStruct struct {
+	Readings []float64
+	Cal      Calibration // a named struct, by value
+	Sequence uint64      // a field after the nested one, to show nothing shifts
+}
+
+// the same fields with Calibration embedded instead, only to compare schemas
+type embeddedStruct struct {
+	Readings []float64
+	Calibration
+	Sequence uint64
+}
+
+// calibrationV2 is Calibration with a field added
+type calibrationV2 struct {
+	Offset           float64
+	Scale            float64
+	CalibratedAtUnix int64 // when the sensor was last calibrated
+}
+
+type sourceStructV2 struct {
+	Readings []float64
+	Cal      calibrationV2
+	Sequence uint64
+}
+
+func printSchema(name string, v interface{}) {
+	schemaJSON, err := schemer.SchemaOf(v).MarshalJSON()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s schema:\n  %s\n", name, schemaJSON)
+}
+
+// roundTrip encodes src with its own schema and decodes it into dest, starting
+// from the binary schema the way a client would
+func roundTrip(src, dest interface{}) error {
+	writerSchema := schemer.SchemaOf(src)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, src); err != nil {
+		return fmt.Errorf("encode error: %w", err)
+	}
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		return fmt.Errorf("cannot decode schema: %w", err)
+	}
+	if err := readerSchema.Decode(&encodedData, dest); err != nil {
+		return fmt.Errorf("decode error: %w", err)
+	}
+	return nil
+}
+
+func sameReadings(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func main() {
+	v1 := sourceStruct{
+		Readings: []float64{20.5, 21.25},
+		Cal:      Calibration{Offset: -0.75, Scale: 1.02},
+		Sequence: 42,
+	}
+	v2 := sourceStructV2{
+		Readings: v1.Readings,
+		Cal:      calibrationV2{Offset: -0.5, Scale: 0.98, CalibratedAtUnix: 1623456789},
+		Sequence: 43,
+	}
+
+	printSchema("named (Cal Calibration)", &v1)
+	printSchema("embedded (Calibration)", &embeddedStruct{})
+	fmt.Println()
+
+	// the same version on both sides
+	var decoded sourceStruct
+	if err := roundTrip(&v1, &decoded); err != nil {
+		log.Fatal(err)
+	}
+	if decoded.Cal != v1.Cal || decoded.Sequence != v1.Sequence || !sameReadings(decoded.Readings, v1.Readings) {
+		log.Fatalf("round trip: sent %+v, got %+v", v1, decoded)
+	}
+	fmt.Printf("round trip:           %+v\n", decoded)
+
+	// old writer, new reader: CalibratedAtUnix isn't in the data
+	newReader := sourceStructV2{Cal: calibrationV2{CalibratedAtUnix: -1}}
+	if err := roundTrip(&v1, &newReader); err != nil {
+		log.Fatal("old data, new reader: ", err)
+	}
+	if newReader.Cal.Offset != v1.Cal.Offset || newReader.Cal.Scale != v1.Cal.Scale || newReader.Sequence != v1.Sequence {
+		log.Fatalf("old data, new reader: sent %+v, got %+v", v1, newReader)
+	}
+	if newReader.Cal.CalibratedAtUnix != -1 {
+		log.Fatalf("old data, new reader: CalibratedAtUnix wasn't sent, but the reader's -1 became %d", newReader.Cal.CalibratedAtUnix)
+	}
+	fmt.Printf("old data, new reader: %+v (CalibratedAtUnix keeps the reader's default)\n", newReader)
+
+	// new writer, old reader: CalibratedAtUnix is skipped
+	var oldReader sourceStruct
+	if err := roundTrip(&v2, &oldReader); err != nil {
+		log.Fatal("new data, old reader: ", err)
+	}
+	if oldReader.Cal.Offset != v2.Cal.Offset || oldReader.Cal.Scale != v2.Cal.Scale || oldReader.Sequence != v2.Sequence {
+		log.Fatalf("new data, old reader: sent %+v, got %+v", v2, oldReader)
+	}
+	fmt.Printf("new data, old reader: %+v (CalibratedAtUnix skipped)\n", oldReader)
+}
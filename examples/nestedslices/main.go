@@ -0,0 +1,71 @@
+// nestedslices shows that schemer handles slices of slices: a [][]float64 holding
+// one time series per sensor survives a round trip with every inner slice
+// keeping its own length, including a ragged matrix and an empty row.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/bminer/schemer"
+)
+
+type sourceStruct struct {
+	Matrix [][]float64 // one row of readings per sensor
+}
+
+func main() {
+
+	structToEncode := sourceStruct{
+		Matrix: [][]float64{
+			{20.5, 20.6, 20.4, 20.7},
+			{18.1},
+			{}, // a sensor that reported nothing this time
+			{22.0, 22.3, 22.1, 21.9, 22.4, 22.2, 22.0},
+		},
+	}
+
+	writerSchema := schemer.SchemaOf(&structToEncode)
+
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, structToEncode); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+
+	schemaJSON, err := writerSchema.MarshalJSON()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("schema: %s\n", schemaJSON)
+	fmt.Printf("encoded into %d bytes\n\n", encodedData.Len())
+
+	// decode the way a client would: starting from the binary schema
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		log.Fatal("cannot decode schema: " + err.Error())
+	}
+
+	var decoded sourceStruct
+	if err := readerSchema.Decode(&encodedData, &decoded); err != nil {
+		log.Fatal("decode error: " + err.Error())
+	}
+
+	if len(decoded.Matrix) != len(structToEncode.Matrix) {
+		log.Fatalf("got %d rows, want %d", len(decoded.Matrix), len(structToEncode.Matrix))
+	}
+	for i, row := range structToEncode.Matrix {
+		got := decoded.Matrix[i]
+		if len(got) != len(row) {
+			log.Fatalf("row %d: got %d readings, want %d", i, len(got), len(row))
+		}
+		for j := range row {
+			if got[j] != row[j] {
+				log.Fatalf("row %d, column %d: got %v, want %v", i, j, got[j], row[j])
+			}
+		}
+		fmt.Printf("row %d (%d readings): %v\n", i, len(got), got)
+	}
+
+	fmt.Println("\nevery row came back with its original length and values")
+}
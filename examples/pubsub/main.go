@@ -0,0 +1,272 @@
+// pubsub is the v2 server restructured around internal/broker. Instead of every
+// handler reading one global struct under a lock, the update loop encodes each
+// new reading once and publishes the payload, and every consumer subscribes:
+//
+//   - an HTTP cache, which keeps the latest payload for /get-data/ (signed in an
+//     X-Signature header, if $SIGNING_KEY is set)
+//   - a WebSocket fan-out at /ws, one subscription per connected client, with a
+//     heartbeat whenever a client has had nothing for $HEARTBEAT_INTERVAL
+//   - a file logger, appending every payload to the file given by -log (each one
+//     followed by its signature, if $SIGNING_KEY is set)
+//
+// A consumer that falls behind only loses its own oldest payloads; /stats/ shows
+// how many each one has dropped.
+//
+//	go run ./examples/pubsub -log readings.bin
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/broker"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/heartbeat"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/signing"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/gorilla/websocket"
+)
+
+const DefaultPort = "8080"
+
+const updateInterval = time.Second
+
+var writerSchema = schemas.V2WriterSchema()
+var binaryWriterSchema = writerSchema.MarshalSchemer()
+
+var upgrader = websocket.Upgrader{
+	// this is an example, so let any page connect
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// publishLoop encodes a new reading every updateInterval and publishes it
+func publishLoop(b *broker.Broker) {
+	generator := sim.New(sim.DefaultConfig, time.Now().UnixNano())
+	var reading schemas.V2Reading
+
+	for {
+		numFloats := rand.Intn(10)
+		reading.Header = fmt.Sprintf("update at %s", time.Now().Format(time.RFC3339))
+		reading.RawReadings = generator.Next(numFloats)
+		reading.FilteredReadings = make([]float64, numFloats)
+
+		smoothingFactor := 0.5
+		var workingAverage float64 = 0.0
+		for i := 0; i < numFloats; i++ {
+			workingAverage = (reading.RawReadings[i] * smoothingFactor) + (workingAverage * (1.0 - smoothingFactor))
+			reading.FilteredReadings[i] = workingAverage
+		}
+
+		reading.Sequence++
+		reading.GeneratedAtUnixMs = time.Now().UnixNano() / int64(time.Millisecond)
+
+		var encodedData bytes.Buffer
+		if err := writerSchema.Encode(&encodedData, &reading); err != nil {
+			log.Println("encode error: " + err.Error())
+		} else {
+			b.Publish(encodedData.Bytes())
+		}
+
+		time.Sleep(updateInterval)
+	}
+}
+
+// cache keeps the latest payload for the HTTP handler
+type cache struct {
+	signingKey []byte // signs every response if set
+
+	mu     sync.Mutex
+	latest []byte
+}
+
+func (c *cache) run(ch <-chan []byte) {
+	for payload := range ch {
+		c.mu.Lock()
+		c.latest = payload
+		c.mu.Unlock()
+	}
+}
+
+func (c *cache) getDataHandler(w http.ResponseWriter, req *http.Request) {
+	c.mu.Lock()
+	latest := c.latest
+	c.mu.Unlock()
+
+	if latest == nil {
+		http.Error(w, "no data yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if c.signingKey != nil {
+		w.Header().Set(signing.Header, signing.SignHex(c.signingKey, latest))
+	}
+	w.Write(latest)
+}
+
+// fileLogger appends every payload to f as a frame (see package frame). With a
+// signing key, every frame is followed by the payload's signing.Size byte
+// signature.
+func fileLogger(ch <-chan []byte, f *os.File, signingKey []byte) {
+	w := bufio.NewWriter(f)
+	for payload := range ch {
+		frame.WriteFrame(w, payload)
+		if signingKey != nil {
+			w.Write(signing.Sign(signingKey, payload))
+		}
+		if err := w.Flush(); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	}
+}
+
+// wsHandler subscribes every client separately, so one slow browser only drops
+// its own frames. A client that hasn't been sent a frame for heartbeatInterval
+// gets a heartbeat (see package heartbeat); 0 turns them off.
+func wsHandler(b *broker.Broker, heartbeatInterval time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+
+		var header http.Header
+		if heartbeatInterval > 0 {
+			header = http.Header{heartbeat.Header: {heartbeat.FormatInterval(heartbeatInterval)}}
+		}
+		conn, err := upgrader.Upgrade(w, req, header)
+		if err != nil {
+			log.Println("upgrade error: " + err.Error())
+			return
+		}
+		defer conn.Close()
+
+		ch, cancel := b.Subscribe()
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		// a payload restarts the timer, so it only fires once the publisher has
+		// been quiet for a whole interval
+		var idle <-chan time.Time
+		var timer *time.Timer
+		if heartbeatInterval > 0 {
+			timer = time.NewTimer(heartbeatInterval)
+			defer timer.Stop()
+			idle = timer.C
+		}
+		restart := func() {
+			if timer == nil {
+				return
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(heartbeatInterval)
+		}
+
+		if err := conn.WriteMessage(websocket.BinaryMessage, binaryWriterSchema); err != nil {
+			return
+		}
+		for {
+			select {
+			case <-done:
+				if dropped := b.Dropped(ch); dropped > 0 {
+					log.Printf("client %s disconnected after %d dropped frames", req.RemoteAddr, dropped)
+				}
+				return
+			case payload := <-ch:
+				if err := conn.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+					return
+				}
+				restart()
+			case <-idle:
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(heartbeat.Message)); err != nil {
+					return
+				}
+				restart()
+			}
+		}
+	}
+}
+
+// statsHandler reports the drop counters of the long-lived subscribers
+func statsHandler(b *broker.Broker, named map[string]<-chan []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "subscribers: %d\n", b.Subscribers())
+		for name, ch := range named {
+			fmt.Fprintf(w, "%s dropped: %d\n", name, b.Dropped(ch))
+		}
+	}
+}
+
+func main() {
+	logPath := flag.String("log", "", "file to append every payload to")
+	flag.Parse()
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = DefaultPort
+	}
+
+	signingKey := signing.KeyFromEnv()
+
+	heartbeatInterval, err := heartbeat.IntervalFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	b := broker.New(broker.DefaultBufferSize)
+	named := map[string]<-chan []byte{}
+
+	c := cache{signingKey: signingKey}
+	cacheCh, _ := b.Subscribe()
+	named["cache"] = cacheCh
+	go c.run(cacheCh)
+
+	if *logPath != "" {
+		f, err := os.OpenFile(*logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		logCh, _ := b.Subscribe()
+		named["file logger"] = logCh
+		go fileLogger(logCh, f, signingKey)
+	}
+
+	rand.Seed(time.Now().UnixNano())
+	go publishLoop(b)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/get-schema/", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Write(binaryWriterSchema)
+	})
+	mux.HandleFunc("/get-data/", c.getDataHandler)
+	mux.HandleFunc("/ws", wsHandler(b, heartbeatInterval))
+	mux.HandleFunc("/stats/", statsHandler(b, named))
+
+	log.Println("pub/sub example server listening on port:", port)
+	log.Println("endpoints: /get-schema/, /get-data/, /ws, /stats/")
+	log.Printf("heartbeat (%s): %v", heartbeat.IntervalEnv, heartbeatInterval)
+
+	log.Fatal(http.ListenAndServe(":"+port, middleware.Recover(mux)))
+}
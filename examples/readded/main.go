@@ -0,0 +1,174 @@
+// readded walks through a field that is removed and later added back with a
+// different type, the hardest kind of schema change for schemer's name-based
+// field matching:
+//
+//	v1   Readings []float64, Location string   "Lab 3", the name of the room
+//	v2   Readings []float64                    Location removed
+//	v3   Readings []float64, Location int64    back, as a room number
+//
+// Adjacent versions are easy. v2 data has no Location, so a v1 or v3 reader
+// keeps whatever its Location held before decoding: pre-fill the default you
+// want ("unknown", -1) and it survives. v1 data decoded by v2 loses its Location,
+// which is the point of removing it.
+//
+// Non-adjacent versions are where it goes wrong, e.g. when a v1 client that was
+// never upgraded talks to a v3 server. Both structs have a field called
+// Location, so schemer pairs them up and tries to turn a room name into a room
+// number (or back). Depending on the
+// values that is an error, or a conversion nobody asked for: nothing in the
+// schemas says the two fields mean different things.
+//
+// v3r shows the fix: add the field back under a new name (RoomNumber). Then v1's
+// Location and v3r's RoomNumber never meet, every combination decodes, and each
+// reader keeps its default for the field the writer doesn't have.
+//
+// The example exits non-zero if a field the writer doesn't have doesn't keep the
+// reader's default, if Readings don't survive a decode that succeeds, or if a
+// combination with the renamed field fails.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/bminer/schemer"
+)
+
+type v1Reading struct {
+	Readings []float64
+	Location string // the name of the room
+}
+
+type v2Reading struct {
+	Readings []float64
+}
+
+type v3Reading struct {
+	Readings []float64
+	Location int64 // the room number: same name as v1's field, different meaning
+}
+
+// v3r adds the room number back under a name that was never used before
+type v3rReading struct {
+	Readings   []float64
+	RoomNumber int64
+}
+
+var readings = []float64{20.5, 21.25}
+
+// a version of the struct: how its writer fills it in, and how its reader
+// pre-fills it with defaults before decoding
+type version struct {
+	name     string
+	written  interface{}
+	defaults func() interface{}
+}
+
+var (
+	v1  = version{"v1", &v1Reading{readings, "Lab 3"}, func() interface{} { return &v1Reading{Location: "unknown"} }}
+	v2  = version{"v2", &v2Reading{readings}, func() interface{} { return &v2Reading{} }}
+	v3  = version{"v3", &v3Reading{readings, 3}, func() interface{} { return &v3Reading{Location: -1} }}
+	v3r = version{"v3r", &v3rReading{readings, 3}, func() interface{} { return &v3rReading{RoomNumber: -1} }}
+)
+
+// encode returns the writer's payload and its schema, as a reader gets it
+func encode(v version) ([]byte, schemer.Schema, error) {
+	writerSchema := schemer.SchemaOf(v.written)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, v.written); err != nil {
+		return nil, nil, err
+	}
+	received, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	return encodedData.Bytes(), received, err
+}
+
+// fields returns the fields of the struct v points to by name, and their names
+// in struct order
+func fields(v interface{}) (map[string]interface{}, []string) {
+	rv := reflect.ValueOf(v).Elem()
+	m := map[string]interface{}{}
+	var names []string
+	for i := 0; i < rv.NumField(); i++ {
+		name := rv.Type().Field(i).Name
+		m[name] = rv.Field(i).Interface()
+		names = append(names, name)
+	}
+	return m, names
+}
+
+// try decodes w's payload into r's struct and prints, field by field, whether
+// the value was preserved, converted, or lost (the reader's default kept)
+func try(w, r version) error {
+	payload, schema, err := encode(w)
+	if err != nil {
+		return fmt.Errorf("%s: encode failed: %w", w.name, err)
+	}
+
+	dest := r.defaults()
+	defaults, _ := fields(r.defaults())
+	fmt.Printf("%s data -> %s reader:\n", w.name, r.name)
+
+	if err := schema.Decode(bytes.NewReader(payload), dest); err != nil {
+		fmt.Printf("  error: %v\n", err)
+		if w.name == "v3r" || r.name == "v3r" {
+			return fmt.Errorf("with the field renamed, %s data should decode into %s", w.name, r.name)
+		}
+		return nil
+	}
+
+	sent, names := fields(w.written)
+	got, readerNames := fields(dest)
+	// the writer's fields, then the ones only the reader has
+	for _, name := range readerNames {
+		if _, ok := sent[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		s, inWriter := sent[name]
+		g, inReader := got[name]
+		switch {
+		case !inReader:
+			fmt.Printf("  %-10s lost: the %s reader has no such field (sent %v)\n", name, r.name, s)
+		case !inWriter && !reflect.DeepEqual(g, defaults[name]):
+			return fmt.Errorf("%s is not in the %s data, but the reader's default %v became %v", name, w.name, defaults[name], g)
+		case !inWriter:
+			fmt.Printf("  %-10s not sent: the reader's default %v is kept\n", name, g)
+		case reflect.TypeOf(s) != reflect.TypeOf(g):
+			fmt.Printf("  %-10s CONVERTED: sent %T %v, got %T %v\n", name, s, s, g, g)
+		case reflect.DeepEqual(s, g):
+			fmt.Printf("  %-10s preserved: %v\n", name, g)
+		default:
+			return fmt.Errorf("%s was sent as %v and decoded as %v", name, s, g)
+		}
+	}
+	return nil
+}
+
+func main() {
+	for _, pair := range []struct {
+		title  string
+		writer version
+		reader version
+	}{
+		{"adjacent: the field is removed", v1, v2},
+		{"", v2, v1},
+		{"adjacent: the field is added back", v2, v3},
+		{"", v3, v2},
+		{"non-adjacent: same name, different type", v1, v3},
+		{"", v3, v1},
+		{"non-adjacent, with the field added back under a new name", v1, v3r},
+		{"", v3r, v1},
+	} {
+		if pair.title != "" {
+			fmt.Printf("\n== %s\n", pair.title)
+		}
+		if err := try(pair.writer, pair.reader); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Println("\nschemer matches fields by name alone: never reuse the name of a removed field for something else")
+}
@@ -0,0 +1,138 @@
+// reusedest measures what a hot decode loop saves by decoding every payload into
+// the same destination struct, instead of a fresh one each time like the polling
+// clients used to. It decodes the same payloads in two ways and reports the heap
+// allocations per decode for each:
+//
+//	fresh   a new schemas.V2Reading for every payload
+//	reused  one schemas.V2Reading, passed through schemerclient.ResetForReuse
+//	        before every payload so no field of the previous one survives
+//
+// Reusing the struct saves allocating the struct itself. Whether it also saves
+// allocating the Readings slices depends on whether schemer's Decode writes into
+// a destination slice's existing capacity or always makes a new slice; the
+// example checks that directly (by comparing the slice's backing array before and
+// after a decode) and prints which it is for the schemer version in go.mod.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+// allocs is what one run of decodes cost
+type allocs struct {
+	mallocs, bytes uint64
+}
+
+// measure runs f and returns the heap allocations it made
+func measure(f func()) allocs {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return allocs{mallocs: after.Mallocs - before.Mallocs, bytes: after.TotalAlloc - before.TotalAlloc}
+}
+
+// payloads encodes n samples of the v2 server's data, all with the same number
+// of readings so the reused slices always have enough capacity
+func payloads(n, readings int) [][]byte {
+	writerSchema := schemas.V2WriterSchema()
+	gen := sim.New(sim.DefaultConfig, 1)
+
+	out := make([][]byte, n)
+	for i := range out {
+		raw := gen.Next(readings)
+		v := schemas.V2Reading{
+			Header:           "reusedest",
+			RawReadings:      raw,
+			FilteredReadings: append([]float64(nil), raw...),
+			Sequence:         uint64(i + 1),
+		}
+		var buf bytes.Buffer
+		if err := writerSchema.Encode(&buf, &v); err != nil {
+			log.Fatal(err)
+		}
+		out[i] = buf.Bytes()
+	}
+	return out
+}
+
+// reusesCapacity reports whether decoding into a struct whose slice already has
+// enough capacity leaves the data in that same backing array
+func reusesCapacity(schema schemer.Schema, payload []byte, readings int) bool {
+	var dest schemas.V2Reading
+	dest.RawReadings = make([]float64, 0, readings)
+	backing := dest.RawReadings[:1]
+
+	if err := schema.Decode(bytes.NewReader(payload), &dest); err != nil {
+		log.Fatal(err)
+	}
+	return len(dest.RawReadings) > 0 && &dest.RawReadings[0] == &backing[0]
+}
+
+func main() {
+	n := flag.Int("n", 10000, "number of payloads to decode in each mode")
+	readings := flag.Int("readings", 32, "number of readings per payload")
+	flag.Parse()
+
+	schema, err := schemer.DecodeSchema(schemas.V2WriterSchema().MarshalSchemer())
+	if err != nil {
+		log.Fatal("cannot decode schema: " + err.Error())
+	}
+	data := payloads(*n, *readings)
+
+	// both modes share one bytes.Reader, so the only difference is the destination
+	var r bytes.Reader
+
+	var sink uint64
+	fresh := measure(func() {
+		for _, p := range data {
+			dest := new(schemas.V2Reading)
+			r.Reset(p)
+			if err := schema.Decode(&r, dest); err != nil {
+				log.Fatal(err)
+			}
+			sink += dest.Sequence
+		}
+	})
+
+	var dest schemas.V2Reading
+	reused := measure(func() {
+		for _, p := range data {
+			schemerclient.ResetForReuse(&dest)
+			r.Reset(p)
+			if err := schema.Decode(&r, &dest); err != nil {
+				log.Fatal(err)
+			}
+			sink += dest.Sequence
+		}
+	})
+	if sink == 0 {
+		log.Fatal("nothing was decoded")
+	}
+
+	perDecode := func(a allocs) string {
+		return fmt.Sprintf("%.1f allocations, %d bytes", float64(a.mallocs)/float64(*n), a.bytes/uint64(*n))
+	}
+	fmt.Printf("%d payloads of %d readings each, per decode:\n", *n, *readings)
+	fmt.Printf("  fresh struct:  %s\n", perDecode(fresh))
+	fmt.Printf("  reused struct: %s\n", perDecode(reused))
+	if fresh.bytes > 0 {
+		fmt.Printf("reusing saves %.0f%% of the bytes allocated\n", 100*(1-float64(reused.bytes)/float64(fresh.bytes)))
+	}
+
+	if reusesCapacity(schema, data[0], *readings) {
+		fmt.Println("schemer's Decode fills an existing slice's capacity, so reused slices aren't allocated again")
+	} else {
+		fmt.Println("schemer's Decode makes a new slice every time, so reusing the struct only saves the struct itself")
+	}
+}
@@ -0,0 +1,148 @@
+// rootslice answers whether the struct every example server wraps its readings
+// in is required by schemer or just a convention. It serves a bare []float64 as
+// the root value, with no wrapper:
+//
+//	schemer.SchemaOf([]float64{...})
+//
+// fetches it with schemerclient into a []float64, and checks that the readings
+// come back. The wrapper isn't required: SchemaOf takes a slice as readily as a
+// struct (schemerclient's TestTopLevel does maps and scalars too).
+//
+// It then compares what goes over the wire for n readings, bare and wrapped in
+//
+//	struct{ Readings []float64 }
+//
+// The wrapper costs a few bytes of schema, for the object and the field's name,
+// and little or nothing per payload, since a struct's fields are written one
+// after another without their names. What it buys is room to grow: the v2 server
+// could add Header next to Readings and a v1 client still decoded the payload,
+// whereas a client of the bare slice can't decode anything else, which the last
+// check shows. The example exits non-zero if the bare slice doesn't round-trip,
+// or if its client decodes a wrapped payload without an error (or panics).
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+// what the example servers send, minus everything but the readings
+type wrapped struct {
+	Readings []float64
+}
+
+// serve serves v's schema and data the way the example servers do
+func serve(v interface{}) (*httptest.Server, error) {
+	writerSchema := schemer.SchemaOf(v)
+	binarySchema := writerSchema.MarshalSchemer()
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, v); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(schemerclient.SchemaPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(binarySchema)
+	})
+	mux.HandleFunc(schemerclient.DataPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(encodedData.Bytes())
+	})
+	return httptest.NewServer(mux), nil
+}
+
+// a panic while fetching, returned as an error so the example can report it
+type panicError struct{ value interface{} }
+
+func (e *panicError) Error() string { return fmt.Sprintf("panic: %v", e.value) }
+
+// fetch decodes what ts serves into dest
+func fetch(ts *httptest.Server, dest interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{r}
+		}
+	}()
+	client, err := schemerclient.New(ts.URL)
+	if err != nil {
+		return err
+	}
+	return client.Fetch(context.Background(), dest)
+}
+
+// sizes returns the length of v's binary schema and of v encoded with it
+func sizes(v interface{}) (schemaSize, payloadSize int, err error) {
+	writerSchema := schemer.SchemaOf(v)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, v); err != nil {
+		return 0, 0, err
+	}
+	return len(writerSchema.MarshalSchemer()), encodedData.Len(), nil
+}
+
+func readings(n int) []float64 {
+	r := make([]float64, n)
+	for i := range r {
+		r[i] = 20 + float64(i%50)/4
+	}
+	return r
+}
+
+func main() {
+	sent := []float64{20.5, 21.25, -3.125}
+	ts, err := serve(sent)
+	if err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+	defer ts.Close()
+
+	var decoded []float64
+	if err := fetch(ts, &decoded); err != nil {
+		log.Fatal("bare slice: ", err)
+	}
+	if !reflect.DeepEqual(decoded, sent) {
+		log.Fatalf("bare slice: sent %v, got %v", sent, decoded)
+	}
+	fmt.Printf("ok   bare []float64 served and decoded: %v\n\n", decoded)
+
+	fmt.Printf("%8s  %12s %12s  %13s %13s\n", "readings", "bare schema", "wrapped", "bare payload", "wrapped")
+	for _, n := range []int{0, 1, 10, 100, 1000} {
+		r := readings(n)
+		bareSchema, barePayload, err := sizes(r)
+		if err != nil {
+			log.Fatal("encode error: " + err.Error())
+		}
+		wrappedSchema, wrappedPayload, err := sizes(&wrapped{Readings: r})
+		if err != nil {
+			log.Fatal("encode error: " + err.Error())
+		}
+		fmt.Printf("%8d  %12d %12d  %13d %13d\n", n, bareSchema, wrappedSchema, barePayload, wrappedPayload)
+	}
+	fmt.Println()
+
+	// a client of the bare slice, pointed at a server that has since wrapped it
+	wrappedServer, err := serve(&wrapped{Readings: sent})
+	if err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+	defer wrappedServer.Close()
+
+	var bareClient []float64
+	err = fetch(wrappedServer, &bareClient)
+	var p *panicError
+	switch {
+	case err == nil:
+		log.Fatalf("a []float64 client decoded a wrapped payload, getting %v", bareClient)
+	case errors.As(err, &p):
+		log.Fatalf("a []float64 client panicked on a wrapped payload instead of failing: %v", err)
+	}
+	fmt.Printf("ok   a []float64 client can't read the wrapped payload: %v\n", err)
+}
@@ -0,0 +1,207 @@
+// saferead shows how a handler should read data that another goroutine keeps
+// updating: take the lock, make a deep copy (slices included), release the lock,
+// and only then encode the copy. Encoding under the lock is correct too, but
+// every update has to wait for every encode in progress; reading without the
+// lock, or copying only the struct while the writer changes slice elements in
+// place, is a data race.
+//
+// A writer updates one shared sample in place as fast as it can, reusing its
+// slices, and sets every reading to the sample's sequence number. Readers
+// snapshot it, encode the snapshot, decode the payload and check that every
+// reading still equals the sequence: a torn read shows up as a mix of two
+// sequences. Each pattern runs for -duration:
+//
+//	locked  encode while holding the lock
+//	copy    deep copy under the lock, encode outside it
+//	shallow copy the struct only: races with the writer (only with -shallow)
+//
+// and the example prints how many updates the writer got through and how long
+// it spent waiting for the lock in total. Run it under the race detector to check the
+// two safe patterns really are race-free:
+//
+//	go run -race ./examples/saferead
+//	go run -race ./examples/saferead -shallow    # the race detector reports the race
+//
+// It exits non-zero if a reader sees a torn sample.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+const readings = 64
+
+// shared is the sample the writer updates and the readers snapshot
+type shared struct {
+	mu     sync.Mutex
+	sample schemas.V2Reading
+}
+
+// update sets every reading to the next sequence number, writing into the
+// existing slices the way a tight update loop would
+func (s *shared) update() time.Duration {
+	start := time.Now()
+	s.mu.Lock()
+	waited := time.Since(start)
+	defer s.mu.Unlock()
+
+	s.sample.Sequence++
+	for i := range s.sample.RawReadings {
+		s.sample.RawReadings[i] = float64(s.sample.Sequence)
+		s.sample.FilteredReadings[i] = float64(s.sample.Sequence)
+	}
+	return waited
+}
+
+// deepCopy returns a copy of the sample that shares no memory with it. s.mu must
+// be held.
+func (s *shared) deepCopy() schemas.V2Reading {
+	c := s.sample
+	c.RawReadings = append([]float64(nil), s.sample.RawReadings...)
+	c.FilteredReadings = append([]float64(nil), s.sample.FilteredReadings...)
+	return c
+}
+
+// a pattern encodes the current sample into buf
+type pattern struct {
+	name   string
+	encode func(s *shared, schema schemer.Schema, buf *bytes.Buffer) error
+}
+
+var (
+	locked = pattern{"locked", func(s *shared, schema schemer.Schema, buf *bytes.Buffer) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return schema.Encode(buf, &s.sample)
+	}}
+	deep = pattern{"copy", func(s *shared, schema schemer.Schema, buf *bytes.Buffer) error {
+		s.mu.Lock()
+		snapshot := s.deepCopy()
+		s.mu.Unlock()
+		return schema.Encode(buf, &snapshot)
+	}}
+	// the slices in the copy are the writer's, and it keeps writing into them
+	shallow = pattern{"shallow", func(s *shared, schema schemer.Schema, buf *bytes.Buffer) error {
+		s.mu.Lock()
+		snapshot := s.sample
+		s.mu.Unlock()
+		return schema.Encode(buf, &snapshot)
+	}}
+)
+
+// torn reports whether the readings in v come from more than one update
+func torn(v *schemas.V2Reading) bool {
+	for _, readings := range [][]float64{v.RawReadings, v.FilteredReadings} {
+		for _, r := range readings {
+			if r != float64(v.Sequence) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type result struct {
+	updates, reads, torn int64
+	waited               time.Duration // the writer's total wait for the lock
+}
+
+// run has a writer and readerCount readers use p for d
+func run(p pattern, readerCount int, d time.Duration) (result, error) {
+	writerSchema := schemas.V2WriterSchema()
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		return result{}, err
+	}
+
+	s := &shared{sample: schemas.V2Reading{
+		RawReadings:      make([]float64, readings),
+		FilteredReadings: make([]float64, readings),
+	}}
+
+	var res result
+	var stop int32
+	var wg sync.WaitGroup
+	errs := make(chan error, readerCount)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for atomic.LoadInt32(&stop) == 0 {
+			res.waited += s.update()
+			res.updates++
+		}
+	}()
+
+	for i := 0; i < readerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			for atomic.LoadInt32(&stop) == 0 {
+				buf.Reset()
+				if err := p.encode(s, writerSchema, &buf); err != nil {
+					errs <- err
+					return
+				}
+				var decoded schemas.V2Reading
+				if err := readerSchema.Decode(&buf, &decoded); err != nil {
+					errs <- err
+					return
+				}
+				atomic.AddInt64(&res.reads, 1)
+				if torn(&decoded) {
+					atomic.AddInt64(&res.torn, 1)
+				}
+			}
+		}()
+	}
+
+	time.Sleep(d)
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return res, err
+	default:
+		return res, nil
+	}
+}
+
+func main() {
+	readerCount := flag.Int("readers", 4, "number of concurrent readers")
+	duration := flag.Duration("duration", time.Second, "how long to run each pattern")
+	withShallow := flag.Bool("shallow", false, "also run the racy shallow-copy pattern")
+	flag.Parse()
+
+	patterns := []pattern{locked, deep}
+	if *withShallow {
+		patterns = append(patterns, shallow)
+	}
+
+	fmt.Printf("%-8s %10s %10s %8s %14s\n", "pattern", "updates", "reads", "torn", "writer waited")
+	failed := false
+	for _, p := range patterns {
+		res, err := run(p, *readerCount, *duration)
+		if err != nil {
+			log.Fatalf("%s: %v", p.name, err)
+		}
+		fmt.Printf("%-8s %10d %10d %8d %14v\n", p.name, res.updates, res.reads, res.torn, res.waited.Round(time.Millisecond))
+		if res.torn > 0 && p.name != shallow.name {
+			failed = true
+		}
+	}
+	if failed {
+		log.Fatal("a reader saw a torn sample with a pattern that should be safe")
+	}
+}
@@ -0,0 +1,193 @@
+// scalartoslice models a schema evolution mistake: v1 of a server sends one
+// reading, and v2, which needs several, changes the field's type from a scalar
+// to a slice but keeps its name on the wire:
+//
+//	v1   Reading  float64   `schemer:"reading"`
+//	v2   Readings []float64 `schemer:"reading"`
+//
+// The Go name changed, so the code reads like a new field, but schemer matches
+// fields by their wire name, and to it this is the "reading" field changing from
+// a number to an array. Nothing converts one into the other: a v2 client can't
+// decode a v1 server's data, and a v1 client can't decode a v2 server's, so
+// every client breaks the moment the server is upgraded (or, worse, stays
+// broken against the servers that weren't). Don't do this.
+//
+// For contrast, the example checks the changes that are safe against v1, in both
+// directions:
+//
+//	field added      Unit string: old readers skip it, new ones keep their
+//	                 default for it when old data doesn't have it
+//	field removed    Header: the same, the other way round
+//	field renamed    Reading becomes Value in Go, still `schemer:"reading"` on
+//	                 the wire, so the value arrives
+//	width changed    float64 becomes float32: numbers convert
+//	the fix          keep Reading, and add the slice as a new field,
+//	                 `schemer:"readings"`: v1 clients still get a reading
+//
+// (Renaming the wire name itself is "safe" only in that nothing fails: the
+// value is lost, see TestUnembedded in schemas.) The example exits non-zero if
+// the breaking change decodes, or panics instead of failing, in either
+// direction, or if a safe change doesn't decode or loses the reading.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/bminer/schemer"
+)
+
+type v1Reading struct {
+	Header  string
+	Reading float64 `schemer:"reading"`
+}
+
+// the mistake: a slice under the name the scalar had
+type v2Reading struct {
+	Header   string
+	Readings []float64 `schemer:"reading"`
+}
+
+type addedReading struct {
+	Header  string
+	Reading float64 `schemer:"reading"`
+	Unit    string
+}
+
+type removedReading struct {
+	Reading float64 `schemer:"reading"`
+}
+
+type renamedReading struct {
+	Header string
+	Value  float64 `schemer:"reading"`
+}
+
+type narrowedReading struct {
+	Header  string
+	Reading float32 `schemer:"reading"`
+}
+
+// what v2 should have been: the scalar stays, and the slice is a new field
+type fixedReading struct {
+	Header   string
+	Reading  float64   `schemer:"reading"`
+	Readings []float64 `schemer:"readings"`
+}
+
+// a version of the struct: how its writer fills it in, and how its reader
+// pre-fills it with defaults before decoding
+type version struct {
+	name     string
+	written  interface{}
+	defaults func() interface{}
+}
+
+var (
+	v1       = version{"v1", &v1Reading{"boiler room", 20.5}, func() interface{} { return &v1Reading{} }}
+	v2       = version{"v2", &v2Reading{"boiler room", []float64{20.5, 21.25}}, func() interface{} { return &v2Reading{} }}
+	added    = version{"field added", &addedReading{"boiler room", 20.5, "C"}, func() interface{} { return &addedReading{Unit: "unknown"} }}
+	removed  = version{"field removed", &removedReading{20.5}, func() interface{} { return &removedReading{} }}
+	renamed  = version{"field renamed", &renamedReading{"boiler room", 20.5}, func() interface{} { return &renamedReading{} }}
+	narrowed = version{"width changed", &narrowedReading{"boiler room", 20.5}, func() interface{} { return &narrowedReading{} }}
+	fixed    = version{"the fix", &fixedReading{"boiler room", 21.25, []float64{20.5, 21.25}}, func() interface{} { return &fixedReading{} }}
+)
+
+// a panic while decoding, returned as an error so the example can report it
+type panicError struct{ value interface{} }
+
+func (e *panicError) Error() string { return fmt.Sprintf("panic: %v", e.value) }
+
+// decode encodes w's struct with its own schema and decodes it into r's, starting
+// from the binary schema the way a client would. It returns what r decoded.
+func decode(w, r version) (dest interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &panicError{p}
+		}
+	}()
+
+	writerSchema := schemer.SchemaOf(w.written)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, w.written); err != nil {
+		return nil, fmt.Errorf("encode error: %w", err)
+	}
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode schema: %w", err)
+	}
+
+	dest = r.defaults()
+	if err := readerSchema.Decode(bytes.NewReader(encodedData.Bytes()), dest); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
+
+// reading returns the field of the struct v points to that is "reading" on the
+// wire, as a float64
+func reading(v interface{}) float64 {
+	rv := reflect.ValueOf(v).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Type().Field(i).Tag.Get("schemer") == "reading" {
+			return rv.Field(i).Convert(reflect.TypeOf(float64(0))).Float()
+		}
+	}
+	return 0
+}
+
+// checkBreaking checks that w's data doesn't decode into r, and says how it
+// fails
+func checkBreaking(w, r version) error {
+	dest, err := decode(w, r)
+	if p, ok := err.(*panicError); ok {
+		return fmt.Errorf("%s data -> %s reader: %v, instead of an error", w.name, r.name, p)
+	}
+	if err == nil {
+		return fmt.Errorf("%s data -> %s reader: decoded, as %+v", w.name, r.name, dest)
+	}
+	fmt.Printf("  %s data -> %s reader: %v\n", w.name, r.name, err)
+	return nil
+}
+
+// checkSafe checks that v1 data decodes into c, and c's data into v1, with the
+// reading arriving both ways (when c has one)
+func checkSafe(c version) error {
+	for _, pair := range [][2]version{{v1, c}, {c, v1}} {
+		w, r := pair[0], pair[1]
+		dest, err := decode(w, r)
+		if err != nil {
+			return fmt.Errorf("%s data -> %s reader: %w", w.name, r.name, err)
+		}
+		if sent, got := reading(w.written), reading(dest); got != sent {
+			return fmt.Errorf("%s data -> %s reader: sent reading %g, got %g", w.name, r.name, sent, got)
+		}
+	}
+	return nil
+}
+
+func main() {
+	fmt.Printf("v1: Reading  float64   `schemer:\"reading\"`\nv2: Readings []float64 `schemer:\"reading\"`\n\n")
+
+	for _, c := range []struct {
+		name  string
+		check func() error
+	}{
+		{"scalar to slice: v1 data doesn't decode into v2", func() error { return checkBreaking(v1, v2) }},
+		{"slice to scalar: v2 data doesn't decode into v1", func() error { return checkBreaking(v2, v1) }},
+		{"safe: " + added.name, func() error { return checkSafe(added) }},
+		{"safe: " + removed.name, func() error { return checkSafe(removed) }},
+		{"safe: " + renamed.name, func() error { return checkSafe(renamed) }},
+		{"safe: " + narrowed.name, func() error { return checkSafe(narrowed) }},
+		{"safe: " + fixed.name + ", a new name for the slice", func() error { return checkSafe(fixed) }},
+	} {
+		if err := c.check(); err != nil {
+			log.Fatalf("%s: %v", c.name, err)
+		}
+		fmt.Println("ok  ", c.name)
+	}
+
+	fmt.Println("\na field's wire name is its identity: never change its kind under the same name, add a new field instead")
+}
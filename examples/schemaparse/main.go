@@ -0,0 +1,143 @@
+// schemaparse measures what parsing a schema costs, to show whether a client
+// should parse the schema once and keep it (as schemerclient does) or can just as
+// well parse it again with every payload. For structs of increasing field count
+// it times, via testing.Benchmark,
+//
+//	binary   schemer.DecodeSchema on the output of MarshalSchemer, what the v2
+//	         and v3 servers send
+//	JSON     schemer.DecodeSchemaJSON on the output of MarshalJSON, what the v1
+//	         server sends
+//	decode   decoding one payload with a schema already parsed, the work a client
+//	         does per request either way
+//
+// and prints ns/op and allocs/op for each, and how much slower a request is when
+// the binary schema is parsed along with every payload. The structs are built
+// with reflect.StructOf, cycling through float64, string, []float64 and int64
+// fields.
+//
+//	go run ./examples/schemaparse
+//	go run ./examples/schemaparse -fields 1,10,100,1000
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bminer/schemer"
+)
+
+// the field types a generated struct cycles through, with a value for each
+var fieldKinds = []struct {
+	t     reflect.Type
+	value reflect.Value
+}{
+	{reflect.TypeOf(float64(0)), reflect.ValueOf(20.5)},
+	{reflect.TypeOf(""), reflect.ValueOf("a header")},
+	{reflect.TypeOf([]float64(nil)), reflect.ValueOf([]float64{20.5, 21.25, 21.5})},
+	{reflect.TypeOf(int64(0)), reflect.ValueOf(int64(1600000000000))},
+}
+
+// sample returns a pointer to a struct with n fields, all set
+func sample(n int) interface{} {
+	fields := make([]reflect.StructField, n)
+	for i := range fields {
+		fields[i] = reflect.StructField{Name: "Field" + strconv.Itoa(i), Type: fieldKinds[i%len(fieldKinds)].t}
+	}
+	v := reflect.New(reflect.StructOf(fields))
+	for i := 0; i < n; i++ {
+		v.Elem().Field(i).Set(fieldKinds[i%len(fieldKinds)].value)
+	}
+	return v.Interface()
+}
+
+type result struct {
+	binarySize, jsonSize int
+	binary, json, decode testing.BenchmarkResult
+}
+
+func measure(n int) (result, error) {
+	var r result
+	v := sample(n)
+	writerSchema := schemer.SchemaOf(v)
+
+	binarySchema := writerSchema.MarshalSchemer()
+	jsonSchema, err := writerSchema.MarshalJSON()
+	if err != nil {
+		return r, err
+	}
+	r.binarySize, r.jsonSize = len(binarySchema), len(jsonSchema)
+
+	// check both parse before timing them
+	readerSchema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		return r, fmt.Errorf("binary schema: %w", err)
+	}
+	if _, err := schemer.DecodeSchemaJSON(jsonSchema); err != nil {
+		return r, fmt.Errorf("JSON schema: %w", err)
+	}
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, v); err != nil {
+		return r, err
+	}
+	payload := encodedData.Bytes()
+	dest := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+	if err := readerSchema.Decode(bytes.NewReader(payload), dest); err != nil {
+		return r, fmt.Errorf("payload: %w", err)
+	}
+
+	r.binary = testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			schemer.DecodeSchema(binarySchema)
+		}
+	})
+	r.json = testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			schemer.DecodeSchemaJSON(jsonSchema)
+		}
+	})
+	r.decode = testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			readerSchema.Decode(bytes.NewReader(payload), dest)
+		}
+	})
+	return r, nil
+}
+
+func main() {
+	counts := flag.String("fields", "1,10,100,500", "comma-separated field counts to measure")
+	flag.Parse()
+
+	var fieldCounts []int
+	for _, s := range strings.Split(*counts, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 1 {
+			log.Fatalf("invalid field count %q", s)
+		}
+		fieldCounts = append(fieldCounts, n)
+	}
+
+	fmt.Printf("%6s  %8s %12s %7s  %8s %12s %7s  %12s %7s  %s\n",
+		"fields", "binary", "ns/op", "allocs", "JSON", "ns/op", "allocs", "decode ns/op", "allocs", "parse per request")
+	for _, n := range fieldCounts {
+		r, err := measure(n)
+		if err != nil {
+			log.Fatalf("%d fields: %v", n, err)
+		}
+		// how much longer a request takes if the client parses the binary schema
+		// every time, instead of once
+		slower := float64(r.binary.NsPerOp()) / float64(r.decode.NsPerOp())
+		fmt.Printf("%6d  %7dB %12d %7d  %7dB %12d %7d  %12d %7d  +%.0f%%\n", n,
+			r.binarySize, r.binary.NsPerOp(), r.binary.AllocsPerOp(),
+			r.jsonSize, r.json.NsPerOp(), r.json.AllocsPerOp(),
+			r.decode.NsPerOp(), r.decode.AllocsPerOp(), slower*100)
+	}
+}
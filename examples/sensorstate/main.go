@@ -0,0 +1,66 @@
+// sensorstate shows the enum pattern for schemer: Go has no enums, so a state is
+// a named integer type with constants (schemas.SensorState, with Idle, Active
+// and Fault), and String and ParseSensorState map it to and from names by hand.
+// schemer only sees the uint8 underneath.
+//
+// That is what makes the pattern safe to evolve. A newer server here knows a
+// fourth state, Calibrating, that the client was built without; it also sends a
+// 255, as a server with a bug might. Both decode without error to the raw
+// number, and the client's switch falls through to its default arm, which
+// handles any state it doesn't know instead of mistaking it for one it does.
+// schemas/state_test.go checks every one of the 256 values round-trips.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+// a state added to the newer server's copy of schemas
+const stateCalibrating schemas.SensorState = 3
+
+// handle is what an older client does with a report: one arm per state it knows,
+// and a default for the ones it doesn't
+func handle(r schemas.StatusReport) string {
+	switch r.State {
+	case schemas.StateIdle:
+		return "nothing to do"
+	case schemas.StateActive:
+		return "plot its readings"
+	case schemas.StateFault:
+		return "page someone"
+	default:
+		return fmt.Sprintf("log %v and keep going", r.State)
+	}
+}
+
+func main() {
+	writerSchema := schemer.SchemaOf(&schemas.StatusReport{})
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		log.Fatal("cannot decode schema: " + err.Error())
+	}
+
+	fmt.Println("reports from a newer server, as an older client handles them:")
+	for _, sent := range []schemas.StatusReport{
+		{Sensor: "boiler", State: schemas.StateIdle},
+		{Sensor: "boiler", State: schemas.StateActive},
+		{Sensor: "boiler", State: schemas.StateFault},
+		{Sensor: "boiler", State: stateCalibrating},
+		{Sensor: "boiler", State: 255},
+	} {
+		var encodedData bytes.Buffer
+		if err := writerSchema.Encode(&encodedData, &sent); err != nil {
+			log.Fatal("encode error: " + err.Error())
+		}
+		var decoded schemas.StatusReport
+		if err := readerSchema.Decode(&encodedData, &decoded); err != nil {
+			log.Fatal("decode error: " + err.Error())
+		}
+		fmt.Printf("  %3d %-16v %s\n", uint8(decoded.State), decoded.State, handle(decoded))
+	}
+}
@@ -0,0 +1,184 @@
+// sizes answers "is schemer still worth it once the payload is gzipped?" It
+// encodes the v2 struct at several reading counts with schemer and with
+// encoding/json, compresses each encoding with gzip and with plain DEFLATE
+// (compress/flate, which is what gzip wraps in a header and a checksum), and
+// prints the sizes along with how long encoding, and encoding plus compressing,
+// take.
+//
+// Compression narrows the gap a lot: JSON spells every reading out as up to 20
+// digits of text and repeats every field name, and that redundancy is exactly
+// what DEFLATE removes. Noisy float64 readings don't compress much in either
+// form, though, and schemer's uncompressed size is already close to what JSON
+// gets down to with gzip, without spending the time compressing takes. Run it and
+// compare the raw schemer column with the gzip JSON one.
+//
+// The readings come from a fixed seed, so the sizes are the same on every run;
+// only the timings vary.
+//
+//	go run ./examples/sizes
+//	go run ./examples/sizes -readings 10,1000 -iterations 1000
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// result is one row of the table
+type result struct {
+	readings int
+	encoding string // "schemer" or "json"
+
+	raw, gzipped, deflated int // sizes in bytes
+
+	// average time per sample
+	encode, encodeGzip, encodeFlate time.Duration
+}
+
+// compressor is what gzip.Writer and flate.Writer have in common
+type compressor interface {
+	io.WriteCloser
+	Reset(dst io.Writer)
+}
+
+// an encoding appends the encoded form of v to buf
+type encoding struct {
+	name   string
+	encode func(buf *bytes.Buffer, v *schemas.V2Reading) error
+}
+
+func encodings() []encoding {
+	writerSchema := schemas.V2WriterSchema()
+	return []encoding{
+		{"schemer", func(buf *bytes.Buffer, v *schemas.V2Reading) error {
+			return writerSchema.Encode(buf, v)
+		}},
+		{"json", func(buf *bytes.Buffer, v *schemas.V2Reading) error {
+			return json.NewEncoder(buf).Encode(v)
+		}},
+	}
+}
+
+// sample builds a reading the way the v2 server does, from seed
+func sample(readings int, seed int64) *schemas.V2Reading {
+	v := schemas.V2Reading{
+		Header:            "update at 2021-06-12T00:33:09Z",
+		RawReadings:       sim.New(sim.DefaultConfig, seed).Next(readings),
+		FilteredReadings:  make([]float64, readings),
+		Sequence:          12345,
+		GeneratedAtUnixMs: 1623456789000,
+	}
+	var workingAverage float64
+	for i := range v.RawReadings {
+		workingAverage = (v.RawReadings[i] * 0.5) + (workingAverage * 0.5)
+		v.FilteredReadings[i] = workingAverage
+	}
+	return &v
+}
+
+// measure fills in the table: one row per reading count and encoding, each
+// timing averaged over iterations runs
+func measure(readingCounts []int, seed int64, iterations int) ([]result, error) {
+	// the compressors are reused, as a server sending many payloads would
+	var raw, compressed bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&compressed, gzip.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	fl, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	compress := func(w compressor) error {
+		compressed.Reset()
+		w.Reset(&compressed)
+		if _, err := w.Write(raw.Bytes()); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+
+	var results []result
+	for _, n := range readingCounts {
+		v := sample(n, seed)
+		for _, e := range encodings() {
+			r := result{readings: n, encoding: e.name}
+
+			steps := []struct {
+				size *int
+				took *time.Duration
+				f    func() error
+			}{
+				{&r.raw, &r.encode, func() error { return nil }},
+				{&r.gzipped, &r.encodeGzip, func() error { return compress(gz) }},
+				{&r.deflated, &r.encodeFlate, func() error { return compress(fl) }},
+			}
+			for i, step := range steps {
+				start := time.Now()
+				for j := 0; j < iterations; j++ {
+					raw.Reset()
+					if err := e.encode(&raw, v); err != nil {
+						return nil, fmt.Errorf("%s, %d readings: %w", e.name, n, err)
+					}
+					if err := step.f(); err != nil {
+						return nil, fmt.Errorf("%s, %d readings: %w", e.name, n, err)
+					}
+				}
+				*step.took = time.Since(start) / time.Duration(iterations)
+				if i == 0 {
+					*step.size = raw.Len()
+				} else {
+					*step.size = compressed.Len()
+				}
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func printTable(results []result) {
+	fmt.Printf("%8s %-8s %8s %8s %8s %12s %12s %12s\n",
+		"readings", "encoding", "raw", "gzip", "flate", "encode", "+gzip", "+flate")
+	for _, r := range results {
+		fmt.Printf("%8d %-8s %8d %8d %8d %12v %12v %12v\n",
+			r.readings, r.encoding, r.raw, r.gzipped, r.deflated, r.encode, r.encodeGzip, r.encodeFlate)
+	}
+}
+
+func main() {
+	counts := flag.String("readings", "0,10,100,1000", "comma-separated numbers of readings to measure")
+	seed := flag.Int64("seed", 1, "seed for the simulated readings")
+	iterations := flag.Int("iterations", 200, "runs each timing is averaged over")
+	flag.Parse()
+
+	var readingCounts []int
+	for _, s := range strings.Split(*counts, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			log.Fatalf("invalid number of readings %q", s)
+		}
+		readingCounts = append(readingCounts, n)
+	}
+	if *iterations < 1 {
+		log.Fatal("-iterations must be at least 1")
+	}
+
+	results, err := measure(readingCounts, *seed, *iterations)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printTable(results)
+}
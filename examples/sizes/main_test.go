@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// gzipOverhead is what gzip adds around the DEFLATE stream: a 10-byte header
+// (no file name or comment) and an 8-byte trailer
+const gzipOverhead = 18
+
+// consistent checks what must hold for any table measure returns
+func consistent(results []result) error {
+	byEncoding := map[string][]result{}
+	for _, r := range results {
+		if r.raw <= 0 || r.deflated <= 0 {
+			return fmt.Errorf("%s, %d readings: empty output", r.encoding, r.readings)
+		}
+		// both use the same DEFLATE level, so gzip is DEFLATE plus its wrapper
+		if r.gzipped != r.deflated+gzipOverhead {
+			return fmt.Errorf("%s, %d readings: gzip is %d bytes, flate %d", r.encoding, r.readings, r.gzipped, r.deflated)
+		}
+		// DEFLATE falls back to storing incompressible data, for 5 bytes a block;
+		// the flate writer also closes the stream with an empty final block,
+		// which takes 2 more
+		if r.deflated > r.raw+5*(r.raw/65535+1)+2 {
+			return fmt.Errorf("%s, %d readings: compressed %d bytes to %d", r.encoding, r.readings, r.raw, r.deflated)
+		}
+		byEncoding[r.encoding] = append(byEncoding[r.encoding], r)
+	}
+
+	// more readings never make a smaller payload
+	for name, rows := range byEncoding {
+		for i := 1; i < len(rows); i++ {
+			if rows[i].readings > rows[i-1].readings && rows[i].raw <= rows[i-1].raw {
+				return fmt.Errorf("%s: %d readings take %d bytes, %d take %d", name, rows[i].readings, rows[i].raw, rows[i-1].readings, rows[i-1].raw)
+			}
+		}
+	}
+
+	// schemer against JSON, row by row
+	for i, s := range byEncoding["schemer"] {
+		j := byEncoding["json"][i]
+		if s.raw >= j.raw {
+			return fmt.Errorf("%d readings: schemer is %d bytes, JSON %d", s.readings, s.raw, j.raw)
+		}
+	}
+	return nil
+}
+
+// counts are the reading counts the tests measure
+var counts = []int{0, 1, 10, 100, 1000}
+
+func TestConsistent(t *testing.T) {
+	results, err := measure(counts, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := consistent(results); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSameSeed checks the sizes come out the same for the same seed; only the
+// timings may differ
+func TestSameSeed(t *testing.T) {
+	first, err := measure(counts, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := measure(counts, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range first {
+		a, b := first[i], second[i]
+		if a.raw != b.raw || a.gzipped != b.gzipped || a.deflated != b.deflated {
+			t.Errorf("%s, %d readings: sizes changed between runs with the same seed", a.encoding, a.readings)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// snapshot serves a schemas.CameraSnapshot, a few KB of opaque image data in a
+// []byte field, and has a client fetch it and write the blob to disk. The server
+// refuses to encode a snapshot larger than maxSnapshotSize, with an error that
+// says so, rather than send a payload no client wants.
+//
+// It also prints the schema schemer gives a []byte field next to that of a
+// []uint16 holding the same values as numbers, and what each encodes into. (In Go
+// []uint8 is []byte, the same type, so there's no []uint8-as-numbers to compare
+// with; []uint16 is the nearest slice of small numbers.)
+//
+//	go run ./examples/snapshot                    # fetch a snapshot into snapshot.bin
+//	go run ./examples/snapshot -out photo.bin
+//
+// The golden payload for CameraSnapshot is in schemas/testdata, with the others.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+// the largest Snapshot the server sends
+const maxSnapshotSize = 8 << 10
+
+var errSnapshotTooLarge = errors.New("snapshot too large")
+
+var writerSchema = schemer.SchemaOf(&schemas.CameraSnapshot{})
+
+// encodeSnapshot encodes s, unless its Snapshot is over maxSnapshotSize
+func encodeSnapshot(s *schemas.CameraSnapshot) ([]byte, error) {
+	if len(s.Snapshot) > maxSnapshotSize {
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d", errSnapshotTooLarge, len(s.Snapshot), maxSnapshotSize)
+	}
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, s); err != nil {
+		return nil, err
+	}
+	return encodedData.Bytes(), nil
+}
+
+// newServer serves s at /get-schema/ and /get-data/
+func newServer(s *schemas.CameraSnapshot) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(schemerclient.SchemaPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(writerSchema.MarshalSchemer())
+	})
+	mux.HandleFunc(schemerclient.DataPath, func(w http.ResponseWriter, req *http.Request) {
+		data, err := encodeSnapshot(s)
+		if err != nil {
+			http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	})
+	return httptest.NewServer(mux)
+}
+
+// fetchToFile fetches the snapshot served at url and writes its blob to path
+func fetchToFile(url, path string) (schemas.CameraSnapshot, error) {
+	client, err := schemerclient.New(url)
+	if err != nil {
+		return schemas.CameraSnapshot{}, err
+	}
+	var s schemas.CameraSnapshot
+	if err := client.Fetch(context.Background(), &s); err != nil {
+		return s, err
+	}
+	return s, ioutil.WriteFile(path, s.Snapshot, 0o644)
+}
+
+// blob returns n bytes of noise, as incompressible as a real JPEG
+func blob(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+// compareWithNumbers prints the schema and encoded size of b as a []byte and as a
+// []uint16
+func compareWithNumbers(b []byte) error {
+	numbers := make([]uint16, len(b))
+	for i, v := range b {
+		numbers[i] = uint16(v)
+	}
+	for _, c := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"[]byte", b},
+		{"[]uint16", numbers},
+	} {
+		schema := schemer.SchemaOf(c.v)
+		jsonSchema, err := schema.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		var encodedData bytes.Buffer
+		if err := schema.Encode(&encodedData, c.v); err != nil {
+			return err
+		}
+		fmt.Printf("  %-9s %5d bytes  schema %s\n", c.name, encodedData.Len(), jsonSchema)
+	}
+	return nil
+}
+
+func main() {
+	out := flag.String("out", "snapshot.bin", "file to write the snapshot to")
+	flag.Parse()
+
+	sent := &schemas.CameraSnapshot{Camera: "camera-1", TakenAtUnixMs: 1600000000000, Snapshot: blob(4 << 10)}
+	ts := newServer(sent)
+	defer ts.Close()
+
+	received, err := fetchToFile(ts.URL, *out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !bytes.Equal(received.Snapshot, sent.Snapshot) {
+		log.Fatalf("the snapshot changed on the way: sent %d bytes, got %d", len(sent.Snapshot), len(received.Snapshot))
+	}
+	fmt.Printf("wrote the %d byte snapshot from %s to %s\n\n", len(received.Snapshot), received.Camera, *out)
+
+	fmt.Println("the same 256 bytes as a []byte and as numbers:")
+	if err := compareWithNumbers(blob(256)); err != nil {
+		log.Fatal(err)
+	}
+}
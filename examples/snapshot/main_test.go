@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+func TestSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		name     string
+		snapshot []byte
+	}{
+		{"empty", []byte{}},
+		{"nil", nil},
+		{"largest", blob(maxSnapshotSize)},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ts := newServer(&schemas.CameraSnapshot{Camera: c.name, Snapshot: c.snapshot})
+			defer ts.Close()
+			path := filepath.Join(dir, c.name+".bin")
+			s, err := fetchToFile(ts.URL, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			written, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Camera != c.name || !bytes.Equal(s.Snapshot, c.snapshot) || !bytes.Equal(written, c.snapshot) {
+				t.Fatalf("sent %d bytes, decoded %d and wrote %d", len(c.snapshot), len(s.Snapshot), len(written))
+			}
+		})
+	}
+}
+
+// TestTooLarge checks one byte over the limit is refused when encoding, not sent
+func TestTooLarge(t *testing.T) {
+	tooLarge := &schemas.CameraSnapshot{Snapshot: blob(maxSnapshotSize + 1)}
+	if _, err := encodeSnapshot(tooLarge); !errors.Is(err, errSnapshotTooLarge) {
+		t.Fatalf("expected errSnapshotTooLarge, got %v", err)
+	}
+
+	ts := newServer(tooLarge)
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "too-large.bin")
+	if _, err := fetchToFile(ts.URL, path); err == nil {
+		t.Fatal("the client got a snapshot over the limit")
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("the client wrote a file")
+	}
+}
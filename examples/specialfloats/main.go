@@ -0,0 +1,123 @@
+// specialfloats shows which float64 values survive a schemer round trip exactly.
+// The simulated sensors only ever produce ordinary positive readings, but a real
+// sensor can legitimately report a negative value, one too small to be normal,
+// or Inf and NaN for "off the scale" and "no reading". Each value below is sent
+// on its own as a []float64 and decoded back two ways:
+//
+//	float64 reader   must get back the very same bits; the example exits
+//	                 non-zero if any value changes
+//	float32 reader   like the v1 client; shows what narrowing does to each value
+//	                 (float32 has no subnormals this small, and no MaxFloat64)
+//
+// Bits are compared rather than values, so a NaN (which never equals itself)
+// and the sign of -0 are checked too.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/bminer/schemer"
+)
+
+type writerStruct struct {
+	Readings []float64
+}
+
+type float32Reader struct {
+	Readings []float32
+}
+
+var values = []struct {
+	name  string
+	value float64
+}{
+	{"negative", -273.15},
+	{"negative zero", math.Copysign(0, -1)},
+	{"largest float64", math.MaxFloat64},
+	{"smallest normal", 2.2250738585072014e-308},
+	{"subnormal", 1e-310},
+	{"smallest subnormal", math.SmallestNonzeroFloat64},
+	{"+Inf", math.Inf(1)},
+	{"-Inf", math.Inf(-1)},
+	{"NaN", math.NaN()},
+}
+
+// same reports whether a and b are the same float64, bit for bit
+func same(a, b float64) bool {
+	return math.Float64bits(a) == math.Float64bits(b)
+}
+
+// roundTrip sends v as a one-reading []float64 and decodes it into both readers
+func roundTrip(v float64) (float64, float32, error, error) {
+	sent := writerStruct{Readings: []float64{v}}
+
+	writerSchema := schemer.SchemaOf(&sent)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, &sent); err != nil {
+		err = fmt.Errorf("cannot encode: %w", err)
+		return 0, 0, err, err
+	}
+
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		log.Fatal("cannot decode schema: " + err.Error())
+	}
+
+	var as64 writerStruct
+	err64 := readerSchema.Decode(bytes.NewReader(encodedData.Bytes()), &as64)
+	if err64 == nil && len(as64.Readings) != 1 {
+		err64 = fmt.Errorf("got back %d readings", len(as64.Readings))
+	}
+	var as32 float32Reader
+	err32 := readerSchema.Decode(bytes.NewReader(encodedData.Bytes()), &as32)
+	if err32 == nil && len(as32.Readings) != 1 {
+		err32 = fmt.Errorf("got back %d readings", len(as32.Readings))
+	}
+
+	var got64 float64
+	var got32 float32
+	if err64 == nil {
+		got64 = as64.Readings[0]
+	}
+	if err32 == nil {
+		got32 = as32.Readings[0]
+	}
+	return got64, got32, err64, err32
+}
+
+func main() {
+	fmt.Printf("%-20s %-34s %s\n", "", "float64 reader", "float32 reader")
+	changed := 0
+	for _, v := range values {
+		got64, got32, err64, err32 := roundTrip(v.value)
+
+		col64 := fmt.Sprintf("%g (exact)", got64)
+		switch {
+		case err64 != nil:
+			col64 = "error: " + err64.Error()
+			changed++
+		case !same(got64, v.value):
+			col64 = fmt.Sprintf("%g (CHANGED)", got64)
+			changed++
+		}
+
+		// for the float32 reader, compare with what Go's own conversion gives
+		col32 := fmt.Sprintf("%g (as float32())", got32)
+		switch {
+		case err32 != nil:
+			col32 = "error: " + err32.Error()
+		case math.Float32bits(got32) != math.Float32bits(float32(v.value)):
+			col32 = fmt.Sprintf("%g (float32() gives %g)", got32, float32(v.value))
+		}
+
+		fmt.Printf("%-20s %-34s %s\n", v.name, col64, col32)
+	}
+
+	if changed > 0 {
+		log.Fatalf("%d of %d float64 values did not survive the round trip exactly", changed, len(values))
+	}
+	fmt.Println("\nevery float64 value survived exactly, Inf and NaN included")
+}
@@ -0,0 +1,94 @@
+// streaming sends a struct holding one million readings over HTTP without
+// holding the encoded payload in memory on either side: the server encodes
+// straight into the http.ResponseWriter, flushing as it goes, and the client
+// decodes straight from resp.Body with schemerclient.FetchStream. Encode and
+// Decode only need an io.Writer and an io.Reader.
+//
+// schemerclient's TestFetchStreamMemory measures what this saves over encoding
+// into a bytes.Buffer and reading the body with ioutil.ReadAll, and
+// BenchmarkFetchStream and BenchmarkFetchBuffered compare the two.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+const (
+	numReadings = 1000000
+	flushEvery  = 64 * 1024 // bytes written between flushes
+)
+
+type sourceStruct struct {
+	Header   string
+	Readings []float64
+}
+
+var structToEncode sourceStruct
+var writerSchema = schemer.SchemaOf(&structToEncode)
+
+// flushWriter flushes the response every flushEvery bytes, so the client starts
+// receiving data while the server is still encoding
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	pending int
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.pending += n
+	if fw.pending >= flushEvery {
+		fw.flusher.Flush()
+		fw.pending = 0
+	}
+	return n, err
+}
+
+// streamingHandler encodes directly into the response
+func streamingHandler(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	// once encoding has started the status is already sent, so an error can
+	// only cut the response short; the client sees that as a decode error
+	fw := &flushWriter{w: w, flusher: flusher}
+	if err := writerSchema.Encode(fw, &structToEncode); err != nil {
+		log.Println("encode error: " + err.Error())
+		return
+	}
+	flusher.Flush()
+}
+
+func main() {
+	structToEncode.Header = "one million readings"
+	structToEncode.Readings = sim.New(sim.DefaultConfig, 1).Next(numReadings)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(schemerclient.SchemaPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(writerSchema.MarshalSchemer())
+	})
+	mux.HandleFunc(schemerclient.DataPath, streamingHandler)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client, err := schemerclient.New(ts.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var dest sourceStruct
+	if err := client.FetchStream(context.Background(), &dest); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s: streamed %d readings, the last %.2f\n", dest.Header, len(dest.Readings), dest.Readings[len(dest.Readings)-1])
+}
@@ -0,0 +1,119 @@
+// transcode shows the usual first step of moving a JSON-based system over to
+// schemer: the Go struct stays the same, only the encoding changes. It reads a
+// JSON document shaped like the v2 server's reading, re-encodes it with schemer,
+// reports how many bytes that saves, and then goes back from schemer to JSON to
+// show nothing was lost along the way.
+//
+//	go run ./examples/transcode                 # uses a generated sample document
+//	go run ./examples/transcode -in reading.json
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+// sourceStruct is the shape of the documents the existing JSON-based API sends
+type sourceStruct = schemas.V2Reading
+
+// sampleDocument builds a realistic JSON document: one minute of readings, once a
+// second, the way an existing JSON API would have sent them
+func sampleDocument() []byte {
+	g := sim.New(sim.DefaultConfig, 1)
+	raw := g.Next(60)
+
+	filtered := make([]float64, len(raw))
+	for i, v := range raw {
+		if i == 0 {
+			filtered[i] = v
+			continue
+		}
+		filtered[i] = 0.8*filtered[i-1] + 0.2*v
+	}
+
+	doc, err := json.MarshalIndent(sourceStruct{
+		Header:            "Four score and seven years ago",
+		RawReadings:       raw,
+		FilteredReadings:  filtered,
+		Sequence:          1234,
+		GeneratedAtUnixMs: time.Date(2021, 6, 11, 19, 26, 54, 0, time.UTC).UnixNano() / int64(time.Millisecond),
+	}, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return doc
+}
+
+func main() {
+	in := flag.String("in", "", "JSON document to transcode (default: a generated sample)")
+	flag.Parse()
+
+	jsonDoc := sampleDocument()
+	if *in != "" {
+		var err error
+		if jsonDoc, err = ioutil.ReadFile(*in); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// JSON -> Go struct -> schemer
+	var fromJSON sourceStruct
+	if err := json.Unmarshal(jsonDoc, &fromJSON); err != nil {
+		log.Fatal("cannot parse JSON document: " + err.Error())
+	}
+
+	writerSchema := schemas.V2WriterSchema()
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, &fromJSON); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+
+	// compact JSON is the fair comparison; nobody sends the indented form
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, jsonDoc); err != nil {
+		log.Fatal(err)
+	}
+	binarySchema := writerSchema.MarshalSchemer()
+
+	fmt.Printf("JSON:    %6d bytes (%d indented)\n", compact.Len(), len(jsonDoc))
+	fmt.Printf("schemer: %6d bytes, %.0f%% smaller\n",
+		encodedData.Len(), 100*(1-float64(encodedData.Len())/float64(compact.Len())))
+	fmt.Printf("         plus a %d byte schema, sent once rather than with every document\n", len(binarySchema))
+
+	// schemer -> Go struct -> JSON, as a reader that still has to hand JSON on to
+	// systems that haven't moved over yet would do
+	readerSchema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		log.Fatal("cannot decode schema: " + err.Error())
+	}
+	var fromSchemer sourceStruct
+	if err := readerSchema.Decode(&encodedData, &fromSchemer); err != nil {
+		log.Fatal("decode error: " + err.Error())
+	}
+
+	backToJSON, err := json.Marshal(&fromSchemer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// marshal the struct parsed from the input too, so that fields the input left
+	// out, key order and whitespace don't count as differences
+	expected, err := json.Marshal(&fromJSON)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !bytes.Equal(expected, backToJSON) {
+		log.Fatalf("document changed on the way through schemer:\nbefore: %s\nafter:  %s", expected, backToJSON)
+	}
+
+	fmt.Println("JSON -> schemer -> JSON gives back the same document")
+}
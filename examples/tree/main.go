@@ -0,0 +1,137 @@
+// tree tries schemer on a recursive type, a tree node whose Children are more
+// tree nodes. Recursive types are a classic hard case for schema systems, since
+// a schema describing the type would have to contain itself. The example builds a
+// tree four levels deep and either shows it surviving a round trip intact, or
+// shows the error schemer gives for the type, so users know which to expect.
+//
+// A library walking a recursive type without noticing can recurse until the stack
+// overflows, which kills the program on the spot; recover can't catch it. So the
+// round trip runs in a child process (this same program, with roundTripEnv set),
+// and the parent reports how the child ended.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"github.com/bminer/schemer"
+)
+
+type TreeNode struct {
+	Value    float64
+	Children []TreeNode
+}
+
+// sampleTree is a root with two children, one of which has its own children,
+// one of which has a child as well: four levels in all
+func sampleTree() TreeNode {
+	return TreeNode{
+		Value: 1,
+		Children: []TreeNode{
+			{Value: 1.1},
+			{
+				Value: 1.2,
+				Children: []TreeNode{
+					{Value: 1.21, Children: []TreeNode{{Value: 1.211}}},
+					{Value: 1.22},
+				},
+			},
+		},
+	}
+}
+
+func printTree(n TreeNode, depth int) {
+	fmt.Printf("%s%v\n", strings.Repeat("  ", depth), n.Value)
+	for _, c := range n.Children {
+		printTree(c, depth+1)
+	}
+}
+
+// schemaOf calls schemer.SchemaOf, turning a panic over the recursive type into
+// an error
+func schemaOf(v interface{}) (s schemer.Schema, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("SchemaOf panicked: %v", r)
+		}
+	}()
+	return schemer.SchemaOf(v), nil
+}
+
+// set in the child process that does the actual round trip
+const roundTripEnv = "TREE_ROUND_TRIP"
+
+func main() {
+	if os.Getenv(roundTripEnv) == "1" {
+		roundTrip()
+		return
+	}
+
+	tree := sampleTree()
+	fmt.Println("tree to encode:")
+	printTree(tree, 1)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), roundTripEnv+"=1")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	exitErr, ok := err.(*exec.ExitError)
+	switch {
+	case err == nil:
+	case ok && exitErr.ExitCode() == 2:
+		// the exit status of a Go program killed by a fatal error or panic
+		firstLine := strings.SplitN(stderr.String(), "\n", 2)[0]
+		fmt.Println("schemer crashed on the recursive type:", firstLine)
+		fmt.Println("store the tree flattened instead, e.g. a []Node where each Node holds its parent's index")
+		os.Exit(1)
+	default:
+		log.Fatalf("round trip failed: %v\n%s", err, stderr.String())
+	}
+}
+
+// roundTrip encodes and decodes the sample tree, and checks it comes back intact
+func roundTrip() {
+	tree := sampleTree()
+
+	writerSchema, err := schemaOf(&tree)
+	if err != nil {
+		fmt.Println("schemer can't build a schema for a recursive type:", err)
+		fmt.Println("store the tree flattened instead, e.g. a []Node where each Node holds its parent's index")
+		return
+	}
+
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, &tree); err != nil {
+		fmt.Println("schemer can't encode the recursive type:", err)
+		return
+	}
+	fmt.Printf("encoded into %d bytes\n", encodedData.Len())
+
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		fmt.Println("the schema for the recursive type doesn't decode:", err)
+		return
+	}
+
+	var decoded TreeNode
+	if err := readerSchema.Decode(&encodedData, &decoded); err != nil {
+		fmt.Println("schemer can't decode the recursive type:", err)
+		return
+	}
+
+	fmt.Println("decoded tree:")
+	printTree(decoded, 1)
+
+	if !reflect.DeepEqual(decoded, tree) {
+		log.Fatal("the decoded tree differs from the original")
+	}
+	fmt.Println("the whole tree, all four levels, survived the round trip")
+}
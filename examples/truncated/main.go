@@ -0,0 +1,83 @@
+// truncated shows what a client sees when a connection drops part way through a
+// response: it encodes a full struct, then hands Decode only the first half of
+// the bytes (and, for good measure, every shorter prefix as well). Decode must
+// fail with an error every time instead of quietly returning partial data. On
+// error the destination may already be partly filled in, so the example decodes
+// into a scratch value and only keeps it once Decode has succeeded.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/bminer/schemer"
+)
+
+type sourceStruct struct {
+	Header   string
+	Readings []float64
+	Sequence uint64
+}
+
+// decode parses binarySchema and uses it to decode data into dest
+func decode(binarySchema, data []byte, dest interface{}) error {
+	readerSchema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		return err
+	}
+	return readerSchema.Decode(bytes.NewReader(data), dest)
+}
+
+func main() {
+
+	structToEncode := sourceStruct{
+		Header:   "Four score and seven years ago",
+		Readings: []float64{20.9, 21.0, 21.2, 21.1, 20.8, 21.3},
+		Sequence: 42,
+	}
+	writerSchema := schemer.SchemaOf(&structToEncode)
+	binarySchema := writerSchema.MarshalSchemer()
+
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, &structToEncode); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+	full := encodedData.Bytes()
+
+	// what the client trusts; only ever replaced after a successful decode
+	var lastGood sourceStruct
+
+	half := full[:len(full)/2]
+	var scratch sourceStruct
+	err := decode(binarySchema, half, &scratch)
+	if err == nil {
+		log.Fatalf("decoding %d of %d bytes succeeded, got %+v", len(half), len(full), scratch)
+	}
+	fmt.Printf("decoding %d of %d bytes fails: %v\n", len(half), len(full), err)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		fmt.Println("  (the error wraps an EOF, so a client can tell a cut-off response from bad data)")
+	}
+	fmt.Printf("  scratch value after the failed decode: %+v (not trusted)\n", scratch)
+	fmt.Printf("  value the client keeps: %+v\n", lastGood)
+
+	// every shorter prefix must fail too, wherever the cut lands: in the middle of
+	// the header, the slice length, a reading or the sequence number
+	for n := 0; n < len(full); n++ {
+		var v sourceStruct
+		if err := decode(binarySchema, full[:n], &v); err == nil {
+			log.Fatalf("decoding the first %d of %d bytes succeeded, got %+v", n, len(full), v)
+		}
+	}
+	fmt.Printf("every prefix from 0 to %d bytes fails to decode\n", len(full)-1)
+
+	// and the whole payload decodes, and only now replaces the trusted value
+	scratch = sourceStruct{}
+	if err := decode(binarySchema, full, &scratch); err != nil {
+		log.Fatal("decode error: " + err.Error())
+	}
+	lastGood = scratch
+	fmt.Printf("all %d bytes decode into %+v\n", len(full), lastGood)
+}
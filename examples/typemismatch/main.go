@@ -0,0 +1,73 @@
+// typemismatch shows where schemer draws the line between a cross-type decode
+// it does for you and one it refuses. The writer sends its Readings as
+// []float64, and two readers decode them:
+//
+//	float32  Readings []float32, as the v1 client has it: allowed, schemer
+//	         converts every double to the nearest float32
+//	string   Readings []string: not allowed, Decode has to fail with an error
+//	         that names the Readings field instead of filling it with garbage
+//
+// Numbers convert between numeric types; nothing converts between a number and
+// a string. The example exits non-zero if either reader gets the other outcome,
+// or if the error doesn't say which field it's about.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bminer/schemer"
+)
+
+type writerStruct struct {
+	Readings []float64
+}
+
+// what the v1 client declares
+type float32Reader struct {
+	Readings []float32
+}
+
+// a reader that got the type wrong
+type stringReader struct {
+	Readings []string
+}
+
+func main() {
+	sent := writerStruct{Readings: []float64{20.5, 21.25, 19.875}}
+
+	writerSchema := schemer.SchemaOf(&sent)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, &sent); err != nil {
+		log.Fatal(err)
+	}
+	payload := encodedData.Bytes()
+
+	// the reader only ever has the schema as it came over the wire
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		log.Fatal("cannot decode schema: " + err.Error())
+	}
+
+	fmt.Printf("sent Readings %v as []float64\n\n", sent.Readings)
+
+	var asFloat32 float32Reader
+	if err := readerSchema.Decode(bytes.NewReader(payload), &asFloat32); err != nil {
+		log.Fatalf("decoding []float64 into []float32 should work, but failed: %v", err)
+	}
+	fmt.Printf("into []float32: ok, %v\n", asFloat32.Readings)
+
+	var asString stringReader
+	err = readerSchema.Decode(bytes.NewReader(payload), &asString)
+	if err == nil {
+		log.Fatalf("decoding []float64 into []string should fail, but gave %q", asString.Readings)
+	}
+	fmt.Printf("into []string:  error, %v\n", err)
+
+	if !strings.Contains(err.Error(), "Readings") {
+		log.Fatal("the error should name the Readings field, so the mismatch can be found")
+	}
+	fmt.Println("\nthe error names the field; numeric types convert, numbers and strings don't")
+}
@@ -0,0 +1,88 @@
+// uint64 shows that schemer carries a uint64 near math.MaxUint64 across the wire
+// exactly, with no sign extension or overflow, and what happens when the same
+// value is decoded into an int64 field that cannot hold it.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/bminer/schemer"
+)
+
+// what the writer sends: a high-magnitude counter
+type counterStruct struct {
+	Counter uint64
+}
+
+// an older reader that declared the counter as signed
+type signedCounterStruct struct {
+	Counter int64
+}
+
+// encode returns the binary schema and the encoded data for v
+func encode(v interface{}) ([]byte, []byte) {
+	writerSchema := schemer.SchemaOf(v)
+
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, v); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+	return writerSchema.MarshalSchemer(), encodedData.Bytes()
+}
+
+// decode parses binarySchema and uses it to decode data into dest
+func decode(binarySchema, data []byte, dest interface{}) error {
+	writerSchema, err := schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		return err
+	}
+	return writerSchema.Decode(bytes.NewReader(data), dest)
+}
+
+func main() {
+
+	values := []uint64{
+		math.MaxUint64,
+		math.MaxUint64 - 1,
+		math.MaxInt64 + 1, // smallest value an int64 can't hold
+		math.MaxInt64,     // largest value an int64 can hold
+		42,
+	}
+
+	for _, v := range values {
+		fmt.Printf("Counter = %d\n", v)
+
+		binarySchema, data := encode(&counterStruct{Counter: v})
+		fmt.Printf("  encoded into %d bytes\n", len(data))
+
+		// uint64 -> uint64 must always survive exactly
+		var unsigned counterStruct
+		if err := decode(binarySchema, data, &unsigned); err != nil {
+			log.Fatal("decode error: " + err.Error())
+		}
+		if unsigned.Counter != v {
+			log.Fatalf("uint64 round trip changed the value: got %d, want %d", unsigned.Counter, v)
+		}
+		fmt.Printf("  uint64 reader: %d (exact)\n", unsigned.Counter)
+
+		// uint64 -> int64 only works while the value fits in an int64
+		var signed signedCounterStruct
+		err := decode(binarySchema, data, &signed)
+		switch {
+		case err != nil:
+			fmt.Printf("  int64 reader:  error: %v\n", err)
+		case signed.Counter < 0 || uint64(signed.Counter) != v:
+			fmt.Printf("  int64 reader:  %d (WRONG: the value did not fit and was silently changed)\n", signed.Counter)
+		default:
+			fmt.Printf("  int64 reader:  %d (exact)\n", signed.Counter)
+		}
+	}
+
+	fmt.Println(`
+A uint64 reader always gets the exact value back. An int64 reader is fine as
+long as the counter stays at or below math.MaxInt64; above that the value simply
+does not fit, so keep the reader field unsigned if the counter can get that big.`)
+}
@@ -0,0 +1,61 @@
+// unexported shows that schemer, like encoding/json, only sees exported fields.
+// An unexported field isn't part of the schema and isn't encoded, so whatever the
+// writer kept in it is gone on the reader's side, where the field is left at its
+// zero value. Anything the other side needs has to live in an exported field.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bminer/schemer"
+)
+
+type sourceStruct struct {
+	Readings    []float64 // exported: encoded
+	internalSeq int       // unexported: invisible to schemer
+}
+
+func main() {
+
+	structToEncode := sourceStruct{
+		Readings:    []float64{20.9, 21.0, 21.2},
+		internalSeq: 42,
+	}
+	writerSchema := schemer.SchemaOf(&structToEncode)
+
+	// the schema only lists the exported field
+	jsonSchema, err := writerSchema.MarshalJSON()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("writer schema: %s\n", jsonSchema)
+	if strings.Contains(strings.ToLower(string(jsonSchema)), "internalseq") {
+		log.Fatal("the schema mentions the unexported field")
+	}
+
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, &structToEncode); err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		log.Fatal("cannot decode schema: " + err.Error())
+	}
+
+	var decoded sourceStruct
+	if err := readerSchema.Decode(&encodedData, &decoded); err != nil {
+		log.Fatal("decode error: " + err.Error())
+	}
+
+	fmt.Printf("sent:     Readings=%v internalSeq=%d\n", structToEncode.Readings, structToEncode.internalSeq)
+	fmt.Printf("received: Readings=%v internalSeq=%d\n", decoded.Readings, decoded.internalSeq)
+
+	if decoded.internalSeq != 0 {
+		log.Fatalf("internalSeq survived the trip as %d", decoded.internalSeq)
+	}
+	fmt.Println("Readings made it across; internalSeq came back as its zero value")
+}
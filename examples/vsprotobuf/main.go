@@ -0,0 +1,165 @@
+// vsprotobuf answers "why not just use protobuf?" with a side-by-side run on
+// the same data: the v2 server's readings, encoded with schemer and with the
+// equivalent protobuf message (see proto.go). It prints
+//
+//   - the encoded size of each, for a range of reading counts
+//   - how long each takes to encode and decode a sample, via testing.Benchmark
+//   - what happens when the v1 client reads v2 data with each of them, which is
+//     where the two differ most
+//
+// On the wire the two are close: both write doubles as 8 bytes and lengths and
+// integers as varints. Protobuf also tags every field with a number, while
+// schemer relies on the schema sent alongside instead.
+//
+// The bigger difference is schema evolution. Protobuf matches fields by number
+// and trusts the reader's .proto for their types, so v2 changing field 1 from
+// float to double makes the v1 reader silently decode garbage: a packed double
+// is exactly two floats long. The protobuf way around it is to never change a
+// field's type, and to send doubles in a new field next to the floats in the old
+// one. Schemer matches fields by name (or tag) and decodes with the writer's
+// schema, so it converts the doubles to the v1 reader's float32 by itself.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+func sample(readings int) *schemas.V2Reading {
+	raw := sim.New(sim.DefaultConfig, 1).Next(readings)
+	return &schemas.V2Reading{
+		Header:            "vsprotobuf",
+		RawReadings:       append([]float64(nil), raw...),
+		FilteredReadings:  append([]float64(nil), raw...),
+		Sequence:          12345,
+		GeneratedAtUnixMs: 1623456789000,
+	}
+}
+
+func encodeSchemer(schema schemer.Schema, v *schemas.V2Reading) []byte {
+	var buf bytes.Buffer
+	if err := schema.Encode(&buf, v); err != nil {
+		log.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func printSizes(writerSchema schemer.Schema) {
+	fmt.Println("encoded size in bytes:")
+	fmt.Printf("  %8s %10s %10s\n", "readings", "schemer", "protobuf")
+	for _, n := range []int{0, 1, 10, 100, 1000} {
+		v := sample(n)
+		protoData := marshalV2(nil, v)
+
+		// make sure the hand-written protobuf code round-trips before timing it
+		var decoded schemas.V2Reading
+		if err := unmarshalV2(protoData, &decoded); err != nil || !reflect.DeepEqual(&decoded, v) {
+			log.Fatalf("protobuf round trip of %d readings failed: %v", n, err)
+		}
+
+		fmt.Printf("  %8d %10d %10d\n", n, len(encodeSchemer(writerSchema, v)), len(protoData))
+	}
+	fmt.Printf("  schemer also sends its schema once: %d bytes\n\n", len(writerSchema.MarshalSchemer()))
+}
+
+func printSpeed(writerSchema schemer.Schema, readings int) {
+	v := sample(readings)
+	schemerData := encodeSchemer(writerSchema, v)
+	protoData := marshalV2(nil, v)
+
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// both encoders write into a reused buffer, so neither pays for growing one
+	var buf bytes.Buffer
+	var b []byte
+	var dest schemas.V2Reading
+
+	results := []struct {
+		name string
+		f    func(*testing.B)
+	}{
+		{"schemer encode", func(tb *testing.B) {
+			for i := 0; i < tb.N; i++ {
+				buf.Reset()
+				if err := writerSchema.Encode(&buf, v); err != nil {
+					tb.Fatal(err)
+				}
+			}
+		}},
+		{"protobuf encode", func(tb *testing.B) {
+			for i := 0; i < tb.N; i++ {
+				b = marshalV2(b[:0], v)
+			}
+		}},
+		{"schemer decode", func(tb *testing.B) {
+			for i := 0; i < tb.N; i++ {
+				if err := readerSchema.Decode(bytes.NewReader(schemerData), &dest); err != nil {
+					tb.Fatal(err)
+				}
+			}
+		}},
+		{"protobuf decode", func(tb *testing.B) {
+			for i := 0; i < tb.N; i++ {
+				if err := unmarshalV2(protoData, &dest); err != nil {
+					tb.Fatal(err)
+				}
+			}
+		}},
+	}
+
+	fmt.Printf("speed, for a sample of %d readings:\n", readings)
+	for _, r := range results {
+		res := testing.Benchmark(func(tb *testing.B) {
+			tb.ReportAllocs()
+			r.f(tb)
+		})
+		fmt.Printf("  %-16s %10d ns/op %6d allocs/op\n", r.name, res.NsPerOp(), res.AllocsPerOp())
+	}
+	fmt.Println()
+}
+
+func printEvolution(writerSchema schemer.Schema) {
+	v := sample(4)
+	fmt.Println("the v1 client reading v2 data, whose readings went from float to double:")
+	fmt.Printf("  sent:     %v\n", v.FilteredReadings)
+
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		log.Fatal(err)
+	}
+	var fromSchemer schemas.V1Reading
+	if err := readerSchema.Decode(bytes.NewReader(encodeSchemer(writerSchema, v)), &fromSchemer); err != nil {
+		fmt.Printf("  schemer:  error: %v\n", err)
+	} else {
+		fmt.Printf("  schemer:  %v\n", fromSchemer.Readings)
+	}
+
+	var fromProto schemas.V1Reading
+	if err := unmarshalV1(marshalV2(nil, v), &fromProto); err != nil {
+		fmt.Printf("  protobuf: error: %v\n", err)
+	} else {
+		fmt.Printf("  protobuf: %v (no error, twice as many values, none of them right)\n", fromProto.Readings)
+	}
+}
+
+func main() {
+	readings := flag.Int("readings", 100, "number of readings in the sample used for the speed comparison")
+	flag.Parse()
+
+	writerSchema := schemas.V2WriterSchema()
+
+	printSizes(writerSchema)
+	printSpeed(writerSchema, *readings)
+	printEvolution(writerSchema)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// The protobuf messages equivalent to schemas.V2Reading and schemas.V1Reading.
+// Field 1 plays the part of schemer's `schemer:"readings"` tag: it is where a v1
+// reader looks for its readings.
+//
+//	syntax = "proto3";
+//
+//	message V2Reading {
+//	  repeated double filtered_readings    = 1;
+//	  repeated double raw_readings         = 2;
+//	  string          header               = 3;
+//	  uint64          sequence             = 4;
+//	  int64           generated_at_unix_ms = 5;
+//	}
+//
+//	message V1Reading {
+//	  repeated float readings = 1;
+//	}
+//
+// There's no protoc in this repo's toolchain, so instead of generated code the
+// messages are marshalled by hand with protowire, the package generated code is
+// built on. The bytes are exactly what protoc-gen-go's code would produce (proto3
+// packs repeated scalars and leaves out zero values), and the speed is in the
+// same league, since generated code does the same appends.
+
+const (
+	fieldFilteredReadings protowire.Number = 1
+	fieldRawReadings      protowire.Number = 2
+	fieldHeader           protowire.Number = 3
+	fieldSequence         protowire.Number = 4
+	fieldGeneratedAt      protowire.Number = 5
+)
+
+func appendPackedDoubles(b []byte, num protowire.Number, values []float64) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	b = protowire.AppendVarint(b, uint64(8*len(values)))
+	for _, v := range values {
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	}
+	return b
+}
+
+// marshalV2 appends the protobuf encoding of v to b
+func marshalV2(b []byte, v *schemas.V2Reading) []byte {
+	b = appendPackedDoubles(b, fieldFilteredReadings, v.FilteredReadings)
+	b = appendPackedDoubles(b, fieldRawReadings, v.RawReadings)
+	if v.Header != "" {
+		b = protowire.AppendTag(b, fieldHeader, protowire.BytesType)
+		b = protowire.AppendString(b, v.Header)
+	}
+	if v.Sequence != 0 {
+		b = protowire.AppendTag(b, fieldSequence, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.Sequence)
+	}
+	if v.GeneratedAtUnixMs != 0 {
+		b = protowire.AppendTag(b, fieldGeneratedAt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v.GeneratedAtUnixMs))
+	}
+	return b
+}
+
+func consumePackedDoubles(b []byte, dest []float64) ([]float64, int) {
+	packed, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return dest, n
+	}
+	if len(packed)%8 != 0 {
+		return dest, -1
+	}
+	for i := 0; i < len(packed); i += 8 {
+		bits, _ := protowire.ConsumeFixed64(packed[i:])
+		dest = append(dest, math.Float64frombits(bits))
+	}
+	return dest, n
+}
+
+// unmarshalV2 decodes a V2Reading message into v. Unknown fields are skipped,
+// which is how protobuf lets old readers ignore fields added later.
+func unmarshalV2(b []byte, v *schemas.V2Reading) error {
+	*v = schemas.V2Reading{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == fieldFilteredReadings && typ == protowire.BytesType:
+			v.FilteredReadings, n = consumePackedDoubles(b, v.FilteredReadings)
+		case num == fieldRawReadings && typ == protowire.BytesType:
+			v.RawReadings, n = consumePackedDoubles(b, v.RawReadings)
+		case num == fieldHeader && typ == protowire.BytesType:
+			var s string
+			s, n = protowire.ConsumeString(b)
+			v.Header = s
+		case num == fieldSequence && typ == protowire.VarintType:
+			v.Sequence, n = protowire.ConsumeVarint(b)
+		case num == fieldGeneratedAt && typ == protowire.VarintType:
+			var x uint64
+			x, n = protowire.ConsumeVarint(b)
+			v.GeneratedAtUnixMs = int64(x)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// unmarshalV1 decodes a V1Reading message into v, the way a client generated
+// from the v1 .proto would
+func unmarshalV1(b []byte, v *schemas.V1Reading) error {
+	*v = schemas.V1Reading{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if num == 1 && typ == protowire.BytesType {
+			var packed []byte
+			packed, n = protowire.ConsumeBytes(b)
+			if n >= 0 && len(packed)%4 != 0 {
+				n = -1
+			}
+			for i := 0; n >= 0 && i < len(packed); i += 4 {
+				bits, _ := protowire.ConsumeFixed32(packed[i:])
+				v.Readings = append(v.Readings, math.Float32frombits(bits))
+			}
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
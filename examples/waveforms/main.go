@@ -0,0 +1,71 @@
+// waveforms sends Frames [][]float64, one waveform captured per tick, served and
+// fetched like the other examples. examples/nestedslices covers a small ragged
+// matrix; this one serves 1000 frames of 1024 samples from internal/sim, and
+// shows a client that only needs float32 precision decoding them into
+// [][]float32, combining nesting with numeric narrowing.
+//
+// internal/sim's TestWaveformRoundTrip checks ragged, empty and nil frames come
+// back intact both ways, and its BenchmarkWaveform* time encoding and decoding
+// them.
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemerclient"
+	"github.com/bminer/schemer"
+)
+
+type waveforms struct {
+	Frames [][]float64
+}
+
+// what a client that only needs float32 precision declares
+type narrowWaveforms struct {
+	Frames [][]float32
+}
+
+// serve serves w at /get-schema/ and /get-data/
+func serve(w *waveforms) (*httptest.Server, error) {
+	writerSchema := schemer.SchemaOf(w)
+	binarySchema := writerSchema.MarshalSchemer()
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, w); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(schemerclient.SchemaPath, func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write(binarySchema)
+	})
+	mux.HandleFunc(schemerclient.DataPath, func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write(encodedData.Bytes())
+	})
+	return httptest.NewServer(mux), nil
+}
+
+func main() {
+	ts, err := serve(&waveforms{Frames: sim.New(sim.DefaultConfig, 1).Frames(1000, 1024)})
+	if err != nil {
+		log.Fatal("encode error: " + err.Error())
+	}
+	defer ts.Close()
+
+	client, err := schemerclient.New(ts.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var narrow narrowWaveforms
+	if err := client.Fetch(context.Background(), &narrow); err != nil {
+		log.Fatal(err)
+	}
+	last := narrow.Frames[len(narrow.Frames)-1]
+	fmt.Printf("decoded %d frames into [][]float32; the last has %d samples, starting %.3f, %.3f, %.3f\n",
+		len(narrow.Frames), len(last), last[0], last[1], last[2])
+}
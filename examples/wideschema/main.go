@@ -0,0 +1,189 @@
+// wideschema shows how schemer scales with the number of fields in a struct. All
+// the other examples send three or four fields; wide telemetry records have
+// hundreds, one per channel. It builds struct types with any number of float64
+// fields at run time (reflect.StructOf, so there is no generated code to keep
+// around), under two naming schemes:
+//
+//	short   F0, F1, F2, ...
+//	long    EngineCoolantTemperatureSensor0000, ...
+//
+// and prints, for each width, the size of the schema (binary, as the servers send
+// it, and JSON), how much of the binary schema is the field names, what each
+// field adds to it, the size of an encoded record, and how long encoding and
+// decoding one take.
+//
+// The field names are only in the schema, never in the data, so an encoded
+// record is the same size whatever the fields are called, and grows by the same
+// amount with every field. The schema is where the names go: the names% column
+// says how much of it they are, and comparing the short and long rows shows
+// everything else in the schema stays the same. That is a one-off cost for a
+// client that caches the schema, and a per-record one for anything that sends
+// the schema with every record (see schemerclient.FetchFramed).
+//
+//	go run ./examples/wideschema
+//	go run ./examples/wideschema -fields 10,100,1000 -iterations 1000
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bminer/schemer"
+)
+
+// a naming scheme for the fields
+type naming struct {
+	name  string
+	field func(i int) string
+}
+
+var namings = []naming{
+	{"short", func(i int) string { return "F" + strconv.Itoa(i) }},
+	{"long", func(i int) string { return fmt.Sprintf("EngineCoolantTemperatureSensor%04d", i) }},
+}
+
+// wideType returns a struct type with n float64 fields, named by nm
+func wideType(n int, nm naming) reflect.Type {
+	fields := make([]reflect.StructField, n)
+	for i := range fields {
+		fields[i] = reflect.StructField{Name: nm.field(i), Type: reflect.TypeOf(float64(0))}
+	}
+	return reflect.StructOf(fields)
+}
+
+// record returns a pointer to a t with every field set
+func record(t reflect.Type) interface{} {
+	v := reflect.New(t)
+	for i := 0; i < t.NumField(); i++ {
+		v.Elem().Field(i).SetFloat(20 + float64(i)/8)
+	}
+	return v.Interface()
+}
+
+// result is one row of the table
+type result struct {
+	fields int
+	naming string
+
+	binarySchema, jsonSchema int // sizes in bytes
+	names                    int // bytes of field names, together
+	data                     int // bytes of one encoded record
+
+	// average time per record
+	encode, decode time.Duration
+}
+
+// perField is what each field adds to the binary schema, beyond the schema of a
+// struct with no fields
+func (r result) perField(empty int) string {
+	if r.fields == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(r.binarySchema-empty)/float64(r.fields), 'f', 1, 64)
+}
+
+// emptySchemaSize is the size of the binary schema of a struct with no fields
+func emptySchemaSize() int {
+	return len(schemer.SchemaOf(reflect.New(wideType(0, namings[0])).Interface()).MarshalSchemer())
+}
+
+// measure fills in the table: one row per width and naming, each timing averaged
+// over iterations runs. Every record is checked to come back as it was sent.
+func measure(widths []int, iterations int) ([]result, error) {
+	var results []result
+	for _, n := range widths {
+		for _, nm := range namings {
+			r := result{fields: n, naming: nm.name}
+			t := wideType(n, nm)
+			for i := 0; i < n; i++ {
+				r.names += len(nm.field(i))
+			}
+
+			sent := record(t)
+			writerSchema := schemer.SchemaOf(sent)
+			binarySchema := writerSchema.MarshalSchemer()
+			jsonSchema, err := writerSchema.MarshalJSON()
+			if err != nil {
+				return nil, fmt.Errorf("%d %s fields: %w", n, nm.name, err)
+			}
+			r.binarySchema, r.jsonSchema = len(binarySchema), len(jsonSchema)
+
+			// a client starts from the schema the way it came over the wire
+			readerSchema, err := schemer.DecodeSchema(binarySchema)
+			if err != nil {
+				return nil, fmt.Errorf("%d %s fields: cannot decode schema: %w", n, nm.name, err)
+			}
+
+			var encodedData bytes.Buffer
+			start := time.Now()
+			for i := 0; i < iterations; i++ {
+				encodedData.Reset()
+				if err := writerSchema.Encode(&encodedData, sent); err != nil {
+					return nil, fmt.Errorf("%d %s fields: encode error: %w", n, nm.name, err)
+				}
+			}
+			r.encode = time.Since(start) / time.Duration(iterations)
+			r.data = encodedData.Len()
+
+			got := reflect.New(t)
+			start = time.Now()
+			for i := 0; i < iterations; i++ {
+				if err := readerSchema.Decode(bytes.NewReader(encodedData.Bytes()), got.Interface()); err != nil {
+					return nil, fmt.Errorf("%d %s fields: decode error: %w", n, nm.name, err)
+				}
+			}
+			r.decode = time.Since(start) / time.Duration(iterations)
+
+			if !reflect.DeepEqual(got.Interface(), sent) {
+				return nil, fmt.Errorf("%d %s fields: the record didn't come back as it was sent", n, nm.name)
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func printTable(results []result) {
+	empty := emptySchemaSize()
+	fmt.Printf("%6s %-6s %8s %8s %8s %6s %9s %8s %12s %12s\n",
+		"fields", "names", "schema", "json", "names", "names%", "per field", "record", "encode", "decode")
+	for _, r := range results {
+		share := "-"
+		if r.binarySchema > 0 {
+			share = strconv.Itoa(100*r.names/r.binarySchema) + "%"
+		}
+		fmt.Printf("%6d %-6s %8d %8d %8d %6s %9s %8d %12v %12v\n",
+			r.fields, r.naming, r.binarySchema, r.jsonSchema, r.names, share, r.perField(empty), r.data, r.encode, r.decode)
+	}
+	fmt.Printf("\nschema sizes are in bytes; a struct with no fields has a %d-byte schema\n", empty)
+}
+
+func main() {
+	widths := flag.String("fields", "1,10,100,500,1000", "comma-separated numbers of fields to measure")
+	iterations := flag.Int("iterations", 200, "runs each timing is averaged over")
+	flag.Parse()
+
+	var fieldCounts []int
+	for _, s := range strings.Split(*widths, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			log.Fatalf("invalid number of fields %q", s)
+		}
+		fieldCounts = append(fieldCounts, n)
+	}
+	if *iterations < 1 {
+		log.Fatal("-iterations must be at least 1")
+	}
+
+	results, err := measure(fieldCounts, *iterations)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printTable(results)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// consistent checks what must hold for any table measure returns
+func consistent(results []result) error {
+	byNaming := map[string][]result{}
+	for _, r := range results {
+		byNaming[r.naming] = append(byNaming[r.naming], r)
+	}
+
+	// more fields always make a bigger schema, and a bigger record
+	for name, rows := range byNaming {
+		for i := 1; i < len(rows); i++ {
+			a, b := rows[i-1], rows[i]
+			if b.fields > a.fields && (b.binarySchema <= a.binarySchema || b.data <= a.data) {
+				return fmt.Errorf("%s names: %d fields take %d schema and %d record bytes, %d fields %d and %d",
+					name, b.fields, b.binarySchema, b.data, a.fields, a.binarySchema, a.data)
+			}
+		}
+	}
+
+	// short names against long, row by row: the names only change the schema,
+	// and only by the bytes of the names themselves
+	for i, s := range byNaming["short"] {
+		l := byNaming["long"][i]
+		if s.data != l.data {
+			return fmt.Errorf("%d fields: a record is %d bytes with short names, %d with long ones", s.fields, s.data, l.data)
+		}
+		if s.binarySchema-s.names != l.binarySchema-l.names {
+			return fmt.Errorf("%d fields: without the names, the schema is %d bytes with short names, %d with long ones",
+				s.fields, s.binarySchema-s.names, l.binarySchema-l.names)
+		}
+	}
+	return nil
+}
+
+// TestConsistent measures a small table, which checks every record comes back
+// as it was sent, and checks the table is consistent
+func TestConsistent(t *testing.T) {
+	results, err := measure([]int{0, 1, 10, 100, 300}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := consistent(results); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/BenjaminPritchard/SchemerExamples
+
+go 1.16
+
+require (
+	github.com/bminer/schemer v0.0.0-20210611192654-982f4821acdc
+	github.com/gorilla/websocket v1.4.2
+	github.com/vmihailenco/msgpack/v5 v5.3.4
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,106 @@
+// Package broker fans encoded payloads out from one publisher to any number of
+// subscribers. Every subscriber gets its own bounded channel; when a subscriber
+// falls behind and its channel is full, the oldest payload waiting in it is
+// dropped to make room, so a slow subscriber never holds up the publisher or the
+// other subscribers.
+package broker
+
+import (
+	"sync"
+)
+
+// DefaultBufferSize is how many payloads a subscriber's channel holds when New is
+// given a size of zero or less
+const DefaultBufferSize = 16
+
+type subscriber struct {
+	ch      chan []byte
+	dropped uint64
+}
+
+// Broker is safe for concurrent use
+type Broker struct {
+	mu         sync.Mutex
+	bufferSize int
+	subs       map[<-chan []byte]*subscriber
+}
+
+// New returns a Broker whose subscribers each buffer up to bufferSize payloads
+func New(bufferSize int) *Broker {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Broker{
+		bufferSize: bufferSize,
+		subs:       make(map[<-chan []byte]*subscriber),
+	}
+}
+
+// Subscribe returns a channel receiving every payload published from now on, and
+// a function that unsubscribes and closes the channel. Calling cancel more than
+// once is harmless.
+func (b *Broker) Subscribe() (<-chan []byte, func()) {
+	s := &subscriber{ch: make(chan []byte, b.bufferSize)}
+
+	b.mu.Lock()
+	b.subs[s.ch] = s
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, s.ch)
+			close(s.ch)
+			b.mu.Unlock()
+		})
+	}
+	return s.ch, cancel
+}
+
+// Publish sends payload to every subscriber without blocking. Subscribers must
+// treat payload as read-only, since they all share it.
+func (b *Broker) Publish(payload []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, s := range b.subs {
+		select {
+		case s.ch <- payload:
+			continue
+		default:
+		}
+
+		// full: make room by dropping the oldest payload. The subscriber may have
+		// emptied the channel in the meantime, so neither step may block.
+		select {
+		case <-s.ch:
+			s.dropped++
+		default:
+		}
+		select {
+		case s.ch <- payload:
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// Dropped returns how many payloads have been dropped for the subscriber reading
+// from ch, or 0 if ch isn't subscribed
+func (b *Broker) Dropped(ch <-chan []byte) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s, ok := b.subs[ch]; ok {
+		return s.dropped
+	}
+	return 0
+}
+
+// Subscribers returns the number of current subscribers
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
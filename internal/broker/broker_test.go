@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestFanOut publishes 10 payloads to three subscribers that keep up, each of
+// which must receive all of them in order
+func TestFanOut(t *testing.T) {
+	b := New(16)
+
+	var chans []<-chan []byte
+	for i := 0; i < 3; i++ {
+		ch, cancel := b.Subscribe()
+		defer cancel()
+		chans = append(chans, ch)
+	}
+
+	for i := 0; i < 10; i++ {
+		b.Publish([]byte{byte(i)})
+	}
+
+	for s, ch := range chans {
+		for i := 0; i < 10; i++ {
+			if got := <-ch; got[0] != byte(i) {
+				t.Fatalf("subscriber %d got payload %d, want %d", s, got[0], i)
+			}
+		}
+		if dropped := b.Dropped(ch); dropped != 0 {
+			t.Fatalf("subscriber %d dropped %d payloads", s, dropped)
+		}
+	}
+}
+
+// TestSlowSubscriber publishes 10 payloads while one subscriber doesn't read at
+// all. The publisher must not block, the slow subscriber must be left with the
+// newest payloads and count the rest as dropped, and a subscriber that keeps up
+// must be unaffected.
+func TestSlowSubscriber(t *testing.T) {
+	const bufferSize = 4
+	b := New(bufferSize)
+
+	slow, cancelSlow := b.Subscribe()
+	defer cancelSlow()
+	fast, cancelFast := b.Subscribe()
+	defer cancelFast()
+
+	// the fast subscriber reads each payload as soon as it's published
+	result := make(chan error, 1)
+	go func() {
+		for i := 0; i < 10; i++ {
+			b.Publish([]byte{byte(i)})
+			if got := <-fast; got[0] != byte(i) {
+				result <- fmt.Errorf("fast subscriber got payload %d, want %d", got[0], i)
+				return
+			}
+		}
+		result <- nil
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publisher blocked on a slow subscriber")
+	}
+
+	if dropped := b.Dropped(slow); dropped != 10-bufferSize {
+		t.Fatalf("slow subscriber dropped %d payloads, want %d", dropped, 10-bufferSize)
+	}
+	for i := 10 - bufferSize; i < 10; i++ {
+		if got := <-slow; got[0] != byte(i) {
+			t.Fatalf("slow subscriber got payload %d, want %d", got[0], i)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Package bufpool keeps bytes.Buffers for reuse across requests, so a busy
+// handler doesn't allocate a new buffer (and grow it to the size of a payload)
+// for every payload it encodes, only for the garbage collector to reclaim it
+// once the response is written.
+package bufpool
+
+import (
+	"bytes"
+	"sync"
+)
+
+// MaxKept is the largest buffer Put keeps. A bigger one is left to the garbage
+// collector, so a single huge payload doesn't keep its memory tied up in the
+// pool for the life of the process.
+const MaxKept = 1 << 20
+
+var pool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// Get returns an empty buffer, from the pool if there is one there
+func Get() *bytes.Buffer {
+	b := pool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+// Put returns b to the pool. Neither b nor anything b.Bytes() returned may be
+// used afterwards, since the next Get may hand it to someone else.
+func Put(b *bytes.Buffer) {
+	if b.Cap() > MaxKept {
+		return
+	}
+	pool.Put(b)
+}
@@ -0,0 +1,152 @@
+package bufpool
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+var writerSchema = schemas.V2WriterSchema()
+
+// unpooled is the v2 server's encode path before it used the pool: a new buffer
+// every request
+func unpooled(w io.Writer, sample *schemas.V2Reading) error {
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, sample); err != nil {
+		return err
+	}
+	_, err := w.Write(encodedData.Bytes())
+	return err
+}
+
+// pooled is the v2 server's encode path now
+func pooled(w io.Writer, sample *schemas.V2Reading) error {
+	encodedData := Get()
+	defer Put(encodedData)
+	if err := writerSchema.Encode(encodedData, sample); err != nil {
+		return err
+	}
+	_, err := w.Write(encodedData.Bytes())
+	return err
+}
+
+// TestPooledSame checks the pooled path writes what a fresh buffer does, for
+// samples of different sizes in turn, so a reused buffer that wasn't reset
+// would show
+func TestPooledSame(t *testing.T) {
+	gen := sim.New(sim.DefaultConfig, 1)
+	for i, n := range []int{100, 3, 0, 50, 1} {
+		sample := &schemas.V2Reading{Header: "sample", RawReadings: gen.Next(n), FilteredReadings: gen.Next(n), Sequence: uint64(i)}
+		var want, got bytes.Buffer
+		if err := unpooled(&want, sample); err != nil {
+			t.Fatal(err)
+		}
+		if err := pooled(&got, sample); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Bytes(), got.Bytes()) {
+			t.Errorf("request %d (%d readings): pooled wrote %d bytes, unpooled %d", i, n, got.Len(), want.Len())
+		}
+	}
+}
+
+func TestPutTooBig(t *testing.T) {
+	b := Get()
+	b.Grow(MaxKept + 1)
+	Put(b)
+	for i := 0; i < 10; i++ {
+		if got := Get(); got == b {
+			t.Fatal("Get handed out a buffer bigger than MaxKept")
+		}
+	}
+}
+
+// benchSample is a sample the size the v2 server sends
+func benchSample() *schemas.V2Reading {
+	gen := sim.New(sim.DefaultConfig, 1)
+	return &schemas.V2Reading{
+		Header:           "Four score and seven years ago",
+		RawReadings:      gen.Next(100),
+		FilteredReadings: gen.Next(100),
+	}
+}
+
+// runParallel runs request on GOMAXPROCS goroutines at once, as under load,
+// reporting allocations and the garbage collections per 10000 requests: the GC
+// pressure the pool takes off
+func runParallel(b *testing.B, request func() error) {
+	b.ReportAllocs()
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := request(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N)*10000, "GCs/10k")
+}
+
+func BenchmarkEncodeUnpooled(b *testing.B) {
+	sample := benchSample()
+	runParallel(b, func() error { return unpooled(ioutil.Discard, sample) })
+}
+
+func BenchmarkEncodePooled(b *testing.B) {
+	sample := benchSample()
+	runParallel(b, func() error { return pooled(ioutil.Discard, sample) })
+}
+
+// benchmarkDecode decodes a sample from a body the way a client does, with
+// decode reading the whole body into memory first
+func benchmarkDecode(b *testing.B, decode func(readerSchema schemer.Schema, body io.Reader, dest interface{}) error) {
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, benchSample()); err != nil {
+		b.Fatal(err)
+	}
+	payload := encodedData.Bytes()
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(payload)))
+	runParallel(b, func() error {
+		var dest schemas.V2Reading
+		return decode(readerSchema, bytes.NewReader(payload), &dest)
+	})
+}
+
+// BenchmarkDecodeUnpooled reads the body with ioutil.ReadAll, as the example
+// clients do, before decoding it
+func BenchmarkDecodeUnpooled(b *testing.B) {
+	benchmarkDecode(b, func(readerSchema schemer.Schema, body io.Reader, dest interface{}) error {
+		payload, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		return readerSchema.Decode(bytes.NewReader(payload), dest)
+	})
+}
+
+// BenchmarkDecodePooled reads the body into a buffer from the pool instead
+func BenchmarkDecodePooled(b *testing.B) {
+	benchmarkDecode(b, func(readerSchema schemer.Schema, body io.Reader, dest interface{}) error {
+		buf := Get()
+		defer Put(buf)
+		if _, err := buf.ReadFrom(body); err != nil {
+			return err
+		}
+		return readerSchema.Decode(buf, dest)
+	})
+}
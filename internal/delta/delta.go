@@ -0,0 +1,270 @@
+// Package delta avoids re-sending a large sensor array on every update. The
+// server keeps a History, a ring buffer of recent snapshots, and answers
+// DeltaPath?since=SEQ with just the readings that changed since SEQ. If SEQ has
+// already fallen out of the ring buffer, it answers 409 Conflict, and a Follower
+// starts over from a full snapshot at SnapshotPath.
+//
+// Snapshots and deltas are different structs, so each has its own schema, at
+// SnapshotSchemaPath and DeltaSchemaPath.
+package delta
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/bminer/schemer"
+)
+
+const (
+	SnapshotSchemaPath = "/get-snapshot-schema/"
+	DeltaSchemaPath    = "/get-delta-schema/"
+	SnapshotPath       = "/get-snapshot/"
+	DeltaPath          = "/get-delta/"
+)
+
+// Snapshot is the full state of the sensor array
+type Snapshot struct {
+	Sequence uint64
+	Values   []float64
+}
+
+// clone returns a copy of s that doesn't share its Values
+func (s Snapshot) clone() Snapshot {
+	values := make([]float64, len(s.Values))
+	copy(values, s.Values)
+	return Snapshot{Sequence: s.Sequence, Values: values}
+}
+
+// Delta turns the snapshot at BaseSequence into the one at Sequence
+type Delta struct {
+	BaseSequence   uint64
+	Sequence       uint64
+	ChangedIndexes []uint32
+	ChangedValues  []float64
+}
+
+// History owns the sensor array and the snapshots it went through recently. It
+// is safe for concurrent use.
+type History struct {
+	mu      sync.Mutex
+	current Snapshot
+	ring    []Snapshot // indexed by Sequence % len(ring)
+}
+
+// NewHistory starts a History at sequence 0 with values, keeping the last size
+// snapshots
+func NewHistory(size int, values []float64) *History {
+	h := &History{
+		current: Snapshot{Values: values},
+		ring:    make([]Snapshot, size),
+	}
+	h.remember()
+	return h
+}
+
+// remember copies the current snapshot into the ring buffer
+func (h *History) remember() {
+	h.ring[h.current.Sequence%uint64(len(h.ring))] = h.current.clone()
+}
+
+// Update lets change modify the readings in place, and moves on to the next
+// sequence
+func (h *History) Update(change func(values []float64)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	change(h.current.Values)
+	h.current.Sequence++
+	h.remember()
+}
+
+// Snapshot returns a copy of the current state
+func (h *History) Snapshot() Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.current.clone()
+}
+
+// Since returns the delta from since to the current snapshot, or false if since
+// is no longer in the ring buffer (or hasn't happened yet)
+func (h *History) Since(since uint64) (Delta, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	base := h.ring[since%uint64(len(h.ring))]
+	if since > h.current.Sequence || base.Sequence != since || base.Values == nil {
+		return Delta{}, false
+	}
+
+	d := Delta{BaseSequence: since, Sequence: h.current.Sequence}
+	for i, v := range h.current.Values {
+		if v != base.Values[i] {
+			d.ChangedIndexes = append(d.ChangedIndexes, uint32(i))
+			d.ChangedValues = append(d.ChangedValues, v)
+		}
+	}
+	return d, true
+}
+
+// writeEncoded encodes v with its own schema and writes it to w
+func writeEncoded(w http.ResponseWriter, v interface{}) {
+	var buf bytes.Buffer
+	if err := schemer.SchemaOf(v).Encode(&buf, v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(buf.Bytes())
+}
+
+// Handler serves h's schemas, snapshots and deltas
+func (h *History) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(SnapshotSchemaPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(schemer.SchemaOf(&Snapshot{}).MarshalSchemer())
+	})
+	mux.HandleFunc(DeltaSchemaPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(schemer.SchemaOf(&Delta{}).MarshalSchemer())
+	})
+	mux.HandleFunc(SnapshotPath, func(w http.ResponseWriter, req *http.Request) {
+		current := h.Snapshot()
+		writeEncoded(w, &current)
+	})
+	mux.HandleFunc(DeltaPath, func(w http.ResponseWriter, req *http.Request) {
+		since, err := strconv.ParseUint(req.URL.Query().Get("since"), 10, 64)
+		if err != nil {
+			http.Error(w, "since must be a sequence number", http.StatusBadRequest)
+			return
+		}
+		d, ok := h.Since(since)
+		if !ok {
+			http.Error(w, "sequence no longer available, fetch a full snapshot", http.StatusConflict)
+			return
+		}
+		writeEncoded(w, &d)
+	})
+
+	return mux
+}
+
+// Follower keeps a copy of a server's sensor array up to date using deltas
+type Follower struct {
+	baseURL        string
+	snapshotSchema schemer.Schema
+	deltaSchema    schemer.Schema
+	state          Snapshot
+
+	// Bytes counts the bytes received in deltas, and in snapshots when
+	// resyncing
+	Bytes int
+	// Resyncs counts the times the server no longer had the Follower's sequence
+	Resyncs int
+}
+
+// get fetches url and returns the body and the status code, with an error for
+// anything but 200
+func get(url string) ([]byte, int, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return body, resp.StatusCode, nil
+}
+
+// Follow fetches the schemas and a first snapshot from the server at baseURL
+func Follow(baseURL string) (*Follower, error) {
+	f := &Follower{baseURL: baseURL}
+	var err error
+	if f.snapshotSchema, err = f.fetchSchema(SnapshotSchemaPath); err != nil {
+		return nil, err
+	}
+	if f.deltaSchema, err = f.fetchSchema(DeltaSchemaPath); err != nil {
+		return nil, err
+	}
+	if f.state, _, err = f.fetchSnapshot(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Follower) fetchSchema(path string) (schemer.Schema, error) {
+	b, _, err := get(f.baseURL + path)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := schemer.DecodeSchema(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode schema: %w", err)
+	}
+	return schema, nil
+}
+
+// fetchSnapshot fetches the full state, returning it and its encoded size
+func (f *Follower) fetchSnapshot() (Snapshot, int, error) {
+	b, _, err := get(f.baseURL + SnapshotPath)
+	if err != nil {
+		return Snapshot{}, 0, err
+	}
+	var s Snapshot
+	if err := f.snapshotSchema.Decode(bytes.NewReader(b), &s); err != nil {
+		return Snapshot{}, 0, fmt.Errorf("decode error: %w", err)
+	}
+	return s, len(b), nil
+}
+
+// State returns the Follower's copy of the sensor array. It is only valid until
+// the next Update.
+func (f *Follower) State() Snapshot {
+	return f.state
+}
+
+// Update brings the Follower up to date, using a delta if the server still has
+// its sequence and a full snapshot if it doesn't
+func (f *Follower) Update() error {
+	b, status, err := get(f.baseURL + DeltaPath + "?since=" + strconv.FormatUint(f.state.Sequence, 10))
+	if status == http.StatusConflict {
+		state, size, err := f.fetchSnapshot()
+		if err != nil {
+			return err
+		}
+		f.state = state
+		f.Bytes += size
+		f.Resyncs++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var d Delta
+	if err := f.deltaSchema.Decode(bytes.NewReader(b), &d); err != nil {
+		return fmt.Errorf("decode error: %w", err)
+	}
+	if d.BaseSequence != f.state.Sequence || len(d.ChangedIndexes) != len(d.ChangedValues) {
+		return fmt.Errorf("malformed delta: %+v", d)
+	}
+	for _, idx := range d.ChangedIndexes {
+		if int(idx) >= len(f.state.Values) {
+			return fmt.Errorf("delta changes reading %d of %d", idx, len(f.state.Values))
+		}
+	}
+	for i, idx := range d.ChangedIndexes {
+		f.state.Values[idx] = d.ChangedValues[i]
+	}
+	f.state.Sequence = d.Sequence
+	f.Bytes += len(b)
+	return nil
+}
@@ -0,0 +1,126 @@
+package delta_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/delta"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+)
+
+const (
+	historySize = 8
+	numReadings = 100
+)
+
+// change returns an update that sets a few readings, different ones for each n
+func change(n int) func(values []float64) {
+	return func(values []float64) {
+		for i := 0; i < 3; i++ {
+			values[(n*7+i*13)%len(values)] = float64(n) + float64(i)/10
+		}
+	}
+}
+
+// follow starts a Follower on upstream, failing the test if it can't
+func follow(t *testing.T, upstream *testserver.Deltas) *delta.Follower {
+	t.Helper()
+	f, err := delta.Follow(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// expectState fails the test unless f's state is the server's
+func expectState(t *testing.T, f *delta.Follower, upstream *testserver.Deltas) {
+	t.Helper()
+	want := upstream.Snapshot()
+	if got := f.State(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("the follower is at sequence %d, the server at %d, and their readings differ", got.Sequence, want.Sequence)
+	}
+}
+
+// TestFollow checks a Follower that keeps up stays in step using deltas alone
+func TestFollow(t *testing.T) {
+	upstream := testserver.NewDeltas(t, historySize, numReadings)
+	f := follow(t, upstream)
+
+	for n := 1; n <= 3*historySize; n++ {
+		upstream.Update(change(n))
+		if n%3 == 0 {
+			// two updates behind is still well inside the history
+			upstream.Update(change(1000 + n))
+		}
+		if err := f.Update(); err != nil {
+			t.Fatalf("update %d: %v", n, err)
+		}
+		expectState(t, f, upstream)
+	}
+
+	if f.Resyncs != 0 {
+		t.Errorf("%d resyncs while keeping up", f.Resyncs)
+	}
+	if snapshots, deltas := upstream.Requests(); snapshots != 1 || deltas != 3*historySize {
+		t.Errorf("%d snapshot and %d delta requests, want only the first snapshot and one delta per update", snapshots, deltas)
+	}
+}
+
+// TestResync lets the server move on past its history while the Follower isn't
+// looking: the next Update has to get a 409 and start over from a full snapshot,
+// after which deltas work again
+func TestResync(t *testing.T) {
+	upstream := testserver.NewDeltas(t, historySize, numReadings)
+	f := follow(t, upstream)
+
+	upstream.Update(change(1))
+	if err := f.Update(); err != nil {
+		t.Fatal(err)
+	}
+	for n := 2; n <= 2+historySize; n++ {
+		upstream.Update(change(n))
+	}
+
+	if err := f.Update(); err != nil {
+		t.Fatalf("resyncing: %v", err)
+	}
+	if f.Resyncs != 1 {
+		t.Errorf("%d resyncs, want 1", f.Resyncs)
+	}
+	expectState(t, f, upstream)
+	if snapshots, _ := upstream.Requests(); snapshots != 2 {
+		t.Errorf("%d snapshot requests, want the first one and one to resync", snapshots)
+	}
+
+	upstream.Update(change(100))
+	if err := f.Update(); err != nil {
+		t.Fatal(err)
+	}
+	expectState(t, f, upstream)
+	if f.Resyncs != 1 {
+		t.Errorf("resynced again after catching up")
+	}
+}
+
+// TestSince checks which sequences History can make a delta from: the ones
+// still in its ring buffer, and not ones it has forgotten or not reached yet
+func TestSince(t *testing.T) {
+	h := delta.NewHistory(historySize, make([]float64, numReadings))
+	for n := 1; n <= 20; n++ {
+		h.Update(change(n))
+	}
+
+	for since := uint64(0); since <= 25; since++ {
+		d, ok := h.Since(since)
+		if want := since > 20-historySize && since <= 20; ok != want {
+			t.Errorf("since %d: ok is %t", since, ok)
+			continue
+		}
+		if ok && (d.BaseSequence != since || d.Sequence != 20) {
+			t.Errorf("since %d: delta from %d to %d", since, d.BaseSequence, d.Sequence)
+		}
+	}
+	if d, _ := h.Since(20); len(d.ChangedIndexes) != 0 {
+		t.Errorf("a delta from the current sequence changes %d readings", len(d.ChangedIndexes))
+	}
+}
@@ -0,0 +1,18 @@
+// Package dryrun checks that a value can be encoded with a schema without
+// producing any output. A handler that builds a payload from a request can
+// check it up front, and answer 400 before it has stored anything or written a
+// single byte of a 200 response it would then have no way to take back.
+package dryrun
+
+import (
+	"io"
+
+	"github.com/bminer/schemer"
+)
+
+// Encode encodes v with schema into io.Discard and returns the error Encode
+// would have, if any. It costs as much CPU as the real encode, but allocates no
+// buffer for the output.
+func Encode(schema schemer.Schema, v interface{}) error {
+	return schema.Encode(io.Discard, v)
+}
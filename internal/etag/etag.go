@@ -0,0 +1,43 @@
+// Package etag implements just enough of HTTP conditional requests for the
+// schema endpoints: an ETag derived from the response bytes, and a check of the
+// client's If-None-Match against it.
+package etag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Of returns a strong ETag for b, quoted as it goes in the ETag header
+func Of(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Matches reports whether req's If-None-Match header lists etag (or is "*"), in
+// which case the client already has the current response and should get a 304
+func Matches(req *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(req.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Serve writes body with its ETag, or just a 304 Not Modified if the client
+// already has it. It reports whether the body was sent.
+func Serve(w http.ResponseWriter, req *http.Request, body []byte) (bool, error) {
+	tag := Of(body)
+	w.Header().Set("ETag", tag)
+
+	if Matches(req, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return false, nil
+	}
+	_, err := w.Write(body)
+	return true, err
+}
@@ -0,0 +1,145 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// decodedSamples encodes a few samples with the v2 writer schema and decodes
+// them again, the way the v2 server's history holds what went out on the wire
+func decodedSamples(t *testing.T) []interface{} {
+	t.Helper()
+	writerSchema := schemas.V2WriterSchema()
+	var samples []interface{}
+	for i, s := range []schemas.V2Reading{
+		{Header: "boiler room", RawReadings: []float64{20.5, 21.3, 0.1}, FilteredReadings: []float64{20.5, 20.9, 1.0 / 3}, Sequence: 1, GeneratedAtUnixMs: 1600000000000},
+		{Header: "a header, with \"quotes\"", RawReadings: []float64{-1e-300}, FilteredReadings: []float64{-1e-300}, Sequence: 2},
+		{Header: "no readings", Sequence: 3},
+	} {
+		var payload bytes.Buffer
+		if err := writerSchema.Encode(&payload, &s); err != nil {
+			t.Fatalf("sample %d: encode error: %v", i, err)
+		}
+		var decoded schemas.V2Reading
+		if err := writerSchema.Decode(&payload, &decoded); err != nil {
+			t.Fatalf("sample %d: decode error: %v", i, err)
+		}
+		samples = append(samples, &decoded)
+	}
+	return samples
+}
+
+// wantRows flattens the decoded samples by hand: one row per reading, at least
+// one per sample
+func wantRows(samples []interface{}) [][]string {
+	var rows [][]string
+	for _, v := range samples {
+		s := v.(*schemas.V2Reading)
+		n := len(s.RawReadings)
+		if len(s.FilteredReadings) > n {
+			n = len(s.FilteredReadings)
+		}
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			raw, filtered := "", ""
+			if i < len(s.RawReadings) {
+				raw = strconv.FormatFloat(s.RawReadings[i], 'g', -1, 64)
+			}
+			if i < len(s.FilteredReadings) {
+				filtered = strconv.FormatFloat(s.FilteredReadings[i], 'g', -1, 64)
+			}
+			rows = append(rows, []string{
+				strconv.Itoa(i), s.Header, raw, filtered,
+				strconv.FormatUint(s.Sequence, 10), strconv.FormatInt(s.GeneratedAtUnixMs, 10),
+			})
+		}
+	}
+	return rows
+}
+
+// TestExportMatchesPayload exports decoded payloads as CSV and JSON, and checks
+// every cell against the decoded value it came from
+func TestExportMatchesPayload(t *testing.T) {
+	samples := decodedSamples(t)
+	table, err := Flatten(samples...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantColumns := []string{IndexColumn, "Header", "RawReadings", "FilteredReadings", "Sequence", "GeneratedAtUnixMs"}
+	want := wantRows(samples)
+
+	t.Run("csv", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := WriteCSV(&out, table); err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(&out).ReadAll()
+		if err != nil {
+			t.Fatalf("the export doesn't read back as CSV: %v", err)
+		}
+		if len(records) != len(want)+1 {
+			t.Fatalf("%d records, want a header and %d rows", len(records), len(want))
+		}
+		if got := records[0]; !equalStrings(got, wantColumns) {
+			t.Errorf("header %q, want %q", got, wantColumns)
+		}
+		for i, row := range want {
+			if got := records[i+1]; !equalStrings(got, row) {
+				t.Errorf("row %d: %q, want %q", i, got, row)
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := WriteJSON(&out, table); err != nil {
+			t.Fatal(err)
+		}
+		// numbers as they were written, so a big int64 isn't rounded to a float64
+		dec := json.NewDecoder(&out)
+		dec.UseNumber()
+		var objects []map[string]interface{}
+		if err := dec.Decode(&objects); err != nil {
+			t.Fatalf("the export doesn't read back as JSON: %v", err)
+		}
+		if len(objects) != len(want) {
+			t.Fatalf("%d objects, want %d", len(objects), len(want))
+		}
+		for i, row := range want {
+			for j, column := range wantColumns {
+				got := ""
+				switch v := objects[i][column].(type) {
+				case nil:
+				case string:
+					got = v
+				case json.Number:
+					got = v.String()
+				default:
+					t.Fatalf("row %d: %s is a %T", i, column, v)
+				}
+				if got != row[j] {
+					t.Errorf("row %d: %s is %q, want %q", i, column, got, row[j])
+				}
+			}
+		}
+	})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
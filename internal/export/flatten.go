@@ -0,0 +1,197 @@
+// Package export turns the example structs into rows for spreadsheets and
+// dashboards, which can't read schemer's binary format. Every struct becomes one
+// row per index of its slices: a V2Reading with 5 readings becomes 5 rows, each
+// holding the Header and Sequence along with one raw and one filtered reading.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// IndexColumn is the first column of every Table: the row's index into the
+// slices of the struct it came from
+const IndexColumn = "index"
+
+// Table is one or more structs of the same type, flattened into rows
+type Table struct {
+	Columns []string
+	Rows    [][]interface{} // nil is an empty cell
+}
+
+// cell is the value of one column for one struct: either the same for every row
+// (fixed) or one value per row
+type cell struct {
+	name   string
+	values []interface{}
+	fixed  bool
+}
+
+// Flatten turns values, which must all be structs (or pointers to structs) of the
+// same type, into a Table. Columns are named after the fields, with nested
+// structs' fields joined by dots (e.g. "Location.Lat"):
+//
+//   - numbers, strings, bools and []byte give one column, repeated on every row
+//   - slices and arrays of those give one column, one element per row
+//   - slices and arrays of structs give a column per field, one element per row
+//   - anything deeper (maps, slices of slices, ...) is written out as JSON
+//
+// A struct's rows run to its longest slice, and at least one row is produced even
+// if every slice is empty. Shorter slices leave their cells empty.
+func Flatten(values ...interface{}) (*Table, error) {
+	t := &Table{}
+	var typ reflect.Type
+
+	for i, v := range values {
+		rv := reflect.Indirect(reflect.ValueOf(v))
+		if rv.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("export: value %d is a %s, not a struct", i, rv.Kind())
+		}
+		if typ == nil {
+			typ = rv.Type()
+		} else if rv.Type() != typ {
+			return nil, fmt.Errorf("export: value %d is a %s, not a %s", i, rv.Type(), typ)
+		}
+
+		var cells []cell
+		if err := walk(rv, "", &cells); err != nil {
+			return nil, err
+		}
+
+		if t.Columns == nil {
+			t.Columns = []string{IndexColumn}
+			for _, c := range cells {
+				t.Columns = append(t.Columns, c.name)
+			}
+		}
+
+		n := 1
+		for _, c := range cells {
+			if !c.fixed && len(c.values) > n {
+				n = len(c.values)
+			}
+		}
+		for r := 0; r < n; r++ {
+			row := []interface{}{r}
+			for _, c := range cells {
+				switch {
+				case c.fixed:
+					row = append(row, c.values[0])
+				case r < len(c.values):
+					row = append(row, c.values[r])
+				default:
+					row = append(row, nil)
+				}
+			}
+			t.Rows = append(t.Rows, row)
+		}
+	}
+	return t, nil
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8 // []byte
+	}
+	return false
+}
+
+// asJSON is the fallback for values that don't fit in a single cell
+func asJSON(v reflect.Value) (interface{}, error) {
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// walk appends the cells of v, named with prefix, to cells
+func walk(v reflect.Value, prefix string, cells *[]cell) error {
+	t := v.Type()
+
+	switch {
+	case t.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			v = reflect.Zero(t.Elem())
+		} else {
+			v = v.Elem()
+		}
+		return walk(v, prefix, cells)
+
+	case isScalar(t):
+		*cells = append(*cells, cell{name: prefix, values: []interface{}{v.Interface()}, fixed: true})
+
+	case t.Kind() == reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue // unexported
+			}
+			if err := walk(v.Field(i), join(prefix, t.Field(i).Name), cells); err != nil {
+				return err
+			}
+		}
+
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && isScalar(t.Elem()):
+		c := cell{name: prefix}
+		for i := 0; i < v.Len(); i++ {
+			c.values = append(c.values, v.Index(i).Interface())
+		}
+		*cells = append(*cells, c)
+
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Struct:
+		// one column per field of the element struct, one element per row. The
+		// columns come from the zero value, so an empty slice still has them.
+		var columns []cell
+		if err := walk(reflect.Zero(t.Elem()), prefix, &columns); err != nil {
+			return err
+		}
+		for i := range columns {
+			columns[i].values = nil
+			columns[i].fixed = false
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			var elem []cell
+			if err := walk(v.Index(i), prefix, &elem); err != nil {
+				return err
+			}
+			for j, c := range elem {
+				value := interface{}(nil)
+				if c.fixed {
+					value = c.values[0]
+				} else {
+					// a slice inside a slice element has no row of its own
+					b, err := json.Marshal(c.values)
+					if err != nil {
+						return err
+					}
+					value = string(b)
+				}
+				columns[j].values = append(columns[j].values, value)
+			}
+		}
+		*cells = append(*cells, columns...)
+
+	default:
+		value, err := asJSON(v)
+		if err != nil {
+			return err
+		}
+		*cells = append(*cells, cell{name: prefix, values: []interface{}{value}, fixed: true})
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// formatCell renders one cell for CSV. Floats use the shortest representation
+// that reads back as the same value.
+func formatCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// WriteCSV writes t as CSV, with the column names as the header row
+func WriteCSV(w io.Writer, t *Table) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.Columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(t.Columns))
+	for _, row := range t.Rows {
+		for i, v := range row {
+			record[i] = formatCell(v)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes t as a JSON array with one object per row. The keys of each
+// object are in column order, which encoding/json wouldn't keep for a map.
+func WriteJSON(w io.Writer, t *Table) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+
+	for r, row := range t.Rows {
+		if r > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n  {")
+		for i, v := range row {
+			if i > 0 {
+				bw.WriteString(", ")
+			}
+			key, err := json.Marshal(t.Columns[i])
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			bw.Write(key)
+			bw.WriteString(": ")
+			bw.Write(value)
+		}
+		bw.WriteString("}")
+	}
+
+	if len(t.Rows) > 0 {
+		bw.WriteString("\n")
+	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
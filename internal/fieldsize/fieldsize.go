@@ -0,0 +1,57 @@
+// Package fieldsize breaks the size of an encoded struct down by field, to show
+// where a payload's bytes go: for a V2Reading, how much is the Header and how
+// much the two slices of readings.
+//
+// schemer writes the fields of a struct back to back, with no per-field tags or
+// padding, so the encoding of a struct is the encodings of its fields one after
+// the other. Encoding each field on its own therefore gives its share of the
+// whole, and the shares add up to the size of the whole.
+package fieldsize
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/bminer/schemer"
+)
+
+// Field is one top-level field's share of an encoded struct
+type Field struct {
+	Name  string // the Go name of the field
+	Tag   string // its schemer tag, if it has one
+	Bytes int    // how many bytes its value takes in the encoding
+}
+
+// Sizes encodes v with schema and returns the size of the result along with what
+// each exported top-level field of v contributed to it, in struct order. v must
+// be a struct or a pointer to one.
+//
+// Anything in total that isn't in one of the fields is overhead of the encoding
+// itself; with schemer's struct layout there isn't any.
+func Sizes(schema schemer.Schema, v interface{}) (fields []Field, total int, err error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, 0, fmt.Errorf("fieldsize: %T is not a struct", v)
+	}
+
+	var whole bytes.Buffer
+	if err := schema.Encode(&whole, v); err != nil {
+		return nil, 0, err
+	}
+
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if f.PkgPath != "" {
+			// schemer skips unexported fields, so they take no space
+			continue
+		}
+		var buf bytes.Buffer
+		fv := rv.Field(i).Interface()
+		if err := schemer.SchemaOf(fv).Encode(&buf, fv); err != nil {
+			return nil, 0, fmt.Errorf("fieldsize: %s: %w", f.Name, err)
+		}
+		fields = append(fields, Field{Name: f.Name, Tag: f.Tag.Get("schemer"), Bytes: buf.Len()})
+	}
+	return fields, whole.Len(), nil
+}
@@ -0,0 +1,77 @@
+// Package frame reads and writes length-prefixed records: a 4-byte big-endian
+// length, then that many bytes, usually a schemer payload. It is how a stream
+// that carries more than one payload (the pubsub example's log file, the schema
+// at the start of a /get-bundle/ response) tells where one ends and the next
+// begins. A /get-framed/ response is FramedMagic followed by two frames, the
+// binary schema and the payload, so that both parts carry their length.
+//
+// A reader can't trust the length it is given: ReadFrame refuses anything over
+// the caller's maxSize before allocating for it, so a corrupt or malicious
+// header can't make it try to allocate 4GB.
+package frame
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// HeaderSize is the length of the length prefix
+const HeaderSize = 4
+
+// FramedMagic starts every /get-framed/ response
+const FramedMagic = "SCHF"
+
+// ErrTooLarge is wrapped by the errors for a frame longer than the reader's
+// maxSize, or too long for its length to fit in the header
+var ErrTooLarge = errors.New("frame too large")
+
+// WriteFrame writes b to w as one frame. A writer that writes less than it was
+// given without saying why gets io.ErrShortWrite.
+func WriteFrame(w io.Writer, b []byte) error {
+	if uint64(len(b)) > math.MaxUint32 {
+		return fmt.Errorf("%w: %d bytes don't fit in a %d byte length", ErrTooLarge, len(b), HeaderSize)
+	}
+	var header [HeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(b)))
+
+	for _, part := range [][]byte{header[:], b} {
+		n, err := w.Write(part)
+		if err != nil {
+			return err
+		}
+		if n < len(part) {
+			return io.ErrShortWrite
+		}
+	}
+	return nil
+}
+
+// ReadFrame reads the next frame from r, which may be at most maxSize bytes long.
+// At the end of the stream, before a frame begins, it returns io.EOF; a frame
+// that ends early is io.ErrUnexpectedEOF. The returned slice is never nil, even
+// for a zero-length frame.
+func ReadFrame(r io.Reader, maxSize uint32) ([]byte, error) {
+	var header [HeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		// io.ReadFull says io.EOF only if nothing at all was read
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d", ErrTooLarge, size, maxSize)
+	}
+
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			// the header was there, so this isn't a clean end of the stream
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,166 @@
+package frame
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"testing/iotest"
+)
+
+// frames returns the frames holding each payload, back to back
+func frames(t *testing.T, payloads ...[]byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	for _, p := range payloads {
+		if err := WriteFrame(&b, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Bytes()
+}
+
+// readAll reads frames from r until the first error, which it returns with them
+func readAll(r io.Reader, maxSize uint32) ([][]byte, error) {
+	var got [][]byte
+	for {
+		b, err := ReadFrame(r, maxSize)
+		if err != nil {
+			return got, err
+		}
+		got = append(got, b)
+	}
+}
+
+// TestZeroLength checks an empty frame reads back as an empty, non-nil slice
+func TestZeroLength(t *testing.T) {
+	stream := frames(t, []byte{})
+	if !bytes.Equal(stream, []byte{0, 0, 0, 0}) {
+		t.Fatalf("wrote % x, expected a zero length", stream)
+	}
+	got, err := readAll(bytes.NewReader(stream), 0)
+	if err != io.EOF || len(got) != 1 || got[0] == nil || len(got[0]) != 0 {
+		t.Fatalf("read back %q, then %v", got, err)
+	}
+}
+
+// TestMaxSize checks a frame of exactly maxSize bytes is read, and one byte more
+// is ErrTooLarge
+func TestMaxSize(t *testing.T) {
+	const maxSize = 64
+	payload := bytes.Repeat([]byte{0xab}, maxSize)
+	stream := frames(t, payload)
+	got, err := ReadFrame(bytes.NewReader(stream), maxSize)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("a frame of exactly maxSize: %v", err)
+	}
+
+	stream = frames(t, append(payload, 0xcd))
+	if _, err := ReadFrame(bytes.NewReader(stream), maxSize); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("a frame one byte over maxSize: got %v, expected ErrTooLarge", err)
+	}
+}
+
+// TestBackToBack checks frames written one after another read back one by one,
+// then io.EOF
+func TestBackToBack(t *testing.T) {
+	payloads := [][]byte{[]byte("first"), {}, []byte("third, a little longer")}
+	stream := frames(t, payloads...)
+	got, err := readAll(bytes.NewReader(stream), 1024)
+	if err != io.EOF {
+		t.Fatalf("after the last frame: got %v, expected io.EOF", err)
+	}
+	if len(got) != len(payloads) {
+		t.Fatalf("read %d frames, wrote %d", len(got), len(payloads))
+	}
+	for i := range payloads {
+		if !bytes.Equal(got[i], payloads[i]) {
+			t.Fatalf("frame %d: read %q, wrote %q", i, got[i], payloads[i])
+		}
+	}
+}
+
+// TestTruncation cuts a stream at every byte boundary: the cut is io.EOF when
+// it falls between frames and io.ErrUnexpectedEOF anywhere else
+func TestTruncation(t *testing.T) {
+	payloads := [][]byte{[]byte("schemer"), []byte("payload")}
+	stream := frames(t, payloads...)
+	between := map[int]bool{0: true, HeaderSize + len(payloads[0]): true}
+
+	for cut := 0; cut < len(stream); cut++ {
+		got, err := readAll(bytes.NewReader(stream[:cut]), 1024)
+		want := io.ErrUnexpectedEOF
+		if between[cut] {
+			want = io.EOF
+		}
+		if err != want {
+			t.Fatalf("cut at byte %d: got %v, expected %v", cut, err, want)
+		}
+		// every frame before the cut is still read in full
+		for i, b := range got {
+			if !bytes.Equal(b, payloads[i]) {
+				t.Fatalf("cut at byte %d: frame %d read as %q", cut, i, b)
+			}
+		}
+	}
+}
+
+// TestShortReads checks a reader that hands out one byte at a time still gets
+// whole frames
+func TestShortReads(t *testing.T) {
+	payload := []byte("one byte at a time")
+	stream := frames(t, payload, payload)
+	got, err := readAll(iotest.OneByteReader(bytes.NewReader(stream)), 1024)
+	if err != io.EOF || len(got) != 2 || !bytes.Equal(got[0], payload) || !bytes.Equal(got[1], payload) {
+		t.Fatalf("read back %q, then %v", got, err)
+	}
+}
+
+// shortWriter breaks the io.Writer contract: it writes at most one byte, and
+// doesn't say it didn't write the rest
+type shortWriter struct{}
+
+func (shortWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// TestShortWrites checks a writer that quietly writes less than it was given is
+// io.ErrShortWrite
+func TestShortWrites(t *testing.T) {
+	if err := WriteFrame(shortWriter{}, []byte("payload")); err != io.ErrShortWrite {
+		t.Fatalf("got %v, expected io.ErrShortWrite", err)
+	}
+	// an error from the writer itself comes back as it is
+	if err := WriteFrame(failingWriter{}, []byte("payload")); err != errDiskFull {
+		t.Fatalf("got %v, expected the writer's own error", err)
+	}
+}
+
+var errDiskFull = errors.New("disk full")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errDiskFull }
+
+// TestMalicious checks a header claiming 4GB is ErrTooLarge, without allocating
+// it
+func TestMalicious(t *testing.T) {
+	// a length of 4GB, followed by a handful of bytes
+	stream := []byte{0xff, 0xff, 0xff, 0xff, 'g', 'o', 't', 'c', 'h', 'a'}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := ReadFrame(bytes.NewReader(stream), 1<<20)
+	runtime.ReadMemStats(&after)
+
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("got %v, expected ErrTooLarge", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf("allocated %d bytes before refusing the frame", allocated)
+	}
+}
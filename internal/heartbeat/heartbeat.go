@@ -0,0 +1,66 @@
+// Package heartbeat keeps long-lived WebSocket streams alive when there is no
+// data to send. NAT tables and load balancers drop connections that have been
+// quiet for a while, usually without telling either end, so a server that has
+// sent nothing for an interval sends a heartbeat instead, and a client that has
+// received nothing at all (data or heartbeat) for Timeout(interval) gives up on
+// the connection and reconnects.
+//
+// Data and schemas go out as binary messages; a heartbeat is a text message
+// holding Message, so it can never be mistaken for a payload.
+package heartbeat
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Message is the body of every heartbeat, sent as a websocket.TextMessage
+const Message = "heartbeat"
+
+// Header is the upgrade response header in which a server announces its interval,
+// in milliseconds, so its clients know how long to wait
+const Header = "X-Heartbeat-Interval"
+
+// IntervalEnv is the environment variable the servers read their interval from
+const IntervalEnv = "HEARTBEAT_INTERVAL"
+
+// DefaultInterval is used without HEARTBEAT_INTERVAL. It is well under the idle
+// timeouts of common NATs and load balancers, which start at about 30 seconds.
+const DefaultInterval = 5 * time.Second
+
+// IntervalFromEnv reads the interval from HEARTBEAT_INTERVAL (a duration, e.g.
+// 5s), defaulting to DefaultInterval. 0 turns heartbeats off.
+func IntervalFromEnv() (time.Duration, error) {
+	s := os.Getenv(IntervalEnv)
+	if s == "" {
+		return DefaultInterval, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: use a duration such as 5s, or 0 to turn heartbeats off", IntervalEnv, s)
+	}
+	return d, nil
+}
+
+// Timeout is how long a client waits for any message before deciding the
+// connection is dead: long enough to miss two heartbeats in a row
+func Timeout(interval time.Duration) time.Duration {
+	return 3 * interval
+}
+
+// FormatInterval formats interval for Header
+func FormatInterval(interval time.Duration) string {
+	return strconv.FormatInt(int64(interval/time.Millisecond), 10)
+}
+
+// ParseInterval reads the interval a server announced in Header. It reports false
+// if there is none, e.g. because the server sends no heartbeats.
+func ParseInterval(s string) (time.Duration, bool) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
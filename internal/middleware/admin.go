@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// AdminTokenEnv is the environment variable holding the token that admin
+// endpoints require. Servers only register their admin endpoints when it is set.
+const AdminTokenEnv = "ADMIN_TOKEN"
+
+// AdminTokenFromEnv returns the token in $ADMIN_TOKEN, or "" if the admin
+// endpoints are disabled
+func AdminTokenFromEnv() string {
+	return os.Getenv(AdminTokenEnv)
+}
+
+// AdminAuth only lets requests through to next that carry token as a bearer
+// token (Authorization: Bearer <token>); everything else gets a 401. An empty
+// token lets nothing through.
+func AdminAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		const prefix = "Bearer "
+		given := ""
+		if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+			given = auth[len(prefix):]
+		}
+
+		// compared in constant time, so the response time gives nothing away
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
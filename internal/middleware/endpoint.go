@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ErrorBody is the JSON body of every error response the servers send
+type ErrorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error replies to the request with the given status code and an ErrorBody. Like
+// http.Error, it expects the caller to write nothing else to w.
+func Error(w http.ResponseWriter, message string, code int) {
+	h := w.Header()
+	// headers set for the response that is no longer being sent don't apply
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(ErrorBody{Code: code, Message: message})
+}
+
+// Endpoint serves next at path, for the given methods, and answers everything
+// else that reaches it with an Error:
+//
+//	404  a longer path: registered at a pattern ending in a slash, such as
+//	     "/get-data/", ServeMux hands it every path under it, like
+//	     /get-data/garbage (see Handle for the path without the slash)
+//	405  any other method, with an Allow header listing methods; HEAD is
+//	     allowed wherever GET is
+//
+// The method is checked before next runs, so a POST gets its 405 even from an
+// endpoint that would answer 503 while warming up.
+func Endpoint(path string, next http.Handler, methods ...string) http.Handler {
+	allowed := map[string]bool{}
+	var list []string
+	for _, m := range methods {
+		allowed[m] = true
+		list = append(list, m)
+	}
+	if allowed[http.MethodGet] && !allowed[http.MethodHead] {
+		allowed[http.MethodHead] = true
+		list = append(list, http.MethodHead)
+	}
+	allow := strings.Join(list, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != path {
+			Error(w, "no such endpoint: "+req.URL.Path, http.StatusNotFound)
+			return
+		}
+		if !allowed[req.Method] {
+			w.Header().Set("Allow", allow)
+			Error(w, req.Method+" is not allowed on "+path+"; use "+allow, http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// NotFound answers every request with a 404 Error. Registered at "/", it catches
+// the paths no endpoint matches, which ServeMux would otherwise answer in plain
+// text. Timing counts the requests it answers as "unmatched", not under "/".
+func NotFound() http.Handler {
+	return notFound{}
+}
+
+type notFound struct{}
+
+func (notFound) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	Error(w, "no such endpoint: "+req.URL.Path, http.StatusNotFound)
+}
+
+// Handle registers Endpoint(path, next, methods...) with mux at path. A path
+// ending in a slash is registered without it too, answering with a redirect to
+// path: ServeMux would send a 301 there anyway, but a 308 doesn't let clients
+// turn a POST into a GET, and the redirect is then part of the routes rather
+// than a side effect of how ServeMux matches them. Paths with a doubled slash,
+// like //get-data/, never reach an endpoint: ServeMux redirects them to the
+// clean path with a 301.
+func Handle(mux *http.ServeMux, path string, next http.Handler, methods ...string) {
+	mux.Handle(path, Endpoint(path, next, methods...))
+	if trimmed := strings.TrimSuffix(path, "/"); trimmed != path && trimmed != "" {
+		mux.Handle(trimmed, redirect(path))
+	}
+}
+
+// redirect answers every request with a permanent redirect to path, keeping the
+// query
+func redirect(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		target := path
+		if req.URL.RawQuery != "" {
+			target += "?" + req.URL.RawQuery
+		}
+		http.Redirect(w, req, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Latency holds every request back for delay plus a random extra of up to
+// jitter, so client authors can try their timeouts and cancellation against a
+// slow server. A request whose context ends while it waits gets a 503 without
+// ever reaching next.
+func Latency(delay, jitter time.Duration, next http.Handler) http.Handler {
+	if delay <= 0 && jitter <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		d := delay
+		if jitter > 0 {
+			d += time.Duration(rand.Int63n(int64(jitter) + 1))
+		}
+
+		t := time.NewTimer(d)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+			next.ServeHTTP(w, req)
+		case <-req.Context().Done():
+			Error(w, "request timed out", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// LatencyFromEnv reads the delay for Latency from SLOW_MS and the jitter from
+// SLOW_JITTER, both in milliseconds. Both default to 0, which turns Latency off.
+func LatencyFromEnv() (delay, jitter time.Duration, err error) {
+	if delay, err = millisFromEnv("SLOW_MS"); err != nil {
+		return 0, 0, err
+	}
+	if jitter, err = millisFromEnv("SLOW_JITTER"); err != nil {
+		return 0, 0, err
+	}
+	return delay, jitter, nil
+}
+
+func millisFromEnv(name string) (time.Duration, error) {
+	s := os.Getenv(name)
+	if s == "" {
+		return 0, nil
+	}
+	ms, err := strconv.Atoi(s)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid %s: %q is not a number of milliseconds", name, s)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
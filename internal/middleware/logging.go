@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+)
+
+// Level is how much Logging logs
+type Level int
+
+const (
+	LevelDebug Level = iota // every request, with its query and user agent
+	LevelInfo               // every request (the default)
+	LevelWarn               // only requests answered with a 4xx or 5xx
+	LevelError              // only requests answered with a 5xx
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// LogLevelFromEnv reads the level for Logging from LOG_LEVEL (debug, info, warn
+// or error), defaulting to info: one line per request. LOG_LEVEL=warn (or error)
+// keeps only the failures.
+func LogLevelFromEnv() (Level, error) {
+	s := strings.ToLower(os.Getenv("LOG_LEVEL"))
+	if s == "" {
+		return LevelInfo, nil
+	}
+	for i, name := range levelNames {
+		if s == name {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid LOG_LEVEL %q: use debug, info, warn or error", s)
+}
+
+// FingerprintHeader is the response header Logging takes a data response's
+// schema fingerprint from
+const FingerprintHeader = registry.FingerprintHeader
+
+// responseRecorder remembers the status and size of the response written
+// through it. It passes Flush and Hijack through, so streaming handlers and
+// websocket upgrades work the same behind Logging.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.status == 0 {
+			r.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: the ResponseWriter doesn't support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// logValue quotes v if it would otherwise break up the key=value line
+func logValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\"=") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// Logging writes one line per request to logger, as key=value fields: level,
+// method, path, status, bytes written, duration, remote address and, for
+// responses that carry one, the schema fingerprint. Requests below level aren't
+// logged. Put it outside Recover, so that requests that panicked are logged with
+// the 500 they were answered with.
+func Logging(logger *log.Logger, level Level, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, req)
+
+		status := rec.status
+		if status == 0 {
+			// the handler wrote nothing at all, which net/http answers with a 200
+			status = http.StatusOK
+		}
+
+		lineLevel := LevelInfo
+		switch {
+		case status >= 500:
+			lineLevel = LevelError
+		case status >= 400:
+			lineLevel = LevelWarn
+		}
+		if lineLevel < level {
+			return
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "level=%s method=%s path=%s status=%d bytes=%d duration=%s remote=%s",
+			lineLevel, req.Method, logValue(req.URL.Path), status, rec.bytes, time.Since(start).Round(time.Microsecond), logValue(req.RemoteAddr))
+		if fp := rec.Header().Get(FingerprintHeader); fp != "" {
+			fmt.Fprintf(&b, " schema=%s", logValue(fp))
+		}
+		if level == LevelDebug {
+			fmt.Fprintf(&b, " query=%s user_agent=%s", logValue(req.URL.RawQuery), logValue(req.UserAgent()))
+		}
+		logger.Print(b.String())
+	})
+}
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testFingerprint = "6d7a00c2fac6a7d2e4b9c923053e95e97ff3bcc9719abdf42c9c2cdddc7f1b46"
+
+// loggedHandlers stands in for one of the example servers
+func loggedHandlers(flushed chan struct{}) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/get-data/", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(FingerprintHeader, testFingerprint)
+		w.Write([]byte("0123456789"))
+	})
+	mux.HandleFunc("/panic/", func(w http.ResponseWriter, req *http.Request) {
+		panic("something broke")
+	})
+	mux.HandleFunc("/stream/", func(w http.ResponseWriter, req *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "no http.Flusher behind the logging middleware", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("first\n"))
+		flusher.Flush()
+
+		// hold the rest back until the client has the first chunk
+		select {
+		case <-flushed:
+		case <-time.After(5 * time.Second):
+		}
+		w.Write([]byte("second\n"))
+	})
+	return mux
+}
+
+// logBuffer collects what the server logs; the server writes it while the test
+// reads it
+type logBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (lb *logBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.b.Write(p)
+}
+
+// line waits for a line to be logged, and returns it without its newline. The
+// line is written once the handler returns, which can be just after the client
+// has the whole response.
+func (lb *logBuffer) line() string {
+	deadline := time.Now().Add(time.Second)
+	for {
+		lb.mu.Lock()
+		s := lb.b.String()
+		lb.mu.Unlock()
+		if s != "" || time.Now().After(deadline) {
+			return strings.TrimSpace(s)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (lb *logBuffer) reset() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.b.Reset()
+}
+
+// logFields parses one logged line into its key=value fields
+func logFields(line string) map[string]string {
+	m := map[string]string{}
+	for _, f := range strings.Fields(line) {
+		if i := strings.IndexByte(f, '='); i > 0 {
+			m[f[:i]] = f[i+1:]
+		}
+	}
+	return m
+}
+
+// startLogged serves loggedHandlers behind Logging at level, around Recover as
+// the servers have it, logging into buf until the end of the test
+func startLogged(t *testing.T, level Level, buf *logBuffer, flushed chan struct{}) string {
+	ts := httptest.NewServer(Logging(log.New(buf, "", 0), level, Recover(loggedHandlers(flushed))))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// logged requests path and returns the line it logged, if any
+func logged(t *testing.T, url, path string, buf *logBuffer) string {
+	t.Helper()
+	buf.reset()
+	resp, err := http.Get(url + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	return buf.line()
+}
+
+func expectFields(t *testing.T, line string, want map[string]string) {
+	t.Helper()
+	got := logFields(line)
+	for _, k := range []string{"level", "method", "path", "status", "bytes", "duration", "remote"} {
+		if got[k] == "" {
+			t.Fatalf("no %s field in %q", k, line)
+		}
+	}
+	if _, err := time.ParseDuration(got["duration"]); err != nil {
+		t.Errorf("duration %q: %v", got["duration"], err)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s is %q, want %q, in %q", k, got[k], v, line)
+		}
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var buf logBuffer
+	url := startLogged(t, LevelInfo, &buf, make(chan struct{}))
+
+	// Recover logs the panic and its stack trace to the standard logger, which
+	// would only clutter the output here
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, c := range []struct {
+		name string
+		path string
+		want map[string]string
+	}{
+		{"success", "/get-data/", map[string]string{"level": "info", "method": "GET", "path": "/get-data/", "status": "200", "bytes": "10", "schema": testFingerprint}},
+		{"404", "/nowhere/", map[string]string{"level": "warn", "path": "/nowhere/", "status": "404", "schema": ""}},
+		{"500", "/panic/", map[string]string{"level": "error", "path": "/panic/", "status": "500"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			expectFields(t, logged(t, url, c.path, &buf), c.want)
+		})
+	}
+}
+
+// TestLoggingFlush checks a streaming handler still gets an http.Flusher behind
+// Logging, and its client receives the first chunk before the handler has
+// finished
+func TestLoggingFlush(t *testing.T) {
+	var buf logBuffer
+	flushed := make(chan struct{})
+	url := startLogged(t, LevelInfo, &buf, flushed)
+
+	resp, err := http.Get(url + "/stream/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	r := bufio.NewReader(resp.Body)
+	first, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading the first chunk: %v", err)
+	}
+	if first != "first\n" {
+		t.Fatalf("first chunk is %q", first)
+	}
+	close(flushed)
+
+	rest, err := ioutil.ReadAll(r)
+	if err != nil || string(rest) != "second\n" {
+		t.Fatalf("rest of the stream is %q (%v)", rest, err)
+	}
+	expectFields(t, buf.line(), map[string]string{"status": "200", "bytes": strconv.Itoa(len("first\nsecond\n"))})
+}
+
+// TestLoggingLevel checks that with the level at warn, successful requests
+// aren't logged
+func TestLoggingLevel(t *testing.T) {
+	var buf logBuffer
+	url := startLogged(t, LevelWarn, &buf, make(chan struct{}))
+
+	if line := logged(t, url, "/get-data/", &buf); line != "" {
+		t.Errorf("a 200 was logged at warn: %q", line)
+	}
+	expectFields(t, logged(t, url, "/nowhere/", &buf), map[string]string{"level": "warn", "status": "404"})
+}
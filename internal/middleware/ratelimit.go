@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucket is one client's token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time // when tokens was last brought up to date
+}
+
+// RateLimiter hands every client IP a token bucket: a request takes a token,
+// and tokens come back at rate per second, up to burst. A bucket that has been
+// left alone long enough to fill up again is no different from a new one, so
+// those are dropped every now and then to keep the map from growing forever.
+type RateLimiter struct {
+	rate       float64 // tokens per second
+	burst      float64
+	trustProxy bool
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter returns a limiter allowing each IP rate requests per second,
+// with bursts of up to burst. With trustProxy set the client IP is taken from
+// X-Forwarded-For, which is only safe behind a proxy that sets it: otherwise
+// any client can pick its own IP, and so its own limit.
+func NewRateLimiter(rate float64, burst int, trustProxy bool) *RateLimiter {
+	return &RateLimiter{
+		rate:       rate,
+		burst:      float64(burst),
+		trustProxy: trustProxy,
+		buckets:    make(map[string]*bucket),
+		lastSweep:  time.Now(),
+	}
+}
+
+// fillTime is how long an empty bucket takes to fill up
+func (l *RateLimiter) fillTime() time.Duration {
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+// sweep drops the buckets that are full by now. It runs at most once per
+// fillTime, so its cost is spread over many requests.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.fillTime() {
+		return
+	}
+	l.lastSweep = now
+	for ip, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// Allow takes a token from ip's bucket. If there is none it returns false and
+// how long until there will be.
+func (l *RateLimiter) Allow(ip string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Clients returns the number of IPs with a bucket
+func (l *RateLimiter) Clients() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// String describes the limit, e.g. "5 requests/s, bursts of 10, by peer address"
+func (l *RateLimiter) String() string {
+	by := "by peer address"
+	if l.trustProxy {
+		by = "by X-Forwarded-For"
+	}
+	return fmt.Sprintf("%g requests/s, bursts of %g, %s", l.rate, l.burst, by)
+}
+
+// ClientIP returns the IP req is limited by: the peer's address or, with
+// trustProxy, the last address in X-Forwarded-For. That's the one our proxy
+// appended; the ones before it are whatever the client claimed.
+func (l *RateLimiter) ClientIP(req *http.Request) string {
+	if l.trustProxy {
+		if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// RateLimit answers requests from a client that is over l's limit with a 429
+// and a Retry-After header, instead of passing them on to next. A nil l turns
+// it off.
+func RateLimit(l *RateLimiter, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ok, wait := l.Allow(l.ClientIP(req))
+		if !ok {
+			// Retry-After is in whole seconds; rounding down would invite a retry
+			// that is still too early
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// RateLimiterFromEnv reads the limit for RateLimit from RATE_LIMIT (requests
+// per second per IP), the burst from RATE_BURST (defaulting to the limit,
+// rounded up) and, with TRUST_PROXY=1, takes client IPs from X-Forwarded-For.
+// Without RATE_LIMIT it returns nil, which turns RateLimit off.
+func RateLimiterFromEnv() (*RateLimiter, error) {
+	s := os.Getenv("RATE_LIMIT")
+	if s == "" {
+		return nil, nil
+	}
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(rate > 0) || math.IsInf(rate, 1) {
+		return nil, fmt.Errorf("invalid RATE_LIMIT: %q is not a positive number of requests per second", s)
+	}
+
+	burst := int(math.Ceil(rate))
+	if s := os.Getenv("RATE_BURST"); s != "" {
+		burst, err = strconv.Atoi(s)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid RATE_BURST: %q is not a positive number of requests", s)
+		}
+	}
+
+	return NewRateLimiter(rate, burst, os.Getenv("TRUST_PROXY") == "1"), nil
+}
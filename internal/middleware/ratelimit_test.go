@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// The limiter the tests run against. Requests come from made-up IPs by way of
+// X-Forwarded-For.
+const (
+	testRate  = 20 // requests per second, so a token comes back every 50ms
+	testBurst = 5
+)
+
+var tokenTime = time.Second / testRate
+
+// startLimited serves a stand-in data handler behind RateLimit until the end of
+// the test, and returns its URL
+func startLimited(t *testing.T, limiter *RateLimiter) string {
+	ts := httptest.NewServer(RateLimit(limiter, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("encoded data"))
+	})))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// limitedRequest sends a request with X-Forwarded-For set to xff (if any), and
+// returns the status and the Retry-After header
+func limitedRequest(t *testing.T, url, xff string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url+"/get-data/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header.Get("Retry-After")
+}
+
+// drain makes requests as ip until it is limited, and returns how many got in
+// and the Retry-After it was limited with
+func drain(t *testing.T, url, ip string) (int, string) {
+	t.Helper()
+	for n := 0; n <= 10*testBurst; n++ {
+		status, retryAfter := limitedRequest(t, url, ip)
+		if status == http.StatusTooManyRequests {
+			return n, retryAfter
+		}
+		if status != http.StatusOK {
+			t.Fatalf("status %d", status)
+		}
+	}
+	t.Fatalf("%s was never limited", ip)
+	return 0, ""
+}
+
+// TestRateLimitBurst checks a fresh client gets a burst of requests in, and the
+// next gets a 429 with a Retry-After of at least a second
+func TestRateLimitBurst(t *testing.T) {
+	url := startLimited(t, NewRateLimiter(testRate, testBurst, true))
+	n, retryAfter := drain(t, url, "192.0.2.1")
+	// a token can come back while the burst is being sent, so allow for one more
+	if n < testBurst || n > testBurst+1 {
+		t.Errorf("%d requests got in, want a burst of %d", n, testBurst)
+	}
+	if secs, err := strconv.Atoi(retryAfter); err != nil || secs < 1 {
+		t.Errorf("Retry-After is %q, want a whole number of seconds of at least 1", retryAfter)
+	}
+}
+
+// TestRateLimitRefill checks that after a token comes back, one more request is
+// let through, and only one
+func TestRateLimitRefill(t *testing.T) {
+	url := startLimited(t, NewRateLimiter(testRate, testBurst, true))
+	drain(t, url, "192.0.2.2")
+	// a little over one token; the drain itself took next to no time
+	time.Sleep(tokenTime + tokenTime/4)
+	if status, _ := limitedRequest(t, url, "192.0.2.2"); status != http.StatusOK {
+		t.Fatalf("no request let through after a token came back: %d", status)
+	}
+	if status, _ := limitedRequest(t, url, "192.0.2.2"); status != http.StatusTooManyRequests {
+		t.Errorf("two requests let through on one token: %d", status)
+	}
+}
+
+// TestRateLimitPerIP checks one client running out doesn't slow down another
+func TestRateLimitPerIP(t *testing.T) {
+	url := startLimited(t, NewRateLimiter(testRate, testBurst, true))
+	drain(t, url, "192.0.2.3")
+	if n, _ := drain(t, url, "192.0.2.4"); n < testBurst {
+		t.Errorf("a second IP only got %d requests in, want a burst of %d of its own", n, testBurst)
+	}
+}
+
+// TestRateLimitForwarded checks X-Forwarded-For is ignored unless the proxy is
+// trusted, and then only its last address counts
+func TestRateLimitForwarded(t *testing.T) {
+	t.Run("untrusted", func(t *testing.T) {
+		// everyone here is 127.0.0.1, whatever they claim
+		url := startLimited(t, NewRateLimiter(testRate, testBurst, false))
+		drain(t, url, "192.0.2.5")
+		if status, _ := limitedRequest(t, url, "192.0.2.6"); status != http.StatusTooManyRequests {
+			t.Errorf("an untrusted X-Forwarded-For got around the limit: %d", status)
+		}
+	})
+
+	t.Run("trusted", func(t *testing.T) {
+		// the address the proxy appended counts, not the ones before it
+		url := startLimited(t, NewRateLimiter(testRate, testBurst, true))
+		drain(t, url, "192.0.2.7")
+		if status, _ := limitedRequest(t, url, "203.0.113.1, 192.0.2.7"); status != http.StatusTooManyRequests {
+			t.Errorf("a spoofed first address got around the limit: %d", status)
+		}
+		if status, _ := limitedRequest(t, url, "192.0.2.8"); status != http.StatusOK {
+			t.Errorf("a different forwarded IP was limited: %d", status)
+		}
+	})
+}
+
+// TestRateLimitSweep checks the buckets of clients that have gone quiet are
+// dropped
+func TestRateLimitSweep(t *testing.T) {
+	limiter := NewRateLimiter(testRate, testBurst, false)
+	for i := 0; i < 100; i++ {
+		limiter.Allow(fmt.Sprintf("198.51.100.%d", i))
+	}
+	if n := limiter.Clients(); n != 100 {
+		t.Fatalf("%d buckets for 100 clients", n)
+	}
+
+	// once every bucket has had time to fill up, the next request sweeps them
+	time.Sleep(testBurst*tokenTime + tokenTime)
+	limiter.Allow("198.51.100.200")
+	if n := limiter.Clients(); n != 1 {
+		t.Errorf("%d buckets left, want only the latest client's", n)
+	}
+}
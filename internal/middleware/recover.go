@@ -0,0 +1,32 @@
+// Package middleware holds the http.Handler wrappers shared by the example
+// servers.
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover wraps next so that a panic in any handler is logged together with its
+// stack trace and answered with a generic 500, instead of tearing down the
+// connection.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// net/http uses this panic on purpose to abort a response
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			log.Printf("panic serving %s %s: %v\n%s", req.Method, req.URL.Path, err, debug.Stack())
+			Error(w, "internal error", http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestRecover panics in a handler behind Recover, on a real server, and checks
+// the client gets a 500 with a JSON body and the server goes on serving
+func TestRecover(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic/", func(w http.ResponseWriter, req *http.Request) {
+		panic("decoding went wrong")
+	})
+	mux.HandleFunc("/ok/", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("still here"))
+	})
+	ts := httptest.NewServer(Recover(mux))
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(ts.URL + "/panic/")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		var body ErrorBody
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("request %d: the 500 has no JSON body: %v", i, err)
+		}
+		if resp.StatusCode != http.StatusInternalServerError || body.Code != http.StatusInternalServerError {
+			t.Fatalf("request %d: got %d %+v, want 500", i, resp.StatusCode, body)
+		}
+		// the panic value is for the log, not the client
+		if strings.Contains(body.Message, "decoding went wrong") {
+			t.Errorf("request %d: the client was sent the panic value: %q", i, body.Message)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/ok/")
+	if err != nil {
+		t.Fatalf("the server stopped serving after a panic: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "still here" {
+		t.Errorf("after a panic, got %d %q", resp.StatusCode, body)
+	}
+
+	if !strings.Contains(logged.String(), "panic serving GET /panic/: decoding went wrong") {
+		t.Errorf("the panic wasn't logged with the request:\n%s", logged.String())
+	}
+	if !strings.Contains(logged.String(), "goroutine ") {
+		t.Errorf("the panic was logged without a stack trace:\n%s", logged.String())
+	}
+}
+
+// TestRecoverAbortHandler checks http.ErrAbortHandler still aborts the response
+// rather than turning into a 500
+func TestRecoverAbortHandler(t *testing.T) {
+	ts := httptest.NewServer(Recover(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic(http.ErrAbortHandler)
+	})))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("got %d, want the connection closed without a response", resp.StatusCode)
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DefaultTimeout is how long a request may take unless REQUEST_TIMEOUT says
+// otherwise
+const DefaultTimeout = 10 * time.Second
+
+// Timeout gives every request a context that is cancelled after d. Handlers
+// check it to stop working on a response nobody is going to wait for.
+func Timeout(d time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), d)
+		defer cancel()
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// TimeoutFromEnv reads the duration for Timeout from REQUEST_TIMEOUT, such as
+// "30s" or "500ms", defaulting to DefaultTimeout
+func TimeoutFromEnv() (time.Duration, error) {
+	s := os.Getenv("REQUEST_TIMEOUT")
+	if s == "" {
+		return DefaultTimeout, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid REQUEST_TIMEOUT: %q is not a positive duration", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// endpoints is published at /debug/vars as
+//
+//	"endpoints": {"/get-data/": {"requests": 12, "errors": 0, "durationNs": 4183000}, ...}
+var endpoints = expvar.NewMap("endpoints")
+
+// endpointVars are the expvars of one endpoint
+type endpointVars struct {
+	requests   *expvar.Int
+	errors     *expvar.Int // requests answered with a 5xx
+	durationNs *expvar.Int // time spent in the handler, in total
+}
+
+var (
+	endpointsMu sync.Mutex
+	endpointMap = map[string]*endpointVars{}
+)
+
+// varsFor returns the expvars of the endpoint pattern, publishing them the first
+// time the pattern is seen
+func varsFor(pattern string) *endpointVars {
+	endpointsMu.Lock()
+	defer endpointsMu.Unlock()
+
+	if v, ok := endpointMap[pattern]; ok {
+		return v
+	}
+	v := &endpointVars{requests: new(expvar.Int), errors: new(expvar.Int), durationNs: new(expvar.Int)}
+	m := new(expvar.Map).Init()
+	m.Set("requests", v.requests)
+	m.Set("errors", v.errors)
+	m.Set("durationNs", v.durationNs)
+	endpoints.Set(pattern, m)
+	endpointMap[pattern] = v
+	return v
+}
+
+// Timing counts the requests to each endpoint of mux and the time spent
+// answering them, published with expvar under "endpoints". Requests are counted
+// by the pattern they matched, so there is one entry per registered endpoint
+// (and one, "unmatched", for everything else, whether ServeMux or NotFound
+// answers it) however many paths clients try. Serve expvar.Handler() at
+// /debug/vars to see them.
+func Timing(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h, pattern := mux.Handler(req)
+		if _, ok := h.(notFound); ok || pattern == "" {
+			pattern = "unmatched"
+		}
+		v := varsFor(pattern)
+
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		panicked := true
+		defer func() {
+			v.requests.Add(1)
+			v.durationNs.Add(int64(time.Since(start)))
+			if panicked || rec.status >= 500 {
+				v.errors.Add(1)
+			}
+		}()
+
+		mux.ServeHTTP(rec, req)
+		panicked = false
+	})
+}
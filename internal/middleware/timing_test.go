@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// counts returns the requests and errors counted so far for each pattern. The
+// expvars are shared by every test in the package, so tests compare counts
+// before and after.
+func counts(patterns ...string) map[string][2]int64 {
+	m := map[string][2]int64{}
+	for _, p := range patterns {
+		v := varsFor(p)
+		m[p] = [2]int64{v.requests.Value(), v.errors.Value()}
+	}
+	return m
+}
+
+// TestTiming checks requests are counted under the endpoint they matched, and
+// that the paths NotFound answers are counted as "unmatched" rather than under
+// the "/" it is registered at
+func TestTiming(t *testing.T) {
+	mux := http.NewServeMux()
+	Handle(mux, "/timing-data/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("encoded data"))
+	}), http.MethodGet)
+	Handle(mux, "/timing-broken/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Error(w, "cannot encode", http.StatusInternalServerError)
+	}), http.MethodGet)
+	mux.Handle("/", NotFound())
+	ts := httptest.NewServer(Timing(mux))
+	defer ts.Close()
+
+	patterns := []string{"/timing-data/", "/timing-broken/", "/", "unmatched"}
+	before := counts(patterns...)
+	for _, path := range []string{"/timing-data/", "/timing-data/", "/timing-broken/", "/no-such-thing", "/"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	after := counts(patterns...)
+
+	for p, want := range map[string][2]int64{
+		"/timing-data/":   {2, 0},
+		"/timing-broken/": {1, 1},
+		"/":               {0, 0},
+		"unmatched":       {2, 0},
+	} {
+		got := [2]int64{after[p][0] - before[p][0], after[p][1] - before[p][1]}
+		if got != want {
+			t.Errorf("%s: counted %d requests and %d errors, want %d and %d", p, got[0], got[1], want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+// Gate is closed until the server has produced its first sample. The zero value
+// is closed.
+type Gate struct {
+	open int32
+}
+
+// Open opens the gate, for good; opening it again does nothing
+func (g *Gate) Open() {
+	atomic.StoreInt32(&g.open, 1)
+}
+
+// IsOpen reports whether the gate has been opened
+func (g *Gate) IsOpen() bool {
+	return atomic.LoadInt32(&g.open) == 1
+}
+
+// WarmUp answers every request with a 503 and Retry-After: 1 until g is open,
+// and passes them on to next from then on. Without it, a client that connects
+// right after startup gets an empty sample (no header, no readings) that looks
+// like a decoding bug on its side. Only wrap the data endpoints: the schema is
+// there from the start.
+func WarmUp(g *Gate, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !g.IsOpen() {
+			w.Header().Set("Retry-After", "1")
+			Error(w, "warming up: no data yet", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// WarmUpMode is how a server avoids sending out an empty sample at startup
+type WarmUpMode string
+
+const (
+	// WarmUpGate starts listening right away, and data requests get a 503 from
+	// WarmUp until the first sample is there
+	WarmUpGate WarmUpMode = "gate"
+	// WarmUpSync makes the first sample before starting to listen, so no client
+	// ever has to wait (WarmUp's gate is open before the first request)
+	WarmUpSync WarmUpMode = "sync"
+)
+
+// WarmUpFromEnv reads the WarmUpMode from WARMUP (gate or sync), defaulting to
+// gate
+func WarmUpFromEnv() (WarmUpMode, error) {
+	switch s := WarmUpMode(os.Getenv("WARMUP")); s {
+	case "":
+		return WarmUpGate, nil
+	case WarmUpGate, WarmUpSync:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid WARMUP %q: use gate or sync", s)
+	}
+}
@@ -0,0 +1,130 @@
+// Package profiling serves net/http/pprof and a /debug/stats JSON endpoint on a
+// listener of its own, so the example servers can be profiled in place without
+// any of it ever being reachable on their public port. It is off unless
+// DEBUG_ADDR is set:
+//
+//	DEBUG_ADDR=localhost:6060 go run ./client-server/server/v2
+//	go tool pprof http://localhost:6060/debug/pprof/heap
+//	curl localhost:6060/debug/stats
+//
+// The package knows nothing about the servers: each hands it a Stats to read
+// its own counters (encodes, cache hits, subscribers, ...) from.
+package profiling
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"time"
+)
+
+// AddrEnv is the environment variable holding the address to listen on
+const AddrEnv = "DEBUG_ADDR"
+
+// how many of the most recent GC pauses /debug/stats lists
+const recentPauses = 10
+
+// Stats is implemented by whatever has counters worth reporting in /debug/stats
+type Stats interface {
+	Stats() map[string]int64
+}
+
+// StatsFunc turns a function into a Stats
+type StatsFunc func() map[string]int64
+
+// Stats calls f
+func (f StatsFunc) Stats() map[string]int64 { return f() }
+
+// Report is the body of /debug/stats
+type Report struct {
+	Goroutines      int              `json:"goroutines"`
+	HeapInUseBytes  uint64           `json:"heapInUseBytes"`
+	HeapObjects     uint64           `json:"heapObjects"`
+	NumGC           uint32           `json:"numGC"`
+	GCPauseTotal    string           `json:"gcPauseTotal"`
+	RecentGCPauses  []string         `json:"recentGCPauses"` // newest first
+	ServerCounters  map[string]int64 `json:"serverCounters"`
+	UptimeInSeconds int64            `json:"uptimeInSeconds"`
+}
+
+func report(stats Stats, started time.Time) Report {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	r := Report{
+		Goroutines:      runtime.NumGoroutine(),
+		HeapInUseBytes:  m.HeapInuse,
+		HeapObjects:     m.HeapObjects,
+		NumGC:           m.NumGC,
+		GCPauseTotal:    time.Duration(m.PauseTotalNs).String(),
+		RecentGCPauses:  []string{},
+		ServerCounters:  map[string]int64{},
+		UptimeInSeconds: int64(time.Since(started) / time.Second),
+	}
+
+	// PauseNs is a circular buffer; the most recent pause is at (NumGC+255)%256
+	for i := uint32(0); i < recentPauses && i < m.NumGC; i++ {
+		pause := m.PauseNs[(m.NumGC-1-i)%uint32(len(m.PauseNs))]
+		r.RecentGCPauses = append(r.RecentGCPauses, time.Duration(pause).String())
+	}
+
+	if stats != nil {
+		for k, v := range stats.Stats() {
+			r.ServerCounters[k] = v
+		}
+	}
+	return r
+}
+
+// Handler returns the debug mux: the pprof handlers under /debug/pprof/ and the
+// runtime and server stats under /debug/stats
+func Handler(stats Stats) http.Handler {
+	started := time.Now()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/stats", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report(stats, started)); err != nil {
+			log.Println("i/o error: " + err.Error())
+		}
+	})
+	return mux
+}
+
+// Start serves Handler(stats) on addr in the background, and returns the
+// address it is listening on (which tells the port when addr ends in :0)
+func Start(addr string, stats Stats) (net.Addr, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: Handler(stats), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			log.Println("debug listener stopped: " + err.Error())
+		}
+	}()
+	return ln.Addr(), nil
+}
+
+// StartFromEnv calls Start with the address in DEBUG_ADDR. Without DEBUG_ADDR
+// it does nothing and returns a nil address.
+func StartFromEnv(stats Stats) (net.Addr, error) {
+	addr := os.Getenv(AddrEnv)
+	if addr == "" {
+		return nil, nil
+	}
+	return Start(addr, stats)
+}
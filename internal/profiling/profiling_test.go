@@ -0,0 +1,175 @@
+package profiling
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// stands in for a server's counters
+var counters = StatsFunc(func() map[string]int64 {
+	return map[string]int64{"encodes": 42, "subscribers": 3}
+})
+
+func get(t *testing.T, url string) []byte {
+	t.Helper()
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: %s %s", url, resp.Status, b)
+	}
+	return b
+}
+
+// setAddrEnv sets DEBUG_ADDR to addr (unsets it for "") until the end of the
+// test
+func setAddrEnv(t *testing.T, addr string) {
+	old, had := os.LookupEnv(AddrEnv)
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(AddrEnv, old)
+		} else {
+			os.Unsetenv(AddrEnv)
+		}
+	})
+	if addr == "" {
+		os.Unsetenv(AddrEnv)
+	} else {
+		os.Setenv(AddrEnv, addr)
+	}
+}
+
+func TestStartFromEnv(t *testing.T) {
+	t.Run("off", func(t *testing.T) {
+		setAddrEnv(t, "")
+		addr, err := StartFromEnv(counters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr != nil {
+			t.Errorf("started a listener on %s without %s", addr, AddrEnv)
+		}
+	})
+
+	t.Run("on", func(t *testing.T) {
+		setAddrEnv(t, "127.0.0.1:0")
+		addr, err := StartFromEnv(counters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr == nil {
+			t.Fatalf("nothing started with %s set", AddrEnv)
+		}
+		get(t, "http://"+addr.String()+"/debug/stats")
+	})
+}
+
+// profileStrings checks that b is a gzipped pprof profile, and returns its
+// string table. See profile.proto in github.com/google/pprof: field 1 is
+// sample_type, field 6 the string table.
+func profileStrings(b []byte) ([]string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("not gzipped: %w", err)
+	}
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("bad gzip stream: %w", err)
+	}
+
+	var strs []string
+	sampleTypes := 0
+	for len(raw) > 0 {
+		num, typ, n := protowire.ConsumeTag(raw)
+		if n < 0 {
+			return nil, fmt.Errorf("not a protobuf message: %w", protowire.ParseError(n))
+		}
+		raw = raw[n:]
+		if typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(raw)
+			if n < 0 {
+				return nil, fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+			}
+			switch num {
+			case 1:
+				sampleTypes++
+			case 6:
+				strs = append(strs, string(v))
+			}
+			raw = raw[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, raw)
+		if n < 0 {
+			return nil, fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		raw = raw[n:]
+	}
+	if sampleTypes == 0 {
+		return nil, errors.New("the profile has no sample types")
+	}
+	return strs, nil
+}
+
+// TestHeapProfile checks /debug/pprof/heap is a valid heap profile: gzipped
+// protobuf with the sample types go tool pprof expects
+func TestHeapProfile(t *testing.T) {
+	ts := httptest.NewServer(Handler(counters))
+	defer ts.Close()
+
+	strs, err := profileStrings(get(t, ts.URL+"/debug/pprof/heap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := map[string]bool{}
+	for _, s := range strs {
+		have[s] = true
+	}
+	for _, want := range []string{"inuse_space", "alloc_space", "bytes"} {
+		if !have[want] {
+			t.Errorf("no %q in the profile's string table", want)
+		}
+	}
+}
+
+// TestStats checks /debug/stats is JSON with the runtime stats and the counters
+// handed to the listener
+func TestStats(t *testing.T) {
+	ts := httptest.NewServer(Handler(counters))
+	defer ts.Close()
+
+	b := get(t, ts.URL+"/debug/stats")
+	var r Report
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatalf("not JSON: %v", err)
+	}
+	if r.Goroutines < 1 || r.HeapInUseBytes == 0 {
+		t.Errorf("implausible runtime stats: %s", b)
+	}
+	if _, err := time.ParseDuration(r.GCPauseTotal); err != nil {
+		t.Errorf("gcPauseTotal: %v", err)
+	}
+	for k, v := range counters() {
+		if r.ServerCounters[k] != v {
+			t.Errorf("counter %s is %d, want %d", k, r.ServerCounters[k], v)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bminer/schemer"
+)
+
+// RegistryEnv is the environment variable producers and consumers read the
+// registry's base URL from
+const RegistryEnv = "REGISTRY_URL"
+
+// Register registers binarySchema with the registry at baseURL and returns its
+// fingerprint
+func Register(ctx context.Context, baseURL string, binarySchema []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/schemas", bytes.NewReader(binarySchema))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("registering schema: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	fingerprint := strings.TrimSpace(string(body))
+	if fingerprint != Fingerprint(binarySchema) {
+		return "", fmt.Errorf("registry answered fingerprint %.12s, expected %.12s", fingerprint, Fingerprint(binarySchema))
+	}
+	return fingerprint, nil
+}
+
+// Resolver turns fingerprints into schemas, asking the registry only the first
+// time it sees each one. It is safe for concurrent use.
+type Resolver struct {
+	baseURL string
+
+	mu      sync.Mutex
+	schemas map[string]schemer.Schema
+	fetches int
+}
+
+// NewResolver returns a Resolver for the registry at baseURL
+func NewResolver(baseURL string) *Resolver {
+	return &Resolver{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		schemas: map[string]schemer.Schema{},
+	}
+}
+
+// Fetches returns how many schemas have been fetched from the registry
+func (r *Resolver) Fetches() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fetches
+}
+
+// Resolve returns the schema with the given fingerprint
+func (r *Resolver) Resolve(ctx context.Context, fingerprint string) (schemer.Schema, error) {
+	r.mu.Lock()
+	schema, ok := r.schemas[fingerprint]
+	r.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+"/schemas/"+fingerprint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schema %.12s: registry answered %s", fingerprint, resp.Status)
+	}
+	binarySchema, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// the fingerprint is the schema's hash, so whatever answered can be checked
+	if Fingerprint(binarySchema) != fingerprint {
+		return nil, fmt.Errorf("schema %.12s: registry sent a schema with a different fingerprint", fingerprint)
+	}
+	schema, err = schemer.DecodeSchema(binarySchema)
+	if err != nil {
+		return nil, fmt.Errorf("schema %.12s: %w", fingerprint, err)
+	}
+
+	r.mu.Lock()
+	r.schemas[fingerprint] = schema
+	r.fetches++
+	r.mu.Unlock()
+	return schema, nil
+}
@@ -0,0 +1,195 @@
+// Package registry is a minimal schema registry. Producers register their binary
+// schema once and stamp every payload with its fingerprint (the hex SHA-256 of
+// the schema); consumers that see a fingerprint they don't know fetch the schema
+// from the registry instead of from the producer.
+//
+//	POST /schemas               body is a binary schema; answers with its fingerprint
+//	GET  /schemas               JSON list of fingerprints and registration times
+//	GET  /schemas/{fingerprint} the binary schema
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bminer/schemer"
+)
+
+// FingerprintHeader is the response header producers put the fingerprint of the
+// payload's schema in
+const FingerprintHeader = "X-Schema-Fingerprint"
+
+// the largest schema the registry accepts
+const maxSchemaSize = 1 << 20
+
+// Fingerprint returns the fingerprint of a binary schema
+func Fingerprint(binarySchema []byte) string {
+	sum := sha256.Sum256(binarySchema)
+	return hex.EncodeToString(sum[:])
+}
+
+// Entry describes one registered schema in the GET /schemas list
+type Entry struct {
+	Fingerprint  string    `json:"fingerprint"`
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+// Store keeps the registered schemas in a directory, one file per schema named
+// after its fingerprint, so the registry survives restarts. The file's
+// modification time is the registration time; registering the same schema again
+// leaves the file alone.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open returns a Store keeping its schemas in dir, creating dir if needed
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(fingerprint string) string {
+	return filepath.Join(s.dir, fingerprint+".schema")
+}
+
+// validFingerprint keeps anything but a hex SHA-256 out of file names
+func validFingerprint(fingerprint string) bool {
+	b, err := hex.DecodeString(fingerprint)
+	return err == nil && len(b) == sha256.Size && fingerprint == strings.ToLower(fingerprint)
+}
+
+// Register stores binarySchema and returns its fingerprint. created is false if
+// the schema was already registered.
+func (s *Store) Register(binarySchema []byte) (fingerprint string, created bool, err error) {
+	if _, err := schemer.DecodeSchema(binarySchema); err != nil {
+		return "", false, fmt.Errorf("not a valid schema: %w", err)
+	}
+	fingerprint = Fingerprint(binarySchema)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(s.path(fingerprint)); err == nil {
+		return fingerprint, false, nil
+	}
+
+	// write to a temporary file and rename it, so a crash can't leave a partial
+	// schema under a valid fingerprint
+	tmp, err := ioutil.TempFile(s.dir, ".register-")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binarySchema); err != nil {
+		tmp.Close()
+		return "", false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", false, err
+	}
+	if err := os.Rename(tmp.Name(), s.path(fingerprint)); err != nil {
+		return "", false, err
+	}
+	return fingerprint, true, nil
+}
+
+// Get returns the schema registered under fingerprint, or an error satisfying
+// os.IsNotExist if there is none
+func (s *Store) Get(fingerprint string) ([]byte, error) {
+	if !validFingerprint(fingerprint) {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.ReadFile(s.path(fingerprint))
+}
+
+// List returns every registered schema, oldest first
+func (s *Store) List() ([]Entry, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, f := range files {
+		fingerprint := strings.TrimSuffix(f.Name(), ".schema")
+		if f.IsDir() || fingerprint == f.Name() || !validFingerprint(fingerprint) {
+			continue
+		}
+		entries = append(entries, Entry{Fingerprint: fingerprint, RegisteredAt: f.ModTime().UTC()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].RegisteredAt.Before(entries[j].RegisteredAt) })
+	return entries, nil
+}
+
+// Handler serves the registry's HTTP API; mount it at both /schemas and /schemas/
+func Handler(s *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		fingerprint := strings.Trim(strings.TrimPrefix(req.URL.Path, "/schemas"), "/")
+
+		switch {
+		case fingerprint == "" && req.Method == http.MethodPost:
+			binarySchema, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxSchemaSize))
+			if err != nil {
+				http.Error(w, "cannot read schema: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			fingerprint, created, err := s.Register(binarySchema)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// registering a known schema again is fine, and answers the same
+			// fingerprint; only the status code tells the two apart
+			w.Header().Set("Location", "/schemas/"+fingerprint)
+			if created {
+				log.Printf("registered schema %.12s", fingerprint)
+				w.WriteHeader(http.StatusCreated)
+			}
+			fmt.Fprintln(w, fingerprint)
+
+		case fingerprint == "" && req.Method == http.MethodGet:
+			entries, err := s.List()
+			if err != nil {
+				http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(entries); err != nil {
+				log.Println("i/o error: " + err.Error())
+			}
+
+		case req.Method == http.MethodGet:
+			binarySchema, err := s.Get(fingerprint)
+			if os.IsNotExist(err) {
+				http.Error(w, "unknown schema "+fingerprint, http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// a schema never changes under its fingerprint
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			w.Write(binarySchema)
+
+		default:
+			http.Error(w, "Invalid Invocation", http.StatusMethodNotAllowed)
+		}
+	}
+}
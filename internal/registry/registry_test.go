@@ -0,0 +1,178 @@
+package registry_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/registry"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// serve serves store the way the registry server does, until the end of the
+// test, and returns its URL
+func serve(t *testing.T, store *registry.Store) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/schemas", registry.Handler(store))
+	mux.HandleFunc("/schemas/", registry.Handler(store))
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// open opens a Store in a new temporary directory and serves it
+func open(t *testing.T) (url, dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	store, err := registry.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serve(t, store), dir
+}
+
+func post(t *testing.T, url string, body []byte) (int, string) {
+	t.Helper()
+	resp, err := http.Post(url+"/schemas", "application/octet-stream", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+// TestDuplicate registers the same schema twice, and checks the second time
+// changes nothing
+func TestDuplicate(t *testing.T) {
+	url, dir := open(t)
+	binarySchema := schemas.V1WriterSchema().MarshalSchemer()
+
+	status, first := post(t, url, binarySchema)
+	if status != http.StatusCreated {
+		t.Fatalf("first registration answered %d, want %d", status, http.StatusCreated)
+	}
+
+	store, err := registry.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, second := post(t, url, binarySchema)
+	if status != http.StatusOK {
+		t.Fatalf("second registration answered %d, want %d", status, http.StatusOK)
+	}
+	if first != second || first != registry.Fingerprint(binarySchema) {
+		t.Fatalf("fingerprints differ: %.12s, %.12s", first, second)
+	}
+
+	after, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("registering again changed the list from %v to %v", before, after)
+	}
+
+	// something that isn't a schema isn't registered at all
+	if status, _ := post(t, url, []byte("not a schema")); status != http.StatusBadRequest {
+		t.Fatalf("registering garbage answered %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+// TestUnknown checks that fingerprints nobody registered, and things that aren't
+// fingerprints at all, get a 404
+func TestUnknown(t *testing.T) {
+	url, _ := open(t)
+	for _, fingerprint := range []string{
+		registry.Fingerprint([]byte("never registered")),
+		"not-a-fingerprint",
+		"..%2f..%2fetc%2fpasswd",
+	} {
+		resp, err := http.Get(url + "/schemas/" + fingerprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET /schemas/%s answered %d, want %d", fingerprint, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+
+	_, err := registry.NewResolver(url).Resolve(context.Background(), registry.Fingerprint([]byte("never registered")))
+	if err == nil {
+		t.Error("resolving an unknown fingerprint succeeded")
+	}
+}
+
+// TestFlow has a producer register its schema and stamp its payloads, and a
+// consumer that only knows the registry decode them. It then restarts the
+// registry on the same directory and checks the schema is still there.
+func TestFlow(t *testing.T) {
+	url, dir := open(t)
+	ctx := context.Background()
+
+	// the producer, as server v2 does it with REGISTRY_URL set
+	writerSchema := schemas.V2WriterSchema()
+	fingerprint, err := registry.Register(ctx, url, writerSchema.MarshalSchemer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := schemas.V2Reading{Header: "check", RawReadings: []float64{1.5, 2.25, 3}, FilteredReadings: []float64{1.5, 2, 2.5}, Sequence: 7}
+	producer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(registry.FingerprintHeader, fingerprint)
+		writerSchema.Encode(w, &sent)
+	}))
+	defer producer.Close()
+
+	// the consumer never asks the producer for the schema
+	resolver := registry.NewResolver(url)
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(producer.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		schema, err := resolver.Resolve(ctx, resp.Header.Get(registry.FingerprintHeader))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var received schemas.V2Reading
+		if err := schema.Decode(bytes.NewReader(data), &received); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(received, sent) {
+			t.Fatalf("decoded %+v, sent %+v", received, sent)
+		}
+	}
+	if n := resolver.Fetches(); n != 1 {
+		t.Errorf("the consumer fetched the schema %d times, want once", n)
+	}
+
+	// a new registry on the same directory still knows the schema
+	store, err := registry.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.NewResolver(serve(t, store)).Resolve(ctx, fingerprint); err != nil {
+		t.Fatalf("after a restart: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+// Package routecheck checks a server's method × path matrix: every route is
+// requested with every method in Methods, and each response must have the
+// status the route's wiring (see middleware.Endpoint) promises. The servers'
+// tests run it.
+package routecheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/middleware"
+)
+
+// Methods are the methods every route is requested with
+var Methods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// Route is a path and what requests for it should get
+type Route struct {
+	Path string // may have a query
+
+	// Allowed are the methods the endpoint accepts, which get Status; HEAD is
+	// accepted wherever GET is. Any other method must get a 405 with an Allow
+	// header listing them. With no Allowed methods the path is not an endpoint,
+	// and every method must get a 404.
+	Allowed []string
+	Status  int
+}
+
+// Check requests every route in routes from baseURL with every method in
+// Methods, and returns an error describing every response that isn't what the
+// route says. Every error response must have a middleware.ErrorBody with its
+// status in it.
+//
+// Each endpoint (a route with Allowed methods) is also requested at spellings of
+// its path that aren't it, which must not reach it:
+//
+//	/get-data             a 308 to /get-data/ (see middleware.Handle)
+//	//get-data/           a 301 to /get-data/, from ServeMux cleaning the path
+//	/get-data//           the same
+//	/get-data/no-such-endpoint
+//	                      a 404
+//
+// A redirect must keep the route's query.
+func Check(baseURL string, routes []Route) error {
+	// every response's connection is closed once it has been checked, which also
+	// ends a streaming response that would otherwise go on; redirects are
+	// checked, not followed
+	client := &http.Client{
+		Transport: &http.Transport{DisableKeepAlives: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var requests []request
+	for _, r := range routes {
+		allowed := map[string]bool{}
+		for _, m := range r.Allowed {
+			allowed[m] = true
+		}
+		if allowed[http.MethodGet] {
+			allowed[http.MethodHead] = true
+		}
+
+		for _, method := range Methods {
+			want := r.Status
+			switch {
+			case len(r.Allowed) == 0:
+				want = http.StatusNotFound
+			case !allowed[method]:
+				want = http.StatusMethodNotAllowed
+			}
+			requests = append(requests, request{method: method, path: r.Path, want: want, allowed: r.Allowed})
+			if len(r.Allowed) > 0 {
+				requests = append(requests, variants(method, r.Path)...)
+			}
+		}
+	}
+
+	var failures []string
+	for _, r := range requests {
+		if err := check(client, baseURL, r); err != nil {
+			failures = append(failures, fmt.Sprintf("%s %s: %v", r.method, r.path, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d requests:\n  %s", len(failures), len(requests), strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// a request Check makes, and what it should get
+type request struct {
+	method, path string
+	want         int
+	location     string   // where a redirect has to point
+	allowed      []string // what the Allow header of a 405 has to list
+}
+
+// variants returns the requests for the spellings of an endpoint's path (with
+// its query, if any) that aren't it
+func variants(method, path string) []request {
+	p, query := path, ""
+	if i := strings.Index(path, "?"); i >= 0 {
+		p, query = path[:i], path[i:]
+	}
+	last := strings.LastIndex(p, "/")
+
+	requests := []request{
+		{method: method, path: "/" + p + query, want: http.StatusMovedPermanently, location: path},
+		{method: method, path: p[:last] + "/" + p[last:] + query, want: http.StatusMovedPermanently, location: path},
+		{method: method, path: strings.TrimSuffix(p, "/") + "/no-such-endpoint" + query, want: http.StatusNotFound},
+	}
+	if trimmed := strings.TrimSuffix(p, "/"); trimmed != p {
+		requests = append(requests, request{method: method, path: trimmed + query, want: http.StatusPermanentRedirect, location: path})
+	}
+	return requests
+}
+
+func check(client *http.Client, baseURL string, r request) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, r.method, baseURL+r.path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	want, method := r.want, r.method
+	if resp.StatusCode != want {
+		return fmt.Errorf("status %d, expected %d", resp.StatusCode, want)
+	}
+	if want == http.StatusMethodNotAllowed {
+		for _, m := range r.allowed {
+			if !strings.Contains(resp.Header.Get("Allow"), m) {
+				return fmt.Errorf("Allow is %q, which doesn't list %s", resp.Header.Get("Allow"), m)
+			}
+		}
+	}
+	if r.location != "" && resp.Header.Get("Location") != r.location {
+		return fmt.Errorf("a %d to %q, expected %q", want, resp.Header.Get("Location"), r.location)
+	}
+	if want < 400 || method == http.MethodHead {
+		return nil
+	}
+
+	// an error: it has to say so in JSON
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "application/json" {
+		return fmt.Errorf("a %d with Content-Type %q, expected application/json", want, resp.Header.Get("Content-Type"))
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var body middleware.ErrorBody
+	if err := json.Unmarshal(b, &body); err != nil {
+		return fmt.Errorf("error body %q: %v", b, err)
+	}
+	if body.Code != want || body.Message == "" {
+		return fmt.Errorf("error body %s, expected code %d and a message", b, want)
+	}
+	return nil
+}
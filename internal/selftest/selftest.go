@@ -0,0 +1,150 @@
+// Package selftest checks, before a server starts listening, that every struct it
+// encodes survives the trip a client puts it through: the schema is marshaled
+// (binary and JSON) and parsed again, a sample with every field set is encoded,
+// and the encoding is decoded with the parsed schema into a fresh value, which
+// has to come out equal to the sample. A bad struct tag (two fields going by the
+// same name on the wire, say) otherwise only shows when the first client gets
+// the wrong data, or falls over; Run makes the server fail at startup instead,
+// naming the struct and the field.
+package selftest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/bminer/schemer"
+)
+
+// Run checks each of values, pointers to the structs a server encodes; only
+// their types matter, the samples are filled in by Run. It returns an error
+// naming the struct, and the field, of the first one that doesn't round-trip.
+func Run(values ...interface{}) error {
+	for _, v := range values {
+		if err := check(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func check(v interface{}) (err error) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("selftest: %T is not a pointer to a struct", v)
+	}
+	t = t.Elem()
+	name := t.String()
+	// schemer panics on some types it can't handle
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("selftest: %s: %v", name, r)
+		}
+	}()
+
+	sent := reflect.New(t)
+	fill(sent.Elem(), new(int))
+
+	writerSchema := schemer.SchemaOf(sent.Interface())
+	if writerSchema == nil {
+		return fmt.Errorf("selftest: %s: SchemaOf returned no schema", name)
+	}
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, sent.Interface()); err != nil {
+		return fmt.Errorf("selftest: %s: encode error: %w", name, err)
+	}
+
+	// the schema as the clients get it: binary from most servers, JSON from v1
+	jsonSchema, err := writerSchema.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("selftest: %s: cannot marshal the schema as JSON: %w", name, err)
+	}
+	for _, parse := range []struct {
+		format string
+		schema func() (schemer.Schema, error)
+	}{
+		{"binary", func() (schemer.Schema, error) { return schemer.DecodeSchema(writerSchema.MarshalSchemer()) }},
+		{"JSON", func() (schemer.Schema, error) { return schemer.DecodeSchemaJSON(jsonSchema) }},
+	} {
+		readerSchema, err := parse.schema()
+		if err != nil {
+			return fmt.Errorf("selftest: %s: cannot parse the %s schema: %w", name, parse.format, err)
+		}
+		got := reflect.New(t)
+		r := bytes.NewReader(encodedData.Bytes())
+		if err := readerSchema.Decode(r, got.Interface()); err != nil {
+			return fmt.Errorf("selftest: %s: decode error with the %s schema: %w", name, parse.format, err)
+		}
+		if r.Len() > 0 {
+			return fmt.Errorf("selftest: %s: decoding with the %s schema left %d of %d bytes unread", name, parse.format, r.Len(), encodedData.Len())
+		}
+		if path, sentField, gotField := diff(name, sent.Elem(), got.Elem()); path != "" {
+			return fmt.Errorf("selftest: %s: sent %v, decoded %v (with the %s schema)", path, sentField, gotField, parse.format)
+		}
+	}
+	return nil
+}
+
+// fill sets every field of v, which must be settable, to a value no other field
+// has, counting up from *n, so that a field decoded into the wrong place shows
+func fill(v reflect.Value, n *int) {
+	*n++
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// small enough for an int8, and negative, so a sign that is lost shows
+		v.SetInt(-int64(*n % 100))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(uint64(*n % 200))
+	case reflect.Float32, reflect.Float64:
+		// exact in a float32
+		v.SetFloat(float64(*n) + 0.25)
+	case reflect.String:
+		v.SetString(fmt.Sprintf("value %d", *n))
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), n)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), n)
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key, elem := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(key, n)
+		fill(elem, n)
+		v.SetMapIndex(key, elem)
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem(), n)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fill(v.Field(i), n)
+			}
+		}
+	}
+}
+
+// diff returns the path of the first field in which sent and got differ, and
+// the two values of it; a path of "" if they are equal
+func diff(path string, sent, got reflect.Value) (string, interface{}, interface{}) {
+	if sent.Kind() == reflect.Struct {
+		for i := 0; i < sent.NumField(); i++ {
+			if !sent.Field(i).CanInterface() {
+				continue
+			}
+			if p, s, g := diff(path+"."+sent.Type().Field(i).Name, sent.Field(i), got.Field(i)); p != "" {
+				return p, s, g
+			}
+		}
+		return "", nil, nil
+	}
+	if !reflect.DeepEqual(sent.Interface(), got.Interface()) {
+		return path, sent.Interface(), got.Interface()
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,35 @@
+package selftest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/selftest"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// brokenReading sends both of its fields under the same name, the kind of struct
+// tag mistake the servers' startup self-test is there to catch
+type brokenReading struct {
+	RawReadings      []float64 `schemer:"readings"`
+	FilteredReadings []float64 `schemer:"readings"`
+}
+
+// TestRun runs the self-test on every struct the servers encode, which has to
+// pass, and on brokenReading, which it has to reject by name
+func TestRun(t *testing.T) {
+	if err := selftest.Run(
+		&schemas.V1Reading{}, &schemas.V2Reading{}, &schemas.V3Reading{},
+		&schemas.TemperatureReading{}, &schemas.HumidityReading{}, &schemas.DoorEvents{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	err := selftest.Run(&schemas.V2Reading{}, &brokenReading{})
+	if err == nil {
+		t.Fatalf("the self-test passed a struct with two fields named %q", "readings")
+	}
+	if !strings.Contains(err.Error(), "brokenReading") {
+		t.Errorf("the self-test error doesn't name the broken struct: %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Package serve starts the example servers over plain HTTP or, when asked to by
+// the environment, over HTTPS, on one address or several:
+//
+//	TLS_CERT, TLS_KEY   certificate and key files to serve HTTPS with
+//	TLS_SELF_SIGNED=1   serve HTTPS with a self-signed certificate for localhost,
+//	                    generated at startup and never written to disk
+//	LISTEN              addresses to listen on instead of the server's own, e.g.
+//	                    "tcp::8080,unix:/tmp/schemer.sock"
+//
+// Browsers only allow a page served over HTTPS to fetch from HTTPS servers, so
+// this is what a demo behind a secure context needs. A Unix socket is for a
+// sidecar in the same container or pod, e.g. a metrics scraper, while people
+// keep using TCP; TLS is only ever served on the TCP listeners.
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ListenEnv is the environment variable ListenAndServe takes its addresses from
+const ListenEnv = "LISTEN"
+
+// how long the listeners get to finish the requests in flight when they shut down
+const shutdownTimeout = 5 * time.Second
+
+// Listen is an address to listen on: a network ("tcp", "tcp4", "tcp6" or "unix")
+// and a host:port, or the path of a Unix socket
+type Listen struct {
+	Network, Address string
+}
+
+func (l Listen) String() string {
+	return l.Network + ":" + l.Address
+}
+
+// ParseListen parses a comma-separated list of network:address pairs, such as
+// "tcp::8080,unix:/tmp/schemer.sock"
+func ParseListen(s string) ([]Listen, error) {
+	var listens []Listen
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.Index(spec, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("listen address %q isn't network:address", spec)
+		}
+		l := Listen{spec[:i], spec[i+1:]}
+		switch l.Network {
+		case "tcp", "tcp4", "tcp6", "unix":
+		default:
+			return nil, fmt.Errorf("listen address %q: network %q isn't tcp, tcp4, tcp6 or unix", spec, l.Network)
+		}
+		if l.Address == "" {
+			return nil, fmt.Errorf("listen address %q has no address", spec)
+		}
+		listens = append(listens, l)
+	}
+	if len(listens) == 0 {
+		return nil, errors.New("no listen addresses")
+	}
+	return listens, nil
+}
+
+// Listen starts listening on l. A Unix socket left behind by a server that
+// didn't get to remove it is removed first; one that a server still answers on,
+// or a file that isn't a socket, is left alone and is an error.
+func (l Listen) Listen() (net.Listener, error) {
+	if l.Network == "unix" {
+		if err := removeStaleSocket(l.Address); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(l.Network, l.Address)
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and isn't a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another server", path)
+	}
+	log.Printf("removing stale socket %s", path)
+	return os.Remove(path)
+}
+
+// ListenAndServe runs server until it fails, or until the process is told to
+// stop (SIGINT or SIGTERM), with TLS if the environment asks for it. It listens
+// on server.Addr, or on every address in LISTEN if that is set. It returns nil
+// after shutting down on a signal.
+func ListenAndServe(server *http.Server) error {
+	listens := []Listen{{"tcp", server.Addr}}
+	if s := os.Getenv(ListenEnv); s != "" {
+		var err error
+		if listens, err = ParseListen(s); err != nil {
+			return fmt.Errorf("invalid %s: %w", ListenEnv, err)
+		}
+	}
+
+	var listeners []net.Listener
+	for _, l := range listens {
+		listener, err := l.Listen()
+		if err != nil {
+			closeAll(listeners)
+			return err
+		}
+		listeners = append(listeners, listener)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return Serve(ctx, server, listeners...)
+}
+
+// Serve serves on every one of listeners, each with an http.Server of its own
+// configured like server, until one of them fails or ctx is done. Then it shuts
+// all of them down together, giving requests in flight a few seconds to finish,
+// and removes the Unix sockets. It returns the error the first one failed with,
+// or nil if ctx ended it.
+func Serve(ctx context.Context, server *http.Server, listeners ...net.Listener) error {
+	certFile, keyFile, useTLS, err := configureTLS(server)
+	if err != nil {
+		closeAll(listeners)
+		return err
+	}
+
+	servers := make([]*http.Server, len(listeners))
+	errs := make(chan error, len(listeners))
+	for i, listener := range listeners {
+		s := &http.Server{
+			Addr:              listener.Addr().String(),
+			Handler:           server.Handler,
+			ReadTimeout:       server.ReadTimeout,
+			ReadHeaderTimeout: server.ReadHeaderTimeout,
+			WriteTimeout:      server.WriteTimeout,
+			IdleTimeout:       server.IdleTimeout,
+			MaxHeaderBytes:    server.MaxHeaderBytes,
+			ErrorLog:          server.ErrorLog,
+		}
+		if server.TLSConfig != nil {
+			s.TLSConfig = server.TLSConfig.Clone()
+		}
+		servers[i] = s
+
+		unix := listener.Addr().Network() == "unix"
+		if len(listeners) > 1 {
+			log.Printf("listening on %s:%s", listener.Addr().Network(), listener.Addr())
+		}
+		go func(listener net.Listener) {
+			if useTLS && !unix {
+				errs <- s.ServeTLS(listener, certFile, keyFile)
+			} else {
+				errs <- s.Serve(listener)
+			}
+		}(listener)
+	}
+
+	var failed error
+	select {
+	case failed = <-errs:
+	case <-ctx.Done():
+		log.Println("shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, s := range servers {
+		s.Shutdown(shutdownCtx)
+	}
+	for _, listener := range listeners {
+		if listener.Addr().Network() == "unix" {
+			// a UnixListener removes its socket when it is closed, unless it was
+			// told not to with SetUnlinkOnClose
+			os.Remove(listener.Addr().String())
+		}
+	}
+	return failed
+}
+
+// configureTLS says whether the environment asks for TLS and, if so, with which
+// files; for a self-signed certificate it adds it to server.TLSConfig, and the
+// files are ""
+func configureTLS(server *http.Server) (certFile, keyFile string, useTLS bool, err error) {
+	certFile, keyFile = os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY")
+	selfSigned := os.Getenv("TLS_SELF_SIGNED") == "1"
+
+	switch {
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return "", "", false, errors.New("TLS_CERT and TLS_KEY have to be set together")
+		}
+		log.Printf("serving HTTPS with the certificate in %s", certFile)
+		return certFile, keyFile, true, nil
+
+	case selfSigned:
+		cert, err := SelfSigned("localhost", "127.0.0.1", "::1")
+		if err != nil {
+			return "", "", false, err
+		}
+		if server.TLSConfig == nil {
+			server.TLSConfig = &tls.Config{}
+		}
+		server.TLSConfig.Certificates = []tls.Certificate{cert}
+		log.Println("serving HTTPS with a self-signed certificate for localhost; clients have to skip verification")
+		return "", "", true, nil
+
+	default:
+		return "", "", false, nil
+	}
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
@@ -0,0 +1,216 @@
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseListen(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		want    []Listen
+		wantErr bool
+	}{
+		{in: "tcp::8080", want: []Listen{{"tcp", ":8080"}}},
+		{in: "tcp::8080,unix:/tmp/schemer.sock", want: []Listen{{"tcp", ":8080"}, {"unix", "/tmp/schemer.sock"}}},
+		{in: " tcp4:127.0.0.1:8080 , tcp6:[::1]:8080,", want: []Listen{{"tcp4", "127.0.0.1:8080"}, {"tcp6", "[::1]:8080"}}},
+		{in: "", wantErr: true},
+		{in: ",", wantErr: true},
+		{in: ":8080", wantErr: true},
+		{in: "8080", wantErr: true},
+		{in: "udp::8080", wantErr: true},
+		{in: "unix:", wantErr: true},
+		{in: "tcp::8080,http://localhost", wantErr: true},
+	} {
+		got, err := ParseListen(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%q: error %v", c.in, err)
+			continue
+		}
+		if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+// socketDir returns a directory for Unix sockets, removed at the end of the test.
+// It is made directly in the system's temporary directory, since a socket's path
+// has to be short.
+func socketDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestListenUnix(t *testing.T) {
+	t.Run("stale socket", func(t *testing.T) {
+		path := filepath.Join(socketDir(t), "s.sock")
+		old, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a server that died without cleaning up
+		old.(*net.UnixListener).SetUnlinkOnClose(false)
+		old.Close()
+		if _, err := os.Lstat(path); err != nil {
+			t.Fatalf("no socket left behind: %v", err)
+		}
+
+		l, err := Listen{"unix", path}.Listen()
+		if err != nil {
+			t.Fatalf("the stale socket wasn't replaced: %v", err)
+		}
+		l.Close()
+	})
+
+	t.Run("in use", func(t *testing.T) {
+		path := filepath.Join(socketDir(t), "s.sock")
+		other, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+
+		if l, err := (Listen{"unix", path}).Listen(); err == nil {
+			l.Close()
+			t.Fatal("took over a socket another server is listening on")
+		}
+	})
+
+	t.Run("not a socket", func(t *testing.T) {
+		path := filepath.Join(socketDir(t), "s.sock")
+		if err := ioutil.WriteFile(path, []byte("keep me"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if l, err := (Listen{"unix", path}).Listen(); err == nil {
+			l.Close()
+			t.Fatal("replaced a file that isn't a socket")
+		}
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != "keep me" {
+			t.Errorf("the file was changed: %q (%v)", b, err)
+		}
+	})
+}
+
+// setenv sets the TLS variables to the given values ("" unsets them) until the
+// end of the test
+func setenv(t *testing.T, vars map[string]string) {
+	for name, v := range vars {
+		old, had := os.LookupEnv(name)
+		name := name
+		t.Cleanup(func() {
+			if had {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+		if v == "" {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, v)
+		}
+	}
+}
+
+func TestConfigureTLS(t *testing.T) {
+	for _, c := range []struct {
+		name                  string
+		cert, key, selfSigned string
+		wantTLS, wantSelf     bool
+		wantErr               bool
+	}{
+		{name: "plain HTTP"},
+		{name: "cert and key", cert: "cert.pem", key: "key.pem", wantTLS: true},
+		{name: "cert without key", cert: "cert.pem", wantErr: true},
+		{name: "key without cert", key: "key.pem", wantErr: true},
+		{name: "self-signed", selfSigned: "1", wantTLS: true, wantSelf: true},
+		{name: "files win over self-signed", cert: "cert.pem", key: "key.pem", selfSigned: "1", wantTLS: true},
+		{name: "self-signed not 1", selfSigned: "true"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			setenv(t, map[string]string{"TLS_CERT": c.cert, "TLS_KEY": c.key, "TLS_SELF_SIGNED": c.selfSigned})
+			server := &http.Server{}
+			certFile, keyFile, useTLS, err := configureTLS(server)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if useTLS != c.wantTLS {
+				t.Errorf("TLS is %t, want %t", useTLS, c.wantTLS)
+			}
+			if c.wantTLS && !c.wantSelf && (certFile != c.cert || keyFile != c.key) {
+				t.Errorf("files %q and %q, want %q and %q", certFile, keyFile, c.cert, c.key)
+			}
+			hasCert := server.TLSConfig != nil && len(server.TLSConfig.Certificates) > 0
+			if hasCert != c.wantSelf {
+				t.Errorf("self-signed certificate added: %t, want %t", hasCert, c.wantSelf)
+			}
+		})
+	}
+}
+
+// TestServeSelfSigned serves over TLS_SELF_SIGNED on TCP and, at the same time,
+// plain HTTP on a Unix socket, and checks both answer
+func TestServeSelfSigned(t *testing.T) {
+	setenv(t, map[string]string{"TLS_CERT": "", "TLS_KEY": "", "TLS_SELF_SIGNED": "1"})
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(socketDir(t), "s.sock")
+	unix, err := Listen{"unix", socket}.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("ok"))
+		})}, tcp, unix)
+	}()
+
+	get := func(client *http.Client, url string, wantTLS bool) {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if b, _ := ioutil.ReadAll(resp.Body); string(b) != "ok" || (resp.TLS != nil) != wantTLS {
+			t.Errorf("GET %s: %q, TLS %v", url, b, resp.TLS != nil)
+		}
+	}
+	get(&http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}, "https://"+tcp.Addr().String()+"/", true)
+	get(&http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}, "http://unix/", false)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned %v after ctx ended", err)
+	}
+	if _, err := os.Lstat(socket); !os.IsNotExist(err) {
+		t.Errorf("the socket is still there after shutting down (%v)", err)
+	}
+}
@@ -0,0 +1,53 @@
+package signing
+
+import (
+	"strings"
+	"testing"
+)
+
+var (
+	key     = []byte("not a very secret key")
+	payload = []byte("\x1eFour score and seven years ago\x02\x40\x35\x80")
+)
+
+func TestVerifyHex(t *testing.T) {
+	signature := SignHex(key, payload)
+	if len(signature) != 2*Size {
+		t.Fatalf("signature %q is %d hex digits, want %d", signature, len(signature), 2*Size)
+	}
+	if !VerifyHex(key, payload, signature) {
+		t.Fatal("an untouched payload doesn't verify")
+	}
+
+	for _, c := range []struct {
+		name      string
+		key       []byte
+		signature string
+	}{
+		{"other key", []byte("some other key"), signature},
+		{"missing", key, ""},
+		{"not hex", key, strings.Repeat("zz", Size)},
+		{"short", key, signature[:len(signature)-2]},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if VerifyHex(c.key, payload, c.signature) {
+				t.Errorf("signature %q verified", c.signature)
+			}
+		})
+	}
+}
+
+// TestFlippedByte flips each bit of every byte of a signed payload in turn;
+// none of them may verify
+func TestFlippedByte(t *testing.T) {
+	signature := SignHex(key, payload)
+	for i := range payload {
+		for bit := 0; bit < 8; bit++ {
+			tampered := append([]byte(nil), payload...)
+			tampered[i] ^= 1 << bit
+			if VerifyHex(key, tampered, signature) {
+				t.Errorf("a payload with bit %d of byte %d flipped verified", bit, i)
+			}
+		}
+	}
+}
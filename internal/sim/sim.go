@@ -0,0 +1,107 @@
+// Package sim generates realistic-looking temperature readings for the example
+// servers: a slow sine wave around a baseline, gaussian noise on top of it, and
+// the occasional spike a real sensor produces when something goes wrong.
+package sim
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SeedEnv names the environment variable that fixes the servers' random seed
+const SeedEnv = "RANDOM_SEED"
+
+// Config holds the parameters of a simulated temperature trace
+type Config struct {
+	Baseline         float64 // mean temperature, in degrees Celsius
+	Amplitude        float64 // how far the sine wave swings above and below Baseline
+	Period           int     // number of samples in one full sine cycle
+	Noise            float64 // standard deviation of the gaussian noise
+	SpikeProbability float64 // chance that any one sample is a spike
+	SpikeSize        float64 // how far a spike jumps away from the signal
+}
+
+// DefaultConfig is a room sitting at about 21 degrees
+var DefaultConfig = Config{
+	Baseline:         21,
+	Amplitude:        2,
+	Period:           600,
+	Noise:            0.25,
+	SpikeProbability: 0.01,
+	SpikeSize:        15,
+}
+
+// Generator produces one continuous trace. The same Config and seed always
+// produce the same readings. A Generator is not safe for concurrent use.
+type Generator struct {
+	cfg Config
+	r   *rand.Rand
+	t   int // number of samples produced so far
+}
+
+// New returns a Generator for the trace cfg describes, starting at the beginning
+// of a sine cycle, with its randomness drawn from seed. A Period of zero or less
+// is taken as 1.
+func New(cfg Config, seed int64) *Generator {
+	if cfg.Period <= 0 {
+		cfg.Period = 1
+	}
+	return &Generator{cfg: cfg, r: rand.New(rand.NewSource(seed))}
+}
+
+// Next returns the next n samples of the trace
+func (g *Generator) Next(n int) []float64 {
+	readings := make([]float64, n)
+	for i := range readings {
+		phase := 2 * math.Pi * float64(g.t) / float64(g.cfg.Period)
+		v := g.cfg.Baseline + g.cfg.Amplitude*math.Sin(phase) + g.r.NormFloat64()*g.cfg.Noise
+
+		if g.r.Float64() < g.cfg.SpikeProbability {
+			if g.r.Intn(2) == 0 {
+				v += g.cfg.SpikeSize
+			} else {
+				v -= g.cfg.SpikeSize
+			}
+		}
+
+		readings[i] = v
+		g.t++
+	}
+	return readings
+}
+
+// Frames returns the next n*size samples of the trace as n frames of size
+// samples, the way a capture device hands over one waveform per tick
+func (g *Generator) Frames(n, size int) [][]float64 {
+	frames := make([][]float64, n)
+	for i := range frames {
+		frames[i] = g.Next(size)
+	}
+	return frames
+}
+
+// Intn returns a random number in [0, n), from the same source as the readings,
+// so that a server drawing everything else it randomizes (how many readings a
+// sample has, which header it gets) from its Generator repeats all of it for the
+// same seed
+func (g *Generator) Intn(n int) int {
+	return g.r.Intn(n)
+}
+
+// SeedFromEnv returns the seed in RANDOM_SEED, which makes a server produce the
+// same samples every run, or a seed from the clock if it isn't set
+func SeedFromEnv() (int64, error) {
+	s := os.Getenv(SeedEnv)
+	if s == "" {
+		return time.Now().UnixNano(), nil
+	}
+	seed, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: use an integer", SeedEnv, s)
+	}
+	return seed, nil
+}
@@ -0,0 +1,108 @@
+package sim
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// samples is enough whole sine cycles of DefaultConfig for the sine to average
+// out and the sample mean and variance to settle
+const samples = 100 * 600
+
+func stats(readings []float64) (mean, variance float64) {
+	for _, r := range readings {
+		mean += r
+	}
+	mean /= float64(len(readings))
+	for _, r := range readings {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(readings))
+	return mean, variance
+}
+
+// over whole cycles the sine contributes nothing to the mean and Amplitude²/2 to
+// the variance, the noise Noise², and spikes, both ways equally, SpikeProbability
+// * SpikeSize²
+func expectedVariance(cfg Config) float64 {
+	return cfg.Amplitude*cfg.Amplitude/2 + cfg.Noise*cfg.Noise + cfg.SpikeProbability*cfg.SpikeSize*cfg.SpikeSize
+}
+
+func TestStatistics(t *testing.T) {
+	quiet := DefaultConfig
+	quiet.SpikeProbability = 0
+	flat := DefaultConfig
+	flat.Amplitude, flat.SpikeProbability = 0, 0
+
+	for _, c := range []struct {
+		name string
+		cfg  Config
+		// how far the sample variance may be from expectedVariance, relatively;
+		// rare spikes make it noisier
+		tolerance float64
+	}{
+		{"default", DefaultConfig, 0.15},
+		{"no spikes", quiet, 0.05},
+		{"noise only", flat, 0.05},
+	} {
+		for _, seed := range []int64{1, 2, 3} {
+			mean, variance := stats(New(c.cfg, seed).Next(samples))
+			want := expectedVariance(c.cfg)
+			// the standard error of the mean is well under 0.05 for this many samples
+			if math.Abs(mean-c.cfg.Baseline) > 0.05 {
+				t.Errorf("%s, seed %d: mean %.3f, want %.3f", c.name, seed, mean, c.cfg.Baseline)
+			}
+			if math.Abs(variance-want) > c.tolerance*want {
+				t.Errorf("%s, seed %d: variance %.3f, want %.3f ± %.0f%%", c.name, seed, variance, want, 100*c.tolerance)
+			}
+		}
+	}
+}
+
+// TestBounded checks that every sample but the spikes stays within six standard
+// deviations of noise of the sine wave, and that spikes come at about the
+// configured rate
+func TestBounded(t *testing.T) {
+	cfg := DefaultConfig
+	g := New(cfg, 1)
+	limit := cfg.Amplitude + 6*cfg.Noise
+	spikes := 0
+	for i, r := range g.Next(samples) {
+		phase := 2 * math.Pi * float64(i) / float64(cfg.Period)
+		d := math.Abs(r - cfg.Baseline - cfg.Amplitude*math.Sin(phase))
+		if d > cfg.SpikeSize-6*cfg.Noise {
+			spikes++
+			continue
+		}
+		if math.Abs(r-cfg.Baseline) > limit {
+			t.Fatalf("sample %d is %.2f, more than %.2f from the baseline", i, r, limit)
+		}
+	}
+	want := cfg.SpikeProbability * samples
+	if math.Abs(float64(spikes)-want) > 4*math.Sqrt(want) {
+		t.Errorf("%d spikes in %d samples, want about %.0f", spikes, samples, want)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	a, b := New(DefaultConfig, 42), New(DefaultConfig, 42)
+	// the split into calls doesn't matter, only the seed
+	got := append(a.Next(10), a.Next(90)...)
+	if want := b.Next(100); !reflect.DeepEqual(got, want) {
+		t.Error("two generators with the same seed produced different readings")
+	}
+	if reflect.DeepEqual(New(DefaultConfig, 43).Next(100), New(DefaultConfig, 42).Next(100)) {
+		t.Error("different seeds produced the same readings")
+	}
+}
+
+func TestZeroPeriod(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Period = 0
+	for _, r := range New(cfg, 1).Next(100) {
+		if math.IsNaN(r) || math.IsInf(r, 0) {
+			t.Fatalf("a zero Period produced %v", r)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package sim
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bminer/schemer"
+)
+
+// waveforms is what a client of a capture device receives: one frame of
+// samples per tick
+type waveforms struct {
+	Frames [][]float64
+}
+
+// what a client that only needs float32 precision declares
+type narrowWaveforms struct {
+	Frames [][]float32
+}
+
+func TestFrames(t *testing.T) {
+	frames := New(DefaultConfig, 1).Frames(3, 5)
+	var joined []float64
+	for i, f := range frames {
+		if len(f) != 5 {
+			t.Fatalf("frame %d has %d samples, want 5", i, len(f))
+		}
+		joined = append(joined, f...)
+	}
+	if want := New(DefaultConfig, 1).Next(15); !reflect.DeepEqual(joined, want) {
+		t.Error("the frames aren't the trace Next produces, cut into frames")
+	}
+}
+
+// roundTrip encodes sent with its own schema and decodes it into dest, with the
+// schema as a client would parse it
+func roundTrip(t testing.TB, sent *waveforms, dest interface{}) {
+	t.Helper()
+	writerSchema := schemer.SchemaOf(sent)
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, sent); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := readerSchema.Decode(&encodedData, dest); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+}
+
+// sameFrames compares got with sent, sample by sample, after narrowing sent's
+// samples with narrow
+func sameFrames(t *testing.T, sent, got [][]float64, narrow func(float64) float64) {
+	t.Helper()
+	if len(got) != len(sent) {
+		t.Fatalf("sent %d frames, got %d", len(sent), len(got))
+	}
+	for i := range sent {
+		// a nil frame may come back empty
+		if len(got[i]) != len(sent[i]) {
+			t.Fatalf("frame %d: sent %d samples, got %d", i, len(sent[i]), len(got[i]))
+		}
+		for j := range sent[i] {
+			if want := narrow(sent[i][j]); got[i][j] != want {
+				t.Fatalf("frame %d, sample %d: sent %v, got %v", i, j, want, got[i][j])
+			}
+		}
+	}
+}
+
+// widen copies frames to float64, so both decodes can be compared the same way
+func widen(frames [][]float32) [][]float64 {
+	wide := make([][]float64, len(frames))
+	for i, f := range frames {
+		wide[i] = make([]float64, len(f))
+		for j, v := range f {
+			wide[i][j] = float64(v)
+		}
+	}
+	return wide
+}
+
+// TestWaveformRoundTrip sends [][]float64 frames in the shapes a capture device
+// produces, and checks each comes back with every frame's length and samples
+// intact, decoded into [][]float64 and, narrowed, into [][]float32
+func TestWaveformRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		frames [][]float64
+	}{
+		{"ragged", [][]float64{{0.5, -0.25, 0.125}, {1}, {0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8}}},
+		{"no frames", [][]float64{}},
+		{"empty frames", [][]float64{{}, {0.5}, {}}},
+		{"nil frames", [][]float64{nil, {0.5, 0.25}, nil}},
+		{"large", New(DefaultConfig, 1).Frames(1000, 1024)},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			sent := &waveforms{Frames: c.frames}
+
+			var decoded waveforms
+			roundTrip(t, sent, &decoded)
+			sameFrames(t, c.frames, decoded.Frames, func(v float64) float64 { return v })
+
+			var narrow narrowWaveforms
+			roundTrip(t, sent, &narrow)
+			sameFrames(t, c.frames, widen(narrow.Frames), func(v float64) float64 { return float64(float32(v)) })
+		})
+	}
+}
+
+// benchmarkWaveforms encodes 1000 frames of 1024 samples once, and runs f with
+// the schema and the payload
+func benchmarkWaveforms(b *testing.B, f func(writerSchema, readerSchema schemer.Schema, sent *waveforms, payload []byte)) {
+	sent := &waveforms{Frames: New(DefaultConfig, 1).Frames(1000, 1024)}
+	writerSchema := schemer.SchemaOf(sent)
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		b.Fatal(err)
+	}
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, sent); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(encodedData.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	f(writerSchema, readerSchema, sent, encodedData.Bytes())
+}
+
+func BenchmarkWaveformEncode(b *testing.B) {
+	benchmarkWaveforms(b, func(writerSchema, _ schemer.Schema, sent *waveforms, _ []byte) {
+		var buf bytes.Buffer
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			if err := writerSchema.Encode(&buf, sent); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkWaveformDecode(b *testing.B) {
+	benchmarkWaveforms(b, func(_, readerSchema schemer.Schema, _ *waveforms, payload []byte) {
+		for i := 0; i < b.N; i++ {
+			var decoded waveforms
+			if err := readerSchema.Decode(bytes.NewReader(payload), &decoded); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkWaveformDecodeFloat32(b *testing.B) {
+	benchmarkWaveforms(b, func(_, readerSchema schemer.Schema, _ *waveforms, payload []byte) {
+		for i := 0; i < b.N; i++ {
+			var decoded narrowWaveforms
+			if err := readerSchema.Decode(bytes.NewReader(payload), &decoded); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
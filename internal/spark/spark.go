@@ -0,0 +1,108 @@
+// Package spark draws series of values as bar charts made of Unicode block
+// characters, for the terminal: one column per value, each bar as tall as
+// where its value falls between the smallest and largest values seen so far,
+// to an eighth of a row. It only turns values into rows of runes; putting them
+// on the screen is up to the caller.
+package spark
+
+import "math"
+
+// Blocks are the partial cells a bar is drawn with, from one eighth of a row to
+// a full one
+var Blocks = []rune("▁▂▃▄▅▆▇█")
+
+// Missing marks the bottom of the column of a NaN, which has no height to draw
+const Missing = '·'
+
+// Range is the span of the values seen so far, which a chart is scaled to.
+// Widening it as values come in, rather than fitting every frame to the values
+// on screen, keeps a live chart from jumping around. The zero Range has seen
+// nothing.
+type Range struct {
+	Min, Max float64
+	seen     bool
+}
+
+// Add widens r to take in values. NaN and the infinities are skipped: they have
+// no place on a scale.
+func (r *Range) Add(values ...float64) {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		if !r.seen {
+			r.Min, r.Max, r.seen = v, v, true
+			continue
+		}
+		r.Min = math.Min(r.Min, v)
+		r.Max = math.Max(r.Max, v)
+	}
+}
+
+// Empty reports whether r has taken in no values
+func (r Range) Empty() bool {
+	return !r.seen
+}
+
+// Fraction returns where v falls in r, from 0 at Min to 1 at Max. Values
+// outside r (the infinities included) are clamped to its ends. When everything
+// seen had the same value, it is drawn half way up, as is any value against an
+// empty Range. NaN gives NaN.
+func (r Range) Fraction(v float64) float64 {
+	switch {
+	case math.IsNaN(v):
+		return math.NaN()
+	case !r.seen || r.Max == r.Min:
+		return 0.5
+	}
+	f := (v - r.Min) / (r.Max - r.Min)
+	return math.Max(0, math.Min(1, f))
+}
+
+// Rows draws values as a bar chart height rows tall, scaled to r, and returns
+// the rows top first, each with a rune per value. The bar of r.Min is one eighth
+// of a row tall, so every value shows, and that of r.Max fills the column. A
+// NaN's column is empty but for Missing at the bottom. With no values, the rows
+// are empty. A height under 1 counts as 1.
+func Rows(values []float64, r Range, height int) [][]rune {
+	if height < 1 {
+		height = 1
+	}
+	rows := make([][]rune, height)
+	for i := range rows {
+		rows[i] = make([]rune, len(values))
+	}
+
+	eighths := height * len(Blocks)
+	for col, v := range values {
+		f := r.Fraction(v)
+		if math.IsNaN(f) {
+			for i := range rows {
+				rows[i][col] = ' '
+			}
+			rows[height-1][col] = Missing
+			continue
+		}
+
+		// how many eighths of a row the bar is tall, at least one
+		n := 1 + int(math.Round(f*float64(eighths-1)))
+		for i := range rows {
+			// the eighths of the bar that fall in this row, counting from the bottom
+			level := n - (height-1-i)*len(Blocks)
+			switch {
+			case level <= 0:
+				rows[i][col] = ' '
+			case level >= len(Blocks):
+				rows[i][col] = Blocks[len(Blocks)-1]
+			default:
+				rows[i][col] = Blocks[level-1]
+			}
+		}
+	}
+	return rows
+}
+
+// Line draws values as a one-row sparkline scaled to r
+func Line(values []float64, r Range) string {
+	return string(Rows(values, r, 1)[0])
+}
@@ -0,0 +1,114 @@
+package spark
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func rangeOf(values ...float64) Range {
+	var r Range
+	r.Add(values...)
+	return r
+}
+
+// rows joins a chart's rows with newlines, for comparing and printing
+func rows(values []float64, r Range, height int) string {
+	var lines []string
+	for _, row := range Rows(values, r, height) {
+		lines = append(lines, string(row))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestScaling(t *testing.T) {
+	for _, c := range []struct {
+		values []float64
+		r      Range
+		want   string
+	}{
+		// the smallest value gets the lowest block, the largest the full one
+		{[]float64{0, 1, 2, 3, 4, 5, 6, 7}, rangeOf(0, 7), "▁▂▃▄▅▆▇█"},
+		{[]float64{-7, -6, -5, -4, -3, -2, -1, 0}, rangeOf(-7, 0), "▁▂▃▄▅▆▇█"},
+		// scaled to the range, not to the values drawn
+		{[]float64{5, 6}, rangeOf(0, 7), "▆▇"},
+		// outside the range is clamped to its ends
+		{[]float64{-100, 100}, rangeOf(0, 7), "▁█"},
+		// one value seen: half way up
+		{[]float64{21, 21}, rangeOf(21), "▅▅"},
+	} {
+		if got := Line(c.values, c.r); got != c.want {
+			t.Fatalf("%v against [%g, %g]: %q, expected %q", c.values, c.r.Min, c.r.Max, got, c.want)
+		}
+	}
+
+	r := rangeOf(3)
+	r.Add(1, 2)
+	r.Add(10)
+	if r.Min != 1 || r.Max != 10 {
+		t.Fatalf("range [%g, %g] after 3, then 1 and 2, then 10", r.Min, r.Max)
+	}
+}
+
+func TestHeight(t *testing.T) {
+	// 16 eighths in two rows: the bottom row fills before the top one starts
+	values := []float64{0, 7, 8, 15}
+	want := "  ▁█\n▁███"
+	if got := rows(values, rangeOf(0, 15), 2); got != want {
+		t.Fatalf("got\n%s\nexpected\n%s", got, want)
+	}
+	// every row has a rune per value, however tall the chart
+	for _, row := range Rows(values, rangeOf(0, 15), 5) {
+		if len(row) != len(values) {
+			t.Fatalf("a row of %d runes for %d values", len(row), len(values))
+		}
+	}
+	if got := len(Rows(values, rangeOf(0, 15), 0)); got != 1 {
+		t.Fatalf("height 0 gave %d rows, expected 1", got)
+	}
+}
+
+func TestNaN(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+
+	r := rangeOf(nan, 2, inf, 4, -inf)
+	if r.Min != 2 || r.Max != 4 {
+		t.Fatalf("range [%g, %g] of NaN, 2, +Inf, 4, -Inf; expected [2, 4]", r.Min, r.Max)
+	}
+
+	want := " █\n" + string(Missing) + "█"
+	if got := rows([]float64{nan, 4}, r, 2); got != want {
+		t.Fatalf("NaN, 4: got\n%s\nexpected\n%s", got, want)
+	}
+	if got, want := Line([]float64{inf, -inf}, r), "█▁"; got != want {
+		t.Fatalf("+Inf, -Inf: %q, expected %q", got, want)
+	}
+
+	// nothing but NaN: nothing to scale to, and nothing drawn but the markers
+	r = rangeOf(nan, nan)
+	if !r.Empty() {
+		t.Fatalf("a range of NaNs isn't empty: [%g, %g]", r.Min, r.Max)
+	}
+	if got, want := Line([]float64{nan, nan}, r), strings.Repeat(string(Missing), 2); got != want {
+		t.Fatalf("NaN, NaN: %q, expected %q", got, want)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	var r Range
+	if !r.Empty() {
+		t.Fatalf("the zero Range isn't empty")
+	}
+	for _, values := range [][]float64{nil, {}} {
+		got := Rows(values, r, 3)
+		if !reflect.DeepEqual(got, [][]rune{{}, {}, {}}) {
+			t.Fatalf("%#v: %q, expected three empty rows", values, got)
+		}
+	}
+	// a value against an empty Range still shows
+	if got, want := Line([]float64{21}, r), "▅"; got != want {
+		t.Fatalf("21 against an empty range: %q, expected %q", got, want)
+	}
+
+}
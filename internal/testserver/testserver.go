@@ -0,0 +1,218 @@
+// Package testserver holds what the tests of the example servers and clients
+// share: Upstream, a stand-in for an example server that serves whatever value
+// it was last given, Deltas, one that serves a delta.History, and Get, for
+// requesting an endpoint and looking at the raw response.
+package testserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/delta"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/signing"
+	"github.com/bminer/schemer"
+)
+
+// the paths the example servers serve their schema and data at (see
+// schemerclient.SchemaPath and DataPath)
+const (
+	SchemaPath = "/get-schema/"
+	DataPath   = "/get-data/"
+)
+
+// Upstream serves a value at DataPath, and its own binary schema at SchemaPath,
+// the way the v2 server does. It counts the requests for each, and can be told
+// to fail or stall the data requests, or to sign the data and then tamper with
+// it.
+type Upstream struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	binarySchema   []byte
+	data           []byte
+	failures       int // how many more data requests to answer with failCode
+	failCode       int
+	stall          time.Duration
+	signingKey     []byte // see Sign; nil for none
+	tamper         bool
+	schemaRequests int
+	dataRequests   int
+}
+
+// New starts an Upstream serving v, which is closed when the test ends
+func New(t testing.TB, v interface{}) *Upstream {
+	t.Helper()
+	u := &Upstream{}
+	u.Set(t, v)
+	u.Server = httptest.NewServer(u)
+	t.Cleanup(u.Close)
+	return u
+}
+
+// Set makes u serve v, with v's own schema, from the next request on
+func (u *Upstream) Set(t testing.TB, v interface{}) {
+	t.Helper()
+	schema := schemer.SchemaOf(v)
+	var encodedData bytes.Buffer
+	if err := schema.Encode(&encodedData, v); err != nil {
+		t.Fatalf("testserver: encoding %T: %v", v, err)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.binarySchema = schema.MarshalSchemer()
+	u.data = encodedData.Bytes()
+}
+
+// Fail makes u answer the next n data requests with code
+func (u *Upstream) Fail(n, code int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failures, u.failCode = n, code
+}
+
+// Stall makes u wait d, or until the client gives up, before answering each
+// data request
+func (u *Upstream) Stall(d time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.stall = d
+}
+
+// Sign makes u send every data response with its signing.Header signature,
+// made with key
+func (u *Upstream) Sign(key []byte) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.signingKey = key
+}
+
+// Tamper makes u flip one byte of every data response after signing it, as an
+// attacker (or a faulty proxy) might
+func (u *Upstream) Tamper() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.tamper = true
+}
+
+// Requests returns how many schema and data requests u has had
+func (u *Upstream) Requests() (schema, data int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.schemaRequests, u.dataRequests
+}
+
+func (u *Upstream) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	u.mu.Lock()
+	switch req.URL.Path {
+	case SchemaPath:
+		u.schemaRequests++
+		body := u.binarySchema
+		u.mu.Unlock()
+		w.Write(body)
+
+	case DataPath:
+		u.dataRequests++
+		body, stall, code := u.data, u.stall, 0
+		if u.failures > 0 {
+			u.failures--
+			code = u.failCode
+		}
+		signature := ""
+		if u.signingKey != nil {
+			signature = signing.SignHex(u.signingKey, body)
+		}
+		if u.tamper && len(body) > 0 {
+			body = append([]byte(nil), body...)
+			body[len(body)/2] ^= 0x01
+		}
+		u.mu.Unlock()
+
+		if stall > 0 {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(stall):
+			}
+		}
+		if code != 0 {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		if signature != "" {
+			w.Header().Set(signing.Header, signature)
+		}
+		w.Write(body)
+
+	default:
+		u.mu.Unlock()
+		http.NotFound(w, req)
+	}
+}
+
+// Deltas serves a delta.History the way examples/delta's server does, and counts
+// the snapshot and delta requests
+type Deltas struct {
+	*httptest.Server
+	*delta.History
+
+	mu               sync.Mutex
+	snapshotRequests int
+	deltaRequests    int
+}
+
+// NewDeltas starts a Deltas over readings readings, all 0, keeping the last size
+// snapshots. It is closed when the test ends.
+func NewDeltas(t testing.TB, size, readings int) *Deltas {
+	t.Helper()
+	d := &Deltas{History: delta.NewHistory(size, make([]float64, readings))}
+	handler := d.History.Handler()
+	d.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		d.mu.Lock()
+		switch req.URL.Path {
+		case delta.SnapshotPath:
+			d.snapshotRequests++
+		case delta.DeltaPath:
+			d.deltaRequests++
+		}
+		d.mu.Unlock()
+		handler.ServeHTTP(w, req)
+	}))
+	t.Cleanup(d.Close)
+	return d
+}
+
+// Requests returns how many snapshot and delta requests d has had
+func (d *Deltas) Requests() (snapshots, deltas int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.snapshotRequests, d.deltaRequests
+}
+
+// Get requests url with the extra request headers in header, and returns the
+// response's status, headers and body. A request that gets no response at all
+// fails the test.
+func Get(t testing.TB, url string, header http.Header) (int, http.Header, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET %s: reading the body: %v", url, err)
+	}
+	return resp.StatusCode, resp.Header, body
+}
@@ -0,0 +1,62 @@
+package schemas_test
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+// The expected encoding of schemas.ByteOrderProbeValue, as written by the schemer
+// version in go.mod. They are literals rather than something computed here so
+// that the test decodes bytes another machine wrote: cross-compile it for a
+// big-endian target (GOARCH=mips, say) and run it there, and a format that
+// stored numbers in the writer's native order would decode them byte-swapped.
+//
+// They are the endianness files TestGolden writes with -update; paste those in
+// whenever they are regenerated.
+var (
+	byteOrderSchema  = []byte{}
+	byteOrderPayload = []byte{}
+)
+
+// layout reports how the bytes of the probe's U64 appear in payload
+func layout(payload []byte) string {
+	bigEndian := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	littleEndian := []byte{8, 7, 6, 5, 4, 3, 2, 1}
+	switch {
+	case bytes.Contains(payload, littleEndian):
+		return "fixed-width little-endian"
+	case bytes.Contains(payload, bigEndian):
+		return "fixed-width big-endian"
+	default:
+		return "not stored as 8 plain bytes (a variable-length encoding)"
+	}
+}
+
+func TestByteOrder(t *testing.T) {
+	if len(byteOrderSchema) == 0 || len(byteOrderPayload) == 0 {
+		t.Fatal("the expected bytes are missing: copy testdata/golden/endianness.schema.golden and " +
+			"endianness.payload.golden, written by TestGolden -update, into byteOrderSchema and byteOrderPayload")
+	}
+
+	readerSchema, err := schemer.DecodeSchema(byteOrderSchema)
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+	var decoded schemas.ByteOrderProbe
+	if err := readerSchema.Decode(bytes.NewReader(byteOrderPayload), &decoded); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	t.Logf("decoded %d bytes on %s; the payload stores U64 %s", len(byteOrderPayload), runtime.GOARCH, layout(byteOrderPayload))
+
+	got, want := reflect.ValueOf(decoded), reflect.ValueOf(schemas.ByteOrderProbeValue())
+	for i := 0; i < got.NumField(); i++ {
+		if !reflect.DeepEqual(got.Field(i).Interface(), want.Field(i).Interface()) {
+			t.Errorf("%s: got %#v, want %#v", got.Type().Field(i).Name, got.Field(i).Interface(), want.Field(i).Interface())
+		}
+	}
+}
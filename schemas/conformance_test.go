@@ -0,0 +1,140 @@
+package schemas_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bminer/schemer"
+)
+
+// The conformance table encodes values with one struct type and decodes them
+// into another, for each writer/reader pairing the examples talk about in
+// comments. Each pairing either decodes to exactly the expected value or fails
+// with an error; the test fails if schemer's behavior ever differs from the
+// table.
+
+type float64Writer struct{ Value float64 }
+type float32Reader struct{ Value float32 }
+
+type int32Writer struct{ Value int32 }
+type int8Reader struct{ Value int8 }
+
+type stringReader struct{ Value string }
+
+type oneField struct{ A int64 }
+type twoFields struct {
+	A int64
+	B string
+}
+
+// renamed in Go, but the tag keeps the old name on the wire (what v2 does)
+type taggedWriter struct {
+	FilteredReadings []float64 `schemer:"readings"`
+}
+type plainReader struct {
+	Readings []float64
+}
+
+// renamed without a tag: the names no longer match
+type temperatureWriter struct{ Temp float64 }
+type temperatureReader struct{ Temperature float64 }
+
+type conformanceCase struct {
+	name    string
+	writer  interface{} // value to encode
+	reader  interface{} // pointer to a zero value of the reader type
+	want    interface{} // expected decoded value; nil if an error is expected
+	comment string
+}
+
+var cases = []conformanceCase{
+	{
+		name:    "float64 -> float32",
+		writer:  float64Writer{Value: 1.5},
+		reader:  &float32Reader{},
+		want:    float32Reader{Value: 1.5},
+		comment: "floats are narrowed, like v2 readings decoded by a v1 client",
+	},
+	{
+		name:   "int32 -> int8, value fits",
+		writer: int32Writer{Value: 100},
+		reader: &int8Reader{},
+		want:   int8Reader{Value: 100},
+	},
+	{
+		name:    "int32 -> int8, value overflows",
+		writer:  int32Writer{Value: 1000},
+		reader:  &int8Reader{},
+		comment: "an integer that doesn't fit is an error, not a silent truncation",
+	},
+	{
+		name:    "float64 -> string",
+		writer:  float64Writer{Value: 1.5},
+		reader:  &stringReader{},
+		comment: "numbers are never coerced into strings",
+	},
+	{
+		name:    "added field",
+		writer:  oneField{A: 7},
+		reader:  &twoFields{},
+		want:    twoFields{A: 7},
+		comment: "a reader field the writer doesn't send keeps its zero value",
+	},
+	{
+		name:    "dropped field",
+		writer:  twoFields{A: 7, B: "ignored"},
+		reader:  &oneField{},
+		want:    oneField{A: 7},
+		comment: "a writer field the reader doesn't declare is skipped",
+	},
+	{
+		name:    "renamed field, name kept with a tag",
+		writer:  taggedWriter{FilteredReadings: []float64{1, 2, 3}},
+		reader:  &plainReader{},
+		want:    plainReader{Readings: []float64{1, 2, 3}},
+		comment: "fields match on the wire name (case-insensitively), not the Go name",
+	},
+	{
+		name:    "renamed field, no tag",
+		writer:  temperatureWriter{Temp: 21.5},
+		reader:  &temperatureReader{},
+		want:    temperatureReader{},
+		comment: "with different names the data is simply lost",
+	},
+}
+
+// decode encodes c.writer with its schema, then decodes it into c.reader using
+// the writer schema parsed back out of its binary form, as a client would
+func decode(c conformanceCase) error {
+	writerSchema := schemer.SchemaOf(c.writer)
+
+	var encoded bytes.Buffer
+	if err := writerSchema.Encode(&encoded, c.writer); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	parsed, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		return fmt.Errorf("decode schema: %w", err)
+	}
+	return parsed.Decode(&encoded, c.reader)
+}
+
+func TestConformance(t *testing.T) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := decode(c)
+			got := reflect.ValueOf(c.reader).Elem().Interface()
+			switch {
+			case c.want == nil && err == nil:
+				t.Errorf("expected an error (%s), but decoded %+v", c.comment, got)
+			case c.want != nil && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case c.want != nil && !reflect.DeepEqual(got, c.want):
+				t.Errorf("decoded %+v, want %+v (%s)", got, c.want, c.comment)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package schemas_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bminer/schemer"
+)
+
+// What schemer does with an embedded (anonymous) struct field. Go promotes its
+// fields, and encoding/json flattens them into the object; these tests expect
+// schemer to see one field named after the type (Metadata) holding a nested
+// object, exactly as if the struct had said `Metadata Metadata`. If so,
+// embedding is safe on the wire as long as the embedded type keeps its name, or
+// the field that replaces it takes that name.
+//
+// The expectations were written against a local stand-in for schemer, not the
+// release go.mod pins, so they are unverified until these tests have passed
+// against that release. If one fails there, schemer behaves differently: fix
+// the expectation and this comment, not schemer's output.
+
+// Metadata says which sensor took a reading, and where
+type Metadata struct {
+	ID       string
+	Location string
+}
+
+// what a server embedding Metadata sends
+type embeddedReading struct {
+	Metadata
+	Values []float64
+}
+
+// the same, spelled without embedding
+type namedReading struct {
+	Metadata Metadata
+	Values   []float64
+}
+
+// a client that declares the promoted fields as its own, the way the JSON looks
+type flatReading struct {
+	ID       string
+	Location string
+	Values   []float64
+}
+
+// a server that un-embeds Metadata under another name
+type renamedReading struct {
+	Meta   Metadata
+	Values []float64
+}
+
+var embeddedSent = embeddedReading{
+	Metadata: Metadata{ID: "sensor-7", Location: "boiler room"},
+	Values:   []float64{20.5, 21.25},
+}
+
+// wireFormat returns the binary schema of src and src encoded with it
+func wireFormat(t *testing.T, src interface{}) ([]byte, []byte) {
+	t.Helper()
+	writerSchema := schemer.SchemaOf(src)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, src); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	return writerSchema.MarshalSchemer(), encodedData.Bytes()
+}
+
+// TestEmbeddedSchema checks the top-level fields are Metadata and Values, with ID
+// and Location only inside Metadata
+func TestEmbeddedSchema(t *testing.T) {
+	schemaJSON, err := schemer.SchemaOf(&embeddedSent).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal(schemaJSON, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range parsed.Fields {
+		names = append(names, f.Name)
+	}
+	if want := []string{"Metadata", "Values"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("top-level fields %q, want %q; the schema is %s", names, want, schemaJSON)
+	}
+}
+
+// TestEmbeddedNamed checks a client declaring `Metadata Metadata` decodes
+// everything, and that the schema and payload are byte for byte those of the
+// embedded version
+func TestEmbeddedNamed(t *testing.T) {
+	var decoded namedReading
+	if err := roundTrip(&embeddedSent, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Metadata != embeddedSent.Metadata || !reflect.DeepEqual(decoded.Values, embeddedSent.Values) {
+		t.Errorf("sent %+v, got %+v", embeddedSent, decoded)
+	}
+
+	embeddedSchema, embeddedPayload := wireFormat(t, &embeddedSent)
+	namedSchema, namedPayload := wireFormat(t, &namedReading{Metadata: embeddedSent.Metadata, Values: embeddedSent.Values})
+	if !bytes.Equal(embeddedSchema, namedSchema) || !bytes.Equal(embeddedPayload, namedPayload) {
+		t.Errorf("embedded and named differ on the wire: schemas of %d and %d bytes, payloads of %d and %d",
+			len(embeddedSchema), len(namedSchema), len(embeddedPayload), len(namedPayload))
+	}
+}
+
+// TestEmbeddedFlat checks a client declaring ID and Location at the top level
+// gets neither (they keep the client's values), while Values still decodes
+func TestEmbeddedFlat(t *testing.T) {
+	decoded := flatReading{ID: "client default", Location: "client default"}
+	if err := roundTrip(&embeddedSent, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != "client default" || decoded.Location != "client default" {
+		t.Errorf("ID and Location were promoted after all: got %+v", decoded)
+	}
+	if !reflect.DeepEqual(decoded.Values, embeddedSent.Values) {
+		t.Errorf("Values: sent %v, got %v", embeddedSent.Values, decoded.Values)
+	}
+}
+
+// TestUnembedded checks what happens when a v2 server stops embedding Metadata.
+// Under the same name it stays compatible with v1 clients both ways; renamed to
+// Meta it is a different field, and v1 clients lose the metadata without an
+// error.
+func TestUnembedded(t *testing.T) {
+	clientDefault := Metadata{ID: "client default"}
+
+	t.Run("same name", func(t *testing.T) {
+		v2 := namedReading{Metadata: Metadata{ID: "sensor-8", Location: "roof"}, Values: []float64{-3.5}}
+		var v1Client embeddedReading
+		if err := roundTrip(&v2, &v1Client); err != nil {
+			t.Fatal(err)
+		}
+		if v1Client.Metadata != v2.Metadata || !reflect.DeepEqual(v1Client.Values, v2.Values) {
+			t.Errorf("v2 server, v1 client: sent %+v, got %+v", v2, v1Client)
+		}
+
+		var v2Client namedReading
+		if err := roundTrip(&embeddedSent, &v2Client); err != nil {
+			t.Fatal(err)
+		}
+		if v2Client.Metadata != embeddedSent.Metadata {
+			t.Errorf("v1 server, v2 client: sent %+v, got %+v", embeddedSent, v2Client)
+		}
+	})
+
+	t.Run("renamed", func(t *testing.T) {
+		v2 := renamedReading{Meta: Metadata{ID: "sensor-8", Location: "roof"}, Values: []float64{-3.5}}
+		v1Client := embeddedReading{Metadata: clientDefault}
+		if err := roundTrip(&v2, &v1Client); err != nil {
+			t.Fatalf("v2 server, v1 client: %v", err)
+		}
+		if v1Client.Metadata != clientDefault {
+			t.Errorf("v2 server, v1 client: Meta was decoded into Metadata: %+v", v1Client.Metadata)
+		}
+		if !reflect.DeepEqual(v1Client.Values, v2.Values) {
+			t.Errorf("v2 server, v1 client: Values: sent %v, got %v", v2.Values, v1Client.Values)
+		}
+
+		v2Client := renamedReading{Meta: clientDefault}
+		if err := roundTrip(&embeddedSent, &v2Client); err != nil {
+			t.Fatalf("v1 server, v2 client: %v", err)
+		}
+		if v2Client.Meta != clientDefault {
+			t.Errorf("v1 server, v2 client: Metadata was decoded into Meta: %+v", v2Client.Meta)
+		}
+	})
+}
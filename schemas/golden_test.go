@@ -0,0 +1,169 @@
+package schemas_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/fieldsize"
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+// update regenerates the golden files (see TestGolden)
+var update = flag.Bool("update", false, "regenerate the golden files in testdata instead of comparing against them")
+
+// the seed used to generate the payloads; changing it changes every golden file
+const goldenSeed = 1
+
+type goldenCase struct {
+	name  string
+	value interface{}
+}
+
+func goldenCases() []goldenCase {
+	generator := sim.New(sim.DefaultConfig, goldenSeed)
+
+	v1 := schemas.V1Reading{Readings: make([]float32, 8)}
+	for i, reading := range generator.Next(8) {
+		v1.Readings[i] = float32(reading)
+	}
+
+	v2 := schemas.V2Reading{Header: "Four score and seven years ago"}
+	v2.RawReadings = generator.Next(8)
+	v2.FilteredReadings = make([]float64, 8)
+	var workingAverage float64
+	for i := range v2.RawReadings {
+		workingAverage = (v2.RawReadings[i] * 0.5) + (workingAverage * 0.5)
+		v2.FilteredReadings[i] = workingAverage
+	}
+
+	// every byte value once, so a change in how []byte is framed shows up
+	snapshot := schemas.CameraSnapshot{Camera: "camera-1", TakenAtUnixMs: 1600000000000, Snapshot: make([]byte, 256)}
+	for i := range snapshot.Snapshot {
+		snapshot.Snapshot[i] = byte(i)
+	}
+
+	probe := schemas.ByteOrderProbeValue()
+
+	return []goldenCase{
+		{name: "v1", value: &v1},
+		{name: "v2", value: &v2},
+		{name: "snapshot", value: &snapshot},
+		{name: "endianness", value: &probe},
+	}
+}
+
+// fieldAt returns the name of the top-level field of v whose encoding holds byte
+// offset, or "" if v isn't a struct (see package fieldsize)
+func fieldAt(v interface{}, offset int) (string, error) {
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() != reflect.Struct {
+		return "", nil
+	}
+	fields, _, err := fieldsize.Sizes(schemer.SchemaOf(v), v)
+	if err != nil {
+		return "", err
+	}
+	end := 0
+	for _, f := range fields {
+		end += f.Bytes
+		if offset < end {
+			return f.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// firstDiff returns the offset of the first byte that differs between a and b, or
+// -1 if they are identical
+func firstDiff(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+	return -1
+}
+
+// hexWindow returns the few bytes of b on either side of offset
+func hexWindow(b []byte, offset int) []byte {
+	start := offset - 8
+	if start < 0 {
+		start = 0
+	}
+	end := offset + 8
+	if end > len(b) {
+		end = len(b)
+	}
+	return b[start:end]
+}
+
+// TestGolden checks the binary schemas and encoded payloads of the example
+// structs against the golden files in testdata. It is the test to run after
+// upgrading the schemer dependency: a change in the wire format that would break
+// already-deployed clients fails it, naming the field the first differing byte
+// falls in. To regenerate the files on purpose, against the schemer version in
+// go.mod:
+//
+//	go test ./schemas -run TestGolden -update
+func TestGolden(t *testing.T) {
+	dir := filepath.Join("testdata", "golden")
+	for _, c := range goldenCases() {
+		schema := schemer.SchemaOf(c.value)
+		var payload bytes.Buffer
+		if err := schema.Encode(&payload, c.value); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		for _, f := range []struct {
+			name  string
+			data  []byte
+			value interface{} // names the field at a differing offset
+		}{
+			{c.name + ".schema.golden", schema.MarshalSchemer(), nil},
+			{c.name + ".payload.golden", payload.Bytes(), c.value},
+		} {
+			t.Run(f.name, func(t *testing.T) {
+				path := filepath.Join(dir, f.name)
+				if *update {
+					if err := os.MkdirAll(dir, 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := ioutil.WriteFile(path, f.data, 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				want, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatalf("%v (generate the golden files with -update, against the schemer version in go.mod)", err)
+				}
+				offset := firstDiff(want, f.data)
+				if offset < 0 {
+					return
+				}
+				field := ""
+				if f.value != nil {
+					if field, err = fieldAt(f.value, offset); err != nil {
+						t.Errorf("can't tell which field byte %d is in: %v", offset, err)
+					}
+				}
+				t.Errorf("the wire format changed: the golden file is %d bytes and the encoding %d, first differing at byte %d (field %q)\n"+
+					"  golden:  % x\n  current: % x\nif this is intentional, rerun with -update",
+					len(want), len(f.data), offset, field, hexWindow(want, offset), hexWindow(f.data, offset))
+			})
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package schemas_test
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+// the most bytes, over the string's own, that encoding a string may add: room
+// for a length prefix of up to 64 bits as a varint
+const maxStringOverhead = 10
+
+// the allocation a v1 decode may make beyond twice the header size
+const allocSlack = 64 << 10
+
+var headerCases = []struct {
+	name   string
+	header string
+}{
+	{"ascii", "Four score and seven years ago"},
+	{"multibyte", "Temperatur über 30 °C — 温度计 𝄞 𐍈"},
+	// combining accents, which must not be normalized into precomposed characters
+	{"combining", "é ǟ ñộ"},
+	// including ZWJ sequences and skin tone modifiers
+	{"emoji", "🌡️ 🔥 👩‍🔬 👍🏽 🏳️‍🌈"},
+	// zero bytes, which must not end the string early
+	{"NULs", "\x00before\x00\x00after\x00"},
+	{"1 MB", strings.Repeat("abcdefgh", 1<<17)},
+	{"8 MB", strings.Repeat("°C 温度 ", 8<<20/len("°C 温度 "))},
+}
+
+func headerSample(header string) *schemas.V2Reading {
+	return &schemas.V2Reading{
+		Header:           header,
+		RawReadings:      []float64{20.5, 21.25},
+		FilteredReadings: []float64{20.5, 21},
+		Sequence:         7,
+	}
+}
+
+func encodeV2(t *testing.T, v *schemas.V2Reading) []byte {
+	t.Helper()
+	var encodedData bytes.Buffer
+	if err := schemas.V2WriterSchema().Encode(&encodedData, v); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	return encodedData.Bytes()
+}
+
+func v2ReaderSchema(t *testing.T) schemer.Schema {
+	t.Helper()
+	readerSchema, err := schemer.DecodeSchema(schemas.V2WriterSchema().MarshalSchemer())
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+	return readerSchema
+}
+
+// TestHeaderStrings puts strings in V2Reading.Header that the v2 server's short
+// ASCII header never exercises, and checks each round-trips byte for byte. The
+// payload may be no more than maxStringOverhead bytes longer than the header
+// itself plus the same payload with an empty header, so a schemer upgrade that
+// changes how strings are framed shows up here.
+func TestHeaderStrings(t *testing.T) {
+	readerSchema := v2ReaderSchema(t)
+	baseline := len(encodeV2(t, headerSample("")))
+
+	for _, c := range headerCases {
+		t.Run(c.name, func(t *testing.T) {
+			sent := headerSample(c.header)
+			payload := encodeV2(t, sent)
+
+			var decoded schemas.V2Reading
+			if err := readerSchema.Decode(bytes.NewReader(payload), &decoded); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if decoded.Header != c.header {
+				t.Fatalf("sent a %d byte header, got back a different %d byte one", len(c.header), len(decoded.Header))
+			}
+			if decoded.Sequence != sent.Sequence || len(decoded.FilteredReadings) != len(sent.FilteredReadings) {
+				t.Errorf("the fields after Header didn't survive: %+v", decoded)
+			}
+
+			if overhead := len(payload) - baseline - len(c.header); overhead < 0 || overhead > maxStringOverhead {
+				t.Errorf("a %d byte header made the payload %d bytes longer, want %d to %d more",
+					len(c.header), len(payload)-baseline, len(c.header), len(c.header)+maxStringOverhead)
+			}
+		})
+	}
+}
+
+// TestHeaderSkipped decodes each header's payload into a V1Reading, which has no
+// Header field and has to skip over it. That must work for any header, and must
+// not allocate more than twice the header's size (plus a little), so a v1 client
+// can't be made to use far more memory than the payload it was sent.
+func TestHeaderSkipped(t *testing.T) {
+	readerSchema := v2ReaderSchema(t)
+
+	for _, c := range headerCases {
+		t.Run(c.name, func(t *testing.T) {
+			sent := headerSample(c.header)
+			payload := encodeV2(t, sent)
+
+			var v1 schemas.V1Reading
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			err := readerSchema.Decode(bytes.NewReader(payload), &v1)
+			runtime.ReadMemStats(&after)
+
+			if err != nil {
+				t.Fatalf("a v1 client can't skip the header: %v", err)
+			}
+			if len(v1.Readings) != len(sent.FilteredReadings) {
+				t.Errorf("the v1 client got %d readings, want %d", len(v1.Readings), len(sent.FilteredReadings))
+			}
+			if used, limit := after.TotalAlloc-before.TotalAlloc, 2*uint64(len(c.header))+allocSlack; used > limit {
+				t.Errorf("the v1 client allocated %d bytes skipping a %d byte header", used, len(c.header))
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package schemas_test
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+// The round-trip properties feed randomly generated values of the example
+// structs through schemer and check that they come back out unchanged. They cover
+// the edge cases the servers never produce: nil and empty slices, empty and very
+// long headers, NaN, infinities and negative zero. They also check the
+// cross-version direction (v2 writer, v1 reader), where the v1 readings must be
+// the v2 filtered readings narrowed to float32.
+//
+// When a property fails, the failing value is shrunk to a minimal one and printed
+// as a Go literal so it can be pasted into a fixed regression case.
+
+// genV1 and genV2 exist only so that quick can generate the shared structs;
+// methods can't be added to types from another package
+type genV1 schemas.V1Reading
+type genV2 schemas.V2Reading
+
+// values the servers never produce but a real sensor might
+var specialFloats = []float64{
+	0, math.Copysign(0, -1), -1, math.NaN(), math.Inf(1), math.Inf(-1),
+	math.SmallestNonzeroFloat32, math.MaxFloat32, -math.MaxFloat32,
+}
+
+func genFloats(r *rand.Rand) []float64 {
+	switch r.Intn(4) {
+	case 0:
+		return nil
+	case 1:
+		return []float64{}
+	}
+	f := make([]float64, r.Intn(20))
+	for i := range f {
+		if r.Intn(4) == 0 {
+			f[i] = specialFloats[r.Intn(len(specialFloats))]
+		} else {
+			f[i] = (r.Float64() - 0.5) * 20000000
+		}
+	}
+	return f
+}
+
+func genHeader(r *rand.Rand) string {
+	switch r.Intn(4) {
+	case 0:
+		return ""
+	case 1:
+		return strings.Repeat("Four score and seven years ago ", 1+r.Intn(4000))
+	}
+	b := make([]rune, r.Intn(40))
+	for i := range b {
+		b[i] = rune(' ' + r.Intn(0x3000))
+	}
+	return string(b)
+}
+
+// Generate implements quick.Generator
+func (genV1) Generate(r *rand.Rand, size int) reflect.Value {
+	v := genV1{}
+	if f := genFloats(r); f != nil {
+		v.Readings = make([]float32, len(f))
+		for i := range f {
+			v.Readings[i] = float32(f[i])
+		}
+	}
+	return reflect.ValueOf(v)
+}
+
+// Generate implements quick.Generator
+func (genV2) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(genV2{
+		Header:            genHeader(r),
+		RawReadings:       genFloats(r),
+		FilteredReadings:  genFloats(r),
+		Sequence:          r.Uint64(),
+		GeneratedAtUnixMs: r.Int63() - r.Int63(),
+	})
+}
+
+// roundTrip encodes src with its own schema, sends the schema through its binary
+// form like the servers do, and decodes the payload into dest
+func roundTrip(src, dest interface{}) error {
+	writerSchema := schemer.SchemaOf(src)
+
+	var encoded bytes.Buffer
+	if err := writerSchema.Encode(&encoded, src); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		return fmt.Errorf("decode schema: %w", err)
+	}
+	if err := readerSchema.Decode(&encoded, dest); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	return nil
+}
+
+// sameFloat compares bit-for-bit, except that any NaN equals any other NaN
+func sameFloat(a, b float64) bool {
+	if math.IsNaN(a) && math.IsNaN(b) {
+		return true
+	}
+	return math.Float64bits(a) == math.Float64bits(b)
+}
+
+// nil and empty slices are interchangeable on the wire, so only lengths matter
+func checkFloats(field string, want, got []float64) error {
+	if len(want) != len(got) {
+		return fmt.Errorf("%s: length %d, want %d", field, len(got), len(want))
+	}
+	for i := range want {
+		if !sameFloat(want[i], got[i]) {
+			return fmt.Errorf("%s[%d]: got %v, want %v", field, i, got[i], want[i])
+		}
+	}
+	return nil
+}
+
+func widen(f []float32) []float64 {
+	out := make([]float64, len(f))
+	for i := range f {
+		out[i] = float64(f[i])
+	}
+	return out
+}
+
+func narrow(f []float64) []float64 {
+	out := make([]float64, len(f))
+	for i := range f {
+		out[i] = float64(float32(f[i]))
+	}
+	return out
+}
+
+func checkV1(src schemas.V1Reading) error {
+	var dest schemas.V1Reading
+	if err := roundTrip(&src, &dest); err != nil {
+		return err
+	}
+	return checkFloats("Readings", widen(src.Readings), widen(dest.Readings))
+}
+
+func checkV2(src schemas.V2Reading) error {
+	var dest schemas.V2Reading
+	if err := roundTrip(&src, &dest); err != nil {
+		return err
+	}
+	if src.Header != dest.Header {
+		return fmt.Errorf("Header: got %d bytes, want %d bytes", len(dest.Header), len(src.Header))
+	}
+	if src.Sequence != dest.Sequence || src.GeneratedAtUnixMs != dest.GeneratedAtUnixMs {
+		return fmt.Errorf("Sequence, GeneratedAtUnixMs: got %d, %d, want %d, %d",
+			dest.Sequence, dest.GeneratedAtUnixMs, src.Sequence, src.GeneratedAtUnixMs)
+	}
+	if err := checkFloats("RawReadings", src.RawReadings, dest.RawReadings); err != nil {
+		return err
+	}
+	return checkFloats("FilteredReadings", src.FilteredReadings, dest.FilteredReadings)
+}
+
+// a v1 client only sees the filtered readings (via the "readings" tag), narrowed
+// to float32; everything else the v2 server sends is skipped
+func checkV2ToV1(src schemas.V2Reading) error {
+	var dest schemas.V1Reading
+	if err := roundTrip(&src, &dest); err != nil {
+		return err
+	}
+	return checkFloats("Readings", narrow(src.FilteredReadings), widen(dest.Readings))
+}
+
+// without returns a copy of f with element i removed
+func without(f []float64, i int) []float64 {
+	return append(append([]float64(nil), f[:i]...), f[i+1:]...)
+}
+
+// shrinkV2 repeatedly tries smaller versions of v and keeps any that still fail
+func shrinkV2(v schemas.V2Reading, check func(schemas.V2Reading) error) schemas.V2Reading {
+	for {
+		var candidates []schemas.V2Reading
+
+		if len(v.Header) > 0 {
+			c := v
+			c.Header = v.Header[:len(v.Header)/2]
+			candidates = append(candidates, c)
+		}
+		for i := range v.RawReadings {
+			c := v
+			c.RawReadings = without(v.RawReadings, i)
+			candidates = append(candidates, c)
+		}
+		for i := range v.FilteredReadings {
+			c := v
+			c.FilteredReadings = without(v.FilteredReadings, i)
+			candidates = append(candidates, c)
+		}
+		if v.Sequence != 0 || v.GeneratedAtUnixMs != 0 {
+			c := v
+			c.Sequence, c.GeneratedAtUnixMs = 0, 0
+			candidates = append(candidates, c)
+		}
+
+		shrunk := false
+		for _, c := range candidates {
+			if check(c) != nil {
+				v = c
+				shrunk = true
+				break
+			}
+		}
+		if !shrunk {
+			return v
+		}
+	}
+}
+
+// shrinkV1 repeatedly drops readings while the value keeps failing
+func shrinkV1(v schemas.V1Reading, check func(schemas.V1Reading) error) schemas.V1Reading {
+	for i := 0; i < len(v.Readings); {
+		c := schemas.V1Reading{Readings: append(append([]float32(nil), v.Readings[:i]...), v.Readings[i+1:]...)}
+		if check(c) != nil {
+			v = c
+			continue
+		}
+		i++
+	}
+	return v
+}
+
+// quickConfig tries 1000 values per property, or 100 with -short, always from the
+// same seed so that a failure reproduces
+func quickConfig() *quick.Config {
+	count := 1000
+	if testing.Short() {
+		count = 100
+	}
+	return &quick.Config{MaxCount: count, Rand: rand.New(rand.NewSource(1))}
+}
+
+func TestRoundTripV1(t *testing.T) {
+	err := quick.Check(func(v genV1) bool { return checkV1(schemas.V1Reading(v)) == nil }, quickConfig())
+	if e, failed := err.(*quick.CheckError); failed {
+		minimal := shrinkV1(schemas.V1Reading(e.In[0].(genV1)), checkV1)
+		t.Fatalf("v1 writer -> v1 reader: %v\nminimal failing value: %#v", checkV1(minimal), minimal)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoundTripV2(t *testing.T) {
+	for _, p := range []struct {
+		name  string
+		check func(schemas.V2Reading) error
+	}{
+		{"v2 writer -> v2 reader", checkV2},
+		{"v2 writer -> v1 reader", checkV2ToV1},
+	} {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			err := quick.Check(func(v genV2) bool { return p.check(schemas.V2Reading(v)) == nil }, quickConfig())
+			if e, failed := err.(*quick.CheckError); failed {
+				minimal := shrinkV2(schemas.V2Reading(e.In[0].(genV2)), p.check)
+				t.Fatalf("%v\nminimal failing value: %#v", p.check(minimal), minimal)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
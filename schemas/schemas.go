@@ -0,0 +1,113 @@
+// Package schemas holds the structs sent by each version of the example server.
+// Servers and clients import them from here so that the two sides of an example
+// can't silently drift apart.
+package schemas
+
+import "github.com/bminer/schemer"
+
+// V1Reading is what v1 of the server sends
+type V1Reading struct {
+	Readings []float32 // temp sensor readings
+}
+
+// V2Reading is what v2 of the server sends. The filtered readings go out under
+// the "readings" name, so a client built against V1Reading decodes them into its
+// Readings without knowing anything changed.
+type V2Reading struct {
+	Header string // example of this is new string-based value that was added in version 2 of this system
+	// in newer version of the front end, we might now want to include both the raw readings and the filtered version
+	RawReadings []float64
+	// however, for backwards compatibility...
+	// notice the struct tag here: we want the old front end to just
+	// see these new filtered values as its "readings" w/o even knowing
+	// that anything changed!
+	FilteredReadings []float64 `schemer:"readings"`
+	// lets a client tell a new sample apart from one it has already seen
+	Sequence          uint64 // incremented by every update
+	GeneratedAtUnixMs int64  // when the update happened, in milliseconds since the Unix epoch
+}
+
+// V3Reading is what v3 of the server sends: a V2Reading, plus the unit the
+// readings are in. The server keeps its readings in Celsius and converts them to
+// whatever unit the client asks for before encoding; older clients just ignore
+// Unit.
+type V3Reading struct {
+	Header            string
+	RawReadings       []float64
+	FilteredReadings  []float64 `schemer:"readings"`
+	Sequence          uint64
+	GeneratedAtUnixMs int64
+	Unit              string // "C", "F" or "K"
+}
+
+// V1WriterSchema returns the schema used to encode a V1Reading
+func V1WriterSchema() schemer.Schema {
+	return schemer.SchemaOf(&V1Reading{})
+}
+
+// V2WriterSchema returns the schema used to encode a V2Reading
+func V2WriterSchema() schemer.Schema {
+	return schemer.SchemaOf(&V2Reading{})
+}
+
+// V3WriterSchema returns the schema used to encode a V3Reading
+func V3WriterSchema() schemer.Schema {
+	return schemer.SchemaOf(&V3Reading{})
+}
+
+// the sensor server (client-server/server/sensors) serves several kinds of sensor,
+// each with a struct and a schema of its own
+
+// TemperatureReading is what a temperature sensor sends, in degrees Celsius
+type TemperatureReading struct {
+	Readings []float64
+}
+
+// HumidityReading is what a humidity sensor sends, in percent relative humidity.
+// A float32 is plenty for a sensor this imprecise.
+type HumidityReading struct {
+	Readings []float32
+}
+
+// DoorEvents is what a door sensor sends: one entry per check, true if the door
+// was open
+type DoorEvents struct {
+	Events []bool
+}
+
+// CameraSnapshot is what a camera sensor sends: a still image, opaque to
+// everything but the client that displays it, with the camera that took it
+type CameraSnapshot struct {
+	Camera        string
+	TakenAtUnixMs int64
+	Snapshot      []byte
+}
+
+// ByteOrderProbe holds a value of each multi-byte number type, with every byte
+// of each integer different, so that a wire format depending on the byte order
+// of the machine that wrote it would decode to different values elsewhere.
+// TestGolden keeps its encoding as a golden file, and TestByteOrder decodes the
+// expected bytes on whatever machine it runs on.
+type ByteOrderProbe struct {
+	U16      uint16
+	U32      uint32
+	U64      uint64
+	I64      int64
+	F32      float32
+	F64      float64
+	Readings []float64
+}
+
+// ByteOrderProbeValue returns the values the golden ByteOrderProbe was encoded
+// with
+func ByteOrderProbeValue() ByteOrderProbe {
+	return ByteOrderProbe{
+		U16:      0x0102,
+		U32:      0x01020304,
+		U64:      0x0102030405060708,
+		I64:      -0x0102030405060708,
+		F32:      1.5,
+		F64:      -123.456,
+		Readings: []float64{20.5, -0.1},
+	}
+}
@@ -0,0 +1,61 @@
+package schemas
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SensorState is the state a sensor reports itself in. schemer sends it as the
+// uint8 it is, so a client decodes any value a server sends, including states
+// added after the client was built; use Known to tell those apart.
+type SensorState uint8
+
+const (
+	StateIdle SensorState = iota
+	StateActive
+	StateFault
+)
+
+var sensorStateNames = [...]string{
+	StateIdle:   "idle",
+	StateActive: "active",
+	StateFault:  "fault",
+}
+
+// Known reports whether s is one of the states defined above
+func (s SensorState) Known() bool {
+	return int(s) < len(sensorStateNames)
+}
+
+// String returns the name of s, or "SensorState(n)" for a state this build
+// doesn't know, which ParseSensorState accepts back
+func (s SensorState) String() string {
+	if s.Known() {
+		return sensorStateNames[s]
+	}
+	return "SensorState(" + strconv.Itoa(int(s)) + ")"
+}
+
+// ParseSensorState is the inverse of String: it accepts a state's name, in any
+// case, or "SensorState(n)" for any n from 0 to 255
+func ParseSensorState(name string) (SensorState, error) {
+	for s, n := range sensorStateNames {
+		if strings.EqualFold(name, n) {
+			return SensorState(s), nil
+		}
+	}
+	if strings.HasPrefix(name, "SensorState(") && strings.HasSuffix(name, ")") {
+		n, err := strconv.ParseUint(name[len("SensorState("):len(name)-1], 10, 8)
+		if err == nil {
+			return SensorState(n), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sensor state %q", name)
+}
+
+// StatusReport is what a sensor sends when its state changes
+type StatusReport struct {
+	Sensor string
+	State  SensorState
+}
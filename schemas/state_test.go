@@ -0,0 +1,58 @@
+package schemas_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+// TestStateRoundTrip sends every state a uint8 holds, including ones this build
+// doesn't know (a newer server's, or a buggy one's 255): each has to decode
+// without error to the number that was sent
+func TestStateRoundTrip(t *testing.T) {
+	writerSchema := schemer.SchemaOf(&schemas.StatusReport{})
+	readerSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+
+	for n := 0; n < 256; n++ {
+		sent := schemas.StatusReport{Sensor: "boiler", State: schemas.SensorState(n)}
+		var encodedData bytes.Buffer
+		if err := writerSchema.Encode(&encodedData, &sent); err != nil {
+			t.Fatalf("%d: encode error: %v", n, err)
+		}
+		var decoded schemas.StatusReport
+		if err := readerSchema.Decode(&encodedData, &decoded); err != nil {
+			t.Fatalf("%d: decode error: %v", n, err)
+		}
+		if decoded != sent {
+			t.Errorf("sent %+v, decoded %+v", sent, decoded)
+		}
+		if known := n <= int(schemas.StateFault); decoded.State.Known() != known {
+			t.Errorf("%d: Known is %t", n, decoded.State.Known())
+		}
+	}
+}
+
+// TestStateNames checks String and ParseSensorState round-trip all 256 values,
+// known and unknown, and ParseSensorState rejects anything else
+func TestStateNames(t *testing.T) {
+	for n := 0; n < 256; n++ {
+		s := schemas.SensorState(n)
+		parsed, err := schemas.ParseSensorState(s.String())
+		if err != nil || parsed != s {
+			t.Errorf("%d: String gave %q, which parses to %d (%v)", n, s.String(), parsed, err)
+		}
+	}
+	if s, err := schemas.ParseSensorState("Active"); err != nil || s != schemas.StateActive {
+		t.Errorf("%q parsed to %v (%v), want active", "Active", s, err)
+	}
+	for _, name := range []string{"", "busy", "SensorState()", "SensorState(256)", "SensorState(-1)", "SensorState(1", "sensorstate(1)"} {
+		if s, err := schemas.ParseSensorState(name); err == nil {
+			t.Errorf("%q parsed to %d", name, s)
+		}
+	}
+}
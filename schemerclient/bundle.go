@@ -0,0 +1,69 @@
+package schemerclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/bminer/schemer"
+)
+
+const BundlePath = "/get-bundle/"
+
+// MaxSchemaSize is the longest schema ReadBundle accepts. Real schemas are a few
+// hundred bytes; the limit keeps a corrupt length from allocating gigabytes.
+const MaxSchemaSize = 1 << 20
+
+// ReadBundle splits a /get-bundle/ response body into the parsed writer schema
+// and the encoded data that follows it
+func ReadBundle(r io.Reader) (schemer.Schema, []byte, error) {
+	schemaBytes, err := frame.ReadFrame(r, MaxSchemaSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read schema: %w", err)
+	}
+	schema, err := DecodeSchema(schemaBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decode schema: %w", err)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schema, data, nil
+}
+
+// FetchBundle gets the schema and the data from baseURL in a single request and
+// decodes the data into dest. It returns the schema so the caller can keep it
+// for later requests.
+func FetchBundle(ctx context.Context, baseURL string, dest interface{}) (schemer.Schema, error) {
+	url := strings.TrimSuffix(baseURL, "/") + BundlePath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{url: url, code: resp.StatusCode}
+	}
+
+	schema, data, err := ReadBundle(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.Decode(bytes.NewReader(data), dest); err != nil {
+		return nil, newDecodeError(url, schemaHash(schema.MarshalSchemer()), schema, data, err)
+	}
+	return schema, nil
+}
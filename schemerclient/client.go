@@ -0,0 +1,342 @@
+// Package schemerclient wraps the boilerplate every example client repeats:
+// fetch the writer schema from /get-schema/, parse it, fetch /get-data/ and
+// decode it into a destination struct.
+package schemerclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/signing"
+	"github.com/bminer/schemer"
+)
+
+const (
+	SchemaPath = "/get-schema/"
+	DataPath   = "/get-data/"
+)
+
+// Client talks to one example server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	retries    int
+	retryDelay time.Duration
+	signingKey []byte
+	schemaFile string // see WithSchemaFile
+
+	mu             sync.Mutex
+	schema         schemer.Schema
+	schemaHash     string // hex SHA-256 of the schema as the server sent it
+	schemaETag     string // ETag the server sent with the schema, if any
+	schemaRequests int
+	dataRequests   int
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient makes the Client send its requests through hc
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithInsecureSkipVerify makes the Client accept any TLS certificate, such as the
+// self-signed one the servers generate with TLS_SELF_SIGNED=1. It removes all
+// protection against a man in the middle, so only use it for local demos.
+func WithInsecureSkipVerify() Option {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		c.httpClient = &http.Client{Transport: transport}
+	}
+}
+
+// WithTimeout limits how long a single request attempt may take (default 10s)
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// WithRetries retries failed requests up to n more times, waiting delay before
+// the first retry and doubling it after every attempt. Network errors and 5xx
+// responses are retried; 4xx responses are not.
+func WithRetries(n int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.retryDelay = delay
+	}
+}
+
+// WithSigningKey makes the Client check the HMAC-SHA256 signature the server
+// sends with every data payload, and reject data that isn't signed with key
+func WithSigningKey(key []byte) Option {
+	return func(c *Client) { c.signingKey = key }
+}
+
+// New returns a Client for the server at baseURL, which has already fetched and
+// parsed the server's schema (or loaded it, see WithSchemaFile)
+func New(baseURL string, opts ...Option) (*Client, error) {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		timeout:    10 * time.Second,
+		retryDelay: 100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// a missing or unreadable schema file is only a cold cache
+	if c.schemaFile != "" && c.loadSchemaFile() == nil {
+		return c, nil
+	}
+	if err := c.RefreshSchema(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ErrNotModified is returned by FetchSince when the server has no sample newer
+// than the one the caller already has
+var ErrNotModified = errors.New("schemerclient: no new data since the last sequence")
+
+// ErrBadSignature is returned when a Client created WithSigningKey receives data
+// with a missing or wrong signature. It is never retried.
+var ErrBadSignature = errors.New("schemerclient: data signature missing or invalid")
+
+// statusError is returned for any unexpected response status
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("GET %s: %d %s", e.url, e.code, http.StatusText(e.code))
+}
+
+func retryable(err error) bool {
+	if errors.Is(err, ErrNotModified) || errors.Is(err, ErrBadSignature) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+// getOnce makes a single GET request with the extra request headers in header,
+// and returns the (decompressed) body along with the response headers
+func (c *Client) getOnce(ctx context.Context, url string, header http.Header) ([]byte, http.Header, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, resp.Header, ErrNotModified
+	default:
+		return nil, resp.Header, &statusError{url: url, code: resp.StatusCode}
+	}
+
+	var body io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	b, err := ioutil.ReadAll(body)
+	return b, resp.Header, err
+}
+
+// get calls getOnce, retrying as configured by WithRetries
+func (c *Client) get(ctx context.Context, path string, header http.Header) ([]byte, http.Header, error) {
+	url := c.baseURL + path
+	delay := c.retryDelay
+
+	for attempt := 0; ; attempt++ {
+		body, respHeader, err := c.getOnce(ctx, url, header)
+		if err == nil || attempt >= c.retries || !retryable(err) {
+			return body, respHeader, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// DecodeSchema accepts either the JSON schema sent by the v1 server or the
+// binary schema sent by the v2 server
+func DecodeSchema(b []byte) (schemer.Schema, error) {
+	if len(b) > 0 && b[0] == '{' {
+		return schemer.DecodeSchemaJSON(b)
+	}
+	return schemer.DecodeSchema(b)
+}
+
+// RefreshSchema fetches the server's schema again. Servers that send an ETag are
+// asked for the schema only if it changed; either way it is only parsed again if
+// it differs from the cached one, which SchemaHash then reflects.
+func (c *Client) RefreshSchema(ctx context.Context) error {
+	c.mu.Lock()
+	c.schemaRequests++
+	c.mu.Unlock()
+
+	// a conditional request: if the schema hasn't changed since we fetched it, the
+	// server answers 304 without sending it again
+	var header http.Header
+	c.mu.Lock()
+	if c.schemaETag != "" {
+		header = http.Header{"If-None-Match": {c.schemaETag}}
+	}
+	c.mu.Unlock()
+
+	schemaBytes, respHeader, err := c.get(ctx, SchemaPath, header)
+	if errors.Is(err, ErrNotModified) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	hash := schemaHash(schemaBytes)
+	if hash == c.SchemaHash() {
+		return nil
+	}
+
+	schema, err := DecodeSchema(schemaBytes)
+	if err != nil {
+		return fmt.Errorf("cannot decode schema: %w", err)
+	}
+
+	c.mu.Lock()
+	c.schema = schema
+	c.schemaHash = hash
+	c.schemaETag = respHeader.Get("ETag")
+	c.mu.Unlock()
+
+	if c.schemaFile != "" {
+		// the v1 server's JSON schema is saved in the binary form, like the others
+		if schemaBytes[0] == '{' {
+			schemaBytes = schema.MarshalSchemer()
+		}
+		if err := c.saveSchemaFile(schemaBytes); err != nil {
+			return fmt.Errorf("cannot save schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// SchemaHash returns the hex SHA-256 of the cached schema, as the server sent it.
+// Comparing it before and after a poll tells whether the server's schema changed
+// in between, e.g. because it was upgraded.
+func (c *Client) SchemaHash() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.schemaHash
+}
+
+// Schema returns the cached writer schema
+func (c *Client) Schema() schemer.Schema {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.schema
+}
+
+// Fetch gets the current data from the server and decodes it into dest, which
+// must be a pointer. If the payload doesn't decode with the cached schema, the
+// server may have been upgraded since the schema was fetched, so the schema is
+// refreshed and the decode tried once more; if that fails too, the error is a
+// *DecodeError.
+func (c *Client) Fetch(ctx context.Context, dest interface{}) error {
+	_, err := c.fetch(ctx, nil, dest)
+	return err
+}
+
+// FetchSince is like Fetch, but asks the server to only send data newer than
+// lastSequence. If there is nothing newer it returns ErrNotModified without
+// touching dest. Otherwise it returns the sequence number of the data decoded
+// into dest, which is 0 for servers that don't send one.
+func (c *Client) FetchSince(ctx context.Context, lastSequence uint64, dest interface{}) (uint64, error) {
+	header := http.Header{}
+	header.Set("X-Last-Sequence", strconv.FormatUint(lastSequence, 10))
+
+	respHeader, err := c.fetch(ctx, header, dest)
+	if err != nil {
+		return lastSequence, err
+	}
+	sequence, _ := strconv.ParseUint(respHeader.Get("X-Sequence"), 10, 64)
+	return sequence, nil
+}
+
+// fetch does the work for Fetch and FetchSince, returning the response headers
+func (c *Client) fetch(ctx context.Context, header http.Header, dest interface{}) (http.Header, error) {
+	c.mu.Lock()
+	c.dataRequests++
+	c.mu.Unlock()
+
+	data, respHeader, err := c.get(ctx, DataPath, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// check the signature before decoding, so tampered data never reaches dest
+	if c.signingKey != nil && !signing.VerifyHex(c.signingKey, data, respHeader.Get(signing.Header)) {
+		return nil, ErrBadSignature
+	}
+
+	if err := c.Schema().Decode(bytes.NewReader(data), dest); err == nil {
+		return respHeader, nil
+	}
+
+	if err := c.RefreshSchema(ctx); err != nil {
+		return nil, err
+	}
+	schema := c.Schema()
+	if err := schema.Decode(bytes.NewReader(data), dest); err != nil {
+		return nil, newDecodeError(c.baseURL+DataPath, c.SchemaHash(), schema, data, err)
+	}
+	return respHeader, nil
+}
+
+// Requests returns how many schema and data requests the Client has made,
+// not counting retries
+func (c *Client) Requests() (schema, data int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.schemaRequests, c.dataRequests
+}
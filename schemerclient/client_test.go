@@ -0,0 +1,186 @@
+package schemerclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+)
+
+type reading struct {
+	Header   string
+	Readings []float64
+}
+
+var sample = &reading{Header: "boiler room", Readings: []float64{20.5, 21.25}}
+
+func TestTimeout(t *testing.T) {
+	u := testserver.New(t, sample)
+	c, err := New(u.URL, WithTimeout(50*time.Millisecond), WithRetries(1, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Stall(5 * time.Second)
+
+	began := time.Now()
+	var dest reading
+	err = c.Fetch(context.Background(), &dest)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a deadline exceeded error", err)
+	}
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Errorf("two 50ms attempts took %v", elapsed)
+	}
+	if _, data := u.Requests(); data != 2 {
+		t.Errorf("the server got %d data requests, want 2: the first and one retry", data)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		failures int
+		code     int
+		retries  int
+		wantErr  int // the status Fetch fails with, or 0 for success
+		wantHits int
+	}{
+		{"5xx, then success", 2, http.StatusServiceUnavailable, 3, 0, 3},
+		{"5xx until the retries run out", 5, http.StatusInternalServerError, 2, http.StatusInternalServerError, 3},
+		{"4xx isn't retried", 1, http.StatusNotFound, 3, http.StatusNotFound, 1},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			u := testserver.New(t, sample)
+			client, err := New(u.URL, WithRetries(c.retries, time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			u.Fail(c.failures, c.code)
+
+			var dest reading
+			err = client.Fetch(context.Background(), &dest)
+			var se *statusError
+			switch {
+			case c.wantErr == 0 && err != nil:
+				t.Fatalf("got %v, want success", err)
+			case c.wantErr == 0 && dest.Header != sample.Header:
+				t.Fatalf("got %+v, want %+v", dest, *sample)
+			case c.wantErr != 0 && !(errors.As(err, &se) && se.code == c.wantErr):
+				t.Fatalf("got %v, want a %d", err, c.wantErr)
+			}
+			if _, data := u.Requests(); data != c.wantHits {
+				t.Errorf("the server got %d data requests, want %d", data, c.wantHits)
+			}
+			if _, data := client.Requests(); data != 1 {
+				t.Errorf("Requests counts %d data requests, want 1: retries don't count", data)
+			}
+		})
+	}
+}
+
+// TestRetryCanceled checks a canceled context ends the wait between retries
+func TestRetryCanceled(t *testing.T) {
+	u := testserver.New(t, sample)
+	c, err := New(u.URL, WithRetries(3, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Fail(1, http.StatusServiceUnavailable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	var dest reading
+	if err := c.Fetch(ctx, &dest); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+// counter is what the server sends after an upgrade: a payload of a single byte,
+// too short for the old schema's string and slice, so decoding it with the
+// schema the client has cached fails for certain
+type counter struct {
+	Count uint8
+}
+
+func TestSchemaChange(t *testing.T) {
+	u := testserver.New(t, sample)
+	c, err := New(u.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before reading
+	if err := c.Fetch(context.Background(), &before); err != nil {
+		t.Fatal(err)
+	}
+	oldHash := c.SchemaHash()
+
+	// the server is upgraded between two polls
+	u.Set(t, &counter{Count: 200})
+
+	var after counter
+	if err := c.Fetch(context.Background(), &after); err != nil {
+		t.Fatalf("the first fetch after the upgrade: %v", err)
+	}
+	if after.Count != 200 {
+		t.Errorf("got %+v, want Count 200", after)
+	}
+	if c.SchemaHash() == oldHash {
+		t.Error("SchemaHash didn't change with the schema")
+	}
+	if schema, _ := u.Requests(); schema != 2 {
+		t.Errorf("the server got %d schema requests, want 2: at New and after the upgrade", schema)
+	}
+
+	// from now on the new schema is used straight away
+	if err := c.Fetch(context.Background(), &after); err != nil {
+		t.Fatal(err)
+	}
+	if schema, _ := u.Requests(); schema != 2 {
+		t.Errorf("the schema was fetched again for a payload the cached one decodes")
+	}
+}
+
+// TestSigning fetches from a server that signs its payloads, with a Client
+// created WithSigningKey. A payload with a byte flipped after signing, or signed
+// with another key, has to be rejected before anything is decoded into dest.
+func TestSigning(t *testing.T) {
+	key := []byte("not a very secret key")
+	for _, c := range []struct {
+		name      string
+		serverKey []byte
+		tamper    bool
+		wantErr   error
+	}{
+		{"untouched", key, false, nil},
+		{"one flipped byte", key, true, ErrBadSignature},
+		{"another key", []byte("some other key"), false, ErrBadSignature},
+		{"unsigned", nil, false, ErrBadSignature},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			u := testserver.New(t, sample)
+			u.Sign(c.serverKey)
+			if c.tamper {
+				u.Tamper()
+			}
+			client, err := New(u.URL, WithSigningKey(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dest reading
+			err = client.Fetch(context.Background(), &dest)
+			if !errors.Is(err, c.wantErr) {
+				t.Fatalf("got %v, want %v", err, c.wantErr)
+			}
+			if c.wantErr != nil && dest.Header != "" {
+				t.Errorf("a rejected payload was decoded into dest anyway: %+v", dest)
+			}
+			if c.wantErr == nil && dest.Header != sample.Header {
+				t.Errorf("decoded %+v, want %+v", dest, *sample)
+			}
+		})
+	}
+}
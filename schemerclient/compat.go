@@ -0,0 +1,178 @@
+package schemerclient
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bminer/schemer"
+)
+
+// FieldMapping is a field the writer sends and the destination field it decodes
+// into
+type FieldMapping struct {
+	// paths of the field in the writer schema, by wire name, and in the
+	// destination, by Go name; both "" when the values aren't structs
+	Writer, Dest string
+
+	WriterType, DestType string
+
+	// Note is what converting the values loses, or for an Unconvertible field,
+	// why it doesn't decode; "" for a field that decodes as sent
+	Note string
+}
+
+func (m FieldMapping) String() string {
+	s := m.Dest
+	if s == "" {
+		s = "(top level)"
+	}
+	if !strings.EqualFold(m.Writer, m.Dest) {
+		s += " <- " + m.Writer
+	}
+	types := m.DestType
+	if m.WriterType != m.DestType {
+		types = m.WriterType + " -> " + m.DestType
+	}
+	s += " (" + types + ")"
+	if m.Note != "" {
+		s += ": " + m.Note
+	}
+	return s
+}
+
+// CompatibilityReport says, before anything is decoded, what decoding data
+// written with a writer schema into a destination will do to every field
+type CompatibilityReport struct {
+	Mapped        []FieldMapping // decode into a destination field, maybe narrowed (see Note)
+	Ignored       []string       // writer fields the destination has no field for, skipped
+	Unset         []string       // destination fields the writer doesn't send, left at their zero values
+	Unconvertible []FieldMapping // type pairs that can't convert: the data won't decode
+}
+
+// Decodable reports whether the data will decode at all
+func (r *CompatibilityReport) Decodable() bool {
+	return len(r.Unconvertible) == 0
+}
+
+// Lines returns the report a line per field: mapped, then ignored, unset and
+// unconvertible ones
+func (r *CompatibilityReport) Lines() []string {
+	var lines []string
+	for _, m := range r.Mapped {
+		lines = append(lines, "maps:          "+m.String())
+	}
+	for _, f := range r.Ignored {
+		lines = append(lines, "ignored:       "+f)
+	}
+	for _, f := range r.Unset {
+		lines = append(lines, "left at zero:  "+f)
+	}
+	for _, m := range r.Unconvertible {
+		lines = append(lines, "can't convert: "+m.String())
+	}
+	return lines
+}
+
+func (r *CompatibilityReport) Error() string {
+	var problems []string
+	if n := len(r.Unconvertible); n > 0 {
+		problems = append(problems, fmt.Sprintf("%d fields can't convert", n))
+	}
+	narrowed := 0
+	for _, m := range r.Mapped {
+		if m.Note != "" {
+			narrowed++
+		}
+	}
+	for _, c := range []struct {
+		n    int
+		what string
+	}{{narrowed, "narrowed"}, {len(r.Ignored), "ignored"}, {len(r.Unset), "left at zero"}} {
+		if c.n > 0 {
+			problems = append(problems, fmt.Sprintf("%d %s", c.n, c.what))
+		}
+	}
+	return "schemerclient: the writer schema doesn't match the destination: " + strings.Join(problems, ", ")
+}
+
+// Compatibility walks writerSchema, the schema data comes with, against
+// readerDest, what it is going to be decoded into, and reports what will happen
+// to every field. Fields are matched the way Decode matches them, by their wire
+// name (so a struct tag can rename a field), without regard to case; see
+// Preflight, which this is built on.
+func Compatibility(readerDest interface{}, writerSchema schemer.Schema) *CompatibilityReport {
+	w, r := writerSchema.GoType(), schemer.SchemaOf(readerDest).GoType()
+	p := preflight{}
+	p.compare(w, r, "", "")
+	if w != nil && r != nil && (indirect(w).Kind() != reflect.Struct || indirect(r).Kind() != reflect.Struct) {
+		// not a struct: the value itself is the one field
+		p.mapped = append(p.mapped, FieldMapping{WriterType: describe(w), DestType: describe(r)})
+	}
+
+	report := &CompatibilityReport{}
+	for _, m := range p.mapped {
+		// what was found about the field, or the elements of it
+		var notes []string
+		convertible := true
+		for _, inc := range p.found {
+			if inc.Writer == "" || inc.Reader == "" {
+				continue
+			}
+			if inc.Field != m.Dest && !strings.HasPrefix(inc.Field, m.Dest+"[") {
+				continue
+			}
+			note := inc.Reason
+			if inc.Field != m.Dest {
+				note = inc.Field[len(m.Dest):] + ": " + note
+			}
+			notes = append(notes, note)
+			convertible = convertible && inc.Severity != Error
+		}
+		m.Note = strings.Join(notes, "; ")
+		if convertible {
+			report.Mapped = append(report.Mapped, m)
+		} else {
+			report.Unconvertible = append(report.Unconvertible, m)
+		}
+	}
+	for _, inc := range p.found {
+		switch {
+		case inc.Reader == "":
+			report.Ignored = append(report.Ignored, inc.Field+" ("+inc.Writer+")")
+		case inc.Writer == "":
+			report.Unset = append(report.Unset, inc.Field+" ("+inc.Reader+")")
+		}
+	}
+	return report
+}
+
+// CheckCompatible checks, before any decode is attempted, that data written with
+// writerSchema decodes into readerDest field for field. It returns nil if it
+// does, and otherwise the *CompatibilityReport, which says what doesn't match
+// and whether the data will decode at all (Decodable):
+//
+//	if err := schemerclient.CheckCompatible(&dest, client.Schema()); err != nil {
+//		report := err.(*schemerclient.CompatibilityReport)
+//		...
+//	}
+func CheckCompatible(readerDest interface{}, writerSchema schemer.Schema) error {
+	report := Compatibility(readerDest, writerSchema)
+	if report.exact() {
+		return nil
+	}
+	return report
+}
+
+// exact reports whether every field maps to one on the other side, unchanged
+func (r *CompatibilityReport) exact() bool {
+	if len(r.Unconvertible) > 0 || len(r.Ignored) > 0 || len(r.Unset) > 0 {
+		return false
+	}
+	for _, m := range r.Mapped {
+		if m.Note != "" {
+			return false
+		}
+	}
+	return true
+}
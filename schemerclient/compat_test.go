@@ -0,0 +1,128 @@
+package schemerclient
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// a client that calls the filtered readings something else, and picks them out
+// by their wire name
+type renamedReader struct {
+	Header       string
+	Temperatures []float64 `schemer:"readings"`
+}
+
+// a client that expects a single reading where the server sends a list
+type scalarReader struct {
+	Readings float64
+}
+
+// a CheckCompatible report, and what it should say
+type reportCase struct {
+	name          string
+	sent          interface{}
+	dest          func() interface{}
+	mapped        []string // FieldMapping.String of every mapped field
+	ignored       []string
+	unset         []string
+	unconvertible []string // FieldMapping.Dest of every unconvertible field
+}
+
+var reportCases = []reportCase{
+	{
+		name:    "renamed by a tag: Temperatures gets the v2 server's readings",
+		sent:    v2Sample,
+		dest:    func() interface{} { return &renamedReader{} },
+		mapped:  []string{"Header (string)", "Temperatures <- readings ([]float64)"},
+		ignored: []string{"RawReadings ([]float64)", "Sequence (uint64)", "GeneratedAtUnixMs (int64)"},
+	},
+	{
+		name:   "missing fields: the v2 client against the v1 server",
+		sent:   v1Sample,
+		dest:   func() interface{} { return &schemas.V2Reading{} },
+		mapped: []string{"FilteredReadings <- Readings ([]float32 -> []float64)"},
+		unset:  []string{"Header (string)", "RawReadings ([]float64)", "Sequence (uint64)", "GeneratedAtUnixMs (int64)"},
+	},
+	{
+		name:    "narrowed: the v1 client against the v2 server",
+		sent:    v2Sample,
+		dest:    func() interface{} { return &schemas.V1Reading{} },
+		mapped:  []string{"Readings ([]float64 -> []float32): []: precision is lost"},
+		ignored: []string{"Header (string)", "RawReadings ([]float64)", "Sequence (uint64)", "GeneratedAtUnixMs (int64)"},
+	},
+	{
+		name:          "doesn't convert: string readings",
+		sent:          v1Sample,
+		dest:          func() interface{} { return &stringReader{} },
+		unconvertible: []string{"Readings"},
+	},
+	{
+		name:          "doesn't convert: a list into a single number",
+		sent:          v1Sample,
+		dest:          func() interface{} { return &scalarReader{} },
+		unconvertible: []string{"Readings"},
+	},
+	{
+		name: "the same schema: nothing to report",
+		sent: v2Sample,
+		dest: func() interface{} { return &schemas.V2Reading{} },
+	},
+}
+
+// TestCheckCompatible checks the report CheckCompatible gives for each case, and
+// that the decode goes the way the report says
+func TestCheckCompatible(t *testing.T) {
+	for _, c := range reportCases {
+		t.Run(c.name, func(t *testing.T) {
+			serverSchema, payload := sendSchema(t, c.sent)
+
+			dest := c.dest()
+			err := CheckCompatible(dest, serverSchema)
+			report := &CompatibilityReport{}
+			if err != nil {
+				var ok bool
+				if report, ok = err.(*CompatibilityReport); !ok {
+					t.Fatalf("CheckCompatible returned a %T: %v", err, err)
+				}
+			}
+
+			var mapped, unconvertible []string
+			for _, m := range report.Mapped {
+				mapped = append(mapped, m.String())
+			}
+			for _, m := range report.Unconvertible {
+				unconvertible = append(unconvertible, m.Dest)
+			}
+			for _, l := range []struct {
+				what      string
+				got, want []string
+			}{
+				{"mapped", mapped, c.mapped},
+				{"ignored", report.Ignored, c.ignored},
+				{"left at zero", report.Unset, c.unset},
+				{"unconvertible", unconvertible, c.unconvertible},
+			} {
+				if !reflect.DeepEqual(l.got, l.want) {
+					t.Errorf("%s: %q, want %q", l.what, l.got, l.want)
+				}
+			}
+			if wantNil := c.mapped == nil && c.ignored == nil && c.unset == nil && c.unconvertible == nil; wantNil != (err == nil) {
+				t.Errorf("CheckCompatible returned %v", err)
+			}
+
+			err = serverSchema.Decode(bytes.NewReader(payload), dest)
+			switch {
+			case !report.Decodable() && err == nil:
+				t.Errorf("the report says the data won't decode, but it did, as %+v", dest)
+			case report.Decodable() && err != nil:
+				t.Errorf("the report says the data decodes, but: %v", err)
+			}
+			if r, ok := dest.(*renamedReader); ok && !reflect.DeepEqual(r.Temperatures, v2Sample.FilteredReadings) {
+				t.Errorf("Temperatures decoded as %v, want the filtered readings %v", r.Temperatures, v2Sample.FilteredReadings)
+			}
+		})
+	}
+}
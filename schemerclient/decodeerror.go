@@ -0,0 +1,132 @@
+package schemerclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	"github.com/bminer/schemer"
+)
+
+// DecodeError is returned when data arrived but didn't decode with the writer
+// schema. Besides schemer's error, which it wraps (so errors.Is and errors.As see
+// through it), it says where the data came from, which schema it was decoded
+// with, and, as far as it can be worked out, which field decoding failed
+// on.
+type DecodeError struct {
+	URL         string // the URL the data came from
+	Fingerprint string // hex SHA-256 of the schema, like Client.SchemaHash
+	PayloadSize int    // length of the payload, in bytes, or -1 if it was streamed
+
+	// Field is the path of the struct field decoding failed on, such as
+	// "Cal.Scale", or "" for the top-level value. Consumed is how many bytes of the
+	// payload came before that field, which all decoded. Both are found by
+	// decoding the payload again one field at a time; if that decodes the whole
+	// payload (the data is fine, but doesn't fit dest), Consumed is -1. A streamed
+	// payload isn't kept, so for one from FetchStream Field is "" and Consumed -1.
+	Field    string
+	Consumed int
+
+	Err error // schemer's error
+}
+
+func (e *DecodeError) Error() string {
+	where := "somewhere past the data (it decodes, but not into the destination)"
+	switch {
+	case e.PayloadSize < 0:
+		return fmt.Sprintf("cannot decode streamed data from %s (schema %.12s): %v", e.URL, e.Fingerprint, e.Err)
+	case e.Consumed >= 0:
+		field := e.Field
+		if field == "" {
+			field = "(top level)"
+		}
+		where = fmt.Sprintf("field %s, after %d bytes", field, e.Consumed)
+	}
+	return fmt.Sprintf("cannot decode data from %s (schema %.12s, %d bytes): %s: %v",
+		e.URL, e.Fingerprint, e.PayloadSize, where, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// schemaHash returns the hex SHA-256 of a schema as the server sent it
+func schemaHash(schemaBytes []byte) string {
+	sum := sha256.Sum256(schemaBytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// newDecodeError returns a DecodeError for err, which schema returned decoding
+// payload from url. A nil payload means it was streamed, and is gone.
+func newDecodeError(url, fingerprint string, schema schemer.Schema, payload []byte, err error) *DecodeError {
+	if payload == nil {
+		return &DecodeError{URL: url, Fingerprint: fingerprint, PayloadSize: -1, Consumed: -1, Err: err}
+	}
+	field, consumed := locate(schema.GoType(), payload, 0, "")
+	return &DecodeError{
+		URL:         url,
+		Fingerprint: fingerprint,
+		PayloadSize: len(payload),
+		Field:       field,
+		Consumed:    consumed,
+		Err:         err,
+	}
+}
+
+// locate finds the field that payload[offset:], a value of the writer's type t,
+// stops decoding at. It decodes the payload with a struct of t's first field,
+// then its first two, and so on; the first that fails ends in the field it
+// added, which is where the search continues if that is a struct too. It relies
+// on schemer reading only what it needs from the reader it is given, so the bytes
+// left in the reader tell how far decoding got. It returns -1 if the whole value
+// decodes.
+func locate(t reflect.Type, payload []byte, offset int, path string) (string, int) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		if _, ok := decodedLength(t, payload[offset:]); ok {
+			return path, -1
+		}
+		return path, offset
+	}
+
+	var fields []reflect.StructField
+	length := 0 // of the fields so far
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, f)
+		n, ok := decodedLength(reflect.StructOf(fields), payload[offset:])
+		if !ok {
+			fieldPath := f.Name
+			if path != "" {
+				fieldPath = path + "." + f.Name
+			}
+			if field, consumed := locate(f.Type, payload, offset+length, fieldPath); consumed >= 0 {
+				return field, consumed
+			}
+			return fieldPath, offset + length
+		}
+		length = n
+	}
+	return path, -1
+}
+
+// decodedLength decodes b as a value of type t, and returns how many bytes that
+// took
+func decodedLength(t reflect.Type, b []byte) (n int, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	dest := reflect.New(t)
+	r := bytes.NewReader(b)
+	if err := schemer.SchemaOf(dest.Interface()).Decode(r, dest.Interface()); err != nil {
+		return 0, false
+	}
+	return len(b) - r.Len(), true
+}
@@ -0,0 +1,162 @@
+package schemerclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bminer/schemer"
+)
+
+type calibration struct {
+	Offset float64
+	Scale  float64
+}
+
+type calibrated struct {
+	Header   string
+	Cal      calibration
+	Readings []float64
+	Note     string
+}
+
+var calibratedSample = calibrated{
+	Header:   "Four score and seven years ago",
+	Cal:      calibration{Offset: -0.75, Scale: 1.02},
+	Readings: []float64{20.5, 21.25, 19.875},
+	Note:     "calibrated in June",
+}
+
+// what a client expecting a different Header decodes into
+type wrongHeader struct {
+	Header []float64
+}
+
+func encode(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	var encodedData bytes.Buffer
+	if err := schemer.SchemaOf(v).Encode(&encodedData, v); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	return encodedData.Bytes()
+}
+
+// serveCalibrated serves calibratedSample's schema, and payload as its data
+func serveCalibrated(t *testing.T, payload []byte) *httptest.Server {
+	binarySchema := schemer.SchemaOf(&calibratedSample).MarshalSchemer()
+	mux := http.NewServeMux()
+	mux.HandleFunc(SchemaPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(binarySchema)
+	})
+	mux.HandleFunc(DataPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(payload)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// wantDecodeError fetches from ts into dest with fetch, and returns the
+// DecodeError that has to result
+func wantDecodeError(t *testing.T, ts *httptest.Server, fetch func(*Client, interface{}) error, dest interface{}) *DecodeError {
+	t.Helper()
+	client, err := New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fetch(client, dest)
+	if err == nil {
+		t.Fatalf("the payload decoded into %+v", dest)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("not a *DecodeError: %v", err)
+	}
+	if !errors.Is(err, de.Err) || errors.Unwrap(de) != de.Err {
+		t.Fatalf("doesn't unwrap to schemer's error: %v", err)
+	}
+	if de.URL != ts.URL+DataPath {
+		t.Errorf("URL %q, want %q", de.URL, ts.URL+DataPath)
+	}
+	if de.Fingerprint != client.SchemaHash() {
+		t.Errorf("fingerprint %.12s, the client's SchemaHash is %.12s", de.Fingerprint, client.SchemaHash())
+	}
+	return de
+}
+
+func fetch(c *Client, dest interface{}) error {
+	return c.Fetch(context.Background(), dest)
+}
+
+func fetchStream(c *Client, dest interface{}) error {
+	return c.FetchStream(context.Background(), dest)
+}
+
+// TestDecodeErrorField cuts the payload short in the middle of each field in
+// turn, nested ones included, and checks that the DecodeError names that field
+// and how many bytes came before it. The field offsets come from encoding each
+// field on its own, since a struct's fields are encoded one after another.
+func TestDecodeErrorField(t *testing.T) {
+	payload := encode(t, &calibratedSample)
+
+	offset := 0
+	for _, f := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"Header", &calibratedSample.Header},
+		{"Cal.Offset", &calibratedSample.Cal.Offset},
+		{"Cal.Scale", &calibratedSample.Cal.Scale},
+		{"Readings", &calibratedSample.Readings},
+		{"Note", &calibratedSample.Note},
+	} {
+		start := offset
+		end := start + len(encode(t, f.value))
+		offset = end
+		t.Run(f.name, func(t *testing.T) {
+			// cut the field in half, leaving none of it if it is a single byte
+			cut := payload[:start+(end-start)/2]
+			var dest calibrated
+			de := wantDecodeError(t, serveCalibrated(t, cut), fetch, &dest)
+			if de.PayloadSize != len(cut) {
+				t.Errorf("payload size %d, the server sent %d bytes", de.PayloadSize, len(cut))
+			}
+			if de.Field != f.name || de.Consumed != start {
+				t.Errorf("blamed field %q after %d bytes, want %q after %d: %v", de.Field, de.Consumed, f.name, start, de)
+			}
+		})
+	}
+	if offset != len(payload) {
+		t.Errorf("the fields encoded on their own come to %d bytes, the sample to %d", offset, len(payload))
+	}
+}
+
+// TestDecodeErrorDest sends an intact payload to a client whose destination
+// doesn't fit it: that is a DecodeError too, with no field blamed, since the
+// data itself is fine
+func TestDecodeErrorDest(t *testing.T) {
+	payload := encode(t, &calibratedSample)
+
+	t.Run("Fetch", func(t *testing.T) {
+		var dest wrongHeader
+		de := wantDecodeError(t, serveCalibrated(t, payload), fetch, &dest)
+		if de.PayloadSize != len(payload) {
+			t.Errorf("payload size %d, the server sent %d bytes", de.PayloadSize, len(payload))
+		}
+		if de.Consumed != -1 {
+			t.Errorf("blamed field %q after %d bytes of an intact payload: %v", de.Field, de.Consumed, de)
+		}
+	})
+
+	// a streamed payload isn't kept, so there is no field to blame
+	t.Run("FetchStream", func(t *testing.T) {
+		var dest wrongHeader
+		de := wantDecodeError(t, serveCalibrated(t, payload), fetchStream, &dest)
+		if de.PayloadSize != -1 || de.Consumed != -1 {
+			t.Errorf("payload size %d and %d bytes consumed for a streamed payload: %v", de.PayloadSize, de.Consumed, de)
+		}
+	})
+}
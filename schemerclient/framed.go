@@ -0,0 +1,115 @@
+package schemerclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/bminer/schemer"
+)
+
+const FramedPath = "/get-framed/"
+
+// framedHeaderSize is how much of a /get-framed/ response comes before the
+// schema: frame.FramedMagic and the schema's length
+const framedHeaderSize = len(frame.FramedMagic) + frame.HeaderSize
+
+// splitFramed returns the schema and the payload in a /get-framed/ response
+// body. The errors say which part of it is short, and wrap ErrTruncated.
+func splitFramed(body []byte) (schema, payload []byte, err error) {
+	// as much of the magic as there is has to be right
+	magic := []byte(frame.FramedMagic)
+	n := len(magic)
+	if len(body) < n {
+		n = len(body)
+	}
+	if !bytes.Equal(body[:n], magic[:n]) {
+		return nil, nil, fmt.Errorf("not a framed response (no %q magic)", frame.FramedMagic)
+	}
+	if len(body) < framedHeaderSize {
+		return nil, nil, fmt.Errorf("%w: cut short in the header, got %d of %d bytes", ErrTruncated, len(body), framedHeaderSize)
+	}
+
+	r := bytes.NewReader(body[n:])
+	if schema, err = readFramedPart(r, "schema"); err != nil {
+		return nil, nil, err
+	}
+	if payload, err = readFramedPart(r, "payload"); err != nil {
+		return nil, nil, err
+	}
+	if r.Len() > 0 {
+		return nil, nil, fmt.Errorf("%d unexpected bytes after the payload", r.Len())
+	}
+	return schema, payload, nil
+}
+
+// readFramedPart reads the next frame from r, which holds the rest of a
+// /get-framed/ body. A frame longer than what is left was cut short.
+func readFramedPart(r *bytes.Reader, part string) ([]byte, error) {
+	if r.Len() < frame.HeaderSize {
+		return nil, fmt.Errorf("%w: cut short in the %s's length, got %d of %d bytes", ErrTruncated, part, r.Len(), frame.HeaderSize)
+	}
+	left := r.Len() - frame.HeaderSize
+	b, err := frame.ReadFrame(r, uint32(left))
+	if errors.Is(err, frame.ErrTooLarge) {
+		return nil, fmt.Errorf("%w: cut short in the %s, only %d bytes left", ErrTruncated, part, left)
+	}
+	return b, err
+}
+
+// ParseFramed splits a /get-framed/ response body into the writer schema and the
+// payload, and decodes the payload into dest. A body cut short anywhere (in the
+// header, the schema or the payload) is an error wrapping ErrTruncated, and dest
+// is left alone. Data that doesn't decode is a *DecodeError, with FramedPath for
+// its URL.
+func ParseFramed(body []byte, dest interface{}) (schemer.Schema, error) {
+	schemaBytes, payload, err := splitFramed(body)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := DecodeSchema(schemaBytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode schema: %w", err)
+	}
+	if err := schema.Decode(bytes.NewReader(payload), dest); err != nil {
+		return nil, newDecodeError(FramedPath, schemaHash(schemaBytes), schema, payload, err)
+	}
+	return schema, nil
+}
+
+// FetchFramed gets the schema and the data from baseURL in a single framed
+// request and decodes the data into dest. It returns the schema so the caller
+// can keep it for later requests.
+func FetchFramed(ctx context.Context, baseURL string, dest interface{}) (schemer.Schema, error) {
+	url := strings.TrimSuffix(baseURL, "/") + FramedPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{url: url, code: resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := ParseFramed(body, dest)
+	var de *DecodeError
+	if errors.As(err, &de) {
+		de.URL = url
+	}
+	return schema, err
+}
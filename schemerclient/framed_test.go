@@ -0,0 +1,105 @@
+package schemerclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/frame"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+)
+
+// framedBody frames a sample the way the v2 server does
+func framedBody(t *testing.T) []byte {
+	writerSchema := schemas.V2WriterSchema()
+	sample := schemas.V2Reading{Header: "framed", RawReadings: []float64{1, 2, 3}, FilteredReadings: []float64{1.5, 2.5}, Sequence: 42}
+
+	var payload, framed bytes.Buffer
+	if err := writerSchema.Encode(&payload, &sample); err != nil {
+		t.Fatal(err)
+	}
+	framed.WriteString(frame.FramedMagic)
+	for _, part := range [][]byte{writerSchema.MarshalSchemer(), payload.Bytes()} {
+		if err := frame.WriteFrame(&framed, part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return framed.Bytes()
+}
+
+// section returns which part of body the byte at offset belongs to. Each
+// length prefix counts as part of what it is the length of, the schema's along
+// with the magic as the header.
+func section(body []byte, offset int) string {
+	schemaEnd := framedHeaderSize + int(binary.BigEndian.Uint32(body[len(frame.FramedMagic):framedHeaderSize]))
+	switch {
+	case offset < framedHeaderSize:
+		return "header"
+	case offset < schemaEnd:
+		return "schema"
+	default:
+		return "payload"
+	}
+}
+
+// TestParseFramed cuts a complete frame at every length from zero up to one
+// byte short, and checks each cut fails with an error naming the part of the
+// frame it ended in, without touching the destination. The complete frame has
+// to decode, and one with bytes after the payload or the wrong magic must not.
+func TestParseFramed(t *testing.T) {
+	body := framedBody(t)
+
+	type framedCase struct {
+		name      string
+		body      []byte
+		truncated string // the part the error has to say is short, if any
+		wantErr   bool
+	}
+	cases := []framedCase{
+		{name: "complete", body: body},
+		{name: "extra byte", body: append(body[:len(body):len(body)], 0), wantErr: true},
+		{name: "wrong magic", body: append([]byte("XXXX"), body[4:]...), wantErr: true},
+	}
+	// the cut ends right before the byte at offset cut, which is the part that's short
+	for cut := 0; cut < len(body); cut++ {
+		cases = append(cases, framedCase{
+			name:      fmt.Sprintf("cut to %d", cut),
+			body:      body[:cut],
+			truncated: section(body, cut),
+			wantErr:   true,
+		})
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// a recognisable value, so a decode that partly happened shows up
+			untouched := schemas.V2Reading{Header: "untouched", Sequence: 1<<64 - 1}
+			dest := untouched
+			_, err := ParseFramed(c.body, &dest)
+
+			switch {
+			case !c.wantErr:
+				if err != nil {
+					t.Fatalf("the complete frame doesn't decode: %v", err)
+				}
+				if dest.Sequence != 42 {
+					t.Errorf("decoded %+v", dest)
+				}
+				return
+			case err == nil:
+				t.Fatalf("%d of %d bytes decoded as %+v", len(c.body), len(body), dest)
+			case errors.Is(err, ErrTruncated) != (c.truncated != ""):
+				t.Fatalf("error says truncated: %t, want %t: %v", errors.Is(err, ErrTruncated), c.truncated != "", err)
+			case c.truncated != "" && !strings.Contains(err.Error(), "in the "+c.truncated):
+				t.Fatalf("error should say it was cut short in the %s: %v", c.truncated, err)
+			}
+			if !reflect.DeepEqual(dest, untouched) {
+				t.Errorf("the destination changed to %+v", dest)
+			}
+		})
+	}
+}
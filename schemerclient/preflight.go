@@ -0,0 +1,288 @@
+package schemerclient
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bminer/schemer"
+)
+
+// Severity is how much an Incompatibility matters to the reader
+type Severity int
+
+const (
+	// Info is a difference that loses nothing the reader has a field for, such
+	// as a field the writer sends and the reader doesn't have, which is skipped
+	Info Severity = iota
+	// Warning is data that decodes, but not as it was sent: numbers narrowed on
+	// the way in, or a reader field the writer doesn't send, which Decode leaves
+	// as it was
+	Warning
+	// Error is data that won't decode, or a required field the writer doesn't
+	// send
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Incompatibility is one difference between a writer schema and the schema a
+// reader expects
+type Incompatibility struct {
+	Severity Severity
+
+	// Field is the path of the field, such as "Readings" or "Cal.Scale", with []
+	// for the elements of a list; "" for the top-level value. Fields are named
+	// the way the reader names them in Go, or by their wire name for fields the
+	// reader doesn't have.
+	Field string
+
+	// the types on either side, "" for the side that doesn't have the field
+	Writer, Reader string
+
+	Reason string
+}
+
+func (inc Incompatibility) String() string {
+	field := inc.Field
+	if field == "" {
+		field = "(top level)"
+	}
+	types := inc.Writer + " -> " + inc.Reader
+	switch {
+	case inc.Reader == "":
+		types = inc.Writer + ", not in the reader"
+	case inc.Writer == "":
+		types = inc.Reader + ", not sent"
+	}
+	return fmt.Sprintf("%s: %s (%s): %s", inc.Severity, field, types, inc.Reason)
+}
+
+// Preflight compares the schema data is written with against the one the reader
+// expects (SchemaOf its own struct), before anything is decoded, and lists what
+// Decode would quietly do about the differences: skip a field, leave one as it
+// was, narrow a number, or fail. Fields are matched by their name on the wire,
+// without regard to case, the way Decode matches them. Reader fields named in
+// required (by path, like Field) are Errors when the writer doesn't send them;
+// other missing ones are Warnings. The list is in reader field order, with the
+// fields only the writer has after the reader's; it is empty when the schemas
+// agree.
+func Preflight(writer, reader schemer.Schema, required ...string) []Incompatibility {
+	p := preflight{required: map[string]bool{}}
+	for _, path := range required {
+		p.required[path] = true
+	}
+	p.compare(writer.GoType(), reader.GoType(), "", "")
+	return p.found
+}
+
+// Preflight compares the Client's schema, the server's, against the one dest's
+// type has, like the package-level Preflight. Call it before the first Fetch,
+// and again after the schema changes.
+func (c *Client) Preflight(dest interface{}, required ...string) []Incompatibility {
+	return Preflight(c.Schema(), schemer.SchemaOf(dest), required...)
+}
+
+type preflight struct {
+	required map[string]bool
+	found    []Incompatibility
+	mapped   []FieldMapping // the fields both sides have, but those of structs (their fields are mapped instead)
+}
+
+func (p *preflight) add(severity Severity, path string, w, r reflect.Type, reason string) {
+	p.found = append(p.found, Incompatibility{severity, path, describe(w), describe(r), reason})
+}
+
+// describe names t for an Incompatibility: structs and lists by their shape,
+// since the types GoType makes up have no names
+func describe(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + describe(t.Elem())
+	case reflect.Struct:
+		return "struct"
+	case reflect.Slice:
+		return "[]" + describe(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), describe(t.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", describe(t.Key()), describe(t.Elem()))
+	case reflect.Interface:
+		return "interface{}"
+	}
+	return t.Kind().String()
+}
+
+// wireName is the name a field goes by in the encoding
+func wireName(f reflect.StructField) string {
+	if tag := f.Tag.Get("schemer"); tag != "" {
+		return tag
+	}
+	return f.Name
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// indirect returns the type t points to, through any number of pointers
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// base returns the type of the values at the bottom of t: what its pointers point
+// to, and its lists and maps hold
+func base(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+func isList(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+}
+
+// compare adds the differences between w and r, at wpath in the writer's value
+// and path in the reader's
+func (p *preflight) compare(w, r reflect.Type, wpath, path string) {
+	if w == nil || r == nil {
+		p.add(Error, path, w, r, "the schema has no Go type to compare")
+		return
+	}
+	// nullable or not, the value is the same
+	w, r = indirect(w), indirect(r)
+
+	switch {
+	case r.Kind() == reflect.Interface:
+		// takes anything
+	case w.Kind() == reflect.Struct && r.Kind() == reflect.Struct:
+		p.compareFields(w, r, wpath, path)
+	case w.Kind() == reflect.Map && r.Kind() == reflect.Map:
+		p.compare(w.Key(), r.Key(), wpath+"[key]", path+"[key]")
+		p.compare(w.Elem(), r.Elem(), wpath+"[]", path+"[]")
+	case isList(w) && isList(r):
+		if r.Kind() == reflect.Array && (w.Kind() == reflect.Slice || w.Len() > r.Len()) {
+			p.add(Warning, path, w, r, fmt.Sprintf("only the first %d elements fit", r.Len()))
+		}
+		p.compare(w.Elem(), r.Elem(), wpath+"[]", path+"[]")
+	case isNumber(w) && isNumber(r):
+		if reason := narrowing(w, r); reason != "" {
+			p.add(Warning, path, w, r, reason)
+		}
+	case w.Kind() == r.Kind():
+		// strings, bools
+	default:
+		p.add(Error, path, w, r, "doesn't decode: nothing converts one into the other")
+	}
+}
+
+// compareFields matches the fields of w and r by wire name, and compares the
+// ones they share
+func (p *preflight) compareFields(w, r reflect.Type, wpath, path string) {
+	matched := make([]bool, w.NumField())
+	for i := 0; i < r.NumField(); i++ {
+		rf := r.Field(i)
+		if rf.PkgPath != "" {
+			continue
+		}
+		fieldPath := join(path, rf.Name)
+
+		found := -1
+		for j := 0; j < w.NumField(); j++ {
+			if !matched[j] && w.Field(j).PkgPath == "" && strings.EqualFold(wireName(w.Field(j)), wireName(rf)) {
+				found = j
+				break
+			}
+		}
+		if found < 0 {
+			if p.required[fieldPath] {
+				p.add(Error, fieldPath, nil, rf.Type, "required")
+			} else {
+				p.add(Warning, fieldPath, nil, rf.Type, "Decode leaves it as it was")
+			}
+			continue
+		}
+		matched[found] = true
+		wf := w.Field(found)
+		writerPath := join(wpath, wireName(wf))
+		if base(wf.Type).Kind() != reflect.Struct || base(rf.Type).Kind() != reflect.Struct {
+			p.mapped = append(p.mapped, FieldMapping{Writer: writerPath, Dest: fieldPath, WriterType: describe(wf.Type), DestType: describe(rf.Type)})
+		}
+		p.compare(wf.Type, rf.Type, writerPath, fieldPath)
+	}
+
+	for j := 0; j < w.NumField(); j++ {
+		if wf := w.Field(j); !matched[j] && wf.PkgPath == "" {
+			p.add(Info, join(wpath, wireName(wf)), wf.Type, nil, "skipped")
+		}
+	}
+}
+
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isFloat(t reflect.Type) bool {
+	return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+}
+
+func isUnsigned(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// narrowing says what can be lost converting numbers of type w into r, or ""
+// if nothing can
+func narrowing(w, r reflect.Type) string {
+	switch {
+	case isFloat(w) && !isFloat(r):
+		return "fractions don't fit in an integer"
+	case isFloat(w):
+		if r.Bits() < w.Bits() {
+			return "precision is lost"
+		}
+	case isFloat(r):
+		// a float64 holds integers up to 2^53 exactly, a float32 up to 2^24
+		if mantissa := map[int]int{32: 24, 64: 53}[r.Bits()]; w.Bits() > mantissa {
+			return "large integers lose precision"
+		}
+	case !isUnsigned(w) && isUnsigned(r):
+		return "negative values don't fit"
+	case r.Bits() < w.Bits() || isUnsigned(w) && !isUnsigned(r) && r.Bits() == w.Bits():
+		return "large values don't fit"
+	}
+	return ""
+}
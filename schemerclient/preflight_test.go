@@ -0,0 +1,121 @@
+package schemerclient
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+// a client that got the type of the readings wrong
+type stringReader struct {
+	Readings []string
+}
+
+// a server's sample, as it goes out
+var (
+	v1Sample = &schemas.V1Reading{Readings: []float32{20.5, 21.25}}
+	v2Sample = &schemas.V2Reading{Header: "boiler room", RawReadings: []float64{20.5, 21.3}, FilteredReadings: []float64{20.5, 21.25}, Sequence: 7}
+	v3Sample = &schemas.V3Reading{Header: "boiler room", RawReadings: []float64{68.9}, FilteredReadings: []float64{68.9}, Sequence: 7, Unit: "F"}
+)
+
+type pairing struct {
+	name     string
+	sent     interface{} // what the server sends
+	dest     func() interface{}
+	required []string
+	want     []string // severity and field of every incompatibility, in order
+}
+
+var pairings = []pairing{
+	{
+		name: "v1 client, v2 server",
+		sent: v2Sample,
+		dest: func() interface{} { return &schemas.V1Reading{} },
+		want: []string{"warning Readings[]", "info Header", "info RawReadings", "info Sequence", "info GeneratedAtUnixMs"},
+	},
+	{
+		name: "v1 client, v3 server",
+		sent: v3Sample,
+		dest: func() interface{} { return &schemas.V1Reading{} },
+		want: []string{"warning Readings[]", "info Header", "info RawReadings", "info Sequence", "info GeneratedAtUnixMs", "info Unit"},
+	},
+	{
+		name: "v2 client, v1 server",
+		sent: v1Sample,
+		dest: func() interface{} { return &schemas.V2Reading{} },
+		want: []string{"warning Header", "warning RawReadings", "warning Sequence", "warning GeneratedAtUnixMs"},
+	},
+	{
+		name:     "v2 client that requires a Sequence, v1 server",
+		sent:     v1Sample,
+		dest:     func() interface{} { return &schemas.V2Reading{} },
+		required: []string{"Sequence"},
+		want:     []string{"warning Header", "warning RawReadings", "error Sequence", "warning GeneratedAtUnixMs"},
+	},
+	{
+		name: "v2 client, v3 server",
+		sent: v3Sample,
+		dest: func() interface{} { return &schemas.V2Reading{} },
+		want: []string{"info Unit"},
+	},
+	{
+		name: "v2 client, v2 server",
+		sent: v2Sample,
+		dest: func() interface{} { return &schemas.V2Reading{} },
+	},
+	{
+		name: "client with string readings, v1 server",
+		sent: v1Sample,
+		dest: func() interface{} { return &stringReader{} },
+		want: []string{"error Readings[]"},
+	},
+}
+
+// sendSchema encodes sent, and returns its schema as a client gets it over the
+// wire along with the payload
+func sendSchema(t *testing.T, sent interface{}) (schemer.Schema, []byte) {
+	t.Helper()
+	writerSchema := schemer.SchemaOf(sent)
+	var encodedData bytes.Buffer
+	if err := writerSchema.Encode(&encodedData, sent); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	serverSchema, err := schemer.DecodeSchema(writerSchema.MarshalSchemer())
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+	return serverSchema, encodedData.Bytes()
+}
+
+// TestPreflight checks the list Preflight gives for each pairing, and that the
+// decode fails exactly when the list has an error about a type
+func TestPreflight(t *testing.T) {
+	for _, p := range pairings {
+		t.Run(p.name, func(t *testing.T) {
+			serverSchema, payload := sendSchema(t, p.sent)
+
+			dest := p.dest()
+			found := Preflight(serverSchema, schemer.SchemaOf(dest), p.required...)
+			var got []string
+			wontDecode := false
+			for _, inc := range found {
+				got = append(got, inc.Severity.String()+" "+inc.Field)
+				wontDecode = wontDecode || inc.Severity == Error && inc.Writer != ""
+			}
+			if !reflect.DeepEqual(got, p.want) {
+				t.Fatalf("preflight found %q, want %q", got, p.want)
+			}
+
+			err := serverSchema.Decode(bytes.NewReader(payload), dest)
+			switch {
+			case wontDecode && err == nil:
+				t.Errorf("preflight said the data won't decode, but it did, as %+v", dest)
+			case !wontDecode && err != nil:
+				t.Errorf("preflight saw no reason, but the decode failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package schemerclient
+
+import "reflect"
+
+// ResetForReuse gets the struct dest points to ready to be decoded into again.
+// Every field is zeroed, so nothing from the previous payload survives a decode
+// that doesn't set it (an older server may not send every field), except that
+// slice fields are only truncated to length zero and keep their backing arrays.
+// Whether that capacity actually saves allocations depends on whether schemer's
+// Decode reuses it; examples/reusedest measures it. dest must be a non-nil
+// pointer to a struct, anything else is left alone.
+func ResetForReuse(dest interface{}) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+		if f.Kind() == reflect.Slice && !f.IsNil() {
+			f.SetLen(0)
+			continue
+		}
+		f.Set(reflect.Zero(f.Type()))
+	}
+}
+
+// ResetValue sets whatever dest points to back to its zero value, slices and
+// all, so a decode into it starts from exactly what a fresh value would. Use it
+// instead of ResetForReuse when correctness matters more than the allocations
+// a reused slice might save. A nil or non-pointer dest is left alone.
+func ResetValue(dest interface{}) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	v.Elem().Set(reflect.Zero(v.Elem().Type()))
+}
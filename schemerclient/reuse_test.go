@@ -0,0 +1,219 @@
+package schemerclient
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/BenjaminPritchard/SchemerExamples/schemas"
+	"github.com/bminer/schemer"
+)
+
+func TestResetForReuse(t *testing.T) {
+	readings := []float64{1, 2, 3}
+	dest := schemas.V2Reading{Header: "old", RawReadings: readings, Sequence: 7}
+	ResetForReuse(&dest)
+
+	if dest.Header != "" || dest.Sequence != 0 || dest.FilteredReadings != nil {
+		t.Errorf("fields left over: %+v", dest)
+	}
+	if len(dest.RawReadings) != 0 || cap(dest.RawReadings) != cap(readings) {
+		t.Errorf("RawReadings has len %d and cap %d, want 0 and %d", len(dest.RawReadings), cap(dest.RawReadings), cap(readings))
+	}
+
+	// anything but a pointer to a struct is left alone
+	n := 5
+	ResetForReuse(&n)
+	ResetForReuse(dest)
+	ResetForReuse(nil)
+	if n != 5 {
+		t.Errorf("ResetForReuse changed an *int to %d", n)
+	}
+}
+
+func TestResetValue(t *testing.T) {
+	dest := schemas.V2Reading{Header: "old", RawReadings: []float64{1, 2, 3}, Sequence: 7}
+	ResetValue(&dest)
+	if !reflect.DeepEqual(dest, schemas.V2Reading{}) {
+		t.Errorf("got %+v, want the zero value", dest)
+	}
+
+	n := 5
+	ResetValue(&n)
+	if n != 0 {
+		t.Errorf("ResetValue left an *int at %d", n)
+	}
+	ResetValue(dest)
+	ResetValue(nil)
+}
+
+// TestShrinkingDecode decodes a short payload into the destination a long one
+// was just decoded into, with nothing done in between and after each reset. The
+// long payload has 10 readings, a header and a sequence number; the short one 3
+// filtered readings, no raw readings (a nil slice) and an empty header. Every
+// time, the result has to be exactly the short payload: nothing may leak
+// through len() from the long one.
+func TestShrinkingDecode(t *testing.T) {
+	readings := sim.New(sim.DefaultConfig, 1).Next(10)
+	long := schemas.V2Reading{
+		Header:           "the long payload",
+		RawReadings:      readings,
+		FilteredReadings: readings,
+		Sequence:         1,
+	}
+	short := schemas.V2Reading{
+		FilteredReadings: []float64{-1, -2, -3},
+		Sequence:         2,
+	}
+	var longPayload, shortPayload bytes.Buffer
+	for _, p := range []struct {
+		v   *schemas.V2Reading
+		buf *bytes.Buffer
+	}{{&long, &longPayload}, {&short, &shortPayload}} {
+		if err := schemas.V2WriterSchema().Encode(p.buf, p.v); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+	}
+
+	schema, err := schemer.DecodeSchema(schemas.V2WriterSchema().MarshalSchemer())
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+
+	for _, mode := range []struct {
+		name  string
+		reset func(dest interface{})
+	}{
+		{"reused", func(interface{}) {}},
+		{"ResetForReuse", ResetForReuse},
+		{"ResetValue", ResetValue},
+	} {
+		t.Run(mode.name, func(t *testing.T) {
+			var dest schemas.V2Reading
+			if err := schema.Decode(bytes.NewReader(longPayload.Bytes()), &dest); err != nil {
+				t.Fatalf("decoding the long payload: %v", err)
+			}
+			afterLong := dest.FilteredReadings
+
+			mode.reset(&dest)
+			if err := schema.Decode(bytes.NewReader(shortPayload.Bytes()), &dest); err != nil {
+				t.Fatalf("decoding the short payload: %v", err)
+			}
+
+			if !reflect.DeepEqual(dest.FilteredReadings, short.FilteredReadings) {
+				t.Errorf("FilteredReadings is %v, want %v", dest.FilteredReadings, short.FilteredReadings)
+			}
+			if len(dest.RawReadings) != 0 {
+				t.Errorf("the short payload has no raw readings, but %d are left from the long one", len(dest.RawReadings))
+			}
+			if dest.Header != "" {
+				t.Errorf("the short payload's header is empty, but %q is left from the long one", dest.Header)
+			}
+			if dest.Sequence != short.Sequence {
+				t.Errorf("Sequence is %d, want %d", dest.Sequence, short.Sequence)
+			}
+
+			// code that reslices past len (s[:cap(s)]) would still see the old
+			// values if the short readings went into the long payload's array
+			if len(afterLong) > 0 && cap(dest.FilteredReadings) > 0 && &dest.FilteredReadings[:1][0] == &afterLong[:1][0] {
+				t.Logf("decoded into the old backing array; past len: %v", dest.FilteredReadings[len(dest.FilteredReadings):cap(dest.FilteredReadings)])
+			}
+		})
+	}
+}
+
+// v3Client is what a client built against a newer server declares:
+// schemas.V3Reading plus a flag a later server might add
+type v3Client struct {
+	Header            string
+	RawReadings       []float64
+	FilteredReadings  []float64 `schemer:"readings"`
+	Sequence          uint64
+	GeneratedAtUnixMs int64
+	Unit              string
+	AlertActive       bool // not sent by any server in this repo yet
+}
+
+// TestNewerReader decodes what the v1 server sends, nothing but its float32
+// Readings, into a v3Client. The v1 readings have to land in FilteredReadings
+// (by its `schemer:"readings"` tag), widened to float64, and no error may say
+// the other fields were missing. The test expects Decode to write only the
+// fields the writer sent, so the others keep whatever the destination held:
+// zero values, a client's defaults, or, for a destination reused from a v3
+// sample, that sample's values, making the v1 data look like a v3 reading with
+// an active alert. ResetForReuse before the decode avoids that. Those
+// expectations were written against a local stand-in for schemer, not the
+// release go.mod pins; until the test has passed against that release, treat
+// them as unverified.
+func TestNewerReader(t *testing.T) {
+	v1Payload := encode(t, &schemas.V1Reading{Readings: []float32{20.5, 21.25}})
+	v1Schema, err := schemer.DecodeSchema(schemer.SchemaOf(&schemas.V1Reading{}).MarshalSchemer())
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+	v3Sample := schemas.V3Reading{
+		Header:           "a v3 sample",
+		RawReadings:      []float64{70, 71, 72, 73, 74},
+		FilteredReadings: []float64{70, 70.5, 71.25, 72.1, 73.05},
+		Sequence:         99,
+		Unit:             "F",
+	}
+	v3Payload := encode(t, &v3Sample)
+	v3Schema, err := schemer.DecodeSchema(schemer.SchemaOf(&v3Sample).MarshalSchemer())
+	if err != nil {
+		t.Fatalf("cannot decode schema: %v", err)
+	}
+	wantReadings := []float64{20.5, 21.25}
+
+	// what the previous decode left behind, for the reused and reset cases
+	previous := func(t *testing.T) *v3Client {
+		dest := &v3Client{}
+		if err := v3Schema.Decode(bytes.NewReader(v3Payload), dest); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		dest.AlertActive = true // as a newer server would have set it
+		return dest
+	}
+
+	for _, c := range []struct {
+		name string
+		dest func(t *testing.T) *v3Client
+		want v3Client // everything but FilteredReadings
+	}{
+		{"fresh", func(*testing.T) *v3Client { return &v3Client{} }, v3Client{}},
+		{"defaults", func(*testing.T) *v3Client { return &v3Client{Unit: "C"} }, v3Client{Unit: "C"}},
+		{"reused", previous, v3Client{
+			Header:      "a v3 sample",
+			RawReadings: []float64{70, 71, 72, 73, 74},
+			Sequence:    99,
+			Unit:        "F",
+			AlertActive: true,
+		}},
+		{"reset", func(t *testing.T) *v3Client {
+			dest := previous(t)
+			ResetForReuse(dest)
+			return dest
+		}, v3Client{}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dest := c.dest(t)
+			if err := v1Schema.Decode(bytes.NewReader(v1Payload), dest); err != nil {
+				t.Fatalf("decoding v1 data into a newer struct failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(dest.FilteredReadings, wantReadings) {
+				t.Errorf("FilteredReadings is %v, want the v1 readings %v", dest.FilteredReadings, wantReadings)
+			}
+			got := *dest
+			got.FilteredReadings = nil
+			// ResetForReuse keeps slices, only empty: compare lengths, not nil-ness
+			if len(got.RawReadings) == 0 && len(c.want.RawReadings) == 0 {
+				got.RawReadings = nil
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("the fields v1 doesn't send hold\n  %+v\nwant\n  %+v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package schemerclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bminer/schemer"
+)
+
+// WithSchemaFile makes the Client keep its schema in the file at path, in the
+// binary MarshalSchemer form. New loads the schema from the file instead of
+// fetching it, if the file exists and holds a valid schema, so a client that
+// restarts often doesn't pay for /get-schema/ every time; otherwise New fetches
+// the schema as usual. Every schema the Client fetches afterwards, by
+// RefreshSchema or because data didn't decode with the one from the file, is
+// saved back to path.
+//
+// A stale schema is only noticed when data stops decoding with it. Call
+// RefreshSchema right after New to check with the server anyway.
+func WithSchemaFile(path string) Option {
+	return func(c *Client) { c.schemaFile = path }
+}
+
+// loadSchemaFile replaces the cached schema with the one in c.schemaFile
+func (c *Client) loadSchemaFile() error {
+	b, err := ioutil.ReadFile(c.schemaFile)
+	if err != nil {
+		return err
+	}
+	schema, err := schemer.DecodeSchema(b)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(b)
+	c.mu.Lock()
+	c.schema = schema
+	c.schemaHash = hex.EncodeToString(sum[:])
+	c.mu.Unlock()
+	return nil
+}
+
+// saveSchemaFile writes binarySchema to c.schemaFile. It writes a temporary file and
+// renames it into place, so a client killed halfway through never leaves a
+// truncated schema behind for the next run.
+func (c *Client) saveSchemaFile(binarySchema []byte) error {
+	dir, base := filepath.Split(c.schemaFile)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, base+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // fails harmlessly once renamed
+
+	if _, err := f.Write(binarySchema); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.schemaFile)
+}
@@ -0,0 +1,96 @@
+package schemerclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/testserver"
+	"github.com/bminer/schemer"
+)
+
+// staleReading stands in for a schema saved from an older server, whose Header
+// was a list of numbers: nothing converts those into the string reading has, so
+// data doesn't decode with it
+type staleReading struct {
+	Header []float64
+}
+
+// TestSchemaFile runs a client against the same server over and over, the way
+// a client that restarts often would, with the schema file missing, current,
+// stale and corrupt. The subtests run in order, sharing the file.
+func TestSchemaFile(t *testing.T) {
+	u := testserver.New(t, sample)
+	binarySchema := schemer.SchemaOf(sample).MarshalSchemer()
+	dir := t.TempDir()
+	schemaFile := filepath.Join(dir, "schema.bin")
+
+	// expectRequests is one run of the client: New, then one Fetch. It checks the
+	// client asked for the schema want times, and left the server's schema in the
+	// file.
+	expectRequests := func(t *testing.T, refresh bool, want int) {
+		t.Helper()
+		before, _ := u.Requests()
+		c, err := New(u.URL, WithSchemaFile(schemaFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if refresh {
+			if err := c.RefreshSchema(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var dest reading
+		if err := c.Fetch(context.Background(), &dest); err != nil {
+			t.Fatal(err)
+		}
+		if dest.Header != sample.Header {
+			t.Fatalf("decoded %+v", dest)
+		}
+		if after, _ := u.Requests(); after-before != want {
+			t.Errorf("%d schema requests, want %d", after-before, want)
+		}
+
+		b, err := ioutil.ReadFile(schemaFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, binarySchema) {
+			t.Errorf("%s holds %d bytes that aren't the server's schema", schemaFile, len(b))
+		}
+	}
+	write := func(t *testing.T, b []byte) {
+		if err := ioutil.WriteFile(schemaFile, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("first run fetches and saves the schema", func(t *testing.T) {
+		expectRequests(t, false, 1)
+	})
+	t.Run("second run loads it instead", func(t *testing.T) {
+		expectRequests(t, false, 0)
+	})
+	t.Run("RefreshSchema fetches it anyway", func(t *testing.T) {
+		expectRequests(t, true, 1)
+	})
+	t.Run("a stale schema is refetched when data doesn't decode", func(t *testing.T) {
+		write(t, schemer.SchemaOf(&staleReading{}).MarshalSchemer())
+		expectRequests(t, false, 1)
+	})
+	t.Run("a corrupt file is fetched over", func(t *testing.T) {
+		write(t, []byte("not a schema"))
+		expectRequests(t, false, 1)
+	})
+	t.Run("no temporary files are left behind", func(t *testing.T) {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("%d files in %s, want just the schema", len(entries), dir)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package schemerclient
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/bminer/schemer"
+)
+
+// size of the buffer DecodeStream reads the response through
+const streamBufferSize = 64 * 1024
+
+// ErrTruncated is returned when a response ends (cleanly or not) before the
+// payload in it does, e.g. because the server closed the connection mid-stream
+// or sent less than its Content-Length promised
+var ErrTruncated = errors.New("schemerclient: response ended before the payload did")
+
+// errStreamSigning is returned by FetchStream for a Client created
+// WithSigningKey: the signature covers the whole payload, so it could only be
+// checked after the data had already been decoded into dest
+var errStreamSigning = errors.New("schemerclient: signed data can't be streamed, since it has to be verified before decoding; use Fetch")
+
+// countingReader counts the bytes read through it and keeps the first error
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	if err != nil && cr.err == nil {
+		cr.err = err
+	}
+	return n, err
+}
+
+// DecodeStream decodes the one payload in body into dest as it arrives, through
+// a bufio.Reader, instead of reading the whole body into memory first. It is
+// meant for http.Response.Body, with contentLength set to the response's
+// ContentLength (-1 if unknown, or if the body was decompressed).
+//
+// A body that ends before the payload does is an error wrapping ErrTruncated; so
+// is one that breaks off, as net/http reports a server closing the connection
+// mid-stream or sending less than its Content-Length. A body with bytes left
+// after the payload is an error too. On any error dest may be partly filled.
+func DecodeStream(schema schemer.Schema, body io.Reader, contentLength int64, dest interface{}) error {
+	cr := &countingReader{r: body}
+	br := bufio.NewReaderSize(cr, streamBufferSize)
+
+	if err := schema.Decode(br, dest); err != nil {
+		switch {
+		case errors.Is(cr.err, io.ErrUnexpectedEOF),
+			cr.err == io.EOF && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)):
+			return fmt.Errorf("%w after %d bytes: %v", ErrTruncated, cr.n, err)
+		case cr.err != nil && cr.err != io.EOF:
+			return fmt.Errorf("reading response: %w", cr.err)
+		default:
+			return fmt.Errorf("cannot decode data: %w", err)
+		}
+	}
+
+	// the payload is complete; make sure that was the whole body, and that the
+	// body was whole
+	extra, err := io.Copy(ioutil.Discard, br)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w after %d bytes", ErrTruncated, cr.n)
+	}
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	if extra > 0 {
+		return fmt.Errorf("schemerclient: %d unexpected bytes after the payload", extra)
+	}
+	if contentLength >= 0 && cr.n != contentLength {
+		return fmt.Errorf("%w: got %d of the %d bytes in Content-Length", ErrTruncated, cr.n, contentLength)
+	}
+	return nil
+}
+
+// FetchStream is like Fetch, but decodes the data as it arrives instead of
+// reading the whole response first, so a large payload is never in memory twice.
+// Only a failure before any data arrived (a network error or a 5xx) is retried;
+// if the data doesn't decode with the cached schema, the schema is refreshed and
+// the data fetched once more, and if that fails too the error is a *DecodeError.
+// It can't be used on a Client created WithSigningKey.
+func (c *Client) FetchStream(ctx context.Context, dest interface{}) error {
+	if c.signingKey != nil {
+		return errStreamSigning
+	}
+
+	err := c.streamWithRetries(ctx, dest)
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		return err
+	}
+
+	if err := c.RefreshSchema(ctx); err != nil {
+		return err
+	}
+	return c.streamWithRetries(ctx, dest)
+}
+
+// streamWithRetries calls streamOnce, retrying as configured by WithRetries as
+// long as nothing has been decoded into dest yet
+func (c *Client) streamWithRetries(ctx context.Context, dest interface{}) error {
+	delay := c.retryDelay
+
+	for attempt := 0; ; attempt++ {
+		started, err := c.streamOnce(ctx, dest)
+		if err == nil || started || attempt >= c.retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// streamOnce makes a single request for the data and decodes it into dest as
+// it arrives. started reports whether decoding had begun.
+func (c *Client) streamOnce(ctx context.Context, dest interface{}) (started bool, err error) {
+	c.mu.Lock()
+	c.dataRequests++
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	url := c.baseURL + DataPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, &statusError{url: url, code: resp.StatusCode}
+	}
+
+	var body io.Reader = resp.Body
+	contentLength := resp.ContentLength
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return false, err
+		}
+		defer gz.Close()
+		body = gz
+		contentLength = -1
+	}
+
+	err = DecodeStream(c.Schema(), body, contentLength, dest)
+	if err != nil && !errors.Is(err, ErrTruncated) && ctx.Err() == nil {
+		err = newDecodeError(url, c.SchemaHash(), c.Schema(), nil, err)
+	}
+	return true, err
+}
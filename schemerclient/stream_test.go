@@ -0,0 +1,298 @@
+package schemerclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/BenjaminPritchard/SchemerExamples/internal/sim"
+	"github.com/bminer/schemer"
+)
+
+// readings returns a reading with n simulated values
+func readings(n int) *reading {
+	return &reading{Header: "stream", Readings: sim.New(sim.DefaultConfig, 1).Next(n)}
+}
+
+// serveReadings serves reading's schema, and answers data requests with data
+func serveReadings(t testing.TB, data http.HandlerFunc) *httptest.Server {
+	binarySchema := schemer.SchemaOf(&reading{}).MarshalSchemer()
+	mux := http.NewServeMux()
+	mux.HandleFunc(SchemaPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(binarySchema)
+	})
+	mux.HandleFunc(DataPath, data)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func newClient(t testing.TB, url string, opts ...Option) *Client {
+	t.Helper()
+	client, err := New(url, append([]Option{WithTimeout(time.Minute)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// halfwayTransport closes reached once half bytes of a data response's body have
+// been read
+type halfwayTransport struct {
+	http.RoundTripper
+	half    int64
+	reached chan struct{}
+}
+
+func (t *halfwayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err == nil && req.URL.Path == DataPath {
+		resp.Body = &halfwayBody{ReadCloser: resp.Body, t: t}
+	}
+	return resp, err
+}
+
+type halfwayBody struct {
+	io.ReadCloser
+	t    *halfwayTransport
+	read int64
+	done bool
+}
+
+func (b *halfwayBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if !b.done && b.read >= b.t.half {
+		close(b.t.reached)
+		b.done = true
+	}
+	return n, err
+}
+
+// TestFetchStreamDribble sends the payload 512 bytes at a time with pauses, and
+// after half of it waits until the client has read everything sent so far. The
+// decode has to cope with short reads, and work on a body that is still
+// arriving: a client that read the whole body before decoding would never get
+// the second half.
+func TestFetchStreamDribble(t *testing.T) {
+	sent := readings(20000)
+	payload := encode(t, sent)
+	half := len(payload) / 2
+
+	consumed := make(chan struct{})
+	ts := serveReadings(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		flusher := w.(http.Flusher)
+		waiting := true
+		for off := 0; off < len(payload); off += 512 {
+			if off >= half && waiting {
+				select {
+				case <-consumed:
+				case <-time.After(10 * time.Second):
+					// the client isn't reading what it has been sent
+					panic(http.ErrAbortHandler)
+				}
+				waiting = false
+			}
+			end := off + 512
+			if end > len(payload) {
+				end = len(payload)
+			}
+			w.Write(payload[off:end])
+			flusher.Flush()
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	hc := &http.Client{Transport: &halfwayTransport{RoundTripper: transport, half: int64(half), reached: consumed}}
+	client := newClient(t, ts.URL, WithHTTPClient(hc))
+
+	var received reading
+	if err := client.FetchStream(context.Background(), &received); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&received, sent) {
+		t.Error("decoded data differs from what was sent")
+	}
+}
+
+// TestFetchStreamErrors checks a response that ends or breaks off before the
+// payload does is ErrTruncated, and one with bytes after the payload is an error
+// but not ErrTruncated
+func TestFetchStreamErrors(t *testing.T) {
+	payload := encode(t, readings(1000))
+	half := payload[:len(payload)/2]
+
+	for _, c := range []struct {
+		name      string
+		data      http.HandlerFunc
+		truncated bool
+	}{
+		{"truncated", func(w http.ResponseWriter, req *http.Request) {
+			// no Content-Length, so ending here looks like a clean end of the body
+			w.Write(half)
+		}, true},
+		{"short", func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+			w.Write(half)
+		}, true},
+		{"aborted", func(w http.ResponseWriter, req *http.Request) {
+			w.Write(half)
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}, true},
+		{"trailing", func(w http.ResponseWriter, req *http.Request) {
+			w.Write(payload)
+			w.Write([]byte("trailing junk"))
+		}, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			client := newClient(t, serveReadings(t, c.data).URL)
+			var dest reading
+			err := client.FetchStream(context.Background(), &dest)
+			switch {
+			case err == nil:
+				t.Fatalf("no error; decoded %d readings", len(dest.Readings))
+			case errors.Is(err, ErrTruncated) != c.truncated:
+				t.Errorf("error says truncated: %t, want %t: %v", errors.Is(err, ErrTruncated), c.truncated, err)
+			}
+		})
+	}
+}
+
+// encodedHandlers returns a data handler that encodes v into a bytes.Buffer
+// before writing it, the way the example servers do, and one that encodes it
+// straight into the response
+func encodedHandlers(v interface{}) (buffered, streamed http.HandlerFunc) {
+	schema := schemer.SchemaOf(v)
+	buffered = func(w http.ResponseWriter, req *http.Request) {
+		var encodedData bytes.Buffer
+		if err := schema.Encode(&encodedData, v); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(encodedData.Bytes())
+	}
+	streamed = func(w http.ResponseWriter, req *http.Request) {
+		// once encoding has started the status is already sent, so an error can
+		// only cut the response short, which the client reports as ErrTruncated
+		schema.Encode(w, v)
+	}
+	return buffered, streamed
+}
+
+// fetchBuffered fetches the data the way the example clients do: the whole
+// body, then Decode
+func fetchBuffered(client *Client, url string, dest interface{}) error {
+	resp, err := http.Get(url + DataPath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return client.Schema().Decode(bytes.NewReader(b), dest)
+}
+
+// allocated returns how many bytes f allocated, server and client together
+func allocated(t *testing.T, f func() error) uint64 {
+	t.Helper()
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if err := f(); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// TestFetchStreamMemory sends one million readings buffered, and then encoded
+// straight into the response and decoded straight from resp.Body. Both ways
+// allocate the decoded readings; buffering also holds the encoded payload in
+// memory on each side, so streaming has to save at least one copy of it.
+func TestFetchStreamMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("sends megabytes of readings")
+	}
+	sent := readings(1000000)
+	size := uint64(len(encode(t, sent)))
+	buffered, streamed := encodedHandlers(sent)
+	bufferedURL := serveReadings(t, buffered).URL
+	streamedURL := serveReadings(t, streamed).URL
+	client := newClient(t, streamedURL)
+	if err := client.RefreshSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var received reading
+	bufferedAlloc := allocated(t, func() error {
+		return fetchBuffered(client, bufferedURL, &received)
+	})
+	received = reading{}
+	streamedAlloc := allocated(t, func() error {
+		return client.FetchStream(context.Background(), &received)
+	})
+	if !reflect.DeepEqual(&received, sent) {
+		t.Fatal("decoded data differs from what was sent")
+	}
+
+	t.Logf("%d byte payload: buffered allocated %d bytes, streamed %d", size, bufferedAlloc, streamedAlloc)
+	if streamedAlloc+size > bufferedAlloc {
+		t.Errorf("streaming saved %d bytes, want at least the %d byte payload", int64(bufferedAlloc)-int64(streamedAlloc), size)
+	}
+}
+
+// benchmarkFetch fetches a megabyte of readings with fetch, reporting the
+// allocations of the server and the client together
+func benchmarkFetch(b *testing.B, fetch func(client *Client, url string, dest *reading) error, streamedServer bool) {
+	sent := readings(1 << 17)
+	var encodedData bytes.Buffer
+	if err := schemer.SchemaOf(sent).Encode(&encodedData, sent); err != nil {
+		b.Fatal(err)
+	}
+	buffered, streamed := encodedHandlers(sent)
+	handler := buffered
+	if streamedServer {
+		handler = streamed
+	}
+	ts := serveReadings(b, handler)
+	client := newClient(b, ts.URL)
+	if err := client.RefreshSchema(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(encodedData.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var received reading
+		if err := fetch(client, ts.URL, &received); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFetchBuffered(b *testing.B) {
+	benchmarkFetch(b, func(client *Client, url string, dest *reading) error {
+		return fetchBuffered(client, url, dest)
+	}, false)
+}
+
+func BenchmarkFetchStream(b *testing.B) {
+	benchmarkFetch(b, func(client *Client, url string, dest *reading) error {
+		return client.FetchStream(context.Background(), dest)
+	}, true)
+}
@@ -0,0 +1,89 @@
+package schemerclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bminer/schemer"
+)
+
+// serveValue serves v's schema and data the way the example servers serve their
+// structs
+func serveValue(t *testing.T, v interface{}) *httptest.Server {
+	binarySchema := schemer.SchemaOf(v).MarshalSchemer()
+	data := encode(t, v)
+	mux := http.NewServeMux()
+	mux.HandleFunc(SchemaPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(binarySchema)
+	})
+	mux.HandleFunc(DataPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(data)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// fetchRecovered fetches from url into dest, failing the test if that panics
+func fetchRecovered(t *testing.T, url string, dest interface{}) error {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("fetching panicked instead of failing: %v", r)
+		}
+	}()
+	client, err := New(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.Fetch(context.Background(), dest)
+}
+
+// TestTopLevel checks the value at the top of a payload can be a bare slice, a
+// map or a single scalar, not only a struct. Empty and nil slices both have to
+// decode to no readings; whether the nil one comes back nil or empty is logged,
+// since the wire format may not tell them apart.
+func TestTopLevel(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		sent interface{}
+		dest interface{} // a pointer to a zero value of the sent type
+	}{
+		{"slice", []float64{20.5, 21.25}, new([]float64)},
+		{"empty slice", []float64{}, new([]float64)},
+		{"nil slice", []float64(nil), new([]float64)},
+		{"map", map[string]int64{"lab": 3, "hall": 1}, new(map[string]int64)},
+		{"string", "a string and nothing else", new(string)},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if err := fetchRecovered(t, serveValue(t, c.sent).URL, c.dest); err != nil {
+				t.Fatal(err)
+			}
+
+			got := reflect.ValueOf(c.dest).Elem()
+			if want := reflect.ValueOf(c.sent); want.Kind() == reflect.Slice && want.Len() == 0 {
+				if got.Len() != 0 {
+					t.Errorf("sent no readings, got %v", got.Interface())
+				}
+				t.Logf("decoded as a nil slice: %t", got.IsNil())
+				return
+			}
+			if !reflect.DeepEqual(got.Interface(), c.sent) {
+				t.Errorf("sent %#v, got %#v", c.sent, got.Interface())
+			}
+		})
+	}
+}
+
+// TestTopLevelIntoStruct checks a top-level slice can't become a struct,
+// whatever its fields are called: decoding has to fail with an error, not panic
+// or quietly leave the struct empty
+func TestTopLevelIntoStruct(t *testing.T) {
+	var wrong struct{ Readings []float64 }
+	if err := fetchRecovered(t, serveValue(t, []float64{20.5, 21.25}).URL, &wrong); err == nil {
+		t.Errorf("decoding a top-level slice into a struct succeeded, leaving %+v", wrong)
+	}
+}